@@ -10,19 +10,32 @@ import (
 	"github.com/zackb/updog/domain"
 	"github.com/zackb/updog/httpx"
 	"github.com/zackb/updog/httpx/middleware"
+	"github.com/zackb/updog/lockout"
+	"github.com/zackb/updog/mail"
 	"github.com/zackb/updog/pageview"
+	"github.com/zackb/updog/session"
+	"github.com/zackb/updog/share"
+	"github.com/zackb/updog/team"
 	"github.com/zackb/updog/user"
 )
 
 type API struct {
-	db   *db.DB
-	auth *auth.Service
+	db       *db.DB
+	auth     *auth.Service
+	sessions *session.Manager
+	sender   mail.Sender
+	emails   *user.Emails
+	guard    *lockout.Guard
 }
 
-func NewAPI(db *db.DB, auth *auth.Service) *API {
+func NewAPI(db *db.DB, auth *auth.Service, sessions *session.Manager, sender mail.Sender) *API {
 	return &API{
-		db:   db,
-		auth: auth,
+		db:       db,
+		auth:     auth,
+		sessions: sessions,
+		sender:   sender,
+		emails:   user.NewEmails(db.UserStorage(), auth, sender),
+		guard:    lockout.NewGuard(db.LockoutStorage(), db.AuditStorage()),
 	}
 }
 func (a *API) Routes() http.Handler {
@@ -31,20 +44,32 @@ func (a *API) Routes() http.Handler {
 	r.Use(middleware.LoggerMiddleware, middleware.JsonContentTypeMiddleware, middleware.CorsMiddleware)
 
 	r.Get("/api/v1/healthz", healthCheckHandler)
+	r.Get("/.well-known/jwks.json", a.handleJWKS)
 
 	r.Route("/api/v1", func(api chi.Router) {
 		us := a.db.UserStorage()
 		ds := a.db.DomainStorage()
 		ps := a.db.PageviewStorage()
-		api.Mount("/pageviews", pageview.NewHandler(ps, ds, a.auth).Routes())
-		api.Mount("/domains", domain.NewHandler(ds, a.auth).Routes())
-		api.Mount("/users", user.NewHandler(us, a.auth).Routes())
+		as := a.db.AuditStorage()
+		ts := a.db.TeamStorage()
+		api.Mount("/pageviews", pageview.NewHandler(ps, ds, as, a.auth).Routes())
+		api.Mount("/domains", domain.NewHandler(ds, ts, as, a.auth).Routes())
+		api.Mount("/users", user.NewHandler(us, as, a.auth, a.sessions, a.emails).Routes())
+		api.Mount("/teams", team.NewHandler(ts, us, as, a.auth, a.sender).Routes())
+		api.Mount("/share", share.NewHandler(a.db.ShareStorage(), ps, ds).Routes())
+		api.With(middleware.AuthMiddleware(a.auth), middleware.RequireScope(auth.ScopeAccount)).Get("/audit", a.handleListAudit)
 
 		// auth
 		api.Post("/auth/login", a.handleLogin)
+		api.Post("/auth/login/2fa", a.handleLoginTwoFactor)
 		api.Post("/auth/logout", a.handleLogout)
+		api.Post("/auth/refresh", a.handleRefresh)
 		api.Post("/auth/register", a.handleRegister)
 		api.Post("/auth/verify", a.handleVerify)
+		api.Post("/auth/password/forgot", a.handleForgotPassword)
+		api.Post("/auth/password/reset", a.handleResetPassword)
+		api.Post("/auth/email/verify", a.handleVerifyEmail)
+		api.Post("/auth/email/resend", a.handleResendVerification)
 	})
 	return r
 }
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/httpx"
+)
+
+// handleListAudit returns audit entries newest first for admins, as JSON or with format=csv as a download
+func (a *API) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	u, err := a.db.UserStorage().ReadUser(r.Context(), httpx.UserIDFromRequest(r))
+	if err != nil || u.Disabled || !u.IsAdmin() {
+		httpx.JSONError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	q := r.URL.Query()
+	filter, err := audit.FilterFromQuery(q)
+	if err != nil {
+		httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		httpx.JSONError(w, "unsupported format: "+format, http.StatusBadRequest)
+		return
+	}
+
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries, err := a.db.AuditStorage().ListAuditEntries(r.Context(), filter, limit, offset)
+	if err != nil {
+		log.Printf("Failed to list audit entries: %v", err)
+		httpx.JSONError(w, "Failed to list audit entries", http.StatusInternalServerError)
+		return
+	}
+
+	if format == "csv" {
+		filename := fmt.Sprintf("audit-%s.csv", time.Now().UTC().Format("20060102"))
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		cw := csv.NewWriter(w)
+		if err := cw.Write(audit.Entry{}.CSVHeader()); err != nil {
+			log.Println("Error exporting audit entries:", err)
+			return
+		}
+		for _, e := range entries {
+			if err := cw.Write(e.CSVRecord()); err != nil {
+				log.Println("Error exporting audit entries:", err)
+				return
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			log.Println("Error exporting audit entries:", err)
+		}
+		return
+	}
+
+	if entries == nil {
+		entries = []*audit.Entry{}
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(entries))
+}
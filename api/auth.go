@@ -2,12 +2,22 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/auth"
 	"github.com/zackb/updog/env"
 	"github.com/zackb/updog/httpx"
 	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/lockout"
+	"github.com/zackb/updog/session"
+	"github.com/zackb/updog/settings"
 	"github.com/zackb/updog/user"
 )
 
@@ -17,55 +27,226 @@ func (a *API) handleLogin(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 
+	if passwordLoginDisabled(w) {
+		return
+	}
+
 	err := json.NewDecoder(r.Body).Decode(&creds)
 	if httpx.CheckError(w, err) {
 		return
 	}
 
-	// find user by email
-	user, err := a.db.UserStorage().ReadUserByEmail(r.Context(), creds.Email)
+	// locked out emails and addresses aren't checked, whether or not an account has the email
+	keys := lockout.LoginKeys(r, creds.Email)
+	if wait := a.guard.Wait(r.Context(), keys...); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	// find user by email and validate password, which takes as long without an account
+	u, err := a.db.UserStorage().ReadUserByEmail(r.Context(), creds.Email)
 	if err != nil {
+		u = nil
+	}
+	if !user.CheckLogin(u, creds.Password) || u.Disabled {
+		var userID string
+		if u != nil {
+			userID = u.ID
+		}
+		a.guard.Fail(r, userID, keys...)
+		audit.Record(r.Context(), a.db.AuditStorage(), audit.NewEntry(r, userID, audit.ActionLoginFailed, audit.TargetUser, userID, map[string]any{
+			"email":  creds.Email,
+			"method": audit.LoginPassword,
+		}))
 		httpx.InvalidCredentials(w)
 		return
 	}
+	a.guard.Succeed(r.Context(), lockout.EmailKey(creds.Email))
+
+	// the second step exchanges the challenge and a code for a session
+	if u.TOTPEnabled {
+		challenge, _, err := a.auth.CreateChallenge(u.ID, auth.PurposeTwoFactor, audit.LoginPassword, auth.ChallengeTTL)
+		if err != nil {
+			log.Printf("Failed to create challenge: %v", err)
+			httpx.InvalidCredentials(w)
+			return
+		}
+		data := map[string]any{"two_factor_required": true, "challenge": challenge}
+		err = json.NewEncoder(w).Encode(data)
+		httpx.CheckError(w, err)
+		return
+	}
+	if a.twoFactorMissing(w, r, u) {
+		return
+	}
 
-	// validate password
-	if user.EncryptedPassword == "" || !user.Validate(creds.Password) {
+	// user is validated, start a session
+	tokens, err := a.sessions.Start(r.Context(), u.ID, r)
+	if err != nil {
+		log.Printf("Failed to start session: %v", err)
 		httpx.InvalidCredentials(w)
 		return
 	}
 
-	// user is validated, create a token
-	token, _, err := a.auth.CreateToken(user.ID)
+	audit.Record(r.Context(), a.db.AuditStorage(), audit.NewEntry(r, u.ID, audit.ActionLogin, audit.TargetUser, u.ID, map[string]any{
+		"method": audit.LoginPassword,
+	}))
+	writeSession(w, tokens, u)
+}
+
+// handleLoginTwoFactor completes logging in with the challenge from handleLogin and an
+// authenticator or recovery code
+func (a *API) handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var body struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := a.auth.ValidateChallenge(ctx, body.Challenge, auth.PurposeTwoFactor)
 	if err != nil {
+		httpx.JSONError(w, "Invalid or expired challenge, log in again", http.StatusUnauthorized)
+		return
+	}
+	u, err := a.db.UserStorage().ReadUser(ctx, challenge.ClientId)
+	if err != nil || u.Disabled {
 		httpx.InvalidCredentials(w)
 		return
 	}
+	keys := lockout.TwoFactorKeys(r, u.ID)
+	if wait := a.guard.Wait(ctx, keys...); wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+	if !u.CheckSecondFactor(body.Code, time.Now()) {
+		a.guard.Fail(r, u.ID, keys...)
+		audit.Record(ctx, a.db.AuditStorage(), audit.NewEntry(r, u.ID, audit.ActionLoginFailed, audit.TargetUser, u.ID, map[string]any{
+			"method":     challenge.Binding,
+			"two_factor": true,
+		}))
+		httpx.JSONError(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	a.guard.Succeed(ctx, lockout.UserKey(u.ID))
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   !env.IsDev(),
-	})
+	// the code and the challenge can't be used again
+	if err := a.db.UserStorage().UpdateUser(ctx, u); err != nil {
+		log.Printf("Failed to update user: %v", err)
+		httpx.JSONError(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+	if err := a.auth.Revoke(ctx, challenge); err != nil {
+		log.Printf("Failed to revoke challenge: %v", err)
+	}
 
-	data := map[string]any{"token": token}
-	muser := map[string]any{"id": user.ID, "email": user.Email}
-	data["user"] = muser
-	err = json.NewEncoder(w).Encode(data)
+	tokens, err := a.sessions.Start(ctx, u.ID, r)
+	if err != nil {
+		log.Printf("Failed to start session: %v", err)
+		httpx.JSONError(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(ctx, a.db.AuditStorage(), audit.NewEntry(r, u.ID, audit.ActionLogin, audit.TargetUser, u.ID, map[string]any{
+		"method":     challenge.Binding,
+		"two_factor": true,
+	}))
+	writeSession(w, tokens, u)
+}
+
+// tooManyAttempts refuses an attempt while locked out
+func tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+	httpx.JSONError(w, lockout.Message, http.StatusTooManyRequests)
+}
+
+// passwordLoginDisabled refuses password logins and signups when only single sign-on is allowed
+func passwordLoginDisabled(w http.ResponseWriter) bool {
+	if env.IsPasswordLoginDisabled() {
+		httpx.JSONError(w, "Password login is disabled, sign in with single sign-on on the web", http.StatusForbidden)
+		return true
+	}
+	return false
+}
+
+// twoFactorMissing refuses a session to users without two-factor authentication if
+// the instance requires it, they set it up on the web
+func (a *API) twoFactorMissing(w http.ResponseWriter, r *http.Request, u *user.User) bool {
+	required, err := a.db.ReadValueAsBool(r.Context(), settings.SettingRequire2FA)
+	if err != nil {
+		log.Printf("Failed to read settings: %v", err)
+	}
+	if required && !u.TOTPEnabled {
+		httpx.JSONError(w, "Two-factor authentication is required, log in on the web to set it up", http.StatusForbidden)
+		return true
+	}
+	return false
+}
+
+// handleRefresh exchanges a refresh token, from the body or the cookie, for new tokens
+func (a *API) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	// the body is optional for browsers, which send the cookie
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if !errors.Is(err, io.EOF) && httpx.CheckError(w, err) {
+		return
+	}
+	if body.RefreshToken == "" {
+		body.RefreshToken = session.RefreshTokenFromRequest(r)
+	}
+
+	tokens, err := a.sessions.Refresh(r.Context(), body.RefreshToken, r)
+	if errors.Is(err, session.ErrInvalidRefreshToken) || errors.Is(err, session.ErrRefreshTokenReused) {
+		session.ClearCookies(w)
+		httpx.JSONError(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to refresh session: %v", err)
+		httpx.JSONError(w, "Failed to refresh session", http.StatusInternalServerError)
+		return
+	}
+
+	writeSession(w, tokens, tokens.Session.User)
+}
+
+// writeSession sets the session cookies and returns the tokens
+func writeSession(w http.ResponseWriter, tokens *session.Tokens, u *user.User) {
+	session.SetCookies(w, tokens)
+
+	data := map[string]any{
+		"token":              tokens.AccessToken,
+		"expires_at":         tokens.ExpiresAt,
+		"refresh_token":      tokens.RefreshToken,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+	}
+	if u != nil {
+		data["user"] = map[string]any{"id": u.ID, "email": u.Email}
+	}
+	err := json.NewEncoder(w).Encode(data)
 	httpx.CheckError(w, err)
 }
 
 func (a *API) handleLogout(w http.ResponseWriter, r *http.Request) {
-	// clear the token cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   !env.IsDev(),
-	})
+	// revoke the token and its session so copies of them can't be used either
+	token := a.auth.IsAuthenticated(r)
+	if err := a.sessions.Logout(r.Context(), token, session.RefreshTokenFromRequest(r)); err != nil {
+		log.Printf("Failed to revoke token: %v", err)
+		httpx.JSONError(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	session.ClearCookies(w)
+	if token != nil {
+		audit.Record(r.Context(), a.db.AuditStorage(), audit.NewEntry(r, token.ClientId, audit.ActionLogout, audit.TargetUser, token.ClientId, nil))
+	}
 
 	data := map[string]string{"message": "Logged out successfully"}
 	err := json.NewEncoder(w).Encode(data)
@@ -81,6 +262,10 @@ func (a *API) handleRegister(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 
+	if passwordLoginDisabled(w) {
+		return
+	}
+
 	err := json.NewDecoder(r.Body).Decode(&creds)
 	if httpx.CheckError(w, err) {
 		return
@@ -118,26 +303,24 @@ func (a *API) handleRegister(w http.ResponseWriter, r *http.Request) {
 		httpx.JSONError(w, "Failed to create user", http.StatusInternalServerError)
 		return
 	}
+	audit.Record(ctx, a.db.AuditStorage(), audit.NewEntry(r, user.ID, audit.ActionUserCreate, audit.TargetUser, user.ID, map[string]any{
+		"email": user.Email,
+	}))
+	if err := a.emails.SendVerification(ctx, user); err != nil {
+		log.Printf("Failed to send verification email: %v", err)
+	}
+	if a.twoFactorMissing(w, r, user) {
+		return
+	}
 
-	token, _, err := a.auth.CreateToken(user.ID)
+	tokens, err := a.sessions.Start(ctx, user.ID, r)
 	if err != nil {
+		log.Printf("Failed to start session: %v", err)
 		httpx.InvalidCredentials(w)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   !env.IsDev(),
-	})
-
-	data := map[string]any{"token": token}
-	muser := map[string]any{"id": user.ID, "email": user.Email}
-	data["user"] = muser
-	err = json.NewEncoder(w).Encode(data)
-	httpx.CheckError(w, err)
+	writeSession(w, tokens, user)
 }
 
 func (a *API) handleVerify(w http.ResponseWriter, r *http.Request) {
@@ -152,7 +335,7 @@ func (a *API) handleVerify(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user, err := a.db.UserStorage().ReadUser(ctx, token.ClientId)
-	if err != nil {
+	if err != nil || user.Disabled {
 		httpx.JSONError(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
@@ -165,3 +348,25 @@ func (a *API) handleVerify(w http.ResponseWriter, r *http.Request) {
 	err = json.NewEncoder(w).Encode(data)
 	httpx.CheckError(w, err)
 }
+
+// handleJWKS publishes the public keys that verify tokens, so other services can check them
+func (a *API) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	keys := a.auth.PublicKeys()
+	set := jwk.NewSet()
+	for i := 0; i < keys.Len(); i++ {
+		key, _ := keys.Get(i)
+		pub, err := key.Clone()
+		if err != nil {
+			httpx.JSONError(w, "Failed to read keys", http.StatusInternalServerError)
+			return
+		}
+		// the rotation status is for this instance only
+		_ = pub.Remove(auth.KeyStatusKey)
+		_ = pub.Remove(auth.KeyRetiredAtKey)
+		set.Add(pub)
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	err := json.NewEncoder(w).Encode(set)
+	httpx.CheckError(w, err)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/user"
+)
+
+// handleForgotPassword emails a reset link, the response is the same whether or not the account exists
+func (a *API) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if passwordLoginDisabled(w) {
+		return
+	}
+
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := a.emails.SendPasswordReset(r.Context(), body.Email); err != nil {
+		log.Printf("Failed to send password reset: %v", err)
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	data := map[string]string{"message": "If the email belongs to an account, a reset link is on its way"}
+	err := json.NewEncoder(w).Encode(data)
+	httpx.CheckError(w, err)
+}
+
+// handleResetPassword sets a new password with the token from the reset email and logs out every session
+func (a *API) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	if passwordLoginDisabled(w) {
+		return
+	}
+
+	ctx := r.Context()
+
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.Password == "" {
+		httpx.JSONError(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	u, err := a.emails.ResetPassword(ctx, body.Token, body.Password)
+	if errors.Is(err, user.ErrInvalidLink) {
+		httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to reset password: %v", err)
+		httpx.JSONError(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	if err := a.sessions.RevokeAll(ctx, u.ID); err != nil {
+		log.Printf("Failed to revoke sessions: %v", err)
+	}
+
+	audit.Record(ctx, a.db.AuditStorage(), audit.NewEntry(r, u.ID, audit.ActionUserReset, audit.TargetUser, u.ID, nil))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleVerifyEmail confirms the user's email with the token from the confirmation email
+func (a *API) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	u, err := a.emails.VerifyEmail(r.Context(), body.Token)
+	if errors.Is(err, user.ErrInvalidLink) {
+		httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to verify email: %v", err)
+		httpx.JSONError(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r.Context(), a.db.AuditStorage(), audit.NewEntry(r, u.ID, audit.ActionUserEmailVerify, audit.TargetUser, u.ID, map[string]any{
+		"email": u.Email,
+	}))
+	data := map[string]any{"id": u.ID, "email": u.Email, "email_verified": u.EmailVerified}
+	err = json.NewEncoder(w).Encode(data)
+	httpx.CheckError(w, err)
+}
+
+// handleResendVerification sends the authenticated user another confirmation email
+func (a *API) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	token := a.auth.IsAuthenticated(r)
+	if token == nil {
+		httpx.JSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	u, err := a.db.UserStorage().ReadUser(r.Context(), token.ClientId)
+	if err != nil || u.Disabled {
+		httpx.JSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if u.EmailVerified {
+		httpx.JSONError(w, "Email is already verified", http.StatusBadRequest)
+		return
+	}
+
+	if err := a.emails.SendVerification(r.Context(), u); err != nil {
+		log.Printf("Failed to send verification email: %v", err)
+		httpx.JSONError(w, "Failed to send email", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,125 @@
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/user"
+)
+
+// Scopes that can be granted to a key
+var Scopes = []string{auth.ScopeStatsRead, auth.ScopeIngestWrite, auth.ScopeDomainsManage}
+
+// touchInterval limits how often LastUsedAt is written for a busy key
+const touchInterval = time.Minute
+
+var ErrInvalidKey = errors.New("invalid api key")
+
+// Key is a long-lived credential for the API, only a hash of it is stored
+type Key struct {
+	bun.BaseModel `bun:"table:api_keys"`
+
+	ID     string `bun:",pk" json:"id"`
+	UserID string `bun:",notnull" json:"user_id"`
+	Name   string `bun:",notnull" json:"name"`
+	// Prefix is the start of the key, to tell keys apart when listing them
+	Prefix     string    `bun:",notnull" json:"prefix"`
+	KeyHash    string    `bun:",notnull,unique" json:"-"`
+	Scopes     string    `bun:",notnull" json:"scopes"`
+	DomainID   string    `bun:",nullzero" json:"domain_id,omitempty"`
+	LastUsedAt time.Time `bun:",nullzero" json:"last_used_at,omitzero"`
+	CreatedAt  time.Time `bun:",default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	User *user.User `bun:"rel:belongs-to,join:user_id=id" json:"-"`
+}
+
+// New creates a key and returns it with the plaintext key, which can't be recovered later
+func New(userID, name string, scopes []string, domainID string) (*Key, string) {
+	secret := auth.APIKeyPrefix + id.NewID() + id.NewID() + id.NewID()
+
+	var granted []string
+	for _, s := range Scopes {
+		if slices.Contains(scopes, s) {
+			granted = append(granted, s)
+		}
+	}
+
+	return &Key{
+		ID:        id.NewID(),
+		UserID:    userID,
+		Name:      strings.TrimSpace(name),
+		Prefix:    secret[:len(auth.APIKeyPrefix)+6],
+		KeyHash:   Hash(secret),
+		Scopes:    strings.Join(granted, ","),
+		DomainID:  domainID,
+		CreatedAt: time.Now().UTC(),
+	}, secret
+}
+
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ScopeList is the scopes granted to the key
+func (k *Key) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// Validator authenticates API keys for auth.Service
+type Validator struct {
+	store Storage
+}
+
+func NewValidator(store Storage) *Validator {
+	return &Validator{store: store}
+}
+
+var _ auth.APIKeyValidator = (*Validator)(nil)
+
+func (v *Validator) ValidateAPIKey(ctx context.Context, key string) (*auth.Token, error) {
+	k, err := v.store.ReadKeyByHash(ctx, Hash(key))
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	if k.User == nil || k.User.Disabled {
+		return nil, ErrInvalidKey
+	}
+
+	if time.Since(k.LastUsedAt) > touchInterval {
+		if err := v.store.TouchKey(ctx, k.ID, time.Now().UTC()); err != nil {
+			return nil, err
+		}
+	}
+
+	return &auth.Token{
+		ClientId: k.UserID,
+		APIKeyID: k.ID,
+		Scopes:   k.ScopeList(),
+		DomainID: k.DomainID,
+	}, nil
+}
+
+// BeforeInsertHook for Key to set ID.
+var _ bun.BeforeInsertHook = (*Key)(nil)
+
+func (k *Key) BeforeInsert(ctx context.Context, query *bun.InsertQuery) error {
+	if k.ID == "" {
+		k.ID = id.NewID()
+	}
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = time.Now()
+	}
+	return nil
+}
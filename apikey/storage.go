@@ -0,0 +1,16 @@
+package apikey
+
+import (
+	"context"
+	"time"
+)
+
+type Storage interface {
+	CreateKey(ctx context.Context, k *Key) error
+	// ReadKeyByHash reads a key and its user
+	ReadKeyByHash(ctx context.Context, hash string) (*Key, error)
+	ListKeysByUser(ctx context.Context, userID string) ([]*Key, error)
+	// DeleteKey revokes a key, userID guards against deleting another user's key
+	DeleteKey(ctx context.Context, userID, keyID string) error
+	TouchKey(ctx context.Context, keyID string, usedAt time.Time) error
+}
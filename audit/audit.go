@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/httpx"
+)
+
+const (
+	ActionDomainCreate     = "domain.create"
+	ActionDomainUpdate     = "domain.update"
+	ActionDomainVerify     = "domain.verify"
+	ActionDomainUnverify   = "domain.unverify"
+	ActionDomainToken      = "domain.token_rotate"
+	ActionDomainTracking   = "domain.tracking_update"
+	ActionDomainDelete     = "domain.delete"
+	ActionDomainResetStats = "domain.reset_stats"
+	ActionPageviewsPurge   = "pageviews.purge"
+	ActionUserCreate       = "user.create"
+	ActionUserUpdate       = "user.update"
+	ActionUserPassword     = "user.password_change"
+	ActionUserDelete       = "user.delete"
+	ActionUserDisable      = "user.disable"
+	ActionUserEnable       = "user.enable"
+	ActionUserRole         = "user.role_change"
+	ActionUser2FAEnable    = "user.2fa_enable"
+	ActionUser2FADisable   = "user.2fa_disable"
+	ActionUserRecovery     = "user.recovery_codes_reset"
+	ActionUserEmailVerify  = "user.email_verify"
+	ActionUserReset        = "user.password_reset"
+	ActionTeamCreate       = "team.create"
+	ActionTeamUpdate       = "team.update"
+	ActionTeamDelete       = "team.delete"
+	ActionTeamInvite       = "team.invite"
+	ActionTeamInviteRevoke = "team.invite_revoke"
+	ActionTeamJoin         = "team.join"
+	ActionTeamMemberUpdate = "team.member_update"
+	ActionTeamMemberRemove = "team.member_remove"
+	ActionShareCreate      = "share.create"
+	ActionShareRevoke      = "share.revoke"
+	ActionAPIKeyCreate     = "api_key.create"
+	ActionAPIKeyRevoke     = "api_key.revoke"
+	ActionSessionRevoke    = "session.revoke"
+	ActionLogin            = "auth.login"
+	ActionLoginFailed      = "auth.login_failed"
+	ActionLogout           = "auth.logout"
+	ActionLoginLockout     = "auth.lockout"
+	ActionSettingsUpdate   = "settings.update"
+)
+
+const (
+	TargetDomain  = "domain"
+	TargetUser    = "user"
+	TargetTeam    = "team"
+	TargetSetting = "setting"
+)
+
+// how a user proved who they are, recorded as the method of a login
+const (
+	LoginPassword = "password"
+	LoginOIDC     = "oidc"
+)
+
+// Entry is an append-only record of a security or configuration change
+type Entry struct {
+	bun.BaseModel `bun:"table:audit_log"`
+
+	ID         int64     `bun:",pk,autoincrement" json:"id"`
+	Timestamp  time.Time `bun:"ts,notnull,default:current_timestamp" json:"timestamp"`
+	ActorID    string    `bun:"actor_id" json:"actor_id"`
+	Action     string    `bun:"action,notnull" json:"action"`
+	TargetType string    `bun:"target_type" json:"target_type"`
+	TargetID   string    `bun:"target_id" json:"target_id"`
+	IP         string    `bun:"ip" json:"ip"`
+	Details    string    `bun:"details" json:"details"` // JSON
+}
+
+func (e Entry) CSVHeader() []string {
+	return []string{"id", "timestamp", "actor_id", "action", "target_type", "target_id", "ip", "details"}
+}
+
+func (e Entry) CSVRecord() []string {
+	return []string{
+		strconv.FormatInt(e.ID, 10),
+		e.Timestamp.UTC().Format(time.RFC3339),
+		e.ActorID,
+		e.Action,
+		e.TargetType,
+		e.TargetID,
+		e.IP,
+		e.Details,
+	}
+}
+
+// NewEntry creates an entry for an action taken by actorID during r, details are stored as JSON
+func NewEntry(r *http.Request, actorID, action, targetType, targetID string, details any) *Entry {
+	e := &Entry{
+		Timestamp:  time.Now().UTC(),
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+	}
+	if r != nil {
+		e.IP = httpx.ClientIP(r)
+	}
+	if details != nil {
+		b, err := json.Marshal(details)
+		if err != nil {
+			log.Println("Failed to marshal audit details:", err)
+		} else {
+			e.Details = string(b)
+		}
+	}
+	return e
+}
+
+// Record writes e, failures are logged rather than failing the audited action
+func Record(ctx context.Context, store Storage, e *Entry) {
+	if err := store.CreateAuditEntry(ctx, e); err != nil {
+		log.Printf("Failed to record audit entry %s %s/%s: %v", e.Action, e.TargetType, e.TargetID, err)
+	}
+}
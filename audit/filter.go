@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zackb/updog/httpx"
+)
+
+// Actions lists every action that is recorded, for choosing one to filter by
+var Actions = []string{
+	ActionDomainCreate,
+	ActionDomainUpdate,
+	ActionDomainVerify,
+	ActionDomainUnverify,
+	ActionDomainToken,
+	ActionDomainTracking,
+	ActionDomainDelete,
+	ActionDomainResetStats,
+	ActionPageviewsPurge,
+	ActionUserCreate,
+	ActionUserUpdate,
+	ActionUserPassword,
+	ActionUserDelete,
+	ActionUserDisable,
+	ActionUserEnable,
+	ActionUserRole,
+	ActionUser2FAEnable,
+	ActionUser2FADisable,
+	ActionUserRecovery,
+	ActionUserEmailVerify,
+	ActionUserReset,
+	ActionTeamCreate,
+	ActionTeamUpdate,
+	ActionTeamDelete,
+	ActionTeamInvite,
+	ActionTeamInviteRevoke,
+	ActionTeamJoin,
+	ActionTeamMemberUpdate,
+	ActionTeamMemberRemove,
+	ActionShareCreate,
+	ActionShareRevoke,
+	ActionAPIKeyCreate,
+	ActionAPIKeyRevoke,
+	ActionSessionRevoke,
+	ActionLogin,
+	ActionLoginFailed,
+	ActionLogout,
+	ActionLoginLockout,
+	ActionSettingsUpdate,
+}
+
+// Categories are the prefixes of Actions, in the order they first appear
+func Categories() []string {
+	var categories []string
+	for _, a := range Actions {
+		c, _, _ := strings.Cut(a, ".")
+		if len(categories) == 0 || categories[len(categories)-1] != c {
+			categories = append(categories, c)
+		}
+	}
+	return categories
+}
+
+// Filter narrows the entries that are listed, zero fields match every entry
+type Filter struct {
+	ActorID string `json:"actor_id,omitempty"`
+	// Action is a single action, or a category such as "domain" for all of its actions
+	Action     string `json:"action,omitempty"`
+	TargetType string `json:"target_type,omitempty"`
+	TargetID   string `json:"target_id,omitempty"`
+	// From is inclusive and To is exclusive
+	From time.Time `json:"from,omitzero"`
+	To   time.Time `json:"to,omitzero"`
+}
+
+// FilterFromQuery reads a filter from the actor_id, action, target_type, target_id, from and to parameters
+func FilterFromQuery(q url.Values) (Filter, error) {
+	f := Filter{
+		ActorID:    strings.TrimSpace(q.Get("actor_id")),
+		Action:     strings.TrimSpace(q.Get("action")),
+		TargetType: strings.TrimSpace(q.Get("target_type")),
+		TargetID:   strings.TrimSpace(q.Get("target_id")),
+	}
+	var err error
+	if s := q.Get("from"); s != "" {
+		if f.From, err = httpx.ParseTimeParam(s); err != nil {
+			return f, fmt.Errorf("Invalid 'from' date: %v", err)
+		}
+	}
+	if s := q.Get("to"); s != "" {
+		if f.To, err = httpx.ParseTimeParam(s); err != nil {
+			return f, fmt.Errorf("Invalid 'to' date: %v", err)
+		}
+	}
+	return f, nil
+}
+
+// IsCategory is true when the filter's action matches a whole category of actions
+func (f Filter) IsCategory() bool {
+	return f.Action != "" && !strings.Contains(f.Action, ".")
+}
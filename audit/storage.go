@@ -0,0 +1,11 @@
+package audit
+
+import (
+	"context"
+)
+
+type Storage interface {
+	CreateAuditEntry(ctx context.Context, e *Entry) error
+	// ListAuditEntries returns the entries matching f, newest first
+	ListAuditEntries(ctx context.Context, f Filter, limit, offset int) ([]*Entry, error)
+}
@@ -1,77 +1,250 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/uptrace/bun"
 	"github.com/zackb/updog/id"
 )
 
+const ScopesKey = "scopes"
+
+// audience is the aud claim of access tokens, challenge tokens have their
+// own audience for each purpose so they can't be used instead
+const audience = "updog"
+
+// Purposes of challenge tokens
+const (
+	// PurposeTwoFactor is the second step of logging in
+	PurposeTwoFactor = "2fa"
+	// PurposeVerifyEmail confirms the user owns the email address in the token's binding
+	PurposeVerifyEmail = "verify_email"
+	// PurposeResetPassword sets a new password, the binding changes with the password so it works once
+	PurposeResetPassword = "reset_password"
+	// PurposeOIDC carries a single sign-on request through the provider's redirect
+	PurposeOIDC = "oidc"
+)
+
+// ChallengeTTL is how long a user has to enter their second factor after their password
+const ChallengeTTL = 5 * time.Minute
+
+// MaxChallengeTTL is the longest a challenge can last, such as the link confirming an email.
+// Retired keys keep verifying tokens at least this long so links sent before a rotation still work.
+const MaxChallengeTTL = 48 * time.Hour
+
+// BindingKey is the claim tying a challenge to the state it was issued for
+const BindingKey = "bnd"
+
+// SessionIDKey is the claim linking an access token to the session that issued it
+const SessionIDKey = "sid"
+
+// AuthTimeKey is the claim carrying when the session signed in, refreshed tokens keep it
+const AuthTimeKey = "auth_time"
+
+// Scopes an API key can be granted, sessions from logging in have all of them
+const (
+	ScopeStatsRead     = "stats:read"
+	ScopeIngestWrite   = "ingest:write"
+	ScopeDomainsManage = "domains:manage"
+	// ScopeAccount covers users and teams, it's never granted to API keys
+	ScopeAccount = "account"
+)
+
 var (
+	// defaultScopes are granted to sessions from logging in
 	defaultScopes = []string{
-		"domain:rw",
+		ScopeStatsRead,
+		ScopeIngestWrite,
+		ScopeDomainsManage,
+		ScopeAccount,
 	}
 )
 
-const ScopesKey = "scopes"
+// legacyScope was granted to every token before scopes were enforced
+const legacyScope = "domain:rw"
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// RevocationStore keeps the ids of tokens revoked before they expire
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	// DeleteExpiredRevocations forgets tokens that have expired anyway
+	DeleteExpiredRevocations(ctx context.Context, now time.Time) (int, error)
+}
+
+// RevokedToken is a token that can no longer be used although it hasn't expired
+type RevokedToken struct {
+	bun.BaseModel `bun:"table:revoked_tokens"`
+
+	JTI       string    `bun:"jti,pk"`
+	ExpiresAt time.Time `bun:",notnull"`
+	RevokedAt time.Time `bun:",notnull"`
+}
+
+// APIKeyPrefix starts every API key so they can be told apart from JWTs
+const APIKeyPrefix = "updog_"
+
+// APIKeyValidator looks up the token for an API key
+type APIKeyValidator interface {
+	ValidateAPIKey(ctx context.Context, key string) (*Token, error)
+}
+
+// UserChecker tells whether a user's tokens may still be used
+type UserChecker interface {
+	// IsUserDisabled is true if an admin disabled the user, or they no longer exist
+	IsUserDisabled(ctx context.Context, userID string) (bool, error)
+}
 
 // Service uses supplied JWK sets and expiration times to create and verify JWT tokens
 type Service struct {
 
-	// the "current" json web key
-	jwKey jwk.Key
-
-	// the set of all valid json web keys
-	jwKeySet jwk.Set
+	// the jwks file, which can be reloaded to rotate keys
+	jwksPath string
+	mu       sync.RWMutex
+	keys     *keyring
 	expiry   time.Duration
+
+	apiKeys APIKeyValidator
+	revoked RevocationStore
+	users   UserChecker
 }
 
 func NewAuthService(jwksPath string, expiry time.Duration) (*Service, error) {
-	set, err := jwk.ReadFile(jwksPath)
+	keys, err := loadKeys(jwksPath, expiry)
 	if err != nil {
 		return nil, err
 	}
 
-	// find the latest key
-	key, ok := set.Get(0)
-	if !ok {
-		return nil, errors.New("couldn't find a json web key")
-	}
-
 	return &Service{
-		jwKey:    key,
-		jwKeySet: set,
+		jwksPath: jwksPath,
+		keys:     keys,
 		expiry:   expiry,
 	}, nil
 }
 
+// KeyMetadata describes a json web key without exposing its secret material
+type KeyMetadata struct {
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	KeyType   string `json:"kty"`
+	Status    string `json:"status,omitempty"`
+}
+
+// ReadKeyMetadata lists the keys in the jwks file at jwksPath
+func ReadKeyMetadata(jwksPath string) ([]KeyMetadata, error) {
+	set, err := jwk.ReadFile(jwksPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]KeyMetadata, 0, set.Len())
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Get(i)
+		keys = append(keys, KeyMetadata{
+			KeyID:     key.KeyID(),
+			Algorithm: key.Algorithm(),
+			KeyType:   string(key.KeyType()),
+			Status:    KeyStatus(key),
+		})
+	}
+	return keys, nil
+}
+
+// SetAPIKeyValidator enables authenticating with API keys
+func (s *Service) SetAPIKeyValidator(v APIKeyValidator) {
+	s.apiKeys = v
+}
+
+// SetRevocationStore enables revoking tokens before they expire
+func (s *Service) SetRevocationStore(store RevocationStore) {
+	s.revoked = store
+}
+
+// SetUserChecker refuses the tokens of disabled users, which would otherwise work until they expire
+func (s *Service) SetUserChecker(users UserChecker) {
+	s.users = users
+}
+
 type Token struct {
 	ClientId string `json:"client_id"`
 	Expiry   int64  `json:"expiry"`
+	// ID is the jti of a JWT
+	ID string `json:"-"`
+	// SessionID is the session a JWT was issued or refreshed for
+	SessionID string `json:"-"`
+	// SignedInAt is when that session signed in, zero without a session
+	SignedInAt time.Time `json:"-"`
+	// Binding is the state a challenge was issued for
+	Binding string `json:"-"`
+
+	// APIKeyID is set when authenticated with an API key, which is also
+	// limited to DomainID if it isn't empty
+	APIKeyID string   `json:"-"`
+	Scopes   []string `json:"-"`
+	DomainID string   `json:"-"`
+}
+
+// HasScope is true if the token grants any of scopes
+func (t *Token) HasScope(scopes ...string) bool {
+	for _, scope := range scopes {
+		if slices.Contains(t.Scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsDomain is true unless the token is restricted to another domain
+func (t *Token) AllowsDomain(domainID string) bool {
+	return t.DomainID == "" || t.DomainID == domainID
 }
 
-// CreateToken creates a new JWT token for the given clientId (user ID).
-// returns the signed token as a string and the expiration time as a Unix timestamp.
-func (s *Service) CreateToken(clientId string) (string, int64, error) {
+// CreateToken creates a new JWT token for the given clientId (user ID) in sessionID, which signed in at signedInAt.
+// returns the signed token as a string and the claims it carries.
+func (s *Service) CreateToken(clientId, sessionID string, signedInAt time.Time) (string, *Token, error) {
+	return s.createToken(clientId, audience, s.expiry, sessionID, signedInAt, defaultScopes, "")
+}
+
+// CreateChallenge creates a token for clientId that's only good for purpose, such as proving
+// they passed the first step of logging in. It can't be used as an access token.
+// binding is returned by ValidateChallenge so the caller can check it still holds.
+func (s *Service) CreateChallenge(clientId, purpose, binding string, ttl time.Duration) (string, *Token, error) {
+	if ttl > MaxChallengeTTL {
+		return "", nil, fmt.Errorf("challenge ttl %s is longer than %s", ttl, MaxChallengeTTL)
+	}
+	return s.createToken(clientId, challengeAudience(purpose), ttl, "", time.Time{}, nil, binding)
+}
+
+func challengeAudience(purpose string) string {
+	return audience + ":" + purpose
+}
+
+func (s *Service) createToken(clientId, aud string, ttl time.Duration, sessionID string, signedInAt time.Time, scopes []string, binding string) (string, *Token, error) {
 
 	// create jwt token
 	token := jwt.New()
 
 	// set attributes
 	// aud
-	_ = token.Set(jwt.AudienceKey, "updog")
+	_ = token.Set(jwt.AudienceKey, aud)
 
 	// sub
 	_ = token.Set(jwt.SubjectKey, clientId)
 
 	// exp
-	exp := time.Now().Add(s.expiry)
+	exp := time.Now().Add(ttl)
 	err := token.Set(jwt.ExpirationKey, exp)
 
 	if err != nil {
@@ -91,45 +264,126 @@ func (s *Service) CreateToken(clientId string) (string, int64, error) {
 		log.Println("failed setting jti", err)
 	}
 	// scopes
-	err = token.Set(ScopesKey, defaultScopes)
-	if err != nil {
-		log.Println("failed setting scopes", err)
+	if len(scopes) > 0 {
+		err = token.Set(ScopesKey, scopes)
+		if err != nil {
+			log.Println("failed setting scopes", err)
+		}
+	}
+	// session
+	if sessionID != "" {
+		err = token.Set(SessionIDKey, sessionID)
+		if err != nil {
+			log.Println("failed setting session", err)
+		}
+	}
+	if !signedInAt.IsZero() {
+		err = token.Set(AuthTimeKey, signedInAt.Unix())
+		if err != nil {
+			log.Println("failed setting auth time", err)
+		}
+	}
+	// binding
+	if binding != "" {
+		err = token.Set(BindingKey, binding)
+		if err != nil {
+			log.Println("failed setting binding", err)
+		}
 	}
 
-	signed, err := jwt.Sign(token, jwa.HS256, s.jwKey)
+	key := s.keyring().signing
+	signed, err := jwt.Sign(token, jwa.SignatureAlgorithm(key.Algorithm()), key)
 	if err != nil {
 		log.Println("failed signing token", err)
-		return "", 0, err
+		return "", nil, err
 	}
-	return string(signed), exp.Unix(), nil
+	return string(signed), &Token{
+		ClientId:   clientId,
+		Expiry:     exp.Unix(),
+		ID:         jti,
+		SessionID:  sessionID,
+		SignedInAt: signedInAt,
+		Binding:    binding,
+		Scopes:     scopes,
+	}, nil
+}
+
+func (s *Service) ValidateToken(ctx context.Context, t string) (*Token, error) {
+	return s.validateToken(ctx, t, audience)
 }
 
-func (s *Service) ValidateToken(t string) (*Token, error) {
+// ValidateChallenge validates a token from CreateChallenge for purpose
+func (s *Service) ValidateChallenge(ctx context.Context, t, purpose string) (*Token, error) {
+	return s.validateToken(ctx, t, challengeAudience(purpose))
+}
+
+func (s *Service) validateToken(ctx context.Context, t, aud string) (*Token, error) {
 	if t == "" {
 		return nil, fmt.Errorf("token is empty")
 	}
 
-	token, err := jwt.Parse([]byte(t), jwt.WithKeySet(s.jwKeySet))
+	token, err := jwt.Parse([]byte(t), jwt.WithKeySet(s.keyring().verify))
 
 	if err != nil {
 		return nil, err
 	}
 
+	if !slices.Contains(token.Audience(), aud) {
+		return nil, fmt.Errorf("wrong audience")
+	}
+
 	now := time.Now().UTC()
 	if token.Expiration().Unix() > 0 && token.Expiration().Before(now) {
 		return nil, fmt.Errorf("token expired")
 	}
 
-	// check if the clientId has been revoked
 	clientId := parseClientId(token)
 	if clientId == "" {
 		return nil, fmt.Errorf("missing client_id")
 	}
 
+	// check if the token has been revoked
+	if s.revoked != nil {
+		if token.JwtID() == "" {
+			return nil, fmt.Errorf("missing jti")
+		}
+		revoked, err := s.revoked.IsTokenRevoked(ctx, token.JwtID())
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	sessionID, _ := token.Get(SessionIDKey)
+	sid, _ := sessionID.(string)
+	binding, _ := token.Get(BindingKey)
+	bnd, _ := binding.(string)
+
 	return &Token{
-		ClientId: clientId,
-		Expiry:   token.Expiration().Unix(),
-	}, err
+		ClientId:   clientId,
+		Expiry:     token.Expiration().Unix(),
+		ID:         token.JwtID(),
+		SessionID:  sid,
+		SignedInAt: parseAuthTime(token),
+		Binding:    bnd,
+		Scopes:     parseScopes(token),
+	}, nil
+}
+
+// Revoke stops t from being accepted before it expires, API keys are revoked by deleting them instead
+func (s *Service) Revoke(ctx context.Context, t *Token) error {
+	if t.APIKeyID != "" {
+		return nil
+	}
+	if s.revoked == nil {
+		return errors.New("token revocation is not enabled")
+	}
+	if t.ID == "" {
+		return fmt.Errorf("missing jti")
+	}
+	return s.revoked.RevokeToken(ctx, t.ID, time.Unix(t.Expiry, 0).UTC())
 }
 
 func (s *Service) IsAuthenticated(r *http.Request) *Token {
@@ -142,6 +396,19 @@ func (s *Service) IsAuthenticated(r *http.Request) *Token {
 		tokenStr = tokenStr[7:]
 	}
 
+	// api keys are only accepted in the header
+	if strings.HasPrefix(tokenStr, APIKeyPrefix) {
+		if s.apiKeys == nil {
+			return nil
+		}
+		token, err := s.apiKeys.ValidateAPIKey(r.Context(), tokenStr)
+		if err != nil {
+			log.Println("failed validating api key", err)
+			return nil
+		}
+		return token
+	}
+
 	// check for cookie otherwise (web)
 	if tokenStr == "" {
 		cookie, err := r.Cookie("token")
@@ -153,7 +420,7 @@ func (s *Service) IsAuthenticated(r *http.Request) *Token {
 	}
 
 	// validate the token
-	token, err := s.ValidateToken(tokenStr)
+	token, err := s.ValidateToken(r.Context(), tokenStr)
 	if err != nil {
 		log.Println("failed validating token", err)
 		return nil
@@ -164,9 +431,59 @@ func (s *Service) IsAuthenticated(r *http.Request) *Token {
 		return nil
 	}
 
+	if s.users != nil {
+		disabled, err := s.users.IsUserDisabled(r.Context(), token.ClientId)
+		if err != nil {
+			log.Println("failed checking user", err)
+			return nil
+		}
+		if disabled {
+			return nil
+		}
+	}
+
 	return token
 }
 
 func parseClientId(token jwt.Token) string {
 	return token.Subject()
 }
+
+// parseScopes reads the scopes claim, the legacy scope grants what a session does now
+func parseScopes(token jwt.Token) []string {
+	v, ok := token.Get(ScopesKey)
+	if !ok {
+		return nil
+	}
+	raw, ok := v.([]any)
+	if !ok {
+		return nil
+	}
+
+	var scopes []string
+	for _, scope := range raw {
+		if str, ok := scope.(string); ok {
+			if str == legacyScope {
+				scopes = append(scopes, defaultScopes...)
+			} else {
+				scopes = append(scopes, str)
+			}
+		}
+	}
+	return scopes
+}
+
+// parseAuthTime is when the token's session signed in, zero if it doesn't say
+func parseAuthTime(token jwt.Token) time.Time {
+	v, ok := token.Get(AuthTimeKey)
+	if !ok {
+		return time.Time{}
+	}
+	switch t := v.(type) {
+	case float64:
+		return time.Unix(int64(t), 0).UTC()
+	case int64:
+		return time.Unix(t, 0).UTC()
+	}
+	return time.Time{}
+}
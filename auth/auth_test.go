@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryRevocations map[string]time.Time
+
+func (m memoryRevocations) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	m[jti] = expiresAt
+	return nil
+}
+
+func (m memoryRevocations) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	_, ok := m[jti]
+	return ok, nil
+}
+
+func (m memoryRevocations) DeleteExpiredRevocations(ctx context.Context, now time.Time) (int, error) {
+	return 0, nil
+}
+
+func newTestService(t *testing.T) *Service {
+	key, err := jwk.New([]byte("0123456789abcdef0123456789abcdef"))
+	assert.NoError(t, err)
+	assert.NoError(t, key.Set(jwk.KeyIDKey, "test"))
+	assert.NoError(t, key.Set(jwk.AlgorithmKey, jwa.HS256))
+	set := jwk.NewSet()
+	set.Add(key)
+
+	b, err := json.Marshal(set)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, b, 0600))
+
+	s, err := NewAuthService(path, time.Hour)
+	assert.NoError(t, err)
+	return s
+}
+
+func TestValidateToken_ScopesAndRevocation(t *testing.T) {
+	s := newTestService(t)
+	revoked := memoryRevocations{}
+	s.SetRevocationStore(revoked)
+	ctx := context.Background()
+
+	signedIn := time.Now().Add(-time.Hour).Truncate(time.Second).UTC()
+	signed, issued, err := s.CreateToken("user-1", "session-1", signedIn)
+	assert.NoError(t, err)
+
+	token, err := s.ValidateToken(ctx, signed)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", token.ClientId)
+	assert.Equal(t, issued.ID, token.ID)
+	assert.Equal(t, "session-1", token.SessionID)
+	assert.Equal(t, signedIn, token.SignedInAt)
+	assert.True(t, token.HasScope(ScopeStatsRead))
+	assert.True(t, token.HasScope(ScopeAccount))
+
+	assert.NoError(t, s.Revoke(ctx, token))
+	_, err = s.ValidateToken(ctx, signed)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+}
+
+func TestToken_HasScope(t *testing.T) {
+	token := &Token{Scopes: []string{ScopeStatsRead}}
+	assert.True(t, token.HasScope(ScopeStatsRead, ScopeDomainsManage))
+	assert.False(t, token.HasScope(ScopeDomainsManage))
+	assert.False(t, (&Token{}).HasScope(ScopeStatsRead))
+}
+
+func TestKeyRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	set := jwk.NewSet()
+	old, err := GenerateKey(jwa.HS256, "old")
+	assert.NoError(t, err)
+	assert.NoError(t, AddKey(set, old))
+	assert.NoError(t, WriteKeySet(path, set))
+
+	s, err := NewAuthService(path, time.Hour)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	before, _, err := s.CreateToken("user-1", "", time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, s.PublicKeys().Len())
+
+	for _, alg := range []jwa.SignatureAlgorithm{jwa.ES256, jwa.EdDSA} {
+		next, err := GenerateKey(alg, string(alg))
+		assert.NoError(t, err)
+		assert.NoError(t, AddKey(set, next))
+		assert.Equal(t, KeyStatusNext, KeyStatus(next))
+		assert.NoError(t, PromoteKey(set, "", time.Now()))
+		assert.NoError(t, WriteKeySet(path, set))
+		assert.NoError(t, s.Reload())
+
+		// new tokens are signed with the promoted key, old ones still verify
+		after, _, err := s.CreateToken("user-1", "", time.Time{})
+		assert.NoError(t, err)
+		_, err = s.ValidateToken(ctx, after)
+		assert.NoError(t, err)
+		_, err = s.ValidateToken(ctx, before)
+		assert.NoError(t, err)
+		_, ok := s.PublicKeys().LookupKeyID(string(alg))
+		assert.True(t, ok)
+	}
+
+	// a retired key can't be promoted again
+	assert.Error(t, PromoteKey(set, "old", time.Now()))
+
+	// keys retired longer ago than tokens and challenges last are no longer accepted
+	assert.NoError(t, old.Set(KeyRetiredAtKey, time.Now().Add(-MaxChallengeTTL-time.Hour).Format(time.RFC3339)))
+	assert.NoError(t, WriteKeySet(path, set))
+	assert.NoError(t, s.Reload())
+	_, err = s.ValidateToken(ctx, before)
+	assert.Error(t, err)
+
+	assert.Equal(t, 1, PruneKeys(set, time.Now().Add(-MaxChallengeTTL)))
+	assert.Equal(t, 2, set.Len())
+}
+
+func TestKeyRotation_EmailLinksOutliveAccessTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	set := jwk.NewSet()
+	old, err := GenerateKey(jwa.HS256, "old")
+	assert.NoError(t, err)
+	assert.NoError(t, AddKey(set, old))
+	assert.NoError(t, WriteKeySet(path, set))
+
+	s, err := NewAuthService(path, 15*time.Minute)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	verify, _, err := s.CreateChallenge("user-1", PurposeVerifyEmail, "alice@example.com", MaxChallengeTTL)
+	assert.NoError(t, err)
+
+	// the server reloads the keys a day after the rotation, long after access tokens expired
+	next, err := GenerateKey(jwa.ES256, "next")
+	assert.NoError(t, err)
+	assert.NoError(t, AddKey(set, next))
+	assert.NoError(t, PromoteKey(set, "", time.Now().Add(-24*time.Hour)))
+	assert.NoError(t, WriteKeySet(path, set))
+	assert.NoError(t, s.Reload())
+
+	token, err := s.ValidateChallenge(ctx, verify, PurposeVerifyEmail)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice@example.com", token.Binding)
+
+	_, _, err = s.CreateChallenge("user-1", PurposeVerifyEmail, "", MaxChallengeTTL+time.Second)
+	assert.Error(t, err)
+}
+
+func TestChallengeIsNotAnAccessToken(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	challenge, _, err := s.CreateChallenge("user-1", PurposeTwoFactor, "", ChallengeTTL)
+	assert.NoError(t, err)
+	_, err = s.ValidateToken(ctx, challenge)
+	assert.Error(t, err)
+	token, err := s.ValidateChallenge(ctx, challenge, PurposeTwoFactor)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", token.ClientId)
+	assert.Empty(t, token.Scopes)
+
+	// challenges are only good for their own purpose
+	_, err = s.ValidateChallenge(ctx, challenge, PurposeResetPassword)
+	assert.Error(t, err)
+	reset, _, err := s.CreateChallenge("user-1", PurposeResetPassword, "fingerprint", time.Hour)
+	assert.NoError(t, err)
+	token, err = s.ValidateChallenge(ctx, reset, PurposeResetPassword)
+	assert.NoError(t, err)
+	assert.Equal(t, "fingerprint", token.Binding)
+
+	access, _, err := s.CreateToken("user-1", "", time.Time{})
+	assert.NoError(t, err)
+	_, err = s.ValidateChallenge(ctx, access, PurposeTwoFactor)
+	assert.Error(t, err)
+}
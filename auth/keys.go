@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// Keys in the jwks file carry their place in the rotation in these fields.
+// A key is added as next, promoted to active to sign tokens and retired when
+// the next one is promoted, it keeps verifying tokens until they've expired.
+const (
+	KeyStatusKey    = "status"
+	KeyRetiredAtKey = "retired_at"
+
+	KeyStatusNext    = "next"
+	KeyStatusActive  = "active"
+	KeyStatusRetired = "retired"
+)
+
+// SigningAlgorithms can be used for new keys
+var SigningAlgorithms = []jwa.SignatureAlgorithm{jwa.HS256, jwa.ES256, jwa.EdDSA}
+
+var ErrKeyNotFound = errors.New("json web key not found")
+
+// keyring is a loaded key set
+type keyring struct {
+	// signing signs new tokens
+	signing jwk.Key
+	// verify checks tokens signed by any key that hasn't expired from the rotation
+	verify jwk.Set
+	// public is the verify set without symmetric keys, safe to publish
+	public jwk.Set
+}
+
+// loadKeys reads the key set at path, retired keys are dropped once tokens they signed have expired.
+// Access tokens last expiry, but challenges can last up to MaxChallengeTTL.
+func loadKeys(path string, expiry time.Duration) (*keyring, error) {
+	set, err := jwk.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	expiry = max(expiry, MaxChallengeTTL)
+
+	kr := &keyring{verify: jwk.NewSet(), public: jwk.NewSet()}
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Get(i)
+		switch KeyStatus(key) {
+		case KeyStatusActive:
+			if kr.signing == nil {
+				kr.signing = key
+			}
+		case KeyStatusRetired:
+			if retired := keyRetiredAt(key); !retired.IsZero() && time.Since(retired) > expiry {
+				continue
+			}
+		}
+
+		pub, err := jwk.PublicKeyOf(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", key.KeyID(), err)
+		}
+		kr.verify.Add(pub)
+		if key.KeyType() != jwa.OctetSeq {
+			kr.public.Add(pub)
+		}
+	}
+
+	// files from before rotation have no status, sign with the first key
+	if kr.signing == nil {
+		for i := 0; i < set.Len(); i++ {
+			if key, _ := set.Get(i); KeyStatus(key) == "" {
+				kr.signing = key
+				break
+			}
+		}
+	}
+	if kr.signing == nil {
+		return nil, errors.New("couldn't find a json web key")
+	}
+	if kr.signing.Algorithm() == "" {
+		return nil, fmt.Errorf("key %q has no algorithm", kr.signing.KeyID())
+	}
+	return kr, nil
+}
+
+// KeyStatus is the key's place in the rotation, empty for keys from before rotation
+func KeyStatus(key jwk.Key) string {
+	v, _ := key.Get(KeyStatusKey)
+	s, _ := v.(string)
+	return s
+}
+
+func keyRetiredAt(key jwk.Key) time.Time {
+	v, _ := key.Get(KeyRetiredAtKey)
+	s, _ := v.(string)
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+// GenerateKey creates a signing key for alg
+func GenerateKey(alg jwa.SignatureAlgorithm, kid string) (jwk.Key, error) {
+	var raw any
+	switch alg {
+	case jwa.HS256:
+		secret := make([]byte, 64)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		raw = secret
+	case jwa.ES256:
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		raw = priv
+	case jwa.EdDSA:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		raw = priv
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	key, err := jwk.New(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.Set(jwk.KeyIDKey, kid); err != nil {
+		return nil, err
+	}
+	if err := key.Set(jwk.AlgorithmKey, alg); err != nil {
+		return nil, err
+	}
+	if err := key.Set(jwk.KeyUsageKey, jwk.ForSignature); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// AddKey adds key to set as the next key, or as the active one if set has none
+func AddKey(set jwk.Set, key jwk.Key) error {
+	status := KeyStatusNext
+	if set.Len() == 0 {
+		status = KeyStatusActive
+	}
+	if err := key.Set(KeyStatusKey, status); err != nil {
+		return err
+	}
+	set.Add(key)
+	return nil
+}
+
+// PromoteKey makes the key kid sign new tokens and retires the key that did.
+// An empty kid promotes the most recently added next key.
+func PromoteKey(set jwk.Set, kid string, now time.Time) error {
+	var next jwk.Key
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Get(i)
+		if kid == "" && KeyStatus(key) == KeyStatusNext || kid != "" && key.KeyID() == kid {
+			next = key
+		}
+	}
+	if next == nil {
+		return ErrKeyNotFound
+	}
+	if KeyStatus(next) == KeyStatusRetired {
+		return fmt.Errorf("key %q is retired", next.KeyID())
+	}
+
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Get(i)
+		if key == next {
+			continue
+		}
+		if status := KeyStatus(key); status == KeyStatusActive || status == "" {
+			if err := key.Set(KeyStatusKey, KeyStatusRetired); err != nil {
+				return err
+			}
+			if err := key.Set(KeyRetiredAtKey, now.UTC().Format(time.RFC3339)); err != nil {
+				return err
+			}
+		}
+	}
+	return next.Set(KeyStatusKey, KeyStatusActive)
+}
+
+// PruneKeys removes keys retired before cutoff and returns how many were removed
+func PruneKeys(set jwk.Set, cutoff time.Time) int {
+	var pruned []jwk.Key
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Get(i)
+		if KeyStatus(key) == KeyStatusRetired && keyRetiredAt(key).Before(cutoff) {
+			pruned = append(pruned, key)
+		}
+	}
+	for _, key := range pruned {
+		set.Remove(key)
+	}
+	return len(pruned)
+}
+
+// WriteKeySet replaces the jwks file at path, atomically so a running server never reads half of it
+func WriteKeySet(path string, set jwk.Set) error {
+	b, err := json.MarshalIndent(set, "", "   ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".jwks-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Reload reads the jwks file again, tokens keep validating if it fails
+func (s *Service) Reload() error {
+	kr, err := loadKeys(s.jwksPath, s.expiry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.keys = kr
+	s.mu.Unlock()
+	return nil
+}
+
+// WatchKeys reloads the jwks file whenever it changes until ctx is done
+func (s *Service) WatchKeys(ctx context.Context, interval time.Duration) {
+	modTime := func() time.Time {
+		info, err := os.Stat(s.jwksPath)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+
+	last := modTime()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if m := modTime(); !m.IsZero() && !m.Equal(last) {
+				last = m
+				if err := s.Reload(); err != nil {
+					log.Println("failed reloading json web keys", err)
+				} else {
+					log.Println("reloaded json web keys from", s.jwksPath)
+				}
+			}
+		}
+	}
+}
+
+// PublicKeys is the set of public keys that verify tokens, symmetric keys are never included
+func (s *Service) PublicKeys() jwk.Set {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys.public
+}
+
+func (s *Service) keyring() *keyring {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys
+}
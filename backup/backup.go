@@ -0,0 +1,358 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/db"
+)
+
+// FormatVersion is bumped whenever the archive layout changes
+const FormatVersion = 1
+
+const (
+	manifestName = "manifest.json"
+	settingsName = "settings.json"
+	databaseName = "updog.db"
+
+	filePrefix = "updog-backup-"
+	fileSuffix = ".tar.gz"
+)
+
+// Manifest describes the contents of a backup archive
+type Manifest struct {
+	FormatVersion int                `json:"format_version"`
+	CreatedAt     time.Time          `json:"created_at"`
+	SourceDialect string             `json:"source_dialect"`
+	SchemaVersion int64              `json:"schema_version"`
+	Tables        map[string]int     `json:"tables"`
+	Keys          []auth.KeyMetadata `json:"jwks,omitempty"`
+}
+
+type Options struct {
+	// JWKSPath is the key set whose metadata is recorded in the manifest, optional
+	JWKSPath string
+}
+
+type RestoreOptions struct {
+	// JWKSPath is compared against the key ids in the manifest, optional
+	JWKSPath string
+	// Force replaces the data of a database that isn't empty, which is refused otherwise
+	Force bool
+}
+
+// Create writes a consistent snapshot of store to w as a gzipped tar archive
+// containing the manifest, the instance settings and a sqlite copy of the database.
+func Create(ctx context.Context, store *db.DB, w io.Writer, opts Options) (*Manifest, error) {
+	tmp, err := os.MkdirTemp("", "updog-backup")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	snapPath := filepath.Join(tmp, databaseName)
+	if err := store.Snapshot(ctx, snapPath); err != nil {
+		return nil, fmt.Errorf("snapshotting database: %w", err)
+	}
+
+	// read everything for the manifest from the snapshot so it matches the archived data
+	snap, err := db.OpenDB("sqlite://" + snapPath)
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Close()
+
+	manifest := &Manifest{
+		FormatVersion: FormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		SourceDialect: store.Db.Dialect().Name().String(),
+	}
+
+	if manifest.SchemaVersion, err = snap.SchemaVersion(ctx); err != nil {
+		return nil, err
+	}
+	if manifest.Tables, err = snap.TableCounts(ctx); err != nil {
+		return nil, err
+	}
+	if opts.JWKSPath != "" {
+		if manifest.Keys, err = auth.ReadKeyMetadata(opts.JWKSPath); err != nil {
+			return nil, fmt.Errorf("reading jwks: %w", err)
+		}
+	}
+
+	s, err := snap.SettingsStorage().ListSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	if err := writeJSON(tw, manifestName, manifest); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(tw, settingsName, s); err != nil {
+		return nil, err
+	}
+	if err := writeFile(tw, databaseName, snapPath); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// CreateFile writes a backup archive into dir, named for the time to the microsecond, and returns its path.
+// The archive only appears under its final name once it's complete.
+func CreateFile(ctx context.Context, store *db.DB, dir string, opts Options) (string, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+
+	name := filePrefix + time.Now().UTC().Format("20060102-150405.000000") + fileSuffix
+	path := filepath.Join(dir, name)
+
+	f, err := os.CreateTemp(dir, "."+name)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := Create(ctx, store, f, opts); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(f.Name(), path)
+}
+
+// Rotate removes all but the newest keep backup archives in dir.
+func Rotate(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var backups []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), filePrefix) && strings.HasSuffix(e.Name(), fileSuffix) {
+			backups = append(backups, e.Name())
+		}
+	}
+
+	// names embed a sortable timestamp, newest last
+	slices.Sort(backups)
+	for len(backups) > keep {
+		if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+			return err
+		}
+		log.Println("Removed old backup", backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Restore loads an archive written by Create into store. The archive's schema
+// version is checked against the migrations this binary knows about before
+// anything is written. It returns the archive manifest and any warnings.
+func Restore(ctx context.Context, r io.Reader, store *db.DB, opts RestoreOptions) (*Manifest, []string, error) {
+	tmp, err := os.MkdirTemp("", "updog-restore")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	snapPath := filepath.Join(tmp, databaseName)
+	manifest, err := extract(r, snapPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if manifest.FormatVersion != FormatVersion {
+		return manifest, nil, fmt.Errorf("unsupported backup format %d, expected %d", manifest.FormatVersion, FormatVersion)
+	}
+
+	migrations, err := store.LoadMigrations()
+	if err != nil {
+		return manifest, nil, err
+	}
+	latest := migrations[len(migrations)-1].Version
+	if manifest.SchemaVersion > latest {
+		return manifest, nil, fmt.Errorf("backup schema version %d is newer than this updog (%d), upgrade before restoring", manifest.SchemaVersion, latest)
+	}
+
+	snap, err := db.OpenDB("sqlite://" + snapPath)
+	if err != nil {
+		return manifest, nil, err
+	}
+	defer snap.Close()
+
+	version, err := snap.SchemaVersion(ctx)
+	if err != nil {
+		return manifest, nil, err
+	}
+	if version != manifest.SchemaVersion {
+		return manifest, nil, fmt.Errorf("backup is corrupt: manifest schema version %d, database schema version %d", manifest.SchemaVersion, version)
+	}
+
+	if _, err := store.MigrateUp(ctx); err != nil {
+		return manifest, nil, err
+	}
+	if opts.Force {
+		// merging would keep rows the backup doesn't have, and skip those it has under the same keys
+		if err := store.DeleteData(ctx); err != nil {
+			return manifest, nil, err
+		}
+	} else {
+		counts, err := store.TableCounts(ctx)
+		if err != nil {
+			return manifest, nil, err
+		}
+		for table, n := range counts {
+			if n > 0 {
+				return manifest, nil, fmt.Errorf("destination database is not empty (%s has %d rows)", table, n)
+			}
+		}
+	}
+
+	if err := db.CopyData(ctx, snap, store, db.CopyOptions{}); err != nil {
+		return manifest, nil, err
+	}
+
+	mismatches, err := db.ValidateCopy(ctx, snap, store)
+	if err != nil {
+		return manifest, nil, err
+	}
+	if len(mismatches) > 0 {
+		return manifest, nil, fmt.Errorf("restored data doesn't match backup: %s", strings.Join(mismatches, "; "))
+	}
+	var warnings []string
+
+	if opts.JWKSPath != "" && len(manifest.Keys) > 0 {
+		keys, err := auth.ReadKeyMetadata(opts.JWKSPath)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("could not read %s: %v", opts.JWKSPath, err))
+		} else {
+			for _, k := range manifest.Keys {
+				if !slices.ContainsFunc(keys, func(c auth.KeyMetadata) bool { return c.KeyID == k.KeyID }) {
+					warnings = append(warnings, fmt.Sprintf("signing key %q from the backup is not in %s, existing tokens won't validate", k.KeyID, opts.JWKSPath))
+				}
+			}
+		}
+	}
+
+	return manifest, warnings, nil
+}
+
+// extract unpacks the manifest and writes the database to dbPath
+func extract(r io.Reader, dbPath string) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading backup: %w", err)
+	}
+	defer gz.Close()
+
+	var manifest *Manifest
+	haveDB := false
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading backup: %w", err)
+		}
+
+		switch hdr.Name {
+		case manifestName:
+			manifest = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("reading manifest: %w", err)
+			}
+		case databaseName:
+			f, err := os.OpenFile(dbPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return nil, err
+			}
+			if err := f.Close(); err != nil {
+				return nil, err
+			}
+			haveDB = true
+		}
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("backup has no %s", manifestName)
+	}
+	if !haveDB {
+		return nil, fmt.Errorf("backup has no %s", databaseName)
+	}
+	return manifest, nil
+}
+
+func writeJSON(tw *tar.Writer, name string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(b)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(b)
+	return err
+}
+
+func writeFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
@@ -0,0 +1,149 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/db"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/pageview"
+)
+
+func setupTestDB(t *testing.T) *db.DB {
+	store, err := db.NewFileDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create db: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestBackupRestore(t *testing.T) {
+	src := setupTestDB(t)
+	ctx := context.Background()
+
+	d := &domain.Domain{ID: id.NewID(), Name: "example.com"}
+	_, err := src.CreateDomain(ctx, d)
+	assert.NoError(t, err)
+	assert.NoError(t, src.SetValueAsBool(ctx, "disable_signups", true))
+
+	pvs := []*pageview.Pageview{
+		{Timestamp: time.Now().UTC(), DomainID: d.ID, VisitorID: 1},
+		{Timestamp: time.Now().UTC(), DomainID: d.ID, VisitorID: 2},
+	}
+	_, err = src.Db.NewInsert().Model(&pvs).Exec(ctx)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	manifest, err := Create(ctx, src, &buf, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, manifest.Tables["pageviews"])
+	assert.NotZero(t, manifest.SchemaVersion)
+
+	dst := setupTestDB(t)
+	restored, warnings, err := Restore(ctx, bytes.NewReader(buf.Bytes()), dst, RestoreOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, manifest.SchemaVersion, restored.SchemaVersion)
+
+	disabled, err := dst.ReadValueAsBool(ctx, "disable_signups")
+	assert.NoError(t, err)
+	assert.True(t, disabled)
+
+	n, err := dst.CountPageviewsByDomainID(ctx, d.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// refuses to overwrite existing data
+	_, _, err = Restore(ctx, bytes.NewReader(buf.Bytes()), dst, RestoreOptions{})
+	assert.Error(t, err)
+}
+
+func TestRestore_Force(t *testing.T) {
+	src := setupTestDB(t)
+	ctx := context.Background()
+
+	d := &domain.Domain{ID: id.NewID(), Name: "example.com"}
+	_, err := src.CreateDomain(ctx, d)
+	assert.NoError(t, err)
+	_, err = src.Db.NewInsert().Model(&pageview.Pageview{Timestamp: time.Now().UTC(), DomainID: d.ID, VisitorID: 1}).Exec(ctx)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = Create(ctx, src, &buf, Options{})
+	assert.NoError(t, err)
+
+	// the destination has its own rows under the same keys, and rows the backup doesn't
+	dst := setupTestDB(t)
+	_, err = dst.CreateDomain(ctx, &domain.Domain{ID: d.ID, Name: "renamed.example.com"})
+	assert.NoError(t, err)
+	other := &domain.Domain{ID: id.NewID(), Name: "other.example.com"}
+	_, err = dst.CreateDomain(ctx, other)
+	assert.NoError(t, err)
+	pvs := []*pageview.Pageview{
+		{Timestamp: time.Now().UTC(), DomainID: other.ID, VisitorID: 2},
+		{Timestamp: time.Now().UTC(), DomainID: other.ID, VisitorID: 3},
+	}
+	_, err = dst.Db.NewInsert().Model(&pvs).Exec(ctx)
+	assert.NoError(t, err)
+
+	_, warnings, err := Restore(ctx, bytes.NewReader(buf.Bytes()), dst, RestoreOptions{Force: true})
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	restored, err := dst.ReadDomain(ctx, d.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", restored.Name)
+	_, err = dst.ReadDomain(ctx, other.ID)
+	assert.Error(t, err)
+	counts, err := dst.TableCounts(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, counts["domains"])
+	assert.Equal(t, 1, counts["pageviews"])
+}
+
+func TestCreateFile_Unique(t *testing.T) {
+	store := setupTestDB(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	first, err := CreateFile(ctx, store, dir, Options{})
+	assert.NoError(t, err)
+	second, err := CreateFile(ctx, store, dir, Options{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.Less(t, filepath.Base(first), filepath.Base(second))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"updog-backup-20250101-030000.tar.gz",
+		"updog-backup-20250102-030000.tar.gz",
+		"updog-backup-20250103-030000.tar.gz",
+		"unrelated.txt",
+	}
+	for _, n := range names {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, n), nil, 0o600))
+	}
+
+	assert.NoError(t, Rotate(dir, 2))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	assert.ElementsMatch(t, []string{names[1], names[2], names[3]}, left)
+}
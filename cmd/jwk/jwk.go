@@ -1,87 +1,142 @@
 package main
 
 import (
-	crand "crypto/rand"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"math/big"
+	"os"
+	"slices"
 	"time"
 
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
-	"github.com/zackb/updog/user"
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/env"
 )
 
+// Rotating the signing key without downtime:
+//
+//	jwk -add       # add a next key, running servers start accepting it
+//	jwk -promote   # sign with the next key, the old one verifies until its tokens expire
+//	jwk -prune 72h # remove keys retired more than three days ago
 func main() {
-	c := flag.Bool("c", false, "Create a new JWK signing key")
-	clientId := flag.String("api_key", "", "Create a new API Key (ClientId/ClientSecret)")
+	// api keys are created by users under Settings
+	c := flag.Bool("c", false, "Create a new JWK signing key and print it")
+	add := flag.Bool("add", false, "Add a new key to the key set as the next signing key")
+	promote := flag.Bool("promote", false, "Sign with the next key (or -kid) and retire the current one")
+	prune := flag.Duration("prune", 0, "Remove keys retired longer ago than this")
+	list := flag.Bool("list", false, "List the keys in the key set")
+	alg := flag.String("alg", string(jwa.HS256), "Algorithm of new keys: HS256, ES256 or EdDSA")
+	kid := flag.String("kid", "", "Key id, generated for new keys")
+	path := flag.String("f", env.GetJWKSPath(), "Path to the key set")
 	flag.Parse()
 
-	if *c {
-		printNewSymmetricKey()
-	} else if *clientId != "" {
-		printNewApiKey(*clientId)
+	switch {
+	case *c:
+		printNewKey(*alg, *kid)
+	case *add:
+		addKey(*path, *alg, *kid)
+	case *promote:
+		promoteKey(*path, *kid)
+	case *prune > 0:
+		pruneKeys(*path, *prune)
+	case *list:
+		listKeys(*path)
+	default:
+		flag.Usage()
 	}
 }
 
-func printNewApiKey(clientId string) {
-	secret := randomString(32)
-	encryptedSecret, err := user.HashPassword(secret)
-	if err != nil {
-		panic(err)
-	}
-	fmt.Printf("ClientID: %s\n", clientId)
-	fmt.Printf("ClientSecret: %s\n", secret)
-	fmt.Printf("Encrypted ClientSecret: %s\n", encryptedSecret)
-}
-
 func createKeyId() string {
 	t := time.Now()
-	return t.Format("2006-01-02-") + fmt.Sprintf("%d", t.Unix())
+	return t.Format("2006-01-02-") + fmt.Sprintf("%d", t.UnixNano())
 }
 
-func printNewSymmetricKey() {
-	key, err := createSymmetricKey(createKeyId())
+func newKey(alg, kid string) jwk.Key {
+	if !slices.Contains(auth.SigningAlgorithms, jwa.SignatureAlgorithm(alg)) {
+		log.Fatalf("unsupported algorithm %q", alg)
+	}
+	if kid == "" {
+		kid = createKeyId()
+	}
+	key, err := auth.GenerateKey(jwa.SignatureAlgorithm(alg), kid)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	j, err := json.MarshalIndent(key, "", "   ")
+	return key
+}
+
+func printNewKey(alg, kid string) {
+	j, err := json.MarshalIndent(newKey(alg, kid), "", "   ")
 	if err != nil {
 		log.Fatalln(err)
 	}
 	fmt.Println(string(j))
 }
 
-func createSymmetricKey(id string) (jwk.Key, error) {
-	keyData := randomString(312)
-	key, err := jwk.New([]byte(keyData))
-	if err != nil {
-		return nil, err
+// readSet reads the key set at path, a missing file is an empty set
+func readSet(path string) jwk.Set {
+	set, err := jwk.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return jwk.NewSet()
 	}
-	err = key.Set(jwk.KeyIDKey, id)
 	if err != nil {
-		return nil, err
+		log.Fatalln(err)
 	}
+	return set
+}
 
-	err = key.Set(jwk.AlgorithmKey, jwa.HS256)
-	if err != nil {
-		return nil, err
+func writeSet(path string, set jwk.Set) {
+	if err := auth.WriteKeySet(path, set); err != nil {
+		log.Fatalln(err)
 	}
-	return key, nil
 }
 
-func randomString(n int) string {
-	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+func addKey(path, alg, kid string) {
+	set := readSet(path)
+	key := newKey(alg, kid)
+	if _, ok := set.LookupKeyID(key.KeyID()); ok {
+		log.Fatalf("key %q already exists", key.KeyID())
+	}
+	if err := auth.AddKey(set, key); err != nil {
+		log.Fatalln(err)
+	}
+	writeSet(path, set)
+	fmt.Printf("Added %s key %s as %s\n", alg, key.KeyID(), auth.KeyStatus(key))
+}
+
+func promoteKey(path, kid string) {
+	set := readSet(path)
+	if err := auth.PromoteKey(set, kid, time.Now()); err != nil {
+		log.Fatalln(err)
+	}
+	writeSet(path, set)
+	listKeys(path)
+}
 
-	s := make([]rune, n)
-	for i := range s {
-		ri, err := crand.Int(crand.Reader, big.NewInt(int64(len(letters))))
-		if err != nil {
-			log.Fatalln(err)
+func pruneKeys(path string, age time.Duration) {
+	// challenges such as email links signed before the key was retired may still be in use
+	if age < auth.MaxChallengeTTL {
+		log.Fatalf("keys retired less than %s ago still verify email links", auth.MaxChallengeTTL)
+	}
+	set := readSet(path)
+	n := auth.PruneKeys(set, time.Now().Add(-age))
+	writeSet(path, set)
+	fmt.Printf("Removed %d retired key(s)\n", n)
+}
+
+func listKeys(path string) {
+	keys, err := auth.ReadKeyMetadata(path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, k := range keys {
+		status := k.Status
+		if status == "" {
+			status = "-"
 		}
-		s[i] = letters[ri.Int64()]
+		fmt.Printf("%s\t%s\t%s\n", k.KeyID, k.Algorithm, status)
 	}
-	return string(s)
 }
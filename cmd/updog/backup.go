@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/zackb/updog/backup"
+	"github.com/zackb/updog/db"
+	"github.com/zackb/updog/env"
+)
+
+func runBackup(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("o", "", "archive to write (default updog-backup-<timestamp>.tar.gz)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: updog backup [-o file]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	store, err := db.NewDB()
+	if err != nil {
+		log.Fatal("Error initializing storage:", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	opts := backup.Options{JWKSPath: optionalFile(env.GetJWKSPath())}
+
+	if *out == "" {
+		path, err := backup.CreateFile(ctx, store, ".", opts)
+		if err != nil {
+			log.Fatal("Error creating backup:", err)
+		}
+		fmt.Println("Backup written to", path)
+		return
+	}
+
+	f, err := os.OpenFile(*out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Fatal("Error creating backup:", err)
+	}
+	manifest, err := backup.Create(ctx, store, f, opts)
+	if err != nil {
+		f.Close()
+		os.Remove(*out)
+		log.Fatal("Error creating backup:", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal("Error writing backup:", err)
+	}
+	fmt.Printf("Backup written to %s (schema version %d)\n", *out, manifest.SchemaVersion)
+}
+
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := fs.String("i", "", "archive to restore")
+	force := fs.Bool("force", false, "replace the data of a database that isn't empty")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: updog restore -i file [-force]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *in == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		log.Fatal("Error opening backup:", err)
+	}
+	defer f.Close()
+
+	// open without migrating, restore checks the archive version first
+	store, err := db.OpenDB(env.GetDsn())
+	if err != nil {
+		log.Fatal("Error initializing storage:", err)
+	}
+	defer store.Close()
+
+	manifest, warnings, err := backup.Restore(context.Background(), f, store, backup.RestoreOptions{
+		JWKSPath: optionalFile(env.GetJWKSPath()),
+		Force:    *force,
+	})
+	if err != nil {
+		log.Fatal("Error restoring backup:", err)
+	}
+	for _, w := range warnings {
+		fmt.Println("WARNING", w)
+	}
+	fmt.Printf("Restored backup from %s (schema version %d)\n", manifest.CreatedAt.Format(time.RFC3339), manifest.SchemaVersion)
+}
+
+// optionalFile returns path if it exists, so a missing jwks.json doesn't fail backups
+func optionalFile(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/zackb/updog/db"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/pageview"
+)
+
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	domainName := fs.String("domain", "", "domain name to export, e.g. example.com")
+	from := fs.String("from", "", "start date (default 7 days ago)")
+	to := fs.String("to", "", "last day, or an exclusive end time (default now)")
+	format := fs.String("format", "csv", "csv, ndjson or parquet")
+	kind := fs.String("type", "pageviews", "pageviews or daily")
+	out := fs.String("o", "", "file to write (default stdout)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: updog export -domain name [-from date] [-to date] [-format csv|ndjson|parquet] [-type pageviews|daily] [-o file]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *domainName == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	f, err := pageview.ParseExportFormat(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	k, err := pageview.ParseExportKind(*kind)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	start := time.Now().UTC().AddDate(0, 0, -7)
+	end := time.Now().UTC()
+	if *from != "" {
+		if start, err = httpx.ParseTimeParam(*from); err != nil {
+			log.Fatal("Invalid -from: ", err)
+		}
+	}
+	if *to != "" {
+		if end, err = httpx.ParseEndTimeParam(*to); err != nil {
+			log.Fatal("Invalid -to: ", err)
+		}
+	}
+
+	store, err := db.NewDB()
+	if err != nil {
+		log.Fatal("Error initializing storage:", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	d, err := store.DomainStorage().ReadDomainByName(ctx, *domainName)
+	if err != nil {
+		log.Fatalf("Domain %s not found: %v", *domainName, err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Fatal("Error creating output:", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if err := pageview.Export(ctx, store.PageviewStorage(), d.ID, k, f, start, end, w); err != nil {
+		log.Fatal("Error exporting:", err)
+	}
+}
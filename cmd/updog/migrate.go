@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/zackb/updog/db"
+	"github.com/zackb/updog/env"
+)
+
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	steps := fs.Int("steps", 1, "number of migrations to roll back with down")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: updog migrate up|down|status [-steps n]")
+		fs.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	action := args[0]
+	fs.Parse(args[1:])
+
+	// open without auto-migrating so down and status see the real state
+	store, err := db.OpenDB(env.GetDsn())
+	if err != nil {
+		log.Fatal("Error initializing storage:", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+
+	switch action {
+	case "up":
+		n, err := store.MigrateUp(ctx)
+		if err != nil {
+			log.Fatal("Error applying migrations:", err)
+		}
+		fmt.Printf("Applied %d migration(s)\n", n)
+
+	case "down":
+		n, err := store.MigrateDown(ctx, *steps)
+		if err != nil {
+			log.Fatal("Error rolling back migrations:", err)
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", n)
+
+	case "status":
+		status, err := store.MigrationStatus(ctx)
+		if err != nil {
+			log.Fatal("Error reading migration status:", err)
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.Applied {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s %s\n", s.Version, s.Name, applied)
+		}
+
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
@@ -1,22 +1,83 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/zackb/updog/api"
+	"github.com/zackb/updog/apikey"
 	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/backup"
 	"github.com/zackb/updog/db"
 	"github.com/zackb/updog/enrichment"
+	"github.com/zackb/updog/env"
 	"github.com/zackb/updog/frontend"
 	"github.com/zackb/updog/handler"
+	"github.com/zackb/updog/httpx"
 	"github.com/zackb/updog/job"
+	"github.com/zackb/updog/mail"
+	"github.com/zackb/updog/oidc"
 	"github.com/zackb/updog/serve"
+	"github.com/zackb/updog/session"
 	"github.com/zackb/updog/signal"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		case "migrate-db":
+			runMigrateDB(os.Args[2:])
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "backup":
+			runBackup(os.Args[2:])
+			return
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		case "help", "-h", "-help", "--help":
+			usage()
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+			usage()
+			os.Exit(2)
+		}
+	}
+
+	runServer()
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage: updog [command]
+
+Commands:
+  serve                      run the server (default)
+  migrate up|down|status     manage database schema migrations
+  migrate-db -from -to       copy all data between databases (e.g. sqlite to postgres)
+  export -domain name        export pageviews or daily rollups as csv, ndjson or parquet
+  backup [-o file]           write a backup archive of the database
+  restore -i file            restore a backup archive into an empty database`)
+}
+
+func runServer() {
+	// forwarding headers are only believed from these, a bad entry is a config error not something to find out per request
+	proxies, err := httpx.ParseTrustedProxies(env.GetTrustedProxies())
+	if err != nil {
+		log.Fatalf("Error parsing %s: %v", env.EnvTrustedProxies, err)
+	}
+	httpx.SetTrustedProxies(proxies)
+
 	// initialize database
 	store, err := db.NewDB()
 	if err != nil {
@@ -28,31 +89,80 @@ func main() {
 		log.Fatal("Error initializing enricher:", err)
 	}
 
-	// create auth service
-	expHours := time.Duration(100) * time.Hour
-	auth, err := auth.NewAuthService("jwks.json", expHours)
+	// create auth service, access tokens are short-lived and refreshed by sessions
+	auth, err := auth.NewAuthService(env.GetJWKSPath(), env.GetAccessTTL())
 
 	if err != nil {
 		log.Fatal("Error initializing auth service:", err)
 	}
+	auth.SetAPIKeyValidator(apikey.NewValidator(store.APIKeyStorage()))
+	auth.SetRevocationStore(store.RevocationStorage())
+	auth.SetUserChecker(store.UserStorage())
+
+	// rotated keys are picked up without a restart, on SIGHUP or when jwks.json changes
+	signal.Reload(func() {
+		if err := auth.Reload(); err != nil {
+			log.Println("Error reloading json web keys:", err)
+		} else {
+			log.Println("Reloaded json web keys.")
+		}
+	})
+	go auth.WatchKeys(context.Background(), 10*time.Second)
+
+	sessions := session.NewManager(store.SessionStorage(), auth, env.GetSessionTTL())
+
+	// emails are only logged unless an smtp server is configured
+	sender := mail.NewSender()
+	if _, err := mail.BaseURL(); err != nil {
+		log.Println("Warning: confirmation, password reset and invitation emails aren't sent,", err)
+	}
+	if len(proxies) == 0 {
+		log.Printf("Warning: %s isn't set, X-Forwarded-For is ignored and behind a reverse proxy every visitor has its address", env.EnvTrustedProxies)
+	}
 
 	// initialize api
-	api := api.NewAPI(store, auth)
+	api := api.NewAPI(store, auth, sessions, sender)
 
 	// initialize frontend
-	frontend, err := frontend.NewFrontend(auth, store)
+	frontend, err := frontend.NewFrontend(auth, store, sessions, sender)
+
+	// single sign-on
+	if config := oidc.ConfigFromEnv(); config != nil {
+		provider, err := oidc.NewProvider(context.Background(), config, &http.Client{Timeout: 10 * time.Second})
+		if err != nil {
+			log.Fatalln("Failed to set up single sign-on", err)
+		}
+		frontend.SetOIDCProvider(provider)
+		log.Println("Single sign-on with", provider.Issuer())
+	} else if env.IsPasswordLoginDisabled() {
+		log.Fatalf("%s needs single sign-on, set %s", env.EnvDisablePasswordLogin, env.EnvOIDCIssuer)
+	}
 
 	// create http server
 	server := serve.NewHTTPServer(func(mux *http.ServeMux) {
 		frontend.Routes(mux)
-		mux.Handle("/view", handler.Handler(store, store, enricher, false))
-		mux.Handle("/view.gif", handler.Handler(store, store, enricher, true))
-		mux.Handle("/api/", api.Routes())
+		mux.Handle("/view", handler.Handler(store, store, enricher, auth, false))
+		mux.Handle("/view.gif", handler.Handler(store, store, enricher, auth, true))
+		mux.Handle("/link", handler.LinkHandler(store, store, enricher, auth, false))
+		mux.Handle("/link.gif", handler.LinkHandler(store, store, enricher, auth, true))
+		mux.Handle("/engage", handler.EngagementHandler(store, store, enricher, auth, false))
+		mux.Handle("/engage.gif", handler.EngagementHandler(store, store, enricher, auth, true))
+		mux.Handle("/vitals", handler.VitalsHandler(store, store, enricher, auth, false))
+		mux.Handle("/vitals.gif", handler.VitalsHandler(store, store, enricher, auth, true))
+		apiRoutes := api.Routes()
+		mux.Handle("/api/", apiRoutes)
+		mux.Handle("/.well-known/", apiRoutes)
 	})
 
 	// create scheduler
 	scheduler := job.NewScheduler()
 	scheduler.AddDefaultJobs(store)
+	if dir := env.GetBackupDir(); dir != "" {
+		err := scheduler.AddBackupJob(store, dir, env.GetBackupCron(), env.GetBackupKeep(), backup.Options{JWKSPath: env.GetJWKSPath()})
+		if err != nil {
+			log.Println("Error adding backup job to scheduler:", err)
+		}
+	}
 	scheduler.Start()
 
 	sig := signal.Stop(func() {
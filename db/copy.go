@@ -0,0 +1,378 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/apikey"
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/lockout"
+	"github.com/zackb/updog/pageview"
+	"github.com/zackb/updog/session"
+	"github.com/zackb/updog/settings"
+	"github.com/zackb/updog/share"
+	"github.com/zackb/updog/team"
+	"github.com/zackb/updog/user"
+)
+
+const defaultCopyBatchSize = 5000
+
+// CopyOptions controls how CopyData moves rows between databases.
+type CopyOptions struct {
+	// BatchSize is the number of rows read and written per statement.
+	BatchSize int
+}
+
+// tableCopier copies a single table from src to dst, returning the number of rows written.
+type tableCopier struct {
+	table string
+	// serial is true if the table has an autoincrement "id" column whose
+	// sequence needs to be advanced after explicit ids are inserted
+	serial bool
+	copy   func(ctx context.Context, src, dst bun.IDB, batchSize int) (int64, error)
+}
+
+// copyTables lists every table in dependency order, so foreign keys are
+// satisfied as rows are inserted.
+var copyTables = []tableCopier{
+	{table: "users", copy: copyByKey[user.User]("id")},
+	{table: "teams", copy: copyByKey[team.Team]("id")},
+	{table: "team_members", copy: copyByKey[team.Member]("team_id, user_id")},
+	{table: "team_invitations", copy: copyByKey[team.Invitation]("id")},
+	{table: "domains", copy: copyByKey[domain.Domain]("id")},
+	{table: "domain_aliases", copy: copyByKey[domain.Alias]("name")},
+	{table: "tracking_configs", copy: copyByKey[domain.TrackingConfig]("domain_id")},
+	{table: "shared_links", copy: copyByKey[share.Link]("id")},
+	{table: "api_keys", copy: copyByKey[apikey.Key]("id")},
+	{table: "revoked_tokens", copy: copyByKey[auth.RevokedToken]("jti")},
+	{table: "sessions", copy: copyByKey[session.Session]("id")},
+	{table: "refresh_tokens", copy: copyByKey[session.RefreshToken]("token_hash")},
+	{table: "login_attempts", copy: copyByKey[lockout.Attempt]("key")},
+	{table: "settings", copy: copyByKey[settings.Settings]("key")},
+	{table: "countries", serial: true, copy: copyByID(func(m *pageview.Country) int64 { return m.ID })},
+	{table: "regions", serial: true, copy: copyByID(func(m *pageview.Region) int64 { return m.ID })},
+	{table: "cities", serial: true, copy: copyByID(func(m *pageview.City) int64 { return m.ID })},
+	{table: "browsers", serial: true, copy: copyByID(func(m *pageview.Browser) int64 { return m.ID })},
+	{table: "operating_systems", serial: true, copy: copyByID(func(m *pageview.OperatingSystem) int64 { return m.ID })},
+	{table: "device_types", serial: true, copy: copyByID(func(m *pageview.DeviceType) int64 { return m.ID })},
+	{table: "languages", serial: true, copy: copyByID(func(m *pageview.Language) int64 { return m.ID })},
+	{table: "referrers", serial: true, copy: copyByID(func(m *pageview.Referrer) int64 { return m.ID })},
+	{table: "paths", serial: true, copy: copyByID(func(m *pageview.Path) int64 { return m.ID })},
+	{table: "hostnames", serial: true, copy: copyByID(func(m *pageview.Hostname) int64 { return m.ID })},
+	{table: "pageviews", serial: true, copy: copyByID(func(m *pageview.Pageview) int64 { return m.ID })},
+	{table: "daily_pageviews", copy: copyDailyPageviews},
+	{table: "link_clicks", serial: true, copy: copyByID(func(m *pageview.LinkClick) int64 { return m.ID })},
+	{table: "web_vitals", serial: true, copy: copyByID(func(m *pageview.WebVital) int64 { return m.ID })},
+	{table: "daily_web_vitals", copy: copyByKey[pageview.DailyVital]("day, domain_id, path_id, device_type_id, country_id, metric")},
+	{table: "audit_log", serial: true, copy: copyByID(func(m *audit.Entry) int64 { return m.ID })},
+}
+
+// CopyData copies every row from src into dst, preserving primary keys.
+// Both databases are migrated to the latest schema first. Copying is
+// resumable: tables keyed by an integer id continue after the highest id
+// already present in dst, and rows that already exist are skipped.
+func CopyData(ctx context.Context, src, dst *DB, opts CopyOptions) error {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultCopyBatchSize
+	}
+
+	if _, err := src.MigrateUp(ctx); err != nil {
+		return fmt.Errorf("migrating source: %w", err)
+	}
+	if _, err := dst.MigrateUp(ctx); err != nil {
+		return fmt.Errorf("migrating destination: %w", err)
+	}
+
+	return copyAll(ctx, src.Db, dst, opts.BatchSize)
+}
+
+// copyAll copies every table from src, which may be a transaction, into dst.
+func copyAll(ctx context.Context, src bun.IDB, dst *DB, batchSize int) error {
+	for _, t := range copyTables {
+		start := time.Now()
+		n, err := t.copy(ctx, src, dst.Db, batchSize)
+		if err != nil {
+			return fmt.Errorf("copying %s: %w", t.table, err)
+		}
+		log.Printf("Copied %d row(s) into %s in %s", n, t.table, time.Since(start).Round(time.Millisecond))
+
+		if t.serial {
+			if err := dst.resetSequence(ctx, t.table); err != nil {
+				return fmt.Errorf("resetting sequence for %s: %w", t.table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteData empties every table CopyData fills, dependents first, so a copy can
+// replace the data instead of being merged into it. The schema is left alone.
+func (d *DB) DeleteData(ctx context.Context) error {
+	return d.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		for i := len(copyTables) - 1; i >= 0; i-- {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+copyTables[i].table); err != nil {
+				return fmt.Errorf("deleting %s: %w", copyTables[i].table, err)
+			}
+		}
+		return nil
+	})
+}
+
+// copyByKey copies a small table ordered by its primary key, skipping rows
+// that already exist in the destination.
+func copyByKey[T any](key string) func(ctx context.Context, src, dst bun.IDB, batchSize int) (int64, error) {
+	return func(ctx context.Context, src, dst bun.IDB, batchSize int) (int64, error) {
+		var total int64
+		for offset := 0; ; offset += batchSize {
+			var rows []*T
+			err := src.NewSelect().
+				Model(&rows).
+				Order(key + " ASC").
+				Limit(batchSize).
+				Offset(offset).
+				Scan(ctx)
+			if err != nil {
+				return total, err
+			}
+			if len(rows) == 0 {
+				return total, nil
+			}
+
+			res, err := dst.NewInsert().Model(&rows).On("CONFLICT DO NOTHING").Exec(ctx)
+			if err != nil {
+				return total, err
+			}
+			n, _ := res.RowsAffected()
+			total += n
+		}
+	}
+}
+
+// copyByID copies a table keyed by an autoincrement id using keyset
+// pagination, resuming after the highest id already in the destination.
+func copyByID[T any](id func(*T) int64) func(ctx context.Context, src, dst bun.IDB, batchSize int) (int64, error) {
+	return func(ctx context.Context, src, dst bun.IDB, batchSize int) (int64, error) {
+		var last int64
+		err := dst.NewSelect().
+			Model((*T)(nil)).
+			ColumnExpr("COALESCE(MAX(id), 0)").
+			Scan(ctx, &last)
+		if err != nil {
+			return 0, err
+		}
+		if last > 0 {
+			log.Printf("Resuming after id %d", last)
+		}
+
+		var total int64
+		for {
+			var rows []*T
+			err := src.NewSelect().
+				Model(&rows).
+				Where("id > ?", last).
+				Order("id ASC").
+				Limit(batchSize).
+				Scan(ctx)
+			if err != nil {
+				return total, err
+			}
+			if len(rows) == 0 {
+				return total, nil
+			}
+
+			res, err := dst.NewInsert().Model(&rows).On("CONFLICT DO NOTHING").Exec(ctx)
+			if err != nil {
+				return total, err
+			}
+			n, _ := res.RowsAffected()
+			total += n
+			last = id(rows[len(rows)-1])
+		}
+	}
+}
+
+// copyDailyPageviews copies the rollup table one day at a time, resuming from
+// the latest day already in the destination.
+func copyDailyPageviews(ctx context.Context, src, dst bun.IDB, batchSize int) (int64, error) {
+	var resume []time.Time
+	err := dst.NewSelect().
+		Model((*pageview.DailyPageview)(nil)).
+		Column("day").
+		Order("day DESC").
+		Limit(1).
+		Scan(ctx, &resume)
+	if err != nil {
+		return 0, err
+	}
+
+	q := src.NewSelect().
+		Model((*pageview.DailyPageview)(nil)).
+		Column("day").
+		Distinct().
+		Order("day ASC")
+	if len(resume) > 0 {
+		log.Printf("Resuming from day %s", resume[0].Format("2006-01-02"))
+		q = q.Where("day >= ?", resume[0].Format("2006-01-02"))
+	}
+
+	var days []time.Time
+	if err := q.Scan(ctx, &days); err != nil {
+		return 0, err
+	}
+
+	// compare days as YYYY-MM-DD strings, sqlite may store them with or
+	// without a time component depending on how they were written
+	var total int64
+	for _, day := range days {
+		from, to := day.Format("2006-01-02"), day.AddDate(0, 0, 1).Format("2006-01-02")
+		for offset := 0; ; offset += batchSize {
+			var rows []*pageview.DailyPageview
+			err := src.NewSelect().
+				Model(&rows).
+				Where("day >= ?", from).
+				Where("day < ?", to).
+				Order("domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id",
+					"device_type_id", "language_id", "referrer_id", "path_id", "hostname_id").
+				Limit(batchSize).
+				Offset(offset).
+				Scan(ctx)
+			if err != nil {
+				return total, err
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			res, err := dst.NewInsert().Model(&rows).On("CONFLICT DO NOTHING").Exec(ctx)
+			if err != nil {
+				return total, err
+			}
+			n, _ := res.RowsAffected()
+			total += n
+		}
+	}
+	return total, nil
+}
+
+// resetSequence advances a postgres serial sequence past explicitly inserted ids.
+// sqlite's AUTOINCREMENT already tracks the highest id so it's a no-op there.
+func (d *DB) resetSequence(ctx context.Context, table string) error {
+	if d.Db.Dialect().Name().String() == "sqlite" {
+		return nil
+	}
+	_, err := d.Db.ExecContext(ctx, fmt.Sprintf(
+		`SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL) FROM %s`,
+		table, table))
+	return err
+}
+
+// TableCounts returns the number of rows in every copied table.
+func (d *DB) TableCounts(ctx context.Context) (map[string]int, error) {
+	counts := make(map[string]int, len(copyTables))
+	for _, t := range copyTables {
+		n, err := d.Db.NewSelect().Table(t.table).Count(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("counting %s: %w", t.table, err)
+		}
+		counts[t.table] = n
+	}
+	return counts, nil
+}
+
+// ValidateCopy compares row counts for every copied table and per-day
+// pageview totals between src and dst, returning a description of each mismatch.
+func ValidateCopy(ctx context.Context, src, dst *DB) ([]string, error) {
+	var mismatches []string
+
+	srcCounts, err := src.TableCounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading source: %w", err)
+	}
+	dstCounts, err := dst.TableCounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading destination: %w", err)
+	}
+	for _, t := range copyTables {
+		if srcCounts[t.table] != dstCounts[t.table] {
+			mismatches = append(mismatches, fmt.Sprintf("%s: %d rows in source, %d in destination", t.table, srcCounts[t.table], dstCounts[t.table]))
+		}
+	}
+
+	for _, totals := range []struct {
+		name string
+		fn   func(context.Context, *DB) (map[string]int64, error)
+	}{
+		{"pageviews", dailyPageviewTotals},
+		{"daily_pageviews", dailyRollupTotals},
+	} {
+		srcTotals, err := totals.fn(ctx, src)
+		if err != nil {
+			return nil, fmt.Errorf("reading source %s totals: %w", totals.name, err)
+		}
+		dstTotals, err := totals.fn(ctx, dst)
+		if err != nil {
+			return nil, fmt.Errorf("reading destination %s totals: %w", totals.name, err)
+		}
+		for day, n := range srcTotals {
+			if dstTotals[day] != n {
+				mismatches = append(mismatches, fmt.Sprintf("%s on %s: %d in source, %d in destination", totals.name, day, n, dstTotals[day]))
+			}
+		}
+		for day, n := range dstTotals {
+			if _, ok := srcTotals[day]; !ok {
+				mismatches = append(mismatches, fmt.Sprintf("%s on %s: 0 in source, %d in destination", totals.name, day, n))
+			}
+		}
+	}
+
+	return mismatches, nil
+}
+
+type dayTotal struct {
+	Day   time.Time `bun:"day"`
+	Total int64     `bun:"total"`
+}
+
+// dailyPageviewTotals counts raw pageviews per UTC day.
+func dailyPageviewTotals(ctx context.Context, d *DB) (map[string]int64, error) {
+	var rows []dayTotal
+	dayExpr := d.dateTrunc("day", "ts")
+	err := d.Db.NewSelect().
+		Model((*pageview.Pageview)(nil)).
+		ColumnExpr(dayExpr+" AS day").
+		ColumnExpr("COUNT(*) AS total").
+		GroupExpr(dayExpr).
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+	return dayTotalsMap(rows), nil
+}
+
+// dailyRollupTotals sums rolled up pageviews per day.
+func dailyRollupTotals(ctx context.Context, d *DB) (map[string]int64, error) {
+	var rows []dayTotal
+	err := d.Db.NewSelect().
+		Model((*pageview.DailyPageview)(nil)).
+		Column("day").
+		ColumnExpr("SUM(count) AS total").
+		Group("day").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+	return dayTotalsMap(rows), nil
+}
+
+func dayTotalsMap(rows []dayTotal) map[string]int64 {
+	m := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		m[r.Day.UTC().Format("2006-01-02")] += r.Total
+	}
+	return m
+}
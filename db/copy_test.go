@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/pageview"
+	"github.com/zackb/updog/user"
+)
+
+func TestCopyData(t *testing.T) {
+	src := setupTestDB(t)
+	dst := setupTestDB(t)
+	ctx := context.Background()
+
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	u := &user.User{ID: id.NewID(), Email: "zack@example.com", Name: "Zack", Initials: "Z", CreatedAt: created}
+	assert.NoError(t, src.CreateUser(ctx, u))
+
+	d := &domain.Domain{ID: id.NewID(), Name: "example.com", UserID: u.ID, Verified: true}
+	_, err := src.CreateDomain(ctx, d)
+	assert.NoError(t, err)
+	assert.NoError(t, src.SetValueAsBool(ctx, "disable_signups", true))
+
+	// leave a gap in ids so we can check they're preserved
+	path := &pageview.Path{ID: 42, Path: "/hello"}
+	_, err = src.Db.NewInsert().Model(path).Exec(ctx)
+	assert.NoError(t, err)
+
+	day := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	var pvs []*pageview.Pageview
+	for i := 0; i < 7; i++ {
+		pvs = append(pvs, &pageview.Pageview{
+			Timestamp: day.Add(time.Duration(i) * time.Hour),
+			DomainID:  d.ID,
+			PathID:    path.ID,
+			VisitorID: int64(i % 3),
+		})
+	}
+	_, err = src.Db.NewInsert().Model(&pvs).Exec(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, src.RunDailyRollup(ctx, day))
+
+	// small batches to exercise pagination
+	err = CopyData(ctx, src, dst, CopyOptions{BatchSize: 2})
+	assert.NoError(t, err)
+
+	mismatches, err := ValidateCopy(ctx, src, dst)
+	assert.NoError(t, err)
+	assert.Empty(t, mismatches)
+
+	copied, err := dst.ReadUser(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.True(t, created.Equal(copied.CreatedAt.UTC()), "created_at should be preserved")
+
+	var copiedPath pageview.Path
+	err = dst.Db.NewSelect().Model(&copiedPath).Where("path = ?", "/hello").Scan(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), copiedPath.ID)
+
+	// running again resumes and writes nothing new
+	err = CopyData(ctx, src, dst, CopyOptions{BatchSize: 2})
+	assert.NoError(t, err)
+	n, err := dst.CountPageviewsByDomainID(ctx, d.ID, day, day.AddDate(0, 0, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, 7, n)
+
+	// a missing row is reported
+	_, err = dst.Db.NewDelete().Model((*pageview.Pageview)(nil)).Where("id = ?", pvs[0].ID).Exec(ctx)
+	assert.NoError(t, err)
+	mismatches, err = ValidateCopy(ctx, src, dst)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, mismatches)
+}
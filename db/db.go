@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log"
 	"strings"
 
 	_ "github.com/lib/pq"
@@ -13,10 +14,17 @@ import (
 	"github.com/uptrace/bun/dialect/pgdialect"
 	"github.com/uptrace/bun/dialect/sqlitedialect"
 	"github.com/uptrace/bun/extra/bundebug"
+	"github.com/zackb/updog/apikey"
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/auth"
 	"github.com/zackb/updog/domain"
 	"github.com/zackb/updog/env"
+	"github.com/zackb/updog/lockout"
 	"github.com/zackb/updog/pageview"
+	"github.com/zackb/updog/session"
 	"github.com/zackb/updog/settings"
+	"github.com/zackb/updog/share"
+	"github.com/zackb/updog/team"
 	"github.com/zackb/updog/user"
 )
 
@@ -25,9 +33,26 @@ type DB struct {
 	Db    *bun.DB
 }
 
+// NewDB connects to the database configured by DATABASE_URL and applies any pending migrations.
 func NewDB() (*DB, error) {
-	dsn := env.GetDsn()
+	db, err := OpenDB(env.GetDsn())
+	if err != nil {
+		return nil, err
+	}
+	return migrate(db)
+}
+
+// NewFileDB opens a sqlite database at path and applies any pending migrations.
+func NewFileDB(path string) (*DB, error) {
+	db, err := openSqlite("file:" + path + "?cache=shared&_fk=1")
+	if err != nil {
+		return nil, err
+	}
+	return migrate(db)
+}
 
+// OpenDB connects to the database without touching its schema.
+func OpenDB(dsn string) (*DB, error) {
 	driver := strings.SplitN(dsn, "://", 2)[0]
 
 	switch driver {
@@ -44,27 +69,27 @@ func NewDB() (*DB, error) {
 		// default to sqlite
 		if dsn == "" {
 			dsn = "file:db.db?cache=shared&_fk=1"
+		} else if path, ok := strings.CutPrefix(dsn, "sqlite://"); ok {
+			// Example: sqlite://data/updog.db
+			dsn = "file:" + path
+			if !strings.Contains(path, "?") {
+				dsn += "?cache=shared&_fk=1"
+			}
 		}
-		sqldb, err := sql.Open("sqlite3", dsn)
-		if err != nil {
-			return nil, err
-		}
-		db := bun.NewDB(sqldb, sqlitedialect.New())
-		return setupDB(sqldb, db)
+		return openSqlite(dsn)
 
 	default:
 		return nil, fmt.Errorf("unsupported DB_DRIVER: %s", driver)
 	}
 }
 
-func NewFileDB(path string) (*DB, error) {
-	sqldb, err := sql.Open("sqlite3", "file:"+path+"?cache=shared&_fk=1")
+func openSqlite(dsn string) (*DB, error) {
+	sqldb, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
 	db := bun.NewDB(sqldb, sqlitedialect.New())
 	return setupDB(sqldb, db)
-
 }
 
 func (db *DB) UserStorage() user.Storage {
@@ -83,6 +108,34 @@ func (db *DB) SettingsStorage() settings.Storage {
 	return db
 }
 
+func (db *DB) AuditStorage() audit.Storage {
+	return db
+}
+
+func (db *DB) TeamStorage() team.Storage {
+	return db
+}
+
+func (db *DB) ShareStorage() share.Storage {
+	return db
+}
+
+func (db *DB) APIKeyStorage() apikey.Storage {
+	return db
+}
+
+func (db *DB) RevocationStorage() auth.RevocationStore {
+	return db
+}
+
+func (db *DB) SessionStorage() session.Storage {
+	return db
+}
+
+func (db *DB) LockoutStorage() lockout.Storage {
+	return db
+}
+
 func setupDB(sqldb *sql.DB, db *bun.DB) (*DB, error) {
 	ctx := context.Background()
 
@@ -91,16 +144,6 @@ func setupDB(sqldb *sql.DB, db *bun.DB) (*DB, error) {
 		db.AddQueryHook(bundebug.NewQueryHook(bundebug.WithVerbose(true)))
 	}
 
-	// autocreate tables
-	if err := CreateTables(db); err != nil {
-		return nil, err
-	}
-
-	// create indexes
-	if err := CreateIndexes(db); err != nil {
-		return nil, err
-	}
-
 	// test connection
 	if err := db.PingContext(ctx); err != nil {
 		return nil, err
@@ -112,98 +155,16 @@ func setupDB(sqldb *sql.DB, db *bun.DB) (*DB, error) {
 	}, nil
 }
 
-func CreateTables(db *bun.DB) error {
-	models := []any{
-		(*user.User)(nil),
-		(*domain.Domain)(nil),
-		(*settings.Settings)(nil),
-		(*pageview.Country)(nil),
-		(*pageview.Region)(nil),
-		(*pageview.City)(nil),
-		(*pageview.Browser)(nil),
-		(*pageview.OperatingSystem)(nil),
-		(*pageview.DeviceType)(nil),
-		(*pageview.Language)(nil),
-		(*pageview.Referrer)(nil),
-		(*pageview.Path)(nil),
-		(*pageview.Pageview)(nil),
-		(*pageview.DailyPageview)(nil),
-	}
-
-	for _, m := range models {
-		if _, err := db.NewCreateTable().
-			Model(m).
-			IfNotExists().
-			Exec(context.Background()); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func CreateIndexes(db *bun.DB) error {
-
-	// create index on users.email
-	if _, err := db.NewCreateIndex().
-		Model((*user.User)(nil)).
-		Index("ux_users_email").
-		Unique().
-		Column("email").
-		IfNotExists().
-		Exec(context.Background()); err != nil {
-		return err
-	}
-
-	// create index on domains.name
-	if _, err := db.NewCreateIndex().
-		Model((*domain.Domain)(nil)).
-		Index("ux_domains_name").
-		Unique().
-		Column("name").
-		IfNotExists().
-		Exec(context.Background()); err != nil {
-		return err
-	}
-
-	// create index on domains.id + ts
-	_, err := db.ExecContext(
-		context.Background(),
-		`CREATE INDEX IF NOT EXISTS idx_pageviews_domain_ts 
-         ON pageviews (domain_id, ts DESC);`,
-	)
-
-	// create index on daily_pageviews
-	_, err = db.ExecContext(
-		context.Background(),
-		`CREATE INDEX IF NOT EXISTS idx_daily_pageviews_domain_day 
-		 ON daily_pageviews (domain_id, day DESC);`,
-	)
-
-	// unique on region, country_id
-	if _, err := db.NewCreateIndex().
-		Model((*pageview.Region)(nil)).
-		Index("ux_regions_country_id_name").
-		Unique().
-		Column("country_id").
-		Column("name").
-		IfNotExists().
-		Exec(context.Background()); err != nil {
-		return err
+func migrate(db *DB) (*DB, error) {
+	n, err := db.MigrateUp(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, err
 	}
-
-	// unique on city, region_id
-	if _, err := db.NewCreateIndex().
-		Model((*pageview.City)(nil)).
-		Index("ux_cities_region_id_name").
-		Unique().
-		Column("region_id").
-		Column("name").
-		IfNotExists().
-		Exec(context.Background()); err != nil {
-		return err
+	if n > 0 {
+		log.Printf("Applied %d database migration(s)", n)
 	}
-
-	return err
+	return db, nil
 }
 
 // GetOrCreateDimension tries to get a record by name, and creates it if not found.
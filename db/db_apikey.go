@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/zackb/updog/apikey"
+)
+
+func (db *DB) CreateKey(ctx context.Context, k *apikey.Key) error {
+	_, err := db.Db.NewInsert().Model(k).Exec(ctx)
+	return err
+}
+
+func (db *DB) ReadKeyByHash(ctx context.Context, hash string) (*apikey.Key, error) {
+	k := &apikey.Key{}
+	err := db.Db.NewSelect().
+		Model(k).
+		Relation("User").
+		Where("key_hash = ?", hash).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (db *DB) ListKeysByUser(ctx context.Context, userID string) ([]*apikey.Key, error) {
+	var keys []*apikey.Key
+	err := db.Db.NewSelect().
+		Model(&keys).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (db *DB) DeleteKey(ctx context.Context, userID, keyID string) error {
+	_, err := db.Db.NewDelete().
+		Model((*apikey.Key)(nil)).
+		Where("id = ?", keyID).
+		Where("user_id = ?", userID).
+		Exec(ctx)
+	return err
+}
+
+func (db *DB) TouchKey(ctx context.Context, keyID string, usedAt time.Time) error {
+	_, err := db.Db.NewUpdate().
+		Model((*apikey.Key)(nil)).
+		Set("last_used_at = ?", usedAt).
+		Where("id = ?", keyID).
+		Exec(ctx)
+	return err
+}
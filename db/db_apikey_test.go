@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/apikey"
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/user"
+)
+
+func TestValidateAPIKey(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	u := &user.User{Email: "alice@example.com"}
+	assert.NoError(t, db.CreateUser(ctx, u))
+
+	k, secret := apikey.New(u.ID, "ci", []string{auth.ScopeStatsRead, auth.ScopeAccount}, "domain-1")
+	assert.NoError(t, db.CreateKey(ctx, k))
+
+	v := apikey.NewValidator(db)
+	token, err := v.ValidateAPIKey(ctx, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, u.ID, token.ClientId)
+	assert.True(t, token.HasScope(auth.ScopeStatsRead))
+	// account scope can't be granted to a key
+	assert.False(t, token.HasScope(auth.ScopeAccount))
+	assert.False(t, token.HasScope(auth.ScopeDomainsManage))
+	assert.True(t, token.AllowsDomain("domain-1"))
+	assert.False(t, token.AllowsDomain("domain-2"))
+
+	keys, err := db.ListKeysByUser(ctx, u.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, keys, 1) {
+		assert.False(t, keys[0].LastUsedAt.IsZero())
+	}
+
+	_, err = v.ValidateAPIKey(ctx, secret+"x")
+	assert.ErrorIs(t, err, apikey.ErrInvalidKey)
+
+	// disabled users' keys stop working
+	u.Disabled = true
+	assert.NoError(t, db.UpdateUser(ctx, u))
+	_, err = v.ValidateAPIKey(ctx, secret)
+	assert.ErrorIs(t, err, apikey.ErrInvalidKey)
+
+	assert.NoError(t, db.DeleteKey(ctx, u.ID, k.ID))
+	keys, err = db.ListKeysByUser(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/pageview"
+)
+
+func (db *DB) CreateAuditEntry(ctx context.Context, e *audit.Entry) error {
+	_, err := db.Db.NewInsert().Model(e).Exec(ctx)
+	return err
+}
+
+func (db *DB) ListAuditEntries(ctx context.Context, f audit.Filter, limit, offset int) ([]*audit.Entry, error) {
+	var entries []*audit.Entry
+	q := db.Db.NewSelect().Model(&entries)
+	if f.ActorID != "" {
+		q = q.Where("actor_id = ?", f.ActorID)
+	}
+	if f.IsCategory() {
+		q = q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("action = ?", f.Action).WhereOr(`action LIKE ? ESCAPE '\'`, pageview.GlobToLike(f.Action+".*"))
+		})
+	} else if f.Action != "" {
+		q = q.Where("action = ?", f.Action)
+	}
+	if f.TargetType != "" {
+		q = q.Where("target_type = ?", f.TargetType)
+	}
+	if f.TargetID != "" {
+		q = q.Where("target_id = ?", f.TargetID)
+	}
+	if !f.From.IsZero() {
+		q = q.Where("ts >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		q = q.Where("ts < ?", f.To)
+	}
+	err := q.
+		Order("ts DESC", "id DESC").
+		Limit(limit).
+		Offset(offset).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/audit"
+)
+
+func TestListAuditEntriesFilter(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for _, e := range []*audit.Entry{
+		{Timestamp: now.Add(-3 * time.Hour), ActorID: "alice", Action: audit.ActionDomainCreate, TargetType: audit.TargetDomain, TargetID: "d1"},
+		{Timestamp: now.Add(-2 * time.Hour), ActorID: "alice", Action: audit.ActionDomainVerify, TargetType: audit.TargetDomain, TargetID: "d1"},
+		{Timestamp: now.Add(-time.Hour), ActorID: "bob", Action: audit.ActionLogin, TargetType: audit.TargetUser, TargetID: "bob"},
+		{Timestamp: now, ActorID: "alice", Action: audit.ActionSettingsUpdate, TargetType: audit.TargetSetting, TargetID: "disable_signups"},
+	} {
+		assert.NoError(t, db.CreateAuditEntry(ctx, e))
+	}
+
+	actions := func(f audit.Filter, limit, offset int) []string {
+		entries, err := db.ListAuditEntries(ctx, f, limit, offset)
+		assert.NoError(t, err)
+		var actions []string
+		for _, e := range entries {
+			actions = append(actions, e.Action)
+		}
+		return actions
+	}
+
+	// newest first
+	assert.Equal(t, []string{audit.ActionSettingsUpdate, audit.ActionLogin, audit.ActionDomainVerify, audit.ActionDomainCreate}, actions(audit.Filter{}, 10, 0))
+	assert.Equal(t, []string{audit.ActionLogin, audit.ActionDomainVerify}, actions(audit.Filter{}, 2, 1))
+
+	assert.Equal(t, []string{audit.ActionLogin}, actions(audit.Filter{ActorID: "bob"}, 10, 0))
+	assert.Equal(t, []string{audit.ActionDomainVerify}, actions(audit.Filter{Action: audit.ActionDomainVerify}, 10, 0))
+	// a category matches each of its actions
+	assert.Equal(t, []string{audit.ActionDomainVerify, audit.ActionDomainCreate}, actions(audit.Filter{Action: "domain"}, 10, 0))
+	assert.Empty(t, actions(audit.Filter{Action: "dom"}, 10, 0))
+	assert.Equal(t, []string{audit.ActionSettingsUpdate}, actions(audit.Filter{TargetType: audit.TargetSetting, TargetID: "disable_signups"}, 10, 0))
+	assert.Equal(t, []string{audit.ActionLogin, audit.ActionDomainVerify}, actions(audit.Filter{From: now.Add(-150 * time.Minute), To: now.Add(-time.Minute)}, 10, 0))
+}
@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/zackb/updog/auth"
+)
+
+func (db *DB) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := db.Db.NewInsert().
+		Model(&auth.RevokedToken{JTI: jti, ExpiresAt: expiresAt, RevokedAt: time.Now().UTC()}).
+		On("CONFLICT DO NOTHING").
+		Exec(ctx)
+	return err
+}
+
+func (db *DB) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return db.Db.NewSelect().
+		Model((*auth.RevokedToken)(nil)).
+		Where("jti = ?", jti).
+		Exists(ctx)
+}
+
+func (db *DB) DeleteExpiredRevocations(ctx context.Context, now time.Time) (int, error) {
+	res, err := db.Db.NewDelete().
+		Model((*auth.RevokedToken)(nil)).
+		Where("expires_at < ?", now).
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -2,8 +2,16 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"time"
 
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/apikey"
 	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/pageview"
+	"github.com/zackb/updog/share"
+	"github.com/zackb/updog/team"
 )
 
 func (db *DB) CreateDomain(ctx context.Context, fb *domain.Domain) (*domain.Domain, error) {
@@ -32,8 +40,35 @@ func (db *DB) ReadDomainByName(ctx context.Context, name string) (*domain.Domain
 	return fb, nil
 }
 
+func (db *DB) UpdateDomain(ctx context.Context, d *domain.Domain) error {
+	_, err := db.Db.NewUpdate().Model(d).WherePK().Exec(ctx)
+	return err
+}
+
+// DeleteDomain removes a domain along with all of its pageviews and rollups
 func (db *DB) DeleteDomain(ctx context.Context, domainID string) error {
-	_, err := db.Db.NewDelete().Model((*domain.Domain)(nil)).Where("id = ?", domainID).Exec(ctx)
+	return db.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return deleteDomain(ctx, tx, domainID)
+	})
+}
+
+func deleteDomain(ctx context.Context, tx bun.Tx, domainID string) error {
+	for _, model := range []any{
+		(*pageview.DailyPageview)(nil),
+		(*pageview.Pageview)(nil),
+		(*pageview.LinkClick)(nil),
+		(*pageview.DailyVital)(nil),
+		(*pageview.WebVital)(nil),
+		(*share.Link)(nil),
+		(*apikey.Key)(nil),
+		(*domain.Alias)(nil),
+		(*domain.TrackingConfig)(nil),
+	} {
+		if _, err := tx.NewDelete().Model(model).Where("domain_id = ?", domainID).Exec(ctx); err != nil {
+			return err
+		}
+	}
+	_, err := tx.NewDelete().Model((*domain.Domain)(nil)).Where("id = ?", domainID).Exec(ctx)
 	return err
 }
 
@@ -50,7 +85,24 @@ func (db *DB) ListDomainsByUser(ctx context.Context, userID string) ([]*domain.D
 	var domains []*domain.Domain
 	err := db.Db.NewSelect().
 		Model(&domains).
-		Where("user_id = ?", userID).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("user_id = ?", userID).
+				WhereOr("team_id IN (SELECT team_id FROM team_members WHERE user_id = ?)", userID)
+		}).
+		Order("created_at DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+func (db *DB) ListDomainsByTeam(ctx context.Context, teamID string) ([]*domain.Domain, error) {
+	var domains []*domain.Domain
+	err := db.Db.NewSelect().
+		Model(&domains).
+		Where("team_id = ?", teamID).
 		Order("created_at DESC").
 		Scan(ctx)
 	if err != nil {
@@ -58,11 +110,133 @@ func (db *DB) ListDomainsByUser(ctx context.Context, userID string) ([]*domain.D
 	}
 	return domains, nil
 }
-func (db *DB) VerifyDomain(ctx context.Context, domainID string) error {
+
+func (db *DB) ReadDomainForUser(ctx context.Context, domainID, userID string) (*domain.Domain, string, error) {
+	d, err := db.ReadDomain(ctx, domainID)
+	if err != nil {
+		return nil, "", err
+	}
+	if d.UserID == userID {
+		return d, team.RoleOwner, nil
+	}
+	if d.TeamID == "" {
+		return d, "", nil
+	}
+
+	m, err := db.ReadMember(ctx, d.TeamID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return d, m.Role, nil
+}
+
+func (db *DB) ListVerifiedDomains(ctx context.Context) ([]*domain.Domain, error) {
+	var domains []*domain.Domain
+	err := db.Db.NewSelect().Model(&domains).Where("verified = ?", true).Order("created_at").Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+func (db *DB) UpdateVerification(ctx context.Context, d *domain.Domain) error {
+	_, err := db.Db.NewUpdate().
+		Model(d).
+		Column("verified", "verification_method", "verified_at", "verification_checked_at", "verification_failures", "verification_error").
+		WherePK().
+		Exec(ctx)
+	return err
+}
+
+func (db *DB) ReadDomainByAlias(ctx context.Context, name string) (*domain.Domain, error) {
+	d := &domain.Domain{}
+	err := db.Db.NewSelect().
+		Model(d).
+		Where("id = (SELECT domain_id FROM domain_aliases WHERE name = ?)", name).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (db *DB) ReadAlias(ctx context.Context, name string) (*domain.Alias, error) {
+	a := &domain.Alias{}
+	if err := db.Db.NewSelect().Model(a).Where("name = ?", name).Scan(ctx); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (db *DB) ListAliases(ctx context.Context, domainID string) ([]*domain.Alias, error) {
+	aliases := []*domain.Alias{}
+	err := db.Db.NewSelect().
+		Model(&aliases).
+		Where("domain_id = ?", domainID).
+		Order("name").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+func (db *DB) SetAliases(ctx context.Context, domainID string, names []string) error {
+	return db.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		q := tx.NewDelete().Model((*domain.Alias)(nil)).Where("domain_id = ?", domainID)
+		if len(names) > 0 {
+			q = q.Where("name NOT IN (?)", bun.In(names))
+		}
+		if _, err := q.Exec(ctx); err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return nil
+		}
+		aliases := make([]*domain.Alias, len(names))
+		for i, name := range names {
+			aliases[i] = &domain.Alias{Name: name, DomainID: domainID, CreatedAt: time.Now()}
+		}
+		// the ones kept are left as they are
+		_, err := tx.NewInsert().Model(&aliases).On("CONFLICT (name) DO NOTHING").Exec(ctx)
+		return err
+	})
+}
+
+func (db *DB) UpdateAlias(ctx context.Context, a *domain.Alias) error {
 	_, err := db.Db.NewUpdate().
-		Model(&domain.Domain{ID: domainID}).
-		Set("verified = TRUE").
+		Model(a).
+		Column("verified", "verification_method", "verified_at").
 		WherePK().
 		Exec(ctx)
 	return err
 }
+
+func (db *DB) ReadTrackingConfig(ctx context.Context, domainID string) (*domain.TrackingConfig, error) {
+	c := &domain.TrackingConfig{}
+	err := db.Db.NewSelect().Model(c).Where("domain_id = ?", domainID).Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (db *DB) SaveTrackingConfig(ctx context.Context, c *domain.TrackingConfig) error {
+	c.UpdatedAt = time.Now()
+	_, err := db.Db.NewInsert().
+		Model(c).
+		On("CONFLICT (domain_id) DO UPDATE").
+		Set("hash_routing = EXCLUDED.hash_routing").
+		Set("track_outbound = EXCLUDED.track_outbound").
+		Set("track_downloads = EXCLUDED.track_downloads").
+		Set("track_vitals = EXCLUDED.track_vitals").
+		Set("download_extensions = EXCLUDED.download_extensions").
+		Set("excluded_paths = EXCLUDED.excluded_paths").
+		Set("query_params = EXCLUDED.query_params").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(ctx)
+	return err
+}
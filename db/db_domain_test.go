@@ -0,0 +1,232 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/pageview"
+	"github.com/zackb/updog/user"
+)
+
+type txtRecords map[string][]string
+
+func (t txtRecords) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return t[name], nil
+}
+
+type offline struct{}
+
+func (offline) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("offline")
+}
+
+func TestReverifyDomains(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	kept := &domain.Domain{ID: id.NewID(), Name: "kept.com", VerificationToken: "k"}
+	kept.MarkVerified(domain.MethodDNS, now)
+	gone := &domain.Domain{ID: id.NewID(), Name: "gone.com", VerificationToken: "g"}
+	gone.MarkVerified(domain.MethodDNS, now)
+	unverified := &domain.Domain{ID: id.NewID(), Name: "new.com"}
+	for _, d := range []*domain.Domain{kept, gone, unverified} {
+		_, err := db.CreateDomain(ctx, d)
+		assert.NoError(t, err)
+	}
+
+	v := &domain.Verifier{
+		Client:   &http.Client{Transport: offline{}},
+		Resolver: txtRecords{"kept.com": {"updog-verification=k"}},
+	}
+
+	// a domain is only unverified after failing several checks in a row
+	for i := 1; i <= domain.ReverifyFailures; i++ {
+		checked, n, err := domain.Reverify(ctx, db, db, v, now.Add(time.Duration(i)*24*time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, checked)
+
+		d, err := db.ReadDomain(ctx, gone.ID)
+		assert.NoError(t, err)
+		if i < domain.ReverifyFailures {
+			assert.Zero(t, n)
+			assert.True(t, d.Verified)
+			assert.Equal(t, i, d.VerificationFailures)
+		} else {
+			assert.Equal(t, 1, n)
+			assert.False(t, d.Verified)
+			assert.Empty(t, d.VerificationMethod)
+		}
+		assert.Contains(t, d.VerificationError, `no TXT record "updog-verification=g" found for gone.com`)
+	}
+
+	d, err := db.ReadDomain(ctx, kept.ID)
+	assert.NoError(t, err)
+	assert.True(t, d.Verified)
+	assert.Zero(t, d.VerificationFailures)
+	assert.Equal(t, domain.MethodDNS, d.VerificationMethod)
+
+	entries, err := db.ListAuditEntries(ctx, audit.Filter{Action: audit.ActionDomainUnverify}, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, gone.ID, entries[0].TargetID)
+	}
+}
+
+func TestResolveHostnames(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	site := &domain.Domain{ID: id.NewID(), Name: "example.com", IncludeSubdomains: true}
+	blog := &domain.Domain{ID: id.NewID(), Name: "blog.example.com"}
+	other := &domain.Domain{ID: id.NewID(), Name: "other.com"}
+	for _, d := range []*domain.Domain{site, blog, other} {
+		_, err := db.CreateDomain(ctx, d)
+		assert.NoError(t, err)
+	}
+
+	aliases, err := domain.ParseAliases(ctx, db, site, []string{"WWW.example.net", "", "www.example.net", "https://example.org/"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.org", "www.example.net"}, aliases)
+	assert.NoError(t, db.SetAliases(ctx, site.ID, aliases))
+
+	// aliases count once they publish the domain's token
+	_, err = domain.Resolve(ctx, db, "www.example.net")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	v := &domain.Verifier{Resolver: txtRecords{
+		"www.example.net": {site.VerificationTXT()},
+		"example.org":     {"updog-verification=someone-else"},
+	}}
+	method, err := domain.VerifyAlias(ctx, db, v, site, "www.example.net", "")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.MethodDNS, method)
+	_, err = domain.VerifyAlias(ctx, db, v, site, "example.org", domain.MethodDNS)
+	assert.ErrorIs(t, err, domain.ErrNotVerified)
+	_, err = domain.VerifyAlias(ctx, db, v, other, "www.example.net", domain.MethodDNS)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// and stay verified while they're kept
+	assert.NoError(t, db.SetAliases(ctx, site.ID, []string{"www.example.net"}))
+	assert.NoError(t, domain.LoadAliases(ctx, db, site))
+	assert.Equal(t, []string{"www.example.net"}, site.VerifiedAliases())
+	assert.NoError(t, db.SetAliases(ctx, site.ID, aliases))
+	assert.NoError(t, domain.LoadAliases(ctx, db, site))
+	assert.Equal(t, []string{"example.org"}, site.UnverifiedAliases)
+
+	for host, want := range map[string]string{
+		"example.com":           site.ID,
+		"www.example.com":       site.ID,
+		"a.b.example.com":       site.ID,
+		"www.example.net":       site.ID,
+		"example.org":           "",
+		"blog.example.com":      blog.ID,
+		"blog.example.com.evil": "",
+		"www.other.com":         "",
+		"com":                   "",
+	} {
+		d, err := domain.Resolve(ctx, db, host)
+		if want == "" {
+			assert.ErrorIs(t, err, sql.ErrNoRows, host)
+			continue
+		}
+		if assert.NoError(t, err, host) {
+			assert.Equal(t, want, d.ID, host)
+		}
+	}
+
+	// a hostname belongs to one domain only
+	_, err = domain.ParseAliases(ctx, db, other, []string{"example.org"})
+	assert.ErrorIs(t, err, domain.ErrHostnameTaken)
+	_, err = domain.ParseAliases(ctx, db, other, []string{"blog.example.com"})
+	assert.ErrorIs(t, err, domain.ErrHostnameTaken)
+	_, err = domain.ParseAliases(ctx, db, other, []string{"other.com"})
+	assert.ErrorIs(t, err, domain.ErrInvalidAlias)
+	assert.ErrorIs(t, domain.HostnameAvailable(ctx, db, "www.example.net", ""), domain.ErrHostnameTaken)
+	assert.NoError(t, domain.HostnameAvailable(ctx, db, "www.example.net", site.ID))
+
+	// deleting the domain frees its aliases
+	assert.NoError(t, db.DeleteDomain(ctx, site.ID))
+	left, err := db.ListAliases(ctx, site.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, left)
+	assert.NoError(t, domain.HostnameAvailable(ctx, db, "www.example.net", ""))
+}
+
+func TestTrackingConfig(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	d := &domain.Domain{ID: id.NewID(), Name: "example.com"}
+	_, err := db.CreateDomain(ctx, d)
+	assert.NoError(t, err)
+
+	// a domain without a config gets the default one
+	c, err := domain.ReadTrackingConfig(ctx, db, d.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.DefaultDownloadExtensions, c.Extensions())
+
+	c.HashRouting = true
+	c.ExcludedPaths = "/admin/*"
+	assert.NoError(t, db.SaveTrackingConfig(ctx, c))
+	c.QueryParams = "page"
+	assert.NoError(t, db.SaveTrackingConfig(ctx, c))
+
+	saved, err := db.ReadTrackingConfig(ctx, d.ID)
+	assert.NoError(t, err)
+	assert.True(t, saved.HashRouting)
+	assert.Equal(t, "/admin/*", saved.ExcludedPaths)
+	assert.Equal(t, "page", saved.QueryParams)
+
+	assert.NoError(t, db.DeleteDomain(ctx, d.ID))
+	_, err = db.ReadTrackingConfig(ctx, d.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestWithApi_DomainNotFound(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	h := pageview.NewHandler(db, db, db, nil)
+
+	alice := &user.User{Email: "alice@example.com"}
+	bob := &user.User{Email: "bob@example.com"}
+	assert.NoError(t, db.CreateUser(ctx, alice))
+	assert.NoError(t, db.CreateUser(ctx, bob))
+	d := &domain.Domain{ID: id.NewID(), Name: "alice.example.com", UserID: alice.ID}
+	_, err := db.CreateDomain(ctx, d)
+	assert.NoError(t, err)
+
+	serve := h.WithApi(func(req *pageview.ApiRequest) error {
+		req.W.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+	get := func(userID, query string) int {
+		r := httptest.NewRequest("GET", "/stats?"+query, nil)
+		r = r.WithContext(context.WithValue(r.Context(), httpx.ContextKeyUserID, userID))
+		w := httptest.NewRecorder()
+		serve(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, get(alice.ID, "domain_id="+d.ID))
+	assert.Equal(t, http.StatusNoContent, get(alice.ID, "domain=alice.example.com"))
+
+	// unknown domains and domains of others aren't server errors
+	assert.Equal(t, http.StatusNotFound, get(alice.ID, "domain_id=nope"))
+	assert.Equal(t, http.StatusNotFound, get(alice.ID, "domain=nope.example.com"))
+	assert.Equal(t, http.StatusNotFound, get(bob.ID, "domain_id="+d.ID))
+	assert.Equal(t, http.StatusNotFound, get(bob.ID, ""))
+
+	// failing storage still is
+	assert.NoError(t, db.Close())
+	assert.Equal(t, http.StatusInternalServerError, get(alice.ID, "domain_id="+d.ID))
+}
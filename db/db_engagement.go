@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/pageview"
+)
+
+// RecordEngagement attaches e to the visitor's latest pageview of path since the given time,
+// keeping whichever values are larger. If the pageview's day was already rolled up, its daily
+// row is updated by the difference. It returns false if there is no such pageview.
+func (db *DB) RecordEngagement(ctx context.Context, domainID string, visitorID int64, path string, since time.Time, e pageview.Engagement) (bool, error) {
+	found := false
+	err := db.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		pv := &pageview.Pageview{}
+		err := tx.NewSelect().
+			Model(pv).
+			Where("domain_id = ?", domainID).
+			Where("visitor_id = ?", visitorID).
+			Where("path_id = (SELECT id FROM paths WHERE path = ?)", path).
+			Where("ts >= ?", since).
+			OrderExpr("ts DESC, id DESC").
+			Limit(1).
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+
+		engaged, scroll := max(pv.EngagedMS, e.EngagedMS), max(pv.ScrollDepth, e.ScrollDepth)
+		if engaged == pv.EngagedMS && scroll == pv.ScrollDepth {
+			return nil
+		}
+		_, err = tx.NewUpdate().
+			Model((*pageview.Pageview)(nil)).
+			Set("engaged_ms = ?", engaged).
+			Set("scroll_depth = ?", scroll).
+			Where("id = ?", pv.ID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		// a pageview from before the last rollup is already counted in daily_pageviews,
+		// which the rollup would only correct if it ran for that day again
+		engagements := 0
+		if pv.EngagedMS == 0 && engaged > 0 {
+			engagements = 1
+		}
+		day := pv.Timestamp.UTC()
+		_, err = tx.NewUpdate().
+			Model((*pageview.DailyPageview)(nil)).
+			Set("engaged_ms = engaged_ms + ?", engaged-pv.EngagedMS).
+			Set("scroll_depth = scroll_depth + ?", scroll-pv.ScrollDepth).
+			Set("engagements = engagements + ?", engagements).
+			Where("domain_id = ?", pv.DomainID).
+			// compare days as YYYY-MM-DD strings, sqlite may store them with or without a time component
+			Where("day >= ?", day.Format("2006-01-02")).
+			Where("day < ?", day.AddDate(0, 0, 1).Format("2006-01-02")).
+			Where("country_id = ?", pv.CountryID).
+			Where("region_id = ?", pv.RegionID).
+			Where("city_id = ?", pv.CityID).
+			Where("browser_id = ?", pv.BrowserID).
+			Where("os_id = ?", pv.OSID).
+			Where("device_type_id = ?", pv.DeviceTypeID).
+			Where("language_id = ?", pv.LanguageID).
+			Where("referrer_id = ?", pv.ReferrerID).
+			Where("path_id = ?", pv.PathID).
+			Where("hostname_id = ?", pv.HostnameID).
+			Exec(ctx)
+		return err
+	})
+	return found, err
+}
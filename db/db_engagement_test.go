@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/pageview"
+)
+
+func TestRecordEngagement(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	d := &domain.Domain{ID: id.NewID(), Name: "example.com"}
+	_, err := db.CreateDomain(ctx, d)
+	assert.NoError(t, err)
+
+	docs := &pageview.Path{Path: "/docs"}
+	assert.NoError(t, GetOrCreateDimension(ctx, db, docs, "path", docs.Path))
+
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	pvs := []*pageview.Pageview{
+		{Timestamp: yesterday, DomainID: d.ID, PathID: docs.ID, VisitorID: 1},
+		{Timestamp: yesterday.Add(time.Minute), DomainID: d.ID, PathID: docs.ID, VisitorID: 2},
+		{Timestamp: now.Add(-time.Hour), DomainID: d.ID, PathID: docs.ID, VisitorID: 1},
+		{Timestamp: now.Add(-time.Minute), DomainID: d.ID, PathID: docs.ID, VisitorID: 1},
+	}
+	_, err = db.Db.NewInsert().Model(&pvs).Exec(ctx)
+	assert.NoError(t, err)
+
+	record := func(visitor int64, since time.Time, ms, scroll int64) bool {
+		found, err := db.RecordEngagement(ctx, d.ID, visitor, "/docs", since, pageview.Engagement{EngagedMS: ms, ScrollDepth: scroll})
+		assert.NoError(t, err)
+		return found
+	}
+
+	// pings are cumulative, a late smaller one doesn't undo a larger one
+	assert.True(t, record(2, yesterday, 20_000, 40))
+	assert.True(t, record(2, yesterday, 10_000, 80))
+	// only the visitor's latest view of the page gets the engagement
+	assert.True(t, record(1, now.Add(-2*time.Hour), 30_000, 100))
+	assert.False(t, record(3, yesterday, 1_000, 10))
+	found, err := db.RecordEngagement(ctx, d.ID, 1, "/missing", yesterday, pageview.Engagement{EngagedMS: 1})
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	var got []*pageview.Pageview
+	assert.NoError(t, db.Db.NewSelect().Model(&got).Order("id").Scan(ctx))
+	assert.Equal(t, []int64{0, 20_000, 0, 30_000}, []int64{got[0].EngagedMS, got[1].EngagedMS, got[2].EngagedMS, got[3].EngagedMS})
+	assert.Equal(t, int64(80), got[1].ScrollDepth)
+
+	// the rolled up day and today's pageviews average over the views that were engaged with
+	assert.NoError(t, db.RunDailyRollup(ctx, yesterday))
+	pages, err := db.GetTopPages(ctx, d.ID, yesterday.Add(-time.Hour), now, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, pages, 1) {
+		assert.Equal(t, int64(4), pages[0].Count)
+		assert.Equal(t, int64(2), pages[0].Engagements)
+		assert.Equal(t, 25*time.Second, pages[0].AvgEngagedTime())
+		assert.Equal(t, 90.0, pages[0].AvgScrollDepth())
+	}
+
+	// engagement arriving after its day was rolled up still counts
+	late := &pageview.Pageview{Timestamp: yesterday.Add(2 * time.Minute), DomainID: d.ID, PathID: docs.ID, VisitorID: 3}
+	_, err = db.Db.NewInsert().Model(late).Exec(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, db.RunDailyRollup(ctx, yesterday))
+	assert.True(t, record(2, yesterday, 50_000, 90))
+	assert.True(t, record(3, yesterday, 10_000, 20))
+	pages, err = db.GetTopPages(ctx, d.ID, yesterday.Add(-time.Hour), now, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, pages, 1) {
+		assert.Equal(t, int64(5), pages[0].Count)
+		assert.Equal(t, int64(3), pages[0].Engagements)
+		assert.Equal(t, 30*time.Second, pages[0].AvgEngagedTime())
+		assert.Equal(t, 70.0, pages[0].AvgScrollDepth())
+	}
+}
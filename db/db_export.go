@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zackb/updog/pageview"
+)
+
+const exportBatchSize = 1000
+
+// ExportPageviews calls fn with each pageview from start up to, but not including, end
+func (db *DB) ExportPageviews(ctx context.Context, domainID string, start, end time.Time, fn func(*pageview.PageviewDTO) error) error {
+	if domainID == "" {
+		return fmt.Errorf("domainID is required")
+	}
+
+	// keyset pagination on id keeps each query short so ingestion isn't blocked
+	var last int64
+	for {
+		var pageviews []*pageview.Pageview
+		err := db.Db.NewSelect().
+			Model(&pageviews).
+			Relation("Country").
+			Relation("Region").
+			Relation("City").
+			Relation("Browser").
+			Relation("OS").
+			Relation("DeviceType").
+			Relation("Language").
+			Relation("Referrer").
+			Relation("Path").
+			Relation("Hostname").
+			Where("pageview.domain_id = ?", domainID).
+			Where("pageview.ts >= ?", start).
+			Where("pageview.ts < ?", end).
+			Where("pageview.id > ?", last).
+			Order("pageview.id ASC").
+			Limit(exportBatchSize).
+			Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("reading pageviews: %w", err)
+		}
+
+		for _, pv := range pageviews {
+			if err := fn(pageview.ToPageviewDTO(pv)); err != nil {
+				return err
+			}
+		}
+
+		if len(pageviews) < exportBatchSize {
+			return nil
+		}
+		last = pageviews[len(pageviews)-1].ID
+	}
+}
+
+// ExportDailyPageviews calls fn with each daily rollup of a day from start up to end, days that end
+// only partly covers are included
+func (db *DB) ExportDailyPageviews(ctx context.Context, domainID string, start, end time.Time, fn func(*pageview.DailyPageviewDTO) error) error {
+	if domainID == "" {
+		return fmt.Errorf("domainID is required")
+	}
+
+	// compare days as YYYY-MM-DD strings, sqlite may store them with or without a time component
+	from := start.UTC().Format("2006-01-02")
+	last := end.UTC().Truncate(24 * time.Hour)
+	if last.Before(end) {
+		last = last.AddDate(0, 0, 1)
+	}
+	to := last.Format("2006-01-02")
+
+	for offset := 0; ; offset += exportBatchSize {
+		var rows []*pageview.DailyPageview
+		err := db.Db.NewSelect().
+			Model(&rows).
+			Relation("Country").
+			Relation("Region").
+			Relation("City").
+			Relation("Browser").
+			Relation("OS").
+			Relation("DeviceType").
+			Relation("Language").
+			Relation("Referrer").
+			Relation("Path").
+			Relation("Hostname").
+			Where("daily_pageview.domain_id = ?", domainID).
+			Where("daily_pageview.day >= ?", from).
+			Where("daily_pageview.day < ?", to).
+			Order("daily_pageview.day", "daily_pageview.path_id", "daily_pageview.country_id", "daily_pageview.region_id",
+				"daily_pageview.city_id", "daily_pageview.browser_id", "daily_pageview.os_id", "daily_pageview.device_type_id",
+				"daily_pageview.language_id", "daily_pageview.referrer_id", "daily_pageview.hostname_id").
+			Limit(exportBatchSize).
+			Offset(offset).
+			Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("reading daily pageviews: %w", err)
+		}
+
+		for _, dp := range rows {
+			if err := fn(pageview.ToDailyPageviewDTO(dp)); err != nil {
+				return err
+			}
+		}
+
+		if len(rows) < exportBatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/pageview"
+)
+
+func TestExport(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	d := &domain.Domain{ID: id.NewID(), Name: "example.com"}
+	_, err := db.CreateDomain(ctx, d)
+	assert.NoError(t, err)
+
+	path := &pageview.Path{Path: "/hello"}
+	assert.NoError(t, GetOrCreateDimension(ctx, db, path, "path", path.Path))
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	// more than one batch
+	n := exportBatchSize + 5
+	var pvs []*pageview.Pageview
+	for i := 0; i < n; i++ {
+		pvs = append(pvs, &pageview.Pageview{
+			Timestamp: day.Add(time.Duration(i) * time.Second),
+			DomainID:  d.ID,
+			PathID:    path.ID,
+			VisitorID: int64(i % 10),
+		})
+	}
+	_, err = db.Db.NewInsert().Model(&pvs).Exec(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, db.RunDailyRollup(ctx, day))
+
+	end := day.Add(23 * time.Hour)
+
+	t.Run("csv pageviews", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := pageview.Export(ctx, db, d.ID, pageview.ExportKindPageviews, pageview.ExportCSV, day, end, &buf)
+		assert.NoError(t, err)
+
+		records, err := csv.NewReader(&buf).ReadAll()
+		assert.NoError(t, err)
+		assert.Len(t, records, n+1) // header
+		assert.Equal(t, "timestamp", records[0][0])
+		assert.Equal(t, "/hello", records[1][10])
+	})
+
+	t.Run("parquet daily", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := pageview.Export(ctx, db, d.ID, pageview.ExportKindDaily, pageview.ExportParquet, day, day.AddDate(0, 0, 1), &buf)
+		assert.NoError(t, err)
+
+		rows, err := parquet.Read[pageview.DailyPageviewDTO](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+		assert.Len(t, rows, 1)
+		assert.Equal(t, int64(n), rows[0].Count)
+		assert.Equal(t, "/hello", rows[0].Path)
+	})
+
+	t.Run("last day included", func(t *testing.T) {
+		next := day.AddDate(0, 0, 1)
+		_, err := db.Db.NewInsert().Model(&pageview.Pageview{Timestamp: next.Add(23 * time.Hour), DomainID: d.ID, PathID: path.ID}).Exec(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, db.RunDailyRollup(ctx, next))
+
+		// to=2024-05-02 is the whole of the 2nd
+		to, err := httpx.ParseEndTimeParam("2024-05-02")
+		assert.NoError(t, err)
+
+		var buf bytes.Buffer
+		assert.NoError(t, pageview.Export(ctx, db, d.ID, pageview.ExportKindPageviews, pageview.ExportCSV, day, to, &buf))
+		records, err := csv.NewReader(&buf).ReadAll()
+		assert.NoError(t, err)
+		assert.Len(t, records, n+2)
+
+		buf.Reset()
+		assert.NoError(t, pageview.Export(ctx, db, d.ID, pageview.ExportKindDaily, pageview.ExportCSV, day, to, &buf))
+		records, err = csv.NewReader(&buf).ReadAll()
+		assert.NoError(t, err)
+		if assert.Len(t, records, 3) {
+			assert.Equal(t, "2024-05-02", records[2][0])
+		}
+
+		// and only the 2nd when it's also the start
+		buf.Reset()
+		assert.NoError(t, pageview.Export(ctx, db, d.ID, pageview.ExportKindPageviews, pageview.ExportCSV, next, to, &buf))
+		records, err = csv.NewReader(&buf).ReadAll()
+		assert.NoError(t, err)
+		assert.Len(t, records, 2)
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := pageview.Export(ctx, db, d.ID, pageview.ExportKindPageviews, pageview.ExportNDJSON, day.AddDate(0, 0, 5), day.AddDate(0, 0, 6), &buf)
+		assert.NoError(t, err)
+		assert.Zero(t, buf.Len())
+	})
+}
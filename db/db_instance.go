@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/pageview"
+	"github.com/zackb/updog/user"
+)
+
+// InstanceStats summarizes the whole instance for admins.
+type InstanceStats struct {
+	Users     int
+	Domains   int
+	Pageviews int
+	// StorageBytes is the size of the database on disk
+	StorageBytes int64
+	// pageviews ingested over the last hour and day
+	PageviewsLastHour int
+	PageviewsLastDay  int
+}
+
+// PerMinute is the average ingestion rate over the last hour.
+func (s *InstanceStats) PerMinute() float64 {
+	return float64(s.PageviewsLastHour) / 60
+}
+
+func (db *DB) InstanceStats(ctx context.Context) (*InstanceStats, error) {
+	stats := &InstanceStats{}
+	var err error
+
+	if stats.Users, err = db.Db.NewSelect().Model((*user.User)(nil)).Count(ctx); err != nil {
+		return nil, err
+	}
+	if stats.Domains, err = db.Db.NewSelect().Model((*domain.Domain)(nil)).Count(ctx); err != nil {
+		return nil, err
+	}
+	if stats.Pageviews, err = db.Db.NewSelect().Model((*pageview.Pageview)(nil)).Count(ctx); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if stats.PageviewsLastHour, err = db.Db.NewSelect().Model((*pageview.Pageview)(nil)).Where("ts >= ?", now.Add(-time.Hour)).Count(ctx); err != nil {
+		return nil, err
+	}
+	if stats.PageviewsLastDay, err = db.Db.NewSelect().Model((*pageview.Pageview)(nil)).Where("ts >= ?", now.Add(-24*time.Hour)).Count(ctx); err != nil {
+		return nil, err
+	}
+
+	if stats.StorageBytes, err = db.storageSize(ctx); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (db *DB) storageSize(ctx context.Context) (int64, error) {
+	var size int64
+	query := "SELECT pg_database_size(current_database())"
+	if db.Db.Dialect().Name().String() == "sqlite" {
+		query = "SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()"
+	}
+	err := db.Db.NewRaw(query).Scan(ctx, &size)
+	return size, err
+}
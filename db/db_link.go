@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zackb/updog/pageview"
+)
+
+// GetLinks counts the clicks of kind on each link of each page, most clicked first
+func (db *DB) GetLinks(ctx context.Context, domainID, kind string, start, end time.Time, limit int) ([]*pageview.LinkStats, error) {
+	var stats []*pageview.LinkStats
+	q := db.Db.NewSelect().
+		Model((*pageview.LinkClick)(nil)).
+		ColumnExpr("link_click.target AS target").
+		ColumnExpr("path.path AS path").
+		ColumnExpr("COUNT(*) AS count").
+		ColumnExpr("COUNT(DISTINCT link_click.visitor_id) AS unique_count").
+		Join("JOIN paths AS path ON path.id = link_click.path_id").
+		Where("link_click.domain_id = ?", domainID).
+		Where("link_click.kind = ?", kind).
+		Where("link_click.ts >= ?", start).
+		Where("link_click.ts <= ?", end).
+		GroupExpr("link_click.target, path.id, path.path").
+		OrderExpr("count DESC, target, path")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	if err := q.Scan(ctx, &stats); err != nil {
+		return nil, fmt.Errorf("reading %s links: %w", kind, err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/pageview"
+)
+
+func TestGetLinks(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	d := &domain.Domain{ID: id.NewID(), Name: "example.com"}
+	_, err := db.CreateDomain(ctx, d)
+	assert.NoError(t, err)
+
+	home := &pageview.Path{Path: "/"}
+	assert.NoError(t, GetOrCreateDimension(ctx, db, home, "path", home.Path))
+	docs := &pageview.Path{Path: "/docs"}
+	assert.NoError(t, GetOrCreateDimension(ctx, db, docs, "path", docs.Path))
+
+	now := time.Now().UTC()
+	for i, c := range []struct {
+		kind, url string
+		path      *pageview.Path
+		visitor   int64
+	}{
+		{pageview.LinkOutbound, "https://github.com/zackb/updog?tab=readme", home, 1},
+		{pageview.LinkOutbound, "https://github.com/zackb", home, 2},
+		{pageview.LinkOutbound, "https://github.com/", home, 2},
+		{pageview.LinkOutbound, "https://example.org/", docs, 1},
+		{pageview.LinkDownload, "https://cdn.example.com/files/guide.pdf", docs, 1},
+	} {
+		click, err := pageview.ParseLink(c.kind, c.url)
+		assert.NoError(t, err)
+		click.DomainID = d.ID
+		click.PathID = c.path.ID
+		click.VisitorID = c.visitor
+		click.Timestamp = now.Add(-time.Duration(i) * time.Minute)
+		_, err = db.Db.NewInsert().Model(click).Exec(ctx)
+		assert.NoError(t, err)
+	}
+
+	outbound, err := db.GetLinks(ctx, d.ID, pageview.LinkOutbound, now.Add(-time.Hour), now, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []*pageview.LinkStats{
+		{Target: "github.com", Path: "/", Count: 3, UniqueCount: 2},
+		{Target: "example.org", Path: "/docs", Count: 1, UniqueCount: 1},
+	}, outbound)
+
+	downloads, err := db.GetLinks(ctx, d.ID, pageview.LinkDownload, now.Add(-time.Hour), now, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []*pageview.LinkStats{
+		{Target: "guide.pdf", Path: "/docs", Count: 1, UniqueCount: 1},
+	}, downloads)
+
+	// purging a page's data removes the clicks on it
+	result, err := db.PurgePageviews(ctx, d.ID, pageview.PurgeCriteria{PathPattern: "/docs"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), result.LinkClicks)
+	downloads, err = db.GetLinks(ctx, d.ID, pageview.LinkDownload, now.Add(-time.Hour), now, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, downloads)
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/zackb/updog/lockout"
+)
+
+func (db *DB) ReadLoginAttempt(ctx context.Context, key string) (*lockout.Attempt, error) {
+	a := &lockout.Attempt{}
+	err := db.Db.NewSelect().Model(a).Where("key = ?", key).Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (db *DB) FailLoginAttempt(ctx context.Context, key string, now, windowStart time.Time) (*lockout.Attempt, error) {
+	a := &lockout.Attempt{Key: key, Failures: 1, LastFailedAt: now}
+	_, err := db.Db.NewInsert().
+		Model(a).
+		On("CONFLICT (key) DO UPDATE").
+		Set("failures = CASE WHEN ?TableAlias.last_failed_at < ? THEN 1 ELSE ?TableAlias.failures + 1 END", windowStart).
+		Set("last_failed_at = EXCLUDED.last_failed_at").
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (db *DB) LockLoginAttempt(ctx context.Context, key string, until time.Time) error {
+	_, err := db.Db.NewUpdate().
+		Model((*lockout.Attempt)(nil)).
+		Set("locked_until = ?", until).
+		Where("key = ?", key).
+		Where("locked_until IS NULL OR locked_until < ?", until).
+		Exec(ctx)
+	return err
+}
+
+func (db *DB) DeleteLoginAttempt(ctx context.Context, key string) error {
+	_, err := db.Db.NewDelete().Model((*lockout.Attempt)(nil)).Where("key = ?", key).Exec(ctx)
+	return err
+}
+
+func (db *DB) DeleteStaleLoginAttempts(ctx context.Context, before, now time.Time) (int, error) {
+	res, err := db.Db.NewDelete().
+		Model((*lockout.Attempt)(nil)).
+		Where("last_failed_at < ?", before).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/lockout"
+)
+
+func TestLoginLockout(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	g := lockout.NewGuard(db, db)
+	r := httptest.NewRequest("POST", "/login", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+
+	// emails without an account are locked out the same way
+	keys := lockout.LoginKeys(r, "Nobody@example.com")
+	for i := 1; i < lockout.EmailPolicy.Free; i++ {
+		g.Fail(r, "", keys...)
+		assert.Zero(t, g.Wait(ctx, keys...))
+	}
+	g.Fail(r, "", keys...)
+	wait := g.Wait(ctx, lockout.EmailKey("nobody@example.com"))
+	assert.InDelta(t, lockout.EmailPolicy.Base.Seconds(), wait.Seconds(), 1)
+
+	// the address isn't locked yet, other emails can still be tried from it
+	assert.Zero(t, g.Wait(ctx, lockout.LoginKeys(r, "alice@example.com")...))
+
+	entries, err := db.ListAuditEntries(ctx, audit.Filter{}, 10, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, audit.ActionLoginLockout, entries[0].Action)
+		assert.Equal(t, lockout.KindEmail, entries[0].TargetType)
+		assert.Equal(t, "nobody@example.com", entries[0].TargetID)
+	}
+
+	// the next failure doubles the lock
+	g.Fail(r, "", keys...)
+	wait = g.Wait(ctx, keys...)
+	assert.InDelta(t, (2 * lockout.EmailPolicy.Base).Seconds(), wait.Seconds(), 1)
+
+	// logging in forgets the email's failures but not the address's
+	g.Succeed(ctx, lockout.EmailKey("nobody@example.com"))
+	assert.Zero(t, g.Wait(ctx, keys...))
+	a, err := db.ReadLoginAttempt(ctx, lockout.IPKey("192.0.2.1").String())
+	assert.NoError(t, err)
+	assert.Equal(t, lockout.EmailPolicy.Free+1, a.Failures)
+
+	// stale attempts are cleaned up once they aren't locked
+	n, err := db.DeleteStaleLoginAttempts(ctx, time.Now().Add(time.Minute), time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestLoginLockout_ParallelFailures(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	g := lockout.NewGuard(db, db)
+	r := httptest.NewRequest("POST", "/login", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	key := lockout.EmailKey("alice@example.com")
+	// shared cache sqlite fails concurrent writers instead of waiting, statements still interleave on one connection
+	db.Db.SetMaxOpenConns(1)
+
+	// guesses racing each other all count
+	const n = 20
+	var wg sync.WaitGroup
+	for range n {
+		wg.Go(func() { g.Fail(r, "", key) })
+	}
+	wg.Wait()
+
+	a, err := db.ReadLoginAttempt(ctx, key.String())
+	assert.NoError(t, err)
+	assert.Equal(t, n, a.Failures)
+	assert.InDelta(t, lockout.EmailPolicy.Max.Seconds(), g.Wait(ctx, key).Seconds(), 1)
+
+	// failures older than the window start over
+	_, err = db.FailLoginAttempt(ctx, key.String(), time.Now().Add(2*lockout.EmailPolicy.Window), time.Now().Add(lockout.EmailPolicy.Window))
+	assert.NoError(t, err)
+	a, err = db.ReadLoginAttempt(ctx, key.String())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, a.Failures)
+}
@@ -1,10 +1,14 @@
 package db
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/uptrace/bun"
 	"github.com/zackb/updog/pageview"
 )
 
@@ -159,10 +163,14 @@ func (db *DB) GetTopPages(ctx context.Context, domainID string, start, end time.
 			ColumnExpr("path.path AS path").
 			ColumnExpr("SUM(daily_pageview.count) AS count").
 			ColumnExpr("SUM(daily_pageview.unique_visitors) AS unique_count").
+			ColumnExpr("SUM(daily_pageview.engaged_ms) AS engaged_ms").
+			ColumnExpr("SUM(daily_pageview.scroll_depth) AS scroll_depth").
+			ColumnExpr("SUM(daily_pageview.engagements) AS engagements").
 			Join("JOIN paths AS path ON path.id = daily_pageview.path_id").
 			Where("daily_pageview.domain_id = ?", domainID).
-			Where("day >= ?", start).
-			Where("day <= ?", historicEnd).
+			// compare days as YYYY-MM-DD strings, sqlite may store them with or without a time component
+			Where("day >= ?", start.Format("2006-01-02")).
+			Where("day < ?", historicEnd.AddDate(0, 0, 1).Format("2006-01-02")).
 			GroupExpr("path.id, path.path").
 			Scan(ctx, &historicStats)
 
@@ -183,6 +191,9 @@ func (db *DB) GetTopPages(ctx context.Context, domainID string, start, end time.
 			ColumnExpr("path.path AS path").
 			ColumnExpr("COUNT(*) AS count").
 			ColumnExpr("COUNT(DISTINCT visitor_id) AS unique_count").
+			ColumnExpr("SUM(pageviews.engaged_ms) AS engaged_ms").
+			ColumnExpr("SUM(pageviews.scroll_depth) AS scroll_depth").
+			ColumnExpr("SUM(CASE WHEN pageviews.engaged_ms > 0 THEN 1 ELSE 0 END) AS engagements").
 			Join("JOIN paths AS path ON path.id = pageviews.path_id").
 			Where("pageviews.domain_id = ?", domainID).
 			Where("pageviews.ts >= ?", liveStart).
@@ -198,6 +209,9 @@ func (db *DB) GetTopPages(ctx context.Context, domainID string, start, end time.
 			if existing, ok := statsMap[s.Path]; ok {
 				existing.Count += s.Count
 				existing.UniqueCount += s.UniqueCount
+				existing.EngagedMS += s.EngagedMS
+				existing.ScrollDepth += s.ScrollDepth
+				existing.Engagements += s.Engagements
 			} else {
 				statsMap[s.Path] = s
 			}
@@ -227,6 +241,91 @@ func (db *DB) GetTopPages(ctx context.Context, domainID string, start, end time.
 	return stats, nil
 }
 
+// GetHostnames breaks a domain's traffic down by the hostname it was sent from, busiest first
+func (db *DB) GetHostnames(ctx context.Context, domainID string, start, end time.Time) ([]*pageview.HostnameStats, error) {
+	// truncate to day UTC
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+
+	now := time.Now().UTC()
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	historicEnd := end
+	if historicEnd.After(todayStart) {
+		historicEnd = todayStart.Add(-time.Nanosecond)
+	}
+	liveStart := start
+	if liveStart.Before(todayStart) {
+		liveStart = todayStart
+	}
+
+	statsMap := make(map[string]*pageview.HostnameStats)
+
+	// historic
+	if start.Before(todayStart) {
+		var historicStats []*pageview.HostnameStats
+		err := db.Db.NewSelect().
+			Model((*pageview.DailyPageview)(nil)).
+			// rows without a hostname, such as rollups from before they were recorded, came from the domain's own name
+			ColumnExpr("COALESCE(hostname.name, domain.name) AS hostname").
+			ColumnExpr("SUM(daily_pageview.count) AS count").
+			ColumnExpr("SUM(daily_pageview.unique_visitors) AS unique_count").
+			Join("JOIN domains AS domain ON domain.id = daily_pageview.domain_id").
+			Join("LEFT JOIN hostnames AS hostname ON hostname.id = daily_pageview.hostname_id").
+			Where("daily_pageview.domain_id = ?", domainID).
+			// compare days as YYYY-MM-DD strings, sqlite may store them with or without a time component
+			Where("day >= ?", start.Format("2006-01-02")).
+			Where("day < ?", historicEnd.AddDate(0, 0, 1).Format("2006-01-02")).
+			GroupExpr("COALESCE(hostname.name, domain.name)").
+			Scan(ctx, &historicStats)
+		if err != nil {
+			return nil, fmt.Errorf("reading historic hostnames: %w", err)
+		}
+		for _, s := range historicStats {
+			statsMap[s.Hostname] = s
+		}
+	}
+
+	// live
+	if !end.Before(todayStart) {
+		var liveStats []*pageview.HostnameStats
+		err := db.Db.NewSelect().
+			Table("pageviews").
+			ColumnExpr("COALESCE(hostname.name, domain.name) AS hostname").
+			ColumnExpr("COUNT(*) AS count").
+			ColumnExpr("COUNT(DISTINCT visitor_id) AS unique_count").
+			Join("JOIN domains AS domain ON domain.id = pageviews.domain_id").
+			Join("LEFT JOIN hostnames AS hostname ON hostname.id = pageviews.hostname_id").
+			Where("pageviews.domain_id = ?", domainID).
+			Where("pageviews.ts >= ?", liveStart).
+			Where("pageviews.ts <= ?", end).
+			GroupExpr("COALESCE(hostname.name, domain.name)").
+			Scan(ctx, &liveStats)
+		if err != nil {
+			return nil, fmt.Errorf("reading live hostnames: %w", err)
+		}
+		for _, s := range liveStats {
+			if existing, ok := statsMap[s.Hostname]; ok {
+				existing.Count += s.Count
+				existing.UniqueCount += s.UniqueCount
+			} else {
+				statsMap[s.Hostname] = s
+			}
+		}
+	}
+
+	stats := make([]*pageview.HostnameStats, 0, len(statsMap))
+	for _, s := range statsMap {
+		stats = append(stats, s)
+	}
+	slices.SortFunc(stats, func(a, b *pageview.HostnameStats) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Hostname, b.Hostname)
+	})
+	return stats, nil
+}
+
 func (db *DB) GetDeviceUsage(ctx context.Context, domainID string, start, end time.Time) ([]*pageview.DeviceStats, error) {
 	// truncate to day UTC
 	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
@@ -326,6 +425,12 @@ func (db *DB) GetDeviceUsage(ctx context.Context, domainID string, start, end ti
 }
 
 func (db *DB) RunDailyRollup(ctx context.Context, dayStart time.Time) error {
+	return db.rollupDay(ctx, db.Db, dayStart)
+}
+
+// rollupDay aggregates a day of raw pageviews into daily_pageviews, and its web vitals into
+// daily_web_vitals, using idb, which may be a transaction
+func (db *DB) rollupDay(ctx context.Context, idb bun.IDB, dayStart time.Time) error {
 	// normalize to UTC start of day
 	dayStart = dayStart.UTC()
 	dayStart = time.Date(dayStart.Year(), dayStart.Month(), dayStart.Day(), 0, 0, 0, 0, time.UTC)
@@ -333,7 +438,7 @@ func (db *DB) RunDailyRollup(ctx context.Context, dayStart time.Time) error {
 
 	dayExpr := db.dateTrunc("day", "pageview.ts") // fully qualified
 
-	_, err := db.Db.ExecContext(ctx, fmt.Sprintf(`
+	_, err := idb.ExecContext(ctx, fmt.Sprintf(`
         INSERT INTO daily_pageviews (
             day,
             domain_id,
@@ -346,9 +451,13 @@ func (db *DB) RunDailyRollup(ctx context.Context, dayStart time.Time) error {
             language_id,
             referrer_id,
 			path_id,
+			hostname_id,
             count,
             unique_visitors,
-            bounces
+            bounces,
+            engaged_ms,
+            scroll_depth,
+            engagements
         )
         SELECT
             %s AS day,
@@ -362,11 +471,15 @@ func (db *DB) RunDailyRollup(ctx context.Context, dayStart time.Time) error {
             pageview.language_id,
             pageview.referrer_id,
 			pageview.path_id,
+			pageview.hostname_id,
             COUNT(*) AS count,
             COUNT(DISTINCT pageview.visitor_id) AS unique_visitors,
             -- bounces as fraction of single-page visitors
             SUM(CASE WHEN visitor_pv.pv_count = 1 THEN 1 ELSE 0 END) / 
-                NULLIF(COUNT(DISTINCT pageview.visitor_id), 0) AS bounces
+                NULLIF(COUNT(DISTINCT pageview.visitor_id), 0) AS bounces,
+            SUM(pageview.engaged_ms) AS engaged_ms,
+            SUM(pageview.scroll_depth) AS scroll_depth,
+            SUM(CASE WHEN pageview.engaged_ms > 0 THEN 1 ELSE 0 END) AS engagements
         FROM pageviews AS pageview
         LEFT JOIN (
             SELECT
@@ -381,11 +494,12 @@ func (db *DB) RunDailyRollup(ctx context.Context, dayStart time.Time) error {
                 language_id,
                 referrer_id,
 				path_id,
+				hostname_id,
                 `+db.dateTrunc("day", "ts")+` AS day,
                 COUNT(*) AS pv_count
             FROM pageviews
             WHERE ts >= ? AND ts < ?
-            GROUP BY visitor_id, domain_id, country_id, region_id, city_id, browser_id, os_id, device_type_id, language_id, referrer_id, path_id, day
+            GROUP BY visitor_id, domain_id, country_id, region_id, city_id, browser_id, os_id, device_type_id, language_id, referrer_id, path_id, hostname_id, day
         ) AS visitor_pv
         ON pageview.visitor_id = visitor_pv.visitor_id
         AND pageview.domain_id = visitor_pv.domain_id
@@ -398,18 +512,25 @@ func (db *DB) RunDailyRollup(ctx context.Context, dayStart time.Time) error {
         AND pageview.language_id = visitor_pv.language_id
         AND pageview.referrer_id = visitor_pv.referrer_id
 		AND pageview.path_id = visitor_pv.path_id
+		AND pageview.hostname_id = visitor_pv.hostname_id
         AND %s = visitor_pv.day
         WHERE pageview.ts >= ? AND pageview.ts < ?
         GROUP BY pageview.domain_id, pageview.country_id, pageview.region_id, pageview.city_id, pageview.browser_id,
-                 pageview.os_id, pageview.device_type_id, pageview.language_id, pageview.referrer_id, pageview.path_id, %s
-        ON CONFLICT (day, domain_id, country_id, region_id, city_id, browser_id, os_id, device_type_id, language_id, referrer_id, path_id)
+                 pageview.os_id, pageview.device_type_id, pageview.language_id, pageview.referrer_id, pageview.path_id, pageview.hostname_id, %s
+        ON CONFLICT (day, domain_id, country_id, region_id, city_id, browser_id, os_id, device_type_id, language_id, referrer_id, path_id, hostname_id)
         DO UPDATE SET
             count = EXCLUDED.count,
             unique_visitors = EXCLUDED.unique_visitors,
-            bounces = EXCLUDED.bounces;
+            bounces = EXCLUDED.bounces,
+            engaged_ms = EXCLUDED.engaged_ms,
+            scroll_depth = EXCLUDED.scroll_depth,
+            engagements = EXCLUDED.engagements;
     `, dayExpr, dayExpr, dayExpr), dayStart, dayEnd, dayStart, dayEnd)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return rollupVitals(ctx, idb, dayStart, dayEnd)
 }
 
 func (db *DB) GetHourlyStats(ctx context.Context, domainID string, start, end time.Time) ([]*pageview.AggregatedPoint, error) {
@@ -512,3 +512,59 @@ func TestGetDailyStats_PartialDay(t *testing.T) {
 		t.Error("Did not find 15:00 bucket")
 	}
 }
+
+func TestGetHostnames_Rollup(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	d := &domain.Domain{ID: id.NewID(), Name: "example.com", IncludeSubdomains: true}
+	_, err := db.DomainStorage().CreateDomain(ctx, d)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+	todayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	yesterday := todayStart.AddDate(0, 0, -1)
+
+	apex := &pageview.Hostname{Name: "example.com"}
+	www := &pageview.Hostname{Name: "www.example.com"}
+	for _, h := range []*pageview.Hostname{apex, www} {
+		_, err = db.Db.NewInsert().Model(h).Exec(ctx)
+		assert.NoError(t, err)
+	}
+
+	// yesterday is rolled up with the hostname kept as a dimension,
+	// pageviews without one are from before hostnames were recorded
+	pvs := []*pageview.Pageview{
+		{Timestamp: yesterday.Add(time.Hour), DomainID: d.ID, HostnameID: apex.ID, VisitorID: 1},
+		{Timestamp: yesterday.Add(time.Hour), DomainID: d.ID, HostnameID: www.ID, VisitorID: 1},
+		{Timestamp: yesterday.Add(2 * time.Hour), DomainID: d.ID, HostnameID: www.ID, VisitorID: 2},
+		{Timestamp: yesterday.Add(3 * time.Hour), DomainID: d.ID, VisitorID: 4},
+		{Timestamp: now, DomainID: d.ID, HostnameID: apex.ID, VisitorID: 3},
+		{Timestamp: now, DomainID: d.ID, HostnameID: www.ID, VisitorID: 2},
+		{Timestamp: now, DomainID: d.ID, VisitorID: 5},
+	}
+	_, err = db.Db.NewInsert().Model(&pvs).Exec(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, db.RunDailyRollup(ctx, yesterday))
+
+	var rows []*pageview.DailyPageview
+	assert.NoError(t, db.Db.NewSelect().Model(&rows).Where("domain_id = ?", d.ID).Order("hostname_id").Scan(ctx))
+	if assert.Len(t, rows, 3) {
+		assert.Equal(t, int64(0), rows[0].HostnameID)
+		assert.Equal(t, apex.ID, rows[1].HostnameID)
+		assert.Equal(t, int64(1), rows[1].Count)
+		assert.Equal(t, www.ID, rows[2].HostnameID)
+		assert.Equal(t, int64(2), rows[2].Count)
+	}
+
+	// the rollup and today's live pageviews are merged, those without a hostname count as the domain's name
+	stats, err := db.GetHostnames(ctx, d.ID, yesterday, now)
+	assert.NoError(t, err)
+	if assert.Len(t, stats, 2) {
+		assert.Equal(t, "example.com", stats[0].Hostname)
+		assert.Equal(t, int64(4), stats[0].Count)
+		assert.Equal(t, "www.example.com", stats[1].Hostname)
+		assert.Equal(t, int64(3), stats[1].Count)
+		assert.Equal(t, int64(3), stats[1].UniqueCount)
+	}
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/pageview"
+)
+
+// PurgePageviews deletes a domain's raw pageviews matching c along with the
+// rollup rows they contributed to. Rollups only have day granularity, so days
+// that are only partially covered by c are rebuilt from the remaining pageviews.
+func (db *DB) PurgePageviews(ctx context.Context, domainID string, c pageview.PurgeCriteria) (*pageview.PurgeResult, error) {
+	if domainID == "" {
+		return nil, fmt.Errorf("domainID is required")
+	}
+
+	result := &pageview.PurgeResult{}
+	err := db.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		q := tx.NewDelete().
+			Model((*pageview.Pageview)(nil)).
+			Where("domain_id = ?", domainID)
+		q = purgeDimensions(q, c)
+		if !c.From.IsZero() {
+			q = q.Where("ts >= ?", c.From)
+		}
+		if !c.To.IsZero() {
+			q = q.Where("ts < ?", c.To)
+		}
+		res, err := q.Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("deleting pageviews: %w", err)
+		}
+		result.Pageviews, _ = res.RowsAffected()
+
+		lq := tx.NewDelete().
+			Model((*pageview.LinkClick)(nil)).
+			Where("domain_id = ?", domainID)
+		lq = purgeDimensions(lq, c)
+		if !c.From.IsZero() {
+			lq = lq.Where("ts >= ?", c.From)
+		}
+		if !c.To.IsZero() {
+			lq = lq.Where("ts < ?", c.To)
+		}
+		res, err = lq.Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("deleting link clicks: %w", err)
+		}
+		result.LinkClicks, _ = res.RowsAffected()
+
+		vq := tx.NewDelete().
+			Model((*pageview.WebVital)(nil)).
+			Where("domain_id = ?", domainID)
+		vq = purgeDimensions(vq, c)
+		if !c.From.IsZero() {
+			vq = vq.Where("ts >= ?", c.From)
+		}
+		if !c.To.IsZero() {
+			vq = vq.Where("ts < ?", c.To)
+		}
+		res, err = vq.Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("deleting web vitals: %w", err)
+		}
+		result.WebVitals, _ = res.RowsAffected()
+
+		// compare days as YYYY-MM-DD strings, sqlite may store them with or without a time component
+		dq := tx.NewDelete().
+			Model((*pageview.DailyPageview)(nil)).
+			Where("domain_id = ?", domainID)
+		dq = purgeDimensions(dq, c)
+		if !c.From.IsZero() {
+			dq = dq.Where("day >= ?", startOfDay(c.From).Format("2006-01-02"))
+		}
+		if !c.To.IsZero() {
+			dq = dq.Where("day < ?", startOfDay(c.To.Add(-time.Nanosecond)).AddDate(0, 0, 1).Format("2006-01-02"))
+		}
+		res, err = dq.Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("deleting daily pageviews: %w", err)
+		}
+		result.DailyPageviews, _ = res.RowsAffected()
+
+		dvq := tx.NewDelete().
+			Model((*pageview.DailyVital)(nil)).
+			Where("domain_id = ?", domainID)
+		dvq = purgeDimensions(dvq, c)
+		if !c.From.IsZero() {
+			dvq = dvq.Where("day >= ?", startOfDay(c.From).Format("2006-01-02"))
+		}
+		if !c.To.IsZero() {
+			dvq = dvq.Where("day < ?", startOfDay(c.To.Add(-time.Nanosecond)).AddDate(0, 0, 1).Format("2006-01-02"))
+		}
+		if _, err := dvq.Exec(ctx); err != nil {
+			return fmt.Errorf("deleting daily web vitals: %w", err)
+		}
+
+		for _, day := range partialDays(c) {
+			if err := db.rollupDay(ctx, tx, day); err != nil {
+				return fmt.Errorf("rebuilding rollup for %s: %w", day.Format("2006-01-02"), err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// purgeDimensions restricts a delete from the pageviews, link clicks or web vitals tables or their rollups to the path and country in c
+func purgeDimensions(q *bun.DeleteQuery, c pageview.PurgeCriteria) *bun.DeleteQuery {
+	if c.PathPattern != "" {
+		q = q.Where(`path_id IN (SELECT id FROM paths WHERE path LIKE ? ESCAPE '\')`, pageview.GlobToLike(c.PathPattern))
+	}
+	if c.Country != "" {
+		q = q.Where("country_id IN (SELECT id FROM countries WHERE name = ?)", c.Country)
+	}
+	return q
+}
+
+// partialDays returns the completed days whose rollups c only partly covers
+func partialDays(c pageview.PurgeCriteria) []time.Time {
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var days []time.Time
+	for _, t := range []time.Time{c.From, c.To} {
+		if t.IsZero() {
+			continue
+		}
+		day := startOfDay(t)
+		// today's rollup is produced by the nightly job
+		if day.Equal(t.UTC()) || !day.Before(today) {
+			continue
+		}
+		if len(days) == 0 || !days[0].Equal(day) {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
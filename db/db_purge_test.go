@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/pageview"
+)
+
+func TestPurgePageviews(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	d := &domain.Domain{ID: id.NewID(), Name: "example.com"}
+	_, err := db.CreateDomain(ctx, d)
+	assert.NoError(t, err)
+
+	blog := &pageview.Path{Path: "/blog/hello_world"}
+	assert.NoError(t, GetOrCreateDimension(ctx, db, blog, "path", blog.Path))
+	about := &pageview.Path{Path: "/about"}
+	assert.NoError(t, GetOrCreateDimension(ctx, db, about, "path", about.Path))
+	de := &pageview.Country{Name: "DE"}
+	assert.NoError(t, GetOrCreateDimension(ctx, db, de, "name", de.Name))
+	us := &pageview.Country{Name: "US"}
+	assert.NoError(t, GetOrCreateDimension(ctx, db, us, "name", us.Name))
+
+	day1 := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	// one view per hour on both days, alternating path and country
+	seed := func() {
+		var pvs []*pageview.Pageview
+		for _, day := range []time.Time{day1, day2} {
+			for h := 0; h < 24; h++ {
+				pv := &pageview.Pageview{
+					Timestamp: day.Add(time.Duration(h) * time.Hour),
+					DomainID:  d.ID,
+					PathID:    about.ID,
+					CountryID: us.ID,
+					VisitorID: int64(h),
+				}
+				if h%2 == 0 {
+					pv.PathID = blog.ID
+				}
+				if h%3 == 0 {
+					pv.CountryID = de.ID
+				}
+				pvs = append(pvs, pv)
+			}
+		}
+		_, err := db.Db.NewInsert().Model(&pvs).Exec(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, db.RunDailyRollup(ctx, day1))
+		assert.NoError(t, db.RunDailyRollup(ctx, day2))
+	}
+
+	totals := func() (int, map[string]int64) {
+		n, err := db.Db.NewSelect().Model((*pageview.Pageview)(nil)).Count(ctx)
+		assert.NoError(t, err)
+		rollups, err := dailyRollupTotals(ctx, db)
+		assert.NoError(t, err)
+		return n, rollups
+	}
+
+	t.Run("path pattern", func(t *testing.T) {
+		seed()
+		res, err := db.PurgePageviews(ctx, d.ID, pageview.PurgeCriteria{PathPattern: "/blog/*"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(24), res.Pageviews)
+
+		n, rollups := totals()
+		assert.Equal(t, 24, n)
+		assert.Equal(t, int64(12), rollups["2024-05-01"])
+		assert.Equal(t, int64(12), rollups["2024-05-02"])
+
+		// _ is literal, not a LIKE wildcard
+		res, err = db.PurgePageviews(ctx, d.ID, pageview.PurgeCriteria{PathPattern: "/abou_"})
+		assert.NoError(t, err)
+		assert.Zero(t, res.Pageviews)
+
+		_, err = db.PurgePageviews(ctx, d.ID, pageview.PurgeCriteria{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("partial day is rebuilt", func(t *testing.T) {
+		seed()
+		res, err := db.PurgePageviews(ctx, d.ID, pageview.PurgeCriteria{
+			From:    day1.Add(12 * time.Hour),
+			To:      day2,
+			Country: "DE",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), res.Pageviews) // hours 12, 15, 18, 21
+
+		n, rollups := totals()
+		assert.Equal(t, 44, n)
+		assert.Equal(t, int64(20), rollups["2024-05-01"])
+		assert.Equal(t, int64(24), rollups["2024-05-02"])
+
+		mismatches, err := ValidateCopy(ctx, db, db)
+		assert.NoError(t, err)
+		assert.Empty(t, mismatches)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		_, err := db.PurgePageviews(ctx, d.ID, pageview.PurgeCriteria{})
+		assert.NoError(t, err)
+
+		n, rollups := totals()
+		assert.Zero(t, n)
+		assert.Empty(t, rollups)
+
+		_, err = db.ReadDomain(ctx, d.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("delete domain", func(t *testing.T) {
+		seed()
+		assert.NoError(t, db.DeleteDomain(ctx, d.ID))
+
+		n, rollups := totals()
+		assert.Zero(t, n)
+		assert.Empty(t, rollups)
+
+		_, err := db.ReadDomain(ctx, d.ID)
+		assert.Error(t, err)
+	})
+}
+
+func TestAuditEntries(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	audit.Record(ctx, db, audit.NewEntry(nil, "user1", audit.ActionDomainDelete, audit.TargetDomain, "d1", map[string]any{"name": "example.com"}))
+	audit.Record(ctx, db, audit.NewEntry(nil, "user1", audit.ActionDomainResetStats, audit.TargetDomain, "d2", nil))
+
+	entries, err := db.ListAuditEntries(ctx, audit.Filter{}, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, audit.ActionDomainResetStats, entries[0].Action)
+	assert.Equal(t, `{"name":"example.com"}`, entries[1].Details)
+}
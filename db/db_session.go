@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/session"
+)
+
+func (db *DB) CreateSession(ctx context.Context, s *session.Session, refreshHash string) error {
+	return db.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(s).Exec(ctx); err != nil {
+			return err
+		}
+		_, err := tx.NewInsert().
+			Model(&session.RefreshToken{TokenHash: refreshHash, SessionID: s.ID, CreatedAt: s.CreatedAt}).
+			Exec(ctx)
+		return err
+	})
+}
+
+func (db *DB) ReadSession(ctx context.Context, id string) (*session.Session, error) {
+	s := &session.Session{}
+	err := db.Db.NewSelect().Model(s).Where("id = ?", id).Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (db *DB) ReadRefreshToken(ctx context.Context, hash string) (*session.RefreshToken, error) {
+	rt := &session.RefreshToken{}
+	err := db.Db.NewSelect().
+		Model(rt).
+		Relation("Session").
+		Relation("Session.User").
+		Where("refresh_token.token_hash = ?", hash).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+func (db *DB) RotateRefreshToken(ctx context.Context, s *session.Session, oldHash, newHash string) error {
+	return db.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// only one refresh can use a token, a concurrent one sees it as reused
+		res, err := tx.NewUpdate().
+			Model((*session.RefreshToken)(nil)).
+			Set("used_at = ?", s.LastUsedAt).
+			Where("token_hash = ?", oldHash).
+			Where("used_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return session.ErrRefreshTokenReused
+		}
+
+		_, err = tx.NewInsert().
+			Model(&session.RefreshToken{TokenHash: newHash, SessionID: s.ID, CreatedAt: s.LastUsedAt}).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().
+			Model(s).
+			Column("user_agent", "ip", "access_token_id", "access_expires_at", "last_used_at", "expires_at").
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+}
+
+func (db *DB) ListSessionsByUser(ctx context.Context, userID string) ([]*session.Session, error) {
+	var sessions []*session.Session
+	err := db.Db.NewSelect().
+		Model(&sessions).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Where("expires_at > ?", time.Now().UTC()).
+		Order("last_used_at DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (db *DB) RevokeSession(ctx context.Context, id string, revokedAt time.Time) error {
+	_, err := db.Db.NewUpdate().
+		Model((*session.Session)(nil)).
+		Set("revoked_at = ?", revokedAt).
+		Where("id = ?", id).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	return err
+}
+
+func (db *DB) DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	var n int64
+	err := db.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		expired := tx.NewSelect().
+			Model((*session.Session)(nil)).
+			Column("id").
+			WhereOr("expires_at < ?", now).
+			WhereOr("revoked_at IS NOT NULL")
+		_, err := tx.NewDelete().
+			Model((*session.RefreshToken)(nil)).
+			Where("session_id IN (?)", expired).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		res, err := tx.NewDelete().
+			Model((*session.Session)(nil)).
+			WhereOr("expires_at < ?", now).
+			WhereOr("revoked_at IS NOT NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return int(n), err
+}
@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/session"
+	"github.com/zackb/updog/user"
+)
+
+func newTestAuth(t *testing.T) *auth.Service {
+	key, err := jwk.New([]byte("0123456789abcdef0123456789abcdef"))
+	assert.NoError(t, err)
+	assert.NoError(t, key.Set(jwk.KeyIDKey, "test"))
+	assert.NoError(t, key.Set(jwk.AlgorithmKey, jwa.HS256))
+	set := jwk.NewSet()
+	set.Add(key)
+
+	b, err := json.Marshal(set)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, b, 0600))
+
+	a, err := auth.NewAuthService(path, time.Minute)
+	assert.NoError(t, err)
+	return a
+}
+
+func TestSessionRefreshRotation(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	a := newTestAuth(t)
+	a.SetRevocationStore(db)
+	m := session.NewManager(db, a, time.Hour)
+	r := httptest.NewRequest("POST", "/api/v1/auth/login", nil)
+
+	u := &user.User{Email: "alice@example.com"}
+	assert.NoError(t, db.CreateUser(ctx, u))
+
+	first, err := m.Start(ctx, u.ID, r)
+	assert.NoError(t, err)
+
+	// refreshing rotates the refresh token
+	second, err := m.Refresh(ctx, first.RefreshToken, r)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	token, err := a.ValidateToken(ctx, second.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, first.Session.ID, token.SessionID)
+
+	sessions, err := db.ListSessionsByUser(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+
+	// using the old refresh token again after the grace revokes the session and its access token
+	m.SetRefreshGrace(0)
+	_, err = m.Refresh(ctx, first.RefreshToken, r)
+	assert.ErrorIs(t, err, session.ErrRefreshTokenReused)
+	_, err = m.Refresh(ctx, second.RefreshToken, r)
+	assert.ErrorIs(t, err, session.ErrInvalidRefreshToken)
+	_, err = a.ValidateToken(ctx, second.AccessToken)
+	assert.ErrorIs(t, err, auth.ErrTokenRevoked)
+
+	sessions, err = db.ListSessionsByUser(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	n, err := db.DeleteExpiredSessions(ctx, time.Now().UTC())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestSessionRefreshGrace(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	a := newTestAuth(t)
+	a.SetRevocationStore(db)
+	m := session.NewManager(db, a, time.Hour)
+	r := httptest.NewRequest("POST", "/api/v1/auth/refresh", nil)
+
+	u := &user.User{Email: "alice@example.com"}
+	assert.NoError(t, db.CreateUser(ctx, u))
+	first, err := m.Start(ctx, u.ID, r)
+	assert.NoError(t, err)
+
+	// tabs refreshing at once all get the same new tokens instead of revoking the session
+	const n = 5
+	var wg sync.WaitGroup
+	results := make([]*session.Tokens, n)
+	for i := range n {
+		wg.Go(func() {
+			tokens, err := m.Refresh(ctx, first.RefreshToken, r)
+			assert.NoError(t, err)
+			results[i] = tokens
+		})
+	}
+	wg.Wait()
+	for _, tokens := range results[1:] {
+		if assert.NotNil(t, tokens) {
+			assert.Equal(t, results[0].RefreshToken, tokens.RefreshToken)
+		}
+	}
+
+	// as does one arriving just after
+	again, err := m.Refresh(ctx, first.RefreshToken, r)
+	assert.NoError(t, err)
+	assert.Equal(t, results[0].RefreshToken, again.RefreshToken)
+	_, err = a.ValidateToken(ctx, again.AccessToken)
+	assert.NoError(t, err)
+
+	// and the chain goes on from there
+	_, err = m.Refresh(ctx, again.RefreshToken, r)
+	assert.NoError(t, err)
+	sessions, err := db.ListSessionsByUser(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+}
+
+func TestSessionRevoke(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	a := newTestAuth(t)
+	a.SetRevocationStore(db)
+	m := session.NewManager(db, a, time.Hour)
+	r := httptest.NewRequest("POST", "/login", nil)
+
+	u := &user.User{Email: "alice@example.com"}
+	assert.NoError(t, db.CreateUser(ctx, u))
+
+	tokens, err := m.Start(ctx, u.ID, r)
+	assert.NoError(t, err)
+
+	// another user can't revoke it
+	assert.ErrorIs(t, m.Revoke(ctx, "someone-else", tokens.Session.ID), session.ErrNotFound)
+
+	assert.NoError(t, m.Revoke(ctx, u.ID, tokens.Session.ID))
+	_, err = m.Refresh(ctx, tokens.RefreshToken, r)
+	assert.ErrorIs(t, err, session.ErrInvalidRefreshToken)
+
+	// deleting the user deletes their sessions
+	_, err = m.Start(ctx, u.ID, r)
+	assert.NoError(t, err)
+	assert.NoError(t, db.DeleteUser(ctx, u.ID))
+	sessions, err := db.ListSessionsByUser(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestDisabledUserSignedOut(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	a := newTestAuth(t)
+	a.SetRevocationStore(db)
+	a.SetUserChecker(db)
+	m := session.NewManager(db, a, time.Hour)
+	api := user.NewHandler(db, db, a, m, nil).Routes()
+	r := httptest.NewRequest("POST", "/login", nil)
+
+	admin := &user.User{Email: "admin@example.com"}
+	epass, err := user.HashPassword("hunter22")
+	assert.NoError(t, err)
+	bob := &user.User{Email: "bob@example.com", EncryptedPassword: epass}
+	assert.NoError(t, db.CreateUser(ctx, admin))
+	assert.NoError(t, db.CreateUser(ctx, bob))
+
+	call := func(u *user.User, method, path, body string) int {
+		access, _, err := a.CreateToken(u.ID, "", time.Time{})
+		assert.NoError(t, err)
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+access)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// changing the password signs out everywhere
+	tokens, err := m.Start(ctx, bob.ID, r)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, call(bob, http.MethodPost, "/me/password", `{"current_password":"hunter22","new_password":"hunter23"}`))
+	_, err = m.Refresh(ctx, tokens.RefreshToken, r)
+	assert.ErrorIs(t, err, session.ErrInvalidRefreshToken)
+
+	// so does being disabled
+	tokens, err = m.Start(ctx, bob.ID, r)
+	assert.NoError(t, err)
+	authenticated := func(access string) bool {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+access)
+		return a.IsAuthenticated(req) != nil
+	}
+	assert.True(t, authenticated(tokens.AccessToken))
+
+	assert.Equal(t, http.StatusOK, call(admin, http.MethodPost, "/"+bob.ID+"/disable", ""))
+	_, err = m.Refresh(ctx, tokens.RefreshToken, r)
+	assert.ErrorIs(t, err, session.ErrInvalidRefreshToken)
+	assert.False(t, authenticated(tokens.AccessToken))
+
+	// tokens outside of a session are refused while the user is disabled
+	access, _, err := a.CreateToken(bob.ID, "", time.Time{})
+	assert.NoError(t, err)
+	assert.False(t, authenticated(access))
+	assert.Equal(t, http.StatusOK, call(admin, http.MethodPost, "/"+bob.ID+"/enable", ""))
+	assert.True(t, authenticated(access))
+}
@@ -21,6 +21,18 @@ func (d *DB) ReadSettings(ctx context.Context, id string) (*settings.Settings, e
 	return &s, nil
 }
 
+func (d *DB) ListSettings(ctx context.Context) ([]*settings.Settings, error) {
+	var s []*settings.Settings
+	err := d.Db.NewSelect().
+		Model(&s).
+		Order("key ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 func (d *DB) ReadValue(ctx context.Context, key string) (string, error) {
 	s, err := d.ReadSettings(ctx, key)
 
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+
+	"github.com/zackb/updog/share"
+)
+
+func (db *DB) CreateLink(ctx context.Context, l *share.Link) error {
+	_, err := db.Db.NewInsert().Model(l).Exec(ctx)
+	return err
+}
+
+func (db *DB) ReadLinkBySlug(ctx context.Context, slug string) (*share.Link, error) {
+	l := &share.Link{}
+	err := db.Db.NewSelect().Model(l).Where("slug = ?", slug).Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (db *DB) ListLinksByDomain(ctx context.Context, domainID string) ([]*share.Link, error) {
+	var links []*share.Link
+	err := db.Db.NewSelect().
+		Model(&links).
+		Where("domain_id = ?", domainID).
+		Order("created_at DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func (db *DB) DeleteLink(ctx context.Context, domainID, linkID string) error {
+	_, err := db.Db.NewDelete().
+		Model((*share.Link)(nil)).
+		Where("id = ?", linkID).
+		Where("domain_id = ?", domainID).
+		Exec(ctx)
+	return err
+}
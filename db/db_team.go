@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/team"
+)
+
+func (db *DB) CreateTeam(ctx context.Context, t *team.Team, ownerID string) error {
+	return db.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(t).Exec(ctx); err != nil {
+			return err
+		}
+		_, err := tx.NewInsert().Model(&team.Member{
+			TeamID:    t.ID,
+			UserID:    ownerID,
+			Role:      team.RoleOwner,
+			CreatedAt: time.Now(),
+		}).Exec(ctx)
+		return err
+	})
+}
+
+func (db *DB) ReadTeam(ctx context.Context, teamID string) (*team.Team, error) {
+	t := &team.Team{}
+	err := db.Db.NewSelect().Model(t).Where("id = ?", teamID).Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (db *DB) UpdateTeam(ctx context.Context, t *team.Team) error {
+	_, err := db.Db.NewUpdate().Model(t).WherePK().Exec(ctx)
+	return err
+}
+
+func (db *DB) DeleteTeam(ctx context.Context, teamID string) error {
+	return db.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		return deleteTeam(ctx, tx, teamID)
+	})
+}
+
+// deleteTeam removes the team in tx, leaving its domains with their owners
+func deleteTeam(ctx context.Context, tx bun.Tx, teamID string) error {
+	_, err := tx.NewUpdate().
+		Model((*domain.Domain)(nil)).
+		Set("team_id = NULL").
+		Where("team_id = ?", teamID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	for _, model := range []any{
+		(*team.Invitation)(nil),
+		(*team.Member)(nil),
+	} {
+		if _, err := tx.NewDelete().Model(model).Where("team_id = ?", teamID).Exec(ctx); err != nil {
+			return err
+		}
+	}
+	_, err = tx.NewDelete().Model((*team.Team)(nil)).Where("id = ?", teamID).Exec(ctx)
+	return err
+}
+
+func (db *DB) ListTeamsByUser(ctx context.Context, userID string) ([]*team.Member, error) {
+	var members []*team.Member
+	err := db.Db.NewSelect().
+		Model(&members).
+		Relation("Team").
+		Where("member.user_id = ?", userID).
+		Order("team.name ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (db *DB) ReadMember(ctx context.Context, teamID, userID string) (*team.Member, error) {
+	m := &team.Member{}
+	err := db.Db.NewSelect().
+		Model(m).
+		Where("team_id = ?", teamID).
+		Where("user_id = ?", userID).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (db *DB) ListMembers(ctx context.Context, teamID string) ([]*team.Member, error) {
+	var members []*team.Member
+	err := db.Db.NewSelect().
+		Model(&members).
+		Relation("User").
+		Where("member.team_id = ?", teamID).
+		Order("member.created_at ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (db *DB) UpdateMember(ctx context.Context, m *team.Member) error {
+	_, err := db.Db.NewUpdate().
+		Model(m).
+		Column("role").
+		WherePK().
+		Exec(ctx)
+	return err
+}
+
+func (db *DB) RemoveMember(ctx context.Context, teamID, userID string) error {
+	_, err := db.Db.NewDelete().
+		Model((*team.Member)(nil)).
+		Where("team_id = ?", teamID).
+		Where("user_id = ?", userID).
+		Exec(ctx)
+	return err
+}
+
+func (db *DB) CreateInvitation(ctx context.Context, inv *team.Invitation) error {
+	_, err := db.Db.NewInsert().Model(inv).Exec(ctx)
+	return err
+}
+
+func (db *DB) ReadInvitationByToken(ctx context.Context, token string) (*team.Invitation, error) {
+	inv := &team.Invitation{}
+	err := db.Db.NewSelect().
+		Model(inv).
+		Relation("Team").
+		Where("invitation.token_hash = ?", team.HashToken(token)).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+func (db *DB) ListInvitations(ctx context.Context, teamID string) ([]*team.Invitation, error) {
+	var invitations []*team.Invitation
+	err := db.Db.NewSelect().
+		Model(&invitations).
+		Where("team_id = ?", teamID).
+		Where("accepted_at IS NULL").
+		Order("created_at DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (db *DB) DeleteInvitation(ctx context.Context, teamID, invitationID string) error {
+	_, err := db.Db.NewDelete().
+		Model((*team.Invitation)(nil)).
+		Where("team_id = ?", teamID).
+		Where("id = ?", invitationID).
+		Exec(ctx)
+	return err
+}
+
+func (db *DB) AcceptInvitation(ctx context.Context, inv *team.Invitation, userID string) error {
+	return db.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// only the first accept wins
+		res, err := tx.NewUpdate().
+			Model((*team.Invitation)(nil)).
+			Set("accepted_at = ?", time.Now().UTC()).
+			Where("id = ?", inv.ID).
+			Where("accepted_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return team.ErrInvitationUsed
+		}
+
+		// an existing member keeps the higher of the two roles
+		existing := &team.Member{}
+		err = tx.NewSelect().Model(existing).Where("team_id = ?", inv.TeamID).Where("user_id = ?", userID).Scan(ctx)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err == nil {
+			if team.RoleAtLeast(existing.Role, inv.Role) {
+				return nil
+			}
+			existing.Role = inv.Role
+			_, err = tx.NewUpdate().Model(existing).Column("role").WherePK().Exec(ctx)
+			return err
+		}
+
+		_, err = tx.NewInsert().Model(&team.Member{
+			TeamID:    inv.TeamID,
+			UserID:    userID,
+			Role:      inv.Role,
+			CreatedAt: time.Now(),
+		}).Exec(ctx)
+		return err
+	})
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/team"
+	"github.com/zackb/updog/user"
+)
+
+func TestTeamMembership(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	alice := &user.User{Email: "alice@example.com"}
+	bob := &user.User{Email: "Bob@example.com"}
+	assert.NoError(t, db.CreateUser(ctx, alice))
+	assert.NoError(t, db.CreateUser(ctx, bob))
+
+	tm := &team.Team{ID: id.NewID(), Name: "Marketing"}
+	assert.NoError(t, db.CreateTeam(ctx, tm, alice.ID))
+
+	shared := &domain.Domain{ID: id.NewID(), Name: "shared.example.com", UserID: alice.ID, TeamID: tm.ID}
+	private := &domain.Domain{ID: id.NewID(), Name: "private.example.com", UserID: alice.ID}
+	for _, d := range []*domain.Domain{shared, private} {
+		_, err := db.CreateDomain(ctx, d)
+		assert.NoError(t, err)
+	}
+
+	// bob can't see anything until he joins
+	domains, err := db.ListDomainsByUser(ctx, bob.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, domains)
+	_, role, err := db.ReadDomainForUser(ctx, shared.ID, bob.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, role)
+
+	inv, token := team.NewInvitation(tm.ID, "bob@example.com", team.RoleViewer, alice.ID)
+	assert.NoError(t, db.CreateInvitation(ctx, inv))
+
+	_, err = team.Accept(ctx, db, token, alice)
+	assert.ErrorIs(t, err, team.ErrWrongRecipient)
+	_, err = team.Accept(ctx, db, token, bob)
+	assert.ErrorIs(t, err, team.ErrEmailNotVerified)
+	bob.EmailVerified = true
+	_, err = team.Accept(ctx, db, token, bob)
+	assert.NoError(t, err)
+	_, err = team.Accept(ctx, db, token, bob)
+	assert.ErrorIs(t, err, team.ErrInvitationInvalid)
+
+	domains, err = db.ListDomainsByUser(ctx, bob.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, domains, 1) {
+		assert.Equal(t, shared.ID, domains[0].ID)
+	}
+	_, role, err = db.ReadDomainForUser(ctx, shared.ID, bob.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, team.RoleViewer, role)
+	_, role, err = db.ReadDomainForUser(ctx, shared.ID, alice.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, team.RoleOwner, role)
+
+	// the last owner can't leave or be demoted
+	owner, err := db.ReadMember(ctx, tm.ID, alice.ID)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, team.Remove(ctx, db, owner), team.ErrLastOwner)
+	assert.ErrorIs(t, team.SetRole(ctx, db, owner, team.RoleEditor), team.ErrLastOwner)
+
+	member, err := db.ReadMember(ctx, tm.ID, bob.ID)
+	assert.NoError(t, err)
+	assert.NoError(t, team.SetRole(ctx, db, member, team.RoleOwner))
+	assert.NoError(t, team.Remove(ctx, db, owner))
+
+	// deleting the team leaves the domain with its owner
+	assert.NoError(t, db.DeleteTeam(ctx, tm.ID))
+	domains, err = db.ListDomainsByUser(ctx, bob.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, domains)
+	d, err := db.ReadDomain(ctx, shared.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, d.TeamID)
+}
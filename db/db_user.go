@@ -2,9 +2,16 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"time"
 
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/apikey"
+	"github.com/zackb/updog/domain"
 	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/session"
+	"github.com/zackb/updog/team"
 	"github.com/zackb/updog/user"
 )
 
@@ -29,16 +36,60 @@ func (db *DB) ReadUserByEmail(ctx context.Context, email string) (*user.User, er
 	return user, nil
 }
 
+func (db *DB) ReadUserByOIDCSubject(ctx context.Context, issuer, subject string) (*user.User, error) {
+	user := &user.User{}
+	err := db.Db.NewSelect().
+		Model(user).
+		Where("oidc_issuer = ?", issuer).
+		Where("oidc_subject = ?", subject).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// IsUserDisabled is true if the user was disabled or doesn't exist
+func (db *DB) IsUserDisabled(ctx context.Context, id string) (bool, error) {
+	var disabled bool
+	err := db.Db.NewSelect().
+		Model((*user.User)(nil)).
+		Column("disabled").
+		Where("id = ?", id).
+		Scan(ctx, &disabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	return disabled, err
+}
+
+// CreateUser inserts u, the first user of an instance becomes its admin
 func (db *DB) CreateUser(ctx context.Context, u *user.User) error {
 	if u.ID == "" {
 		u.ID = id.NewID()
 		u.CreatedAt = time.Now()
 	}
-	_, err := db.Db.NewInsert().Model(u).Exec(ctx)
-	if err != nil {
-		return err
+	if u.Role == "" {
+		u.Role = user.RoleMember
 	}
-	return nil
+	return db.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// two first signups mustn't both see no users and become admins. sqlite already has a single
+		// writer and fails the other transaction, postgres lets both read so signups take turns.
+		if db.Db.Dialect().Name().String() == "pg" {
+			if _, err := tx.ExecContext(ctx, "LOCK TABLE users IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+				return err
+			}
+		}
+		exists, err := tx.NewSelect().Model((*user.User)(nil)).Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			u.Role = user.RoleAdmin
+		}
+		_, err = tx.NewInsert().Model(u).Exec(ctx)
+		return err
+	})
 }
 
 func (db *DB) UpdateUser(ctx context.Context, u *user.User) error {
@@ -46,3 +97,108 @@ func (db *DB) UpdateUser(ctx context.Context, u *user.User) error {
 	_, err := db.Db.NewUpdate().Model(u).Where("id = ?", u.ID).Exec(ctx)
 	return err
 }
+
+func (db *DB) DeleteUser(ctx context.Context, id string) error {
+	return db.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var memberships []*team.Member
+		if err := tx.NewSelect().Model(&memberships).Where("user_id = ?", id).Scan(ctx); err != nil {
+			return err
+		}
+
+		// teams only they belong to go with them, any other team needs another owner to take over
+		newOwners := map[string]string{}
+		for _, m := range memberships {
+			var others []*team.Member
+			err := tx.NewSelect().
+				Model(&others).
+				Where("team_id = ?", m.TeamID).
+				Where("user_id != ?", id).
+				Order("created_at ASC").
+				Scan(ctx)
+			if err != nil {
+				return err
+			}
+			if len(others) == 0 {
+				if err := deleteTeam(ctx, tx, m.TeamID); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, o := range others {
+				if o.Role == team.RoleOwner {
+					newOwners[m.TeamID] = o.UserID
+					break
+				}
+			}
+			if newOwners[m.TeamID] == "" {
+				return user.ErrSoleTeamOwner
+			}
+		}
+
+		var domains []*domain.Domain
+		if err := tx.NewSelect().Model(&domains).Column("id", "team_id").Where("user_id = ?", id).Scan(ctx); err != nil {
+			return err
+		}
+		for _, d := range domains {
+			// a team keeps its domains, under another of its owners
+			owner, ok := newOwners[d.TeamID]
+			if !ok && d.TeamID != "" {
+				err := tx.NewSelect().
+					Model((*team.Member)(nil)).
+					Column("user_id").
+					Where("team_id = ?", d.TeamID).
+					Where("role = ?", team.RoleOwner).
+					Where("user_id != ?", id).
+					Order("created_at ASC").
+					Limit(1).
+					Scan(ctx, &owner)
+				if err != nil && !errors.Is(err, sql.ErrNoRows) {
+					return err
+				}
+				newOwners[d.TeamID] = owner
+			}
+			if owner != "" {
+				_, err := tx.NewUpdate().Model((*domain.Domain)(nil)).Set("user_id = ?", owner).Where("id = ?", d.ID).Exec(ctx)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if err := deleteDomain(ctx, tx, d.ID); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.NewDelete().
+			Model((*session.RefreshToken)(nil)).
+			Where("session_id IN (?)", tx.NewSelect().Model((*session.Session)(nil)).Column("id").Where("user_id = ?", id)).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		for _, model := range []any{
+			(*team.Member)(nil),
+			(*apikey.Key)(nil),
+			(*session.Session)(nil),
+		} {
+			if _, err := tx.NewDelete().Model(model).Where("user_id = ?", id).Exec(ctx); err != nil {
+				return err
+			}
+		}
+		_, err = tx.NewDelete().Model((*user.User)(nil)).Where("id = ?", id).Exec(ctx)
+		return err
+	})
+}
+
+func (db *DB) CountAdmins(ctx context.Context) (int, error) {
+	return db.Db.NewSelect().Model((*user.User)(nil)).Where("role = ?", user.RoleAdmin).Where("disabled = ?", false).Count(ctx)
+}
+
+func (db *DB) ListUsers(ctx context.Context, limit, offset int) ([]*user.User, error) {
+	var users []*user.User
+	err := db.Db.NewSelect().Model(&users).Order("created_at ASC").Limit(limit).Offset(offset).Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -0,0 +1,389 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/mail"
+	"github.com/zackb/updog/oidc"
+	"github.com/zackb/updog/pageview"
+	"github.com/zackb/updog/session"
+	"github.com/zackb/updog/team"
+	"github.com/zackb/updog/totp"
+	"github.com/zackb/updog/user"
+)
+
+func TestDeleteUser(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	alice := &user.User{Email: "alice@example.com"}
+	bob := &user.User{Email: "bob@example.com"}
+	assert.NoError(t, db.CreateUser(ctx, alice))
+	assert.NoError(t, db.CreateUser(ctx, bob))
+	// the first user becomes admin
+	alice, err := db.ReadUser(ctx, alice.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, user.RoleAdmin, alice.Role)
+	bob, err = db.ReadUser(ctx, bob.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, user.RoleMember, bob.Role)
+
+	var domains []*domain.Domain
+	for _, d := range []*domain.Domain{
+		{ID: id.NewID(), Name: "a.example.com", UserID: alice.ID},
+		{ID: id.NewID(), Name: "b.example.com", UserID: alice.ID},
+		{ID: id.NewID(), Name: "bob.example.com", UserID: bob.ID},
+	} {
+		_, err := db.CreateDomain(ctx, d)
+		assert.NoError(t, err)
+		domains = append(domains, d)
+
+		_, err = db.Db.NewInsert().Model(&pageview.Pageview{Timestamp: time.Now(), DomainID: d.ID}).Exec(ctx)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, db.DeleteUser(ctx, alice.ID))
+
+	_, err = db.ReadUser(ctx, alice.ID)
+	assert.Error(t, err)
+
+	remaining, err := db.ListDomains(ctx, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, remaining, 1)
+	assert.Equal(t, domains[2].ID, remaining[0].ID)
+
+	n, err := db.Db.NewSelect().Model((*pageview.Pageview)(nil)).Count(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	users, err := db.ListUsers(ctx, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, bob.ID, users[0].ID)
+
+	stats, err := db.InstanceStats(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.Users)
+	assert.Equal(t, 1, stats.Domains)
+	assert.Equal(t, 1, stats.PageviewsLastHour)
+	assert.Positive(t, stats.StorageBytes)
+}
+
+func TestDeleteUser_Teams(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	alice := &user.User{Email: "alice@example.com"}
+	bob := &user.User{Email: "bob@example.com"}
+	carol := &user.User{Email: "carol@example.com"}
+	for _, u := range []*user.User{alice, bob, carol} {
+		assert.NoError(t, db.CreateUser(ctx, u))
+	}
+
+	// alice owns marketing with bob, and a team of her own
+	marketing := &team.Team{ID: id.NewID(), Name: "Marketing"}
+	solo := &team.Team{ID: id.NewID(), Name: "Solo"}
+	assert.NoError(t, db.CreateTeam(ctx, marketing, alice.ID))
+	assert.NoError(t, db.CreateTeam(ctx, solo, alice.ID))
+	inv, _ := team.NewInvitation(marketing.ID, bob.Email, team.RoleViewer, alice.ID)
+	assert.NoError(t, db.CreateInvitation(ctx, inv))
+	assert.NoError(t, db.AcceptInvitation(ctx, inv, bob.ID))
+
+	// carol owns sales and shares a domain of alice's
+	sales := &team.Team{ID: id.NewID(), Name: "Sales"}
+	assert.NoError(t, db.CreateTeam(ctx, sales, carol.ID))
+
+	shared := &domain.Domain{ID: id.NewID(), Name: "shared.example.com", UserID: alice.ID, TeamID: marketing.ID}
+	sold := &domain.Domain{ID: id.NewID(), Name: "sales.example.com", UserID: alice.ID, TeamID: sales.ID}
+	alone := &domain.Domain{ID: id.NewID(), Name: "solo.example.com", UserID: alice.ID, TeamID: solo.ID}
+	private := &domain.Domain{ID: id.NewID(), Name: "private.example.com", UserID: alice.ID}
+	for _, d := range []*domain.Domain{shared, sold, alone, private} {
+		_, err := db.CreateDomain(ctx, d)
+		assert.NoError(t, err)
+	}
+
+	// bob is only a viewer, marketing would have nobody to own it
+	assert.ErrorIs(t, db.DeleteUser(ctx, alice.ID), user.ErrSoleTeamOwner)
+	_, err := db.ReadUser(ctx, alice.ID)
+	assert.NoError(t, err)
+	_, err = db.ReadDomain(ctx, private.ID)
+	assert.NoError(t, err, "nothing is deleted")
+
+	member, err := db.ReadMember(ctx, marketing.ID, bob.ID)
+	assert.NoError(t, err)
+	assert.NoError(t, team.SetRole(ctx, db, member, team.RoleOwner))
+	assert.NoError(t, db.DeleteUser(ctx, alice.ID))
+
+	// teams keep their domains under another owner
+	d, err := db.ReadDomain(ctx, shared.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, bob.ID, d.UserID)
+	assert.Equal(t, marketing.ID, d.TeamID)
+	d, err = db.ReadDomain(ctx, sold.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, carol.ID, d.UserID)
+
+	// the rest went with her
+	for _, gone := range []*domain.Domain{alone, private} {
+		_, err = db.ReadDomain(ctx, gone.ID)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+	}
+	_, err = db.ReadTeam(ctx, solo.ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	members, err := db.ListMembers(ctx, marketing.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, members, 1) {
+		assert.Equal(t, bob.ID, members[0].UserID)
+	}
+}
+
+func TestLastAdmin(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	a := newTestAuth(t)
+	api := user.NewHandler(db, db, a, session.NewManager(db, a, time.Hour), nil).Routes()
+
+	epass, err := user.HashPassword("hunter22")
+	assert.NoError(t, err)
+	alice := &user.User{Email: "alice@example.com", EncryptedPassword: epass}
+	bob := &user.User{Email: "bob@example.com", EncryptedPassword: epass}
+	assert.NoError(t, db.CreateUser(ctx, alice))
+	assert.NoError(t, db.CreateUser(ctx, bob))
+
+	call := func(u *user.User, method, path, body string) int {
+		access, _, err := a.CreateToken(u.ID, "", time.Time{})
+		assert.NoError(t, err)
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+access)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		return w.Code
+	}
+	role := func(u *user.User) string {
+		found, err := db.ReadUser(ctx, u.ID)
+		assert.NoError(t, err)
+		return found.Role
+	}
+
+	// alice signed up first and is the only admin
+	assert.Equal(t, http.StatusConflict, call(alice, http.MethodDelete, "/me", `{"password":"hunter22"}`))
+	assert.Equal(t, http.StatusBadRequest, call(alice, http.MethodPatch, "/"+alice.ID, `{"role":"member"}`))
+	assert.Equal(t, http.StatusForbidden, call(bob, http.MethodPatch, "/"+bob.ID, `{"role":"admin"}`))
+
+	assert.Equal(t, http.StatusBadRequest, call(alice, http.MethodPatch, "/"+bob.ID, `{"role":"owner"}`))
+	assert.Equal(t, http.StatusOK, call(alice, http.MethodPatch, "/"+bob.ID, `{"role":"admin"}`))
+	assert.Equal(t, user.RoleAdmin, role(bob))
+
+	// a disabled admin can't take over
+	assert.Equal(t, http.StatusOK, call(alice, http.MethodPost, "/"+bob.ID+"/disable", ""))
+	assert.Equal(t, http.StatusConflict, call(alice, http.MethodDelete, "/me", `{"password":"hunter22"}`))
+	assert.Equal(t, http.StatusOK, call(alice, http.MethodPost, "/"+bob.ID+"/enable", ""))
+
+	// with two, either can step down
+	assert.Equal(t, http.StatusOK, call(bob, http.MethodPatch, "/"+alice.ID, `{"role":"member"}`))
+	assert.Equal(t, user.RoleMember, role(alice))
+	assert.Equal(t, http.StatusForbidden, call(alice, http.MethodPatch, "/"+alice.ID, `{"role":"admin"}`))
+	assert.Equal(t, http.StatusNoContent, call(alice, http.MethodDelete, "/me", `{"password":"hunter22"}`))
+
+	n, err := db.CountAdmins(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestCreateUser_ConcurrentFirstSignups(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	// signups racing to be first may fail, but only one of them becomes admin
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Go(func() {
+			_ = db.CreateUser(ctx, &user.User{Email: fmt.Sprintf("user%d@example.com", i)})
+		})
+	}
+	wg.Wait()
+
+	users, err := db.ListUsers(ctx, 100, 0)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, users)
+	admins := 0
+	for _, u := range users {
+		if u.IsAdmin() {
+			admins++
+		}
+	}
+	assert.Equal(t, 1, admins)
+}
+
+func TestUserTwoFactor(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	u := &user.User{Email: "alice@example.com", TOTPSecret: totp.NewSecret()}
+	assert.NoError(t, db.CreateUser(ctx, u))
+
+	now := time.Now()
+	code, err := totp.Code(u.TOTPSecret, totp.Step(now))
+	assert.NoError(t, err)
+	recovery, ok := u.EnableTwoFactor(code, now)
+	assert.True(t, ok)
+	assert.NoError(t, db.UpdateUser(ctx, u))
+
+	u, err = db.ReadUser(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.True(t, u.TOTPEnabled)
+	assert.Equal(t, totp.RecoveryCodeCount, u.RecoveryCodesLeft())
+
+	// a code can't be used twice, recovery codes are used up
+	assert.False(t, u.CheckSecondFactor(code, now))
+	assert.True(t, u.CheckSecondFactor(recovery[0], now))
+	assert.False(t, u.CheckSecondFactor(recovery[0], now))
+	assert.Equal(t, totp.RecoveryCodeCount-1, u.RecoveryCodesLeft())
+
+	u.DisableTwoFactor()
+	assert.NoError(t, db.UpdateUser(ctx, u))
+	u, err = db.ReadUser(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.False(t, u.TOTPEnabled)
+	assert.Empty(t, u.TOTPSecret)
+}
+
+// outbox keeps sent messages instead of delivering them
+type outbox []*mail.Message
+
+func (o *outbox) Send(ctx context.Context, msg *mail.Message) error {
+	*o = append(*o, msg)
+	return nil
+}
+
+// linkToken reads the token from the link in the last message
+func (o outbox) linkToken(t *testing.T) string {
+	body := o[len(o)-1].Body
+	i := strings.Index(body, "token=")
+	assert.True(t, i >= 0)
+	token, err := url.QueryUnescape(strings.Fields(body[i+len("token="):])[0])
+	assert.NoError(t, err)
+	return token
+}
+
+func TestUserEmailLinks(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	a := newTestAuth(t)
+	var sent outbox
+	emails := user.NewEmails(db, a, &sent)
+
+	// links are only emailed once they can point at the configured URL rather than the request's host
+	t.Setenv("BASE_URL", "")
+	assert.ErrorIs(t, emails.SendPasswordReset(ctx, "alice@example.com"), mail.ErrNoBaseURL)
+	t.Setenv("BASE_URL", "https://updog.example.com/")
+
+	pw, err := user.HashPassword("old password")
+	assert.NoError(t, err)
+	u := &user.User{Email: "alice@example.com", EncryptedPassword: pw}
+	assert.NoError(t, db.CreateUser(ctx, u))
+
+	// confirming the email
+	assert.NoError(t, emails.SendVerification(ctx, u))
+	assert.Contains(t, sent[0].Body, "https://updog.example.com/verify-email?token=")
+	verify := sent.linkToken(t)
+	u, err = emails.VerifyEmail(ctx, verify)
+	assert.NoError(t, err)
+	assert.True(t, u.EmailVerified)
+
+	// the link is for the address it was sent to
+	u.Email = "mallory@example.com"
+	u.EmailVerified = false
+	assert.NoError(t, db.UpdateUser(ctx, u))
+	_, err = emails.VerifyEmail(ctx, verify)
+	assert.ErrorIs(t, err, user.ErrInvalidLink)
+
+	// unknown emails are ignored without telling the caller
+	assert.NoError(t, emails.SendPasswordReset(ctx, "nobody@example.com"))
+	emails.Wait()
+	assert.Len(t, sent, 1)
+
+	assert.NoError(t, emails.SendPasswordReset(ctx, "mallory@example.com"))
+	emails.Wait()
+	assert.Len(t, sent, 2)
+	reset := sent.linkToken(t)
+	_, err = emails.VerifyEmail(ctx, reset)
+	assert.ErrorIs(t, err, user.ErrInvalidLink)
+
+	u, err = emails.ResetPassword(ctx, reset, "new password")
+	assert.NoError(t, err)
+	assert.True(t, u.Validate("new password"))
+	assert.True(t, u.EmailVerified)
+
+	// the reset link works once
+	_, err = emails.ResetPassword(ctx, reset, "another password")
+	assert.ErrorIs(t, err, user.ErrInvalidLink)
+}
+
+func TestOIDCProvision(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	issuer := "https://sso.example.com"
+
+	alice := &user.User{Email: "alice@example.com"}
+	assert.NoError(t, db.CreateUser(ctx, alice))
+
+	// an existing account is only linked if the provider confirmed the email
+	claims := &oidc.Claims{Subject: "sub-alice", Email: "alice@example.com"}
+	_, err := oidc.Provision(ctx, db, issuer, claims, nil, true)
+	assert.ErrorIs(t, err, oidc.ErrEmailNotVerified)
+	claims.EmailVerified = true
+	u, err := oidc.Provision(ctx, db, issuer, claims, nil, true)
+	assert.NoError(t, err)
+	assert.Equal(t, alice.ID, u.ID)
+
+	// afterwards the subject finds it even if the email changed at the provider
+	u, err = oidc.Provision(ctx, db, issuer, &oidc.Claims{Subject: "sub-alice", Email: "alice@new.example.com"}, nil, true)
+	assert.NoError(t, err)
+	assert.Equal(t, alice.ID, u.ID)
+
+	// new users are created unless signups are disabled, and only at allowed domains
+	bob := &oidc.Claims{Subject: "sub-bob", Email: "bob@example.com", Name: "Bob Builder"}
+	_, err = oidc.Provision(ctx, db, issuer, bob, []string{"corp.example.com"}, true)
+	assert.ErrorIs(t, err, oidc.ErrDomainNotAllowed)
+	_, err = oidc.Provision(ctx, db, issuer, bob, nil, false)
+	assert.ErrorIs(t, err, oidc.ErrSignupsDisabled)
+	u, err = oidc.Provision(ctx, db, issuer, bob, nil, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bob Builder", u.Name)
+	assert.Empty(t, u.EncryptedPassword)
+	assert.False(t, u.EmailVerified)
+	read, err := db.ReadUserByOIDCSubject(ctx, issuer, "sub-bob")
+	assert.NoError(t, err)
+	assert.Equal(t, u.ID, read.ID)
+
+	// anyone can claim an email at an allowed domain, it has to be confirmed by the provider
+	carol := &oidc.Claims{Subject: "sub-carol", Email: "carol@corp.example.com"}
+	_, err = oidc.Provision(ctx, db, issuer, carol, []string{"corp.example.com"}, true)
+	assert.ErrorIs(t, err, oidc.ErrDomainNotVerified)
+	_, err = db.ReadUserByOIDCSubject(ctx, issuer, "sub-carol")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// nor can an unverified email at an allowed domain be linked to the existing account
+	assert.NoError(t, db.CreateUser(ctx, &user.User{Email: "dave@corp.example.com"}))
+	dave := &oidc.Claims{Subject: "sub-dave", Email: "dave@corp.example.com"}
+	_, err = oidc.Provision(ctx, db, issuer, dave, []string{"corp.example.com"}, true)
+	assert.ErrorIs(t, err, oidc.ErrDomainNotVerified)
+
+	carol.EmailVerified = true
+	u, err = oidc.Provision(ctx, db, issuer, carol, []string{"corp.example.com"}, true)
+	assert.NoError(t, err)
+	assert.True(t, u.EmailVerified)
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/pageview"
+)
+
+// vitalsBatchSize is how many raw vitals or rollup rows are read or written at once
+const vitalsBatchSize = 1000
+
+// GetPageVitals reports the 75th percentile of each vital per page, pages with the most samples first
+func (db *DB) GetPageVitals(ctx context.Context, domainID string, start, end time.Time, f pageview.VitalsFilter, limit int) ([]*pageview.PageVitals, error) {
+	pages := map[string]pageview.VitalsSketches{}
+	err := db.vitalSketches(ctx, domainID, start, end, f, func(_ time.Time, path string) pageview.VitalsSketches {
+		if pages[path] == nil {
+			pages[path] = pageview.VitalsSketches{}
+		}
+		return pages[path]
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]*pageview.PageVitals, 0, len(pages))
+	for path, sketches := range pages {
+		stats = append(stats, &pageview.PageVitals{Path: path, VitalsSummary: sketches.Summary()})
+	}
+	slices.SortFunc(stats, func(a, b *pageview.PageVitals) int {
+		if c := cmp.Compare(b.Samples, a.Samples); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+// GetDailyVitals reports the 75th percentile of each vital per day, oldest first
+func (db *DB) GetDailyVitals(ctx context.Context, domainID string, start, end time.Time, f pageview.VitalsFilter) ([]*pageview.VitalsPoint, error) {
+	days := map[time.Time]pageview.VitalsSketches{}
+	err := db.vitalSketches(ctx, domainID, start, end, f, func(day time.Time, _ string) pageview.VitalsSketches {
+		if days[day] == nil {
+			days[day] = pageview.VitalsSketches{}
+		}
+		return days[day]
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]*pageview.VitalsPoint, 0, len(days))
+	for day, sketches := range days {
+		points = append(points, &pageview.VitalsPoint{Time: day, VitalsSummary: sketches.Summary()})
+	}
+	slices.SortFunc(points, func(a, b *pageview.VitalsPoint) int {
+		return a.Time.Compare(b.Time)
+	})
+	return points, nil
+}
+
+// vitalSketches merges the domain's vitals between start and end matching f into the sketches bucket
+// returns for each day and path. Completed days are read from their rollups, today from the raw vitals.
+func (db *DB) vitalSketches(ctx context.Context, domainID string, start, end time.Time, f pageview.VitalsFilter, bucket func(day time.Time, path string) pageview.VitalsSketches) error {
+	start = startOfDay(start)
+	todayStart := startOfDay(time.Now())
+
+	historicEnd := end
+	if historicEnd.After(todayStart) {
+		historicEnd = todayStart.Add(-time.Nanosecond)
+	}
+
+	liveStart := start
+	if liveStart.Before(todayStart) {
+		liveStart = todayStart
+	}
+
+	// historic, comparing days as YYYY-MM-DD strings as sqlite may store them with a time component
+	if start.Before(todayStart) {
+		var daily []struct {
+			Day    time.Time        `bun:"day"`
+			Path   string           `bun:"path"`
+			Metric string           `bun:"metric"`
+			Sketch *pageview.Sketch `bun:"sketch"`
+		}
+		q := db.Db.NewSelect().
+			Model((*pageview.DailyVital)(nil)).
+			ColumnExpr("daily_vital.day, path.path, daily_vital.metric, daily_vital.sketch").
+			Join("JOIN paths AS path ON path.id = daily_vital.path_id").
+			Where("daily_vital.domain_id = ?", domainID).
+			Where("daily_vital.day >= ?", start.Format("2006-01-02")).
+			Where("daily_vital.day < ?", startOfDay(historicEnd).AddDate(0, 0, 1).Format("2006-01-02"))
+		if err := vitalsFilter(q, f).Scan(ctx, &daily); err != nil {
+			return fmt.Errorf("reading historic vitals: %w", err)
+		}
+		for _, d := range daily {
+			bucket(startOfDay(d.Day), d.Path).Add(d.Metric, d.Sketch)
+		}
+	}
+
+	// live
+	if !end.Before(todayStart) {
+		var live []struct {
+			pageview.WebVital `bun:",extend"`
+			Path              string `bun:"path"`
+		}
+		q := db.Db.NewSelect().
+			Model(&live).
+			ColumnExpr("web_vital.*, path.path").
+			Join("JOIN paths AS path ON path.id = web_vital.path_id").
+			Where("web_vital.domain_id = ?", domainID).
+			Where("web_vital.ts >= ?", liveStart).
+			Where("web_vital.ts <= ?", end)
+		if err := vitalsFilter(q, f).Scan(ctx); err != nil {
+			return fmt.Errorf("reading live vitals: %w", err)
+		}
+		for _, v := range live {
+			sketches := bucket(startOfDay(v.Timestamp), v.Path)
+			for metric, value := range v.Values() {
+				if value != nil {
+					sketches.Record(metric, *value)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// vitalsFilter restricts a web_vitals or daily_web_vitals select to the device type and country in f
+func vitalsFilter(q *bun.SelectQuery, f pageview.VitalsFilter) *bun.SelectQuery {
+	if f.Device != "" {
+		q = q.Where("device_type_id IN (SELECT id FROM device_types WHERE name = ?)", f.Device)
+	}
+	if f.Country != "" {
+		q = q.Where("country_id IN (SELECT id FROM countries WHERE name = ?)", f.Country)
+	}
+	return q
+}
+
+// rollupVitals sketches a day of raw web vitals into daily_web_vitals using idb, which may be a transaction.
+// Percentiles can't be summed like counts, so each day keeps a sketch of every vital per dimension.
+func rollupVitals(ctx context.Context, idb bun.IDB, dayStart, dayEnd time.Time) error {
+	type key struct {
+		domainID                        string
+		pathID, deviceTypeID, countryID int64
+	}
+	sketches := map[key]pageview.VitalsSketches{}
+
+	var last int64
+	for {
+		var raw []*pageview.WebVital
+		err := idb.NewSelect().
+			Model(&raw).
+			Where("ts >= ?", dayStart).
+			Where("ts < ?", dayEnd).
+			Where("id > ?", last).
+			Order("id ASC").
+			Limit(vitalsBatchSize).
+			Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("reading web vitals: %w", err)
+		}
+		if len(raw) == 0 {
+			break
+		}
+		for _, v := range raw {
+			k := key{v.DomainID, v.PathID, v.DeviceTypeID, v.CountryID}
+			if sketches[k] == nil {
+				sketches[k] = pageview.VitalsSketches{}
+			}
+			for metric, value := range v.Values() {
+				if value != nil {
+					sketches[k].Record(metric, *value)
+				}
+			}
+		}
+		last = raw[len(raw)-1].ID
+	}
+
+	var rows []*pageview.DailyVital
+	for k, vitals := range sketches {
+		for metric, s := range vitals {
+			rows = append(rows, &pageview.DailyVital{
+				Day:          dayStart,
+				DomainID:     k.domainID,
+				PathID:       k.pathID,
+				DeviceTypeID: k.deviceTypeID,
+				CountryID:    k.countryID,
+				Metric:       metric,
+				Sketch:       s,
+			})
+		}
+	}
+	for batch := range slices.Chunk(rows, vitalsBatchSize) {
+		_, err := idb.NewInsert().
+			Model(&batch).
+			On("CONFLICT (day, domain_id, path_id, device_type_id, country_id, metric) DO UPDATE").
+			Set("sketch = EXCLUDED.sketch").
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("writing daily web vitals: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/pageview"
+)
+
+func TestWebVitals(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	d := &domain.Domain{ID: id.NewID(), Name: "example.com"}
+	_, err := db.CreateDomain(ctx, d)
+	assert.NoError(t, err)
+
+	home := &pageview.Path{Path: "/"}
+	assert.NoError(t, GetOrCreateDimension(ctx, db, home, "path", home.Path))
+	docs := &pageview.Path{Path: "/docs"}
+	assert.NoError(t, GetOrCreateDimension(ctx, db, docs, "path", docs.Path))
+	desktop := &pageview.DeviceType{Name: "Desktop"}
+	assert.NoError(t, GetOrCreateDimension(ctx, db, desktop, "name", desktop.Name))
+	mobile := &pageview.DeviceType{Name: "Mobile"}
+	assert.NoError(t, GetOrCreateDimension(ctx, db, mobile, "name", mobile.Name))
+
+	ms := func(v float64) *float64 { return &v }
+	now := time.Now().UTC()
+	yesterday := startOfDay(now).Add(-12 * time.Hour)
+	vitals := []*pageview.WebVital{
+		{Timestamp: yesterday, PathID: home.ID, DeviceTypeID: desktop.ID, LCP: ms(1000), TTFB: ms(200)},
+		{Timestamp: yesterday, PathID: home.ID, DeviceTypeID: desktop.ID, LCP: ms(2000)},
+		{Timestamp: yesterday, PathID: home.ID, DeviceTypeID: desktop.ID, LCP: ms(3000)},
+		{Timestamp: yesterday, PathID: home.ID, DeviceTypeID: desktop.ID, LCP: ms(4000)},
+		{Timestamp: yesterday, PathID: home.ID, DeviceTypeID: mobile.ID, LCP: ms(5000)},
+		{Timestamp: now.Add(-time.Minute), PathID: home.ID, DeviceTypeID: desktop.ID, LCP: ms(6000)},
+		{Timestamp: now.Add(-time.Minute), PathID: docs.ID, DeviceTypeID: mobile.ID, INP: ms(100), CLS: ms(0.05)},
+	}
+	for _, v := range vitals {
+		v.DomainID = d.ID
+	}
+	_, err = db.Db.NewInsert().Model(&vitals).Exec(ctx)
+	assert.NoError(t, err)
+
+	// rolling up twice replaces the day's sketches rather than adding to them
+	assert.NoError(t, db.RunDailyRollup(ctx, yesterday))
+	assert.NoError(t, db.RunDailyRollup(ctx, yesterday))
+	n, err := db.Db.NewSelect().Model((*pageview.DailyVital)(nil)).Count(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	// the rolled up day and today's raw vitals are merged into one distribution per page
+	pages, err := db.GetPageVitals(ctx, d.ID, yesterday, now, pageview.VitalsFilter{}, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, pages, 2) {
+		assert.Equal(t, "/", pages[0].Path)
+		assert.Equal(t, int64(6), pages[0].Samples)
+		assert.InEpsilon(t, 4000, *pages[0].LCP, 0.01)
+		assert.InEpsilon(t, 200, *pages[0].TTFB, 0.01)
+		assert.Nil(t, pages[0].INP)
+		assert.Equal(t, "/docs", pages[1].Path)
+		assert.InEpsilon(t, 100, *pages[1].INP, 0.01)
+		assert.InEpsilon(t, 0.05, *pages[1].CLS, 0.01)
+	}
+
+	pages, err = db.GetPageVitals(ctx, d.ID, yesterday, now, pageview.VitalsFilter{Device: "Mobile"}, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, pages, 2) {
+		assert.Equal(t, int64(1), pages[0].Samples)
+		assert.InEpsilon(t, 5000, *pages[0].LCP, 0.01)
+	}
+
+	days, err := db.GetDailyVitals(ctx, d.ID, yesterday, now, pageview.VitalsFilter{Device: "Desktop"})
+	assert.NoError(t, err)
+	if assert.Len(t, days, 2) {
+		assert.Equal(t, startOfDay(yesterday), days[0].Time)
+		assert.Equal(t, int64(4), days[0].Samples)
+		assert.InEpsilon(t, 3000, *days[0].LCP, 0.01)
+		assert.Equal(t, startOfDay(now), days[1].Time)
+		assert.InEpsilon(t, 6000, *days[1].LCP, 0.01)
+	}
+
+	// purging a page removes its raw vitals and rollups
+	result, err := db.PurgePageviews(ctx, d.ID, pageview.PurgeCriteria{PathPattern: "/"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), result.WebVitals)
+	pages, err = db.GetPageVitals(ctx, d.ID, yesterday, now, pageview.VitalsFilter{}, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, pages, 1) {
+		assert.Equal(t, "/docs", pages[0].Path)
+	}
+}
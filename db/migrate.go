@@ -0,0 +1,265 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// migrations are embedded per dialect as migrations/<dialect>/NNNN_name.(up|down).sql
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// Migration is a single versioned schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied to the database.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// SchemaMigration tracks applied migrations.
+type SchemaMigration struct {
+	bun.BaseModel `bun:"table:schema_migrations"`
+
+	Version   int64     `bun:",pk"`
+	Name      string    `bun:",notnull"`
+	AppliedAt time.Time `bun:",notnull,default:current_timestamp"`
+}
+
+// migrationsDir maps the bun dialect to the directory holding its migrations.
+func (d *DB) migrationsDir() string {
+	if d.Db.Dialect().Name().String() == "sqlite" {
+		return "migrations/sqlite"
+	}
+	return "migrations/postgres"
+}
+
+// LoadMigrations reads the embedded migrations for the database dialect, sorted by version.
+func (d *DB) LoadMigrations() ([]*Migration, error) {
+	return loadMigrations(migrationsFS, d.migrationsDir())
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+
+		// 0001_init.up.sql -> "0001_init", "up"
+		base := strings.TrimSuffix(e.Name(), ".sql")
+		dot := strings.LastIndex(base, ".")
+		if dot == -1 {
+			return nil, fmt.Errorf("migration %s: missing up/down suffix", e.Name())
+		}
+		stem, direction := base[:dot], base[dot+1:]
+
+		num, name, ok := strings.Cut(stem, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name", e.Name())
+		}
+		version, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", e.Name(), err)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d: conflicting names %q and %q", version, m.Name, name)
+		}
+
+		switch direction {
+		case "up":
+			m.Up = string(body)
+		case "down":
+			m.Down = string(body)
+		default:
+			return nil, fmt.Errorf("migration %s: unknown direction %q", e.Name(), direction)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s: missing up migration", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func (d *DB) createMigrationsTable(ctx context.Context) error {
+	_, err := d.Db.NewCreateTable().
+		Model((*SchemaMigration)(nil)).
+		IfNotExists().
+		Exec(ctx)
+	return err
+}
+
+func (d *DB) appliedMigrations(ctx context.Context) (map[int64]*SchemaMigration, error) {
+	if err := d.createMigrationsTable(ctx); err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	var rows []*SchemaMigration
+	if err := d.Db.NewSelect().Model(&rows).Scan(ctx); err != nil {
+		return nil, fmt.Errorf("reading schema_migrations: %w", err)
+	}
+
+	applied := make(map[int64]*SchemaMigration, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// MigrateUp applies all pending migrations in order and returns the number applied.
+func (d *DB) MigrateUp(ctx context.Context) (int, error) {
+	migrations, err := d.LoadMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	applied, err := d.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		err := d.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+				return err
+			}
+			_, err := tx.NewInsert().Model(&SchemaMigration{
+				Version:   m.Version,
+				Name:      m.Name,
+				AppliedAt: time.Now().UTC(),
+			}).Exec(ctx)
+			return err
+		})
+		if err != nil {
+			return n, fmt.Errorf("applying migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// MigrateDown rolls back the most recently applied migrations, up to steps, and
+// returns the number rolled back.
+func (d *DB) MigrateDown(ctx context.Context, steps int) (int, error) {
+	migrations, err := d.LoadMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	applied, err := d.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i := len(migrations) - 1; i >= 0 && n < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return n, fmt.Errorf("migration %04d_%s is irreversible", m.Version, m.Name)
+		}
+
+		err := d.Db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+				return err
+			}
+			_, err := tx.NewDelete().
+				Model((*SchemaMigration)(nil)).
+				Where("version = ?", m.Version).
+				Exec(ctx)
+			return err
+		})
+		if err != nil {
+			return n, fmt.Errorf("rolling back migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// MigrationStatus lists every known migration and whether it has been applied.
+func (d *DB) MigrationStatus(ctx context.Context) ([]*MigrationStatus, error) {
+	migrations, err := d.LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := d.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]*MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		s := &MigrationStatus{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.AppliedAt
+		}
+		status[i] = s
+	}
+	return status, nil
+}
+
+// SchemaVersion returns the highest applied migration version, or 0 for an empty database.
+func (d *DB) SchemaVersion(ctx context.Context) (int64, error) {
+	applied, err := d.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
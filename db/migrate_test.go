@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/id"
+)
+
+func TestMigrations_UpDownStatus(t *testing.T) {
+	db, err := openSqlite("file:" + t.TempDir() + "/test.db?cache=shared&_fk=1")
+	assert.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+
+	migrations, err := db.LoadMigrations()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+
+	// nothing applied yet
+	version, err := db.SchemaVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+
+	n, err := db.MigrateUp(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), n)
+
+	// idempotent
+	n, err = db.MigrateUp(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	status, err := db.MigrationStatus(ctx)
+	assert.NoError(t, err)
+	for _, s := range status {
+		assert.True(t, s.Applied, "migration %d should be applied", s.Version)
+	}
+
+	version, err = db.SchemaVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, migrations[len(migrations)-1].Version, version)
+
+	// roll everything back
+	n, err = db.MigrateDown(ctx, len(migrations))
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), n)
+
+	version, err = db.SchemaVersion(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+}
+
+func TestMigrations_ExistingSchema(t *testing.T) {
+	db, err := openSqlite("file:" + t.TempDir() + "/test.db?cache=shared&_fk=1")
+	assert.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+
+	// simulate a database created before versioned migrations, with the
+	// table as bun used to create it rather than from the current model
+	_, err = db.Db.ExecContext(ctx, `CREATE TABLE "domains" ("id" VARCHAR NOT NULL, "name" VARCHAR NOT NULL, "user_id" VARCHAR NOT NULL, "verified" BOOLEAN NOT NULL, "verification_token" VARCHAR NOT NULL, "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP, "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("id"), UNIQUE ("name"))`)
+	assert.NoError(t, err)
+	_, err = db.Db.ExecContext(ctx, `INSERT INTO "domains" ("id", "name", "user_id", "verified", "verification_token") VALUES (?, 'example.com', '', FALSE, '')`, id.NewID())
+	assert.NoError(t, err)
+
+	_, err = db.MigrateUp(ctx)
+	assert.NoError(t, err)
+
+	d, err := db.ReadDomainByName(ctx, "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", d.Name)
+}
+
+// hostnamesVersion is the migration that added the hostname dimension
+const hostnamesVersion = 16
+
+// migrateDownTo rolls back every migration after version
+func migrateDownTo(t *testing.T, db *DB, version int64) {
+	ctx := context.Background()
+	for {
+		v, err := db.SchemaVersion(ctx)
+		if !assert.NoError(t, err) || v <= version {
+			return
+		}
+		_, err = db.MigrateDown(ctx, 1)
+		if !assert.NoError(t, err) {
+			return
+		}
+	}
+}
+
+func TestMigrations_HostnameBackfill(t *testing.T) {
+	db, err := openSqlite("file:" + t.TempDir() + "/test.db?cache=shared&_fk=1")
+	assert.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+
+	_, err = db.MigrateUp(ctx)
+	assert.NoError(t, err)
+	migrateDownTo(t, db, hostnamesVersion-1)
+
+	// data collected before hostnames were recorded
+	for _, q := range []string{
+		`INSERT INTO domains (id, name, user_id, verified, verification_token) VALUES ('d1', 'example.com', 'u1', TRUE, 't')`,
+		`INSERT INTO pageviews (ts, domain_id, visitor_id, path_id) VALUES ('2024-01-01 10:00:00', 'd1', 1, 1)`,
+		`INSERT INTO daily_pageviews (day, domain_id, country_id, region_id, city_id, browser_id, os_id, device_type_id, language_id, referrer_id, path_id, count, unique_visitors, bounces)
+			VALUES ('2024-01-01', 'd1', 0, 0, 0, 0, 0, 0, 0, 0, 1, 5, 3, 1)`,
+	} {
+		_, err = db.Db.ExecContext(ctx, q)
+		assert.NoError(t, err)
+	}
+
+	_, err = db.MigrateUp(ctx)
+	assert.NoError(t, err)
+
+	var hostnameID int64
+	assert.NoError(t, db.Db.NewRaw(`SELECT id FROM hostnames WHERE name = 'example.com'`).Scan(ctx, &hostnameID))
+	var ids []int64
+	assert.NoError(t, db.Db.NewRaw(`SELECT hostname_id FROM pageviews UNION ALL SELECT hostname_id FROM daily_pageviews`).Scan(ctx, &ids))
+	assert.Equal(t, []int64{hostnameID, hostnameID}, ids)
+
+	// rolling back merges the rollups of each hostname
+	_, err = db.Db.ExecContext(ctx, `INSERT INTO daily_pageviews (day, domain_id, country_id, region_id, city_id, browser_id, os_id, device_type_id, language_id, referrer_id, path_id, hostname_id, count, unique_visitors, bounces)
+		VALUES ('2024-01-01', 'd1', 0, 0, 0, 0, 0, 0, 0, 0, 1, 99, 2, 2, 0)`)
+	assert.NoError(t, err)
+	migrateDownTo(t, db, hostnamesVersion-1)
+	var count int64
+	assert.NoError(t, db.Db.NewRaw(`SELECT SUM(count) FROM daily_pageviews`).Scan(ctx, &count))
+	assert.Equal(t, int64(7), count)
+}
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS "daily_pageviews";
+DROP TABLE IF EXISTS "pageviews";
+DROP TABLE IF EXISTS "paths";
+DROP TABLE IF EXISTS "referrers";
+DROP TABLE IF EXISTS "languages";
+DROP TABLE IF EXISTS "device_types";
+DROP TABLE IF EXISTS "operating_systems";
+DROP TABLE IF EXISTS "browsers";
+DROP TABLE IF EXISTS "cities";
+DROP TABLE IF EXISTS "regions";
+DROP TABLE IF EXISTS "countries";
+DROP TABLE IF EXISTS "settings";
+DROP TABLE IF EXISTS "domains";
+DROP TABLE IF EXISTS "users";
@@ -0,0 +1,23 @@
+-- baseline schema, matches what CreateTables/CreateIndexes used to produce so
+-- databases created before versioned migrations upgrade cleanly
+CREATE TABLE IF NOT EXISTS "users" ("id" VARCHAR NOT NULL, "email" VARCHAR NOT NULL, "name" VARCHAR NOT NULL, "initials" VARCHAR NOT NULL, "encrypted_password" VARCHAR, "updated_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, "created_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("id"));
+CREATE TABLE IF NOT EXISTS "domains" ("id" VARCHAR NOT NULL, "name" VARCHAR NOT NULL, "user_id" VARCHAR NOT NULL, "verified" BOOLEAN NOT NULL, "verification_token" VARCHAR NOT NULL, "updated_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, "created_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("id"), UNIQUE ("name"));
+CREATE TABLE IF NOT EXISTS "settings" ("key" VARCHAR NOT NULL, "value" VARCHAR NOT NULL, "updated_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, "created_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("key"));
+CREATE TABLE IF NOT EXISTS "countries" ("id" BIGSERIAL NOT NULL, "name" VARCHAR NOT NULL, PRIMARY KEY ("id"), UNIQUE ("name"));
+CREATE TABLE IF NOT EXISTS "regions" ("id" BIGSERIAL NOT NULL, "country_id" BIGINT NOT NULL, "geonames_id" BIGINT, "lat" DOUBLE PRECISION, "lon" DOUBLE PRECISION, "name" VARCHAR NOT NULL, PRIMARY KEY ("id"));
+CREATE TABLE IF NOT EXISTS "cities" ("id" BIGSERIAL NOT NULL, "region_id" BIGINT NOT NULL, "geonames_id" BIGINT, "lat" DOUBLE PRECISION, "lon" DOUBLE PRECISION, "name" VARCHAR NOT NULL, PRIMARY KEY ("id"));
+CREATE TABLE IF NOT EXISTS "browsers" ("id" BIGSERIAL NOT NULL, "name" VARCHAR NOT NULL, PRIMARY KEY ("id"), UNIQUE ("name"));
+CREATE TABLE IF NOT EXISTS "operating_systems" ("id" BIGSERIAL NOT NULL, "name" VARCHAR NOT NULL, PRIMARY KEY ("id"), UNIQUE ("name"));
+CREATE TABLE IF NOT EXISTS "device_types" ("id" BIGSERIAL NOT NULL, "name" VARCHAR NOT NULL, PRIMARY KEY ("id"), UNIQUE ("name"));
+CREATE TABLE IF NOT EXISTS "languages" ("id" BIGSERIAL NOT NULL, "code" VARCHAR NOT NULL, PRIMARY KEY ("id"), UNIQUE ("code"));
+CREATE TABLE IF NOT EXISTS "referrers" ("id" BIGSERIAL NOT NULL, "host" VARCHAR NOT NULL, PRIMARY KEY ("id"), UNIQUE ("host"));
+CREATE TABLE IF NOT EXISTS "paths" ("id" BIGSERIAL NOT NULL, "path" VARCHAR NOT NULL, PRIMARY KEY ("id"), UNIQUE ("path"));
+CREATE TABLE IF NOT EXISTS "pageviews" ("id" BIGSERIAL NOT NULL, "ts" TIMESTAMPTZ NOT NULL DEFAULT current_timestamp, "domain_id" VARCHAR NOT NULL, "country_id" BIGINT, "region_id" BIGINT, "city_id" BIGINT, "browser_id" BIGINT, "os_id" BIGINT, "device_type_id" BIGINT, "language_id" BIGINT, "referrer_id" BIGINT, "visitor_id" BIGINT NOT NULL, "path_id" BIGINT, PRIMARY KEY ("id"));
+CREATE TABLE IF NOT EXISTS "daily_pageviews" ("day" date NOT NULL, "domain_id" VARCHAR NOT NULL, "country_id" BIGINT NOT NULL, "region_id" BIGINT NOT NULL, "city_id" BIGINT NOT NULL, "browser_id" BIGINT NOT NULL, "os_id" BIGINT NOT NULL, "device_type_id" BIGINT NOT NULL, "language_id" BIGINT NOT NULL, "referrer_id" BIGINT NOT NULL, "path_id" BIGINT NOT NULL, "count" BIGINT NOT NULL, "unique_visitors" BIGINT, "bounces" BIGINT, PRIMARY KEY ("day", "domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id", "device_type_id", "language_id", "referrer_id", "path_id"));
+
+CREATE UNIQUE INDEX IF NOT EXISTS "ux_users_email" ON "users" ("email");
+CREATE UNIQUE INDEX IF NOT EXISTS "ux_domains_name" ON "domains" ("name");
+CREATE INDEX IF NOT EXISTS "idx_pageviews_domain_ts" ON "pageviews" ("domain_id", "ts" DESC);
+CREATE INDEX IF NOT EXISTS "idx_daily_pageviews_domain_day" ON "daily_pageviews" ("domain_id", "day" DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS "ux_regions_country_id_name" ON "regions" ("country_id", "name");
+CREATE UNIQUE INDEX IF NOT EXISTS "ux_cities_region_id_name" ON "cities" ("region_id", "name");
@@ -0,0 +1,2 @@
+CREATE TABLE "audit_log" ("id" BIGSERIAL NOT NULL, "ts" TIMESTAMPTZ NOT NULL DEFAULT current_timestamp, "actor_id" VARCHAR, "action" VARCHAR NOT NULL, "target_type" VARCHAR, "target_id" VARCHAR, "ip" VARCHAR, "details" VARCHAR, PRIMARY KEY ("id"));
+CREATE INDEX "idx_audit_log_ts" ON "audit_log" ("ts" DESC);
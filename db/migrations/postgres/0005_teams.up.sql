@@ -0,0 +1,7 @@
+CREATE TABLE "teams" ("id" VARCHAR NOT NULL, "name" VARCHAR NOT NULL, "updated_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, "created_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("id"));
+CREATE TABLE "team_members" ("team_id" VARCHAR NOT NULL, "user_id" VARCHAR NOT NULL, "role" VARCHAR NOT NULL, "created_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("team_id", "user_id"));
+CREATE INDEX "idx_team_members_user_id" ON "team_members" ("user_id");
+CREATE TABLE "team_invitations" ("id" VARCHAR NOT NULL, "team_id" VARCHAR NOT NULL, "email" VARCHAR NOT NULL, "role" VARCHAR NOT NULL, "token_hash" VARCHAR NOT NULL, "invited_by" VARCHAR NOT NULL, "expires_at" TIMESTAMPTZ NOT NULL, "accepted_at" TIMESTAMPTZ, "created_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("id"), UNIQUE ("token_hash"));
+CREATE INDEX "idx_team_invitations_team_id" ON "team_invitations" ("team_id");
+ALTER TABLE "domains" ADD COLUMN "team_id" VARCHAR;
+CREATE INDEX "idx_domains_team_id" ON "domains" ("team_id");
@@ -0,0 +1,2 @@
+CREATE TABLE "api_keys" ("id" VARCHAR NOT NULL, "user_id" VARCHAR NOT NULL, "name" VARCHAR NOT NULL, "prefix" VARCHAR NOT NULL, "key_hash" VARCHAR NOT NULL, "scopes" VARCHAR NOT NULL, "domain_id" VARCHAR, "last_used_at" TIMESTAMPTZ, "created_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("id"), UNIQUE ("key_hash"));
+CREATE INDEX "idx_api_keys_user_id" ON "api_keys" ("user_id");
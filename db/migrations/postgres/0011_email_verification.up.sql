@@ -0,0 +1,3 @@
+ALTER TABLE "users" ADD COLUMN "email_verified" BOOLEAN NOT NULL DEFAULT FALSE;
+-- accounts from before verification are trusted
+UPDATE "users" SET "email_verified" = TRUE;
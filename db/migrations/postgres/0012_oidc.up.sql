@@ -0,0 +1,3 @@
+ALTER TABLE "users" ADD COLUMN "oidc_issuer" VARCHAR;
+ALTER TABLE "users" ADD COLUMN "oidc_subject" VARCHAR;
+CREATE UNIQUE INDEX "idx_users_oidc_subject" ON "users" ("oidc_issuer", "oidc_subject");
@@ -0,0 +1,3 @@
+CREATE INDEX "idx_audit_log_actor_id" ON "audit_log" ("actor_id", "ts" DESC);
+CREATE INDEX "idx_audit_log_action" ON "audit_log" ("action", "ts" DESC);
+CREATE INDEX "idx_audit_log_target" ON "audit_log" ("target_type", "target_id");
@@ -0,0 +1,17 @@
+CREATE TABLE "daily_pageviews_old" AS
+SELECT "day", "domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id", "device_type_id", "language_id", "referrer_id", "path_id",
+	SUM("count")::BIGINT AS "count", SUM("unique_visitors")::BIGINT AS "unique_visitors", MAX("bounces") AS "bounces"
+FROM "daily_pageviews"
+GROUP BY "day", "domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id", "device_type_id", "language_id", "referrer_id", "path_id";
+DELETE FROM "daily_pageviews";
+ALTER TABLE "daily_pageviews" DROP CONSTRAINT "daily_pageviews_pkey";
+ALTER TABLE "daily_pageviews" DROP COLUMN "hostname_id";
+ALTER TABLE "daily_pageviews" ADD PRIMARY KEY ("day", "domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id", "device_type_id", "language_id", "referrer_id", "path_id");
+INSERT INTO "daily_pageviews" SELECT * FROM "daily_pageviews_old";
+DROP TABLE "daily_pageviews_old";
+
+ALTER TABLE "pageviews" DROP COLUMN "hostname_id";
+ALTER TABLE "domains" DROP COLUMN "include_subdomains";
+DROP INDEX IF EXISTS "idx_domain_aliases_domain_id";
+DROP TABLE IF EXISTS "domain_aliases";
+DROP TABLE IF EXISTS "hostnames";
@@ -0,0 +1,15 @@
+CREATE TABLE "hostnames" ("id" BIGSERIAL NOT NULL, "name" VARCHAR NOT NULL, PRIMARY KEY ("id"), UNIQUE ("name"));
+CREATE TABLE "domain_aliases" ("name" VARCHAR NOT NULL, "domain_id" VARCHAR NOT NULL, "created_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("name"));
+CREATE INDEX "idx_domain_aliases_domain_id" ON "domain_aliases" ("domain_id");
+ALTER TABLE "domains" ADD COLUMN "include_subdomains" BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- pageviews from before hostnames were recorded came from the domain's own name
+INSERT INTO "hostnames" ("name") SELECT "name" FROM "domains";
+ALTER TABLE "pageviews" ADD COLUMN "hostname_id" BIGINT NOT NULL DEFAULT 0;
+UPDATE "pageviews" AS p SET "hostname_id" = h."id" FROM "domains" AS d JOIN "hostnames" AS h ON h."name" = d."name" WHERE d."id" = p."domain_id";
+
+-- the hostname is part of the rollup key
+ALTER TABLE "daily_pageviews" ADD COLUMN "hostname_id" BIGINT NOT NULL DEFAULT 0;
+UPDATE "daily_pageviews" AS p SET "hostname_id" = h."id" FROM "domains" AS d JOIN "hostnames" AS h ON h."name" = d."name" WHERE d."id" = p."domain_id";
+ALTER TABLE "daily_pageviews" DROP CONSTRAINT "daily_pageviews_pkey";
+ALTER TABLE "daily_pageviews" ADD PRIMARY KEY ("day", "domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id", "device_type_id", "language_id", "referrer_id", "path_id", "hostname_id");
@@ -0,0 +1 @@
+CREATE TABLE "tracking_configs" ("domain_id" VARCHAR NOT NULL, "hash_routing" BOOLEAN NOT NULL DEFAULT FALSE, "track_outbound" BOOLEAN NOT NULL DEFAULT FALSE, "track_downloads" BOOLEAN NOT NULL DEFAULT FALSE, "download_extensions" VARCHAR NOT NULL DEFAULT '', "excluded_paths" VARCHAR NOT NULL DEFAULT '', "query_params" VARCHAR NOT NULL DEFAULT '', "updated_at" TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("domain_id"));
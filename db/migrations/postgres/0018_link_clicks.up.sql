@@ -0,0 +1,2 @@
+CREATE TABLE "link_clicks" ("id" BIGSERIAL NOT NULL, "ts" TIMESTAMPTZ NOT NULL DEFAULT current_timestamp, "domain_id" VARCHAR NOT NULL, "kind" VARCHAR NOT NULL, "path_id" BIGINT NOT NULL, "country_id" BIGINT NOT NULL, "visitor_id" BIGINT NOT NULL, "url" VARCHAR NOT NULL, "target" VARCHAR NOT NULL, PRIMARY KEY ("id"));
+CREATE INDEX "idx_link_clicks_domain_ts" ON "link_clicks" ("domain_id", "ts" DESC);
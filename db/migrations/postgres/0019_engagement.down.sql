@@ -0,0 +1,5 @@
+ALTER TABLE "daily_pageviews" DROP COLUMN "engagements";
+ALTER TABLE "daily_pageviews" DROP COLUMN "scroll_depth";
+ALTER TABLE "daily_pageviews" DROP COLUMN "engaged_ms";
+ALTER TABLE "pageviews" DROP COLUMN "scroll_depth";
+ALTER TABLE "pageviews" DROP COLUMN "engaged_ms";
@@ -0,0 +1,5 @@
+ALTER TABLE "pageviews" ADD COLUMN "engaged_ms" BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE "pageviews" ADD COLUMN "scroll_depth" BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE "daily_pageviews" ADD COLUMN "engaged_ms" BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE "daily_pageviews" ADD COLUMN "scroll_depth" BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE "daily_pageviews" ADD COLUMN "engagements" BIGINT NOT NULL DEFAULT 0;
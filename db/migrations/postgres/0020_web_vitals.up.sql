@@ -0,0 +1,5 @@
+CREATE TABLE "web_vitals" ("id" BIGSERIAL NOT NULL, "ts" TIMESTAMPTZ NOT NULL DEFAULT current_timestamp, "domain_id" VARCHAR NOT NULL, "path_id" BIGINT NOT NULL, "device_type_id" BIGINT NOT NULL, "country_id" BIGINT NOT NULL, "lcp" DOUBLE PRECISION, "inp" DOUBLE PRECISION, "cls" DOUBLE PRECISION, "ttfb" DOUBLE PRECISION, "fcp" DOUBLE PRECISION, PRIMARY KEY ("id"));
+CREATE INDEX "idx_web_vitals_domain_ts" ON "web_vitals" ("domain_id", "ts" DESC);
+CREATE TABLE "daily_web_vitals" ("day" date NOT NULL, "domain_id" VARCHAR NOT NULL, "path_id" BIGINT NOT NULL, "device_type_id" BIGINT NOT NULL, "country_id" BIGINT NOT NULL, "metric" VARCHAR NOT NULL, "sketch" BYTEA NOT NULL, PRIMARY KEY ("day", "domain_id", "path_id", "device_type_id", "country_id", "metric"));
+CREATE INDEX "idx_daily_web_vitals_domain_day" ON "daily_web_vitals" ("domain_id", "day" DESC);
+ALTER TABLE "tracking_configs" ADD COLUMN "track_vitals" BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,23 @@
+-- baseline schema, matches what CreateTables/CreateIndexes used to produce so
+-- databases created before versioned migrations upgrade cleanly
+CREATE TABLE IF NOT EXISTS "users" ("id" VARCHAR NOT NULL, "email" VARCHAR NOT NULL, "name" VARCHAR NOT NULL, "initials" VARCHAR NOT NULL, "encrypted_password" VARCHAR, "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP, "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("id"));
+CREATE TABLE IF NOT EXISTS "domains" ("id" VARCHAR NOT NULL, "name" VARCHAR NOT NULL, "user_id" VARCHAR NOT NULL, "verified" BOOLEAN NOT NULL, "verification_token" VARCHAR NOT NULL, "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP, "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("id"), UNIQUE ("name"));
+CREATE TABLE IF NOT EXISTS "settings" ("key" VARCHAR NOT NULL, "value" VARCHAR NOT NULL, "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP, "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("key"));
+CREATE TABLE IF NOT EXISTS "countries" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "name" VARCHAR NOT NULL, UNIQUE ("name"));
+CREATE TABLE IF NOT EXISTS "regions" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "country_id" INTEGER NOT NULL, "geonames_id" INTEGER, "lat" DOUBLE PRECISION, "lon" DOUBLE PRECISION, "name" VARCHAR NOT NULL);
+CREATE TABLE IF NOT EXISTS "cities" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "region_id" INTEGER NOT NULL, "geonames_id" INTEGER, "lat" DOUBLE PRECISION, "lon" DOUBLE PRECISION, "name" VARCHAR NOT NULL);
+CREATE TABLE IF NOT EXISTS "browsers" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "name" VARCHAR NOT NULL, UNIQUE ("name"));
+CREATE TABLE IF NOT EXISTS "operating_systems" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "name" VARCHAR NOT NULL, UNIQUE ("name"));
+CREATE TABLE IF NOT EXISTS "device_types" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "name" VARCHAR NOT NULL, UNIQUE ("name"));
+CREATE TABLE IF NOT EXISTS "languages" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "code" VARCHAR NOT NULL, UNIQUE ("code"));
+CREATE TABLE IF NOT EXISTS "referrers" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "host" VARCHAR NOT NULL, UNIQUE ("host"));
+CREATE TABLE IF NOT EXISTS "paths" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "path" VARCHAR NOT NULL, UNIQUE ("path"));
+CREATE TABLE IF NOT EXISTS "pageviews" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "ts" TIMESTAMP NOT NULL DEFAULT current_timestamp, "domain_id" VARCHAR NOT NULL, "country_id" INTEGER, "region_id" INTEGER, "city_id" INTEGER, "browser_id" INTEGER, "os_id" INTEGER, "device_type_id" INTEGER, "language_id" INTEGER, "referrer_id" INTEGER, "visitor_id" INTEGER NOT NULL, "path_id" INTEGER);
+CREATE TABLE IF NOT EXISTS "daily_pageviews" ("day" date NOT NULL, "domain_id" VARCHAR NOT NULL, "country_id" INTEGER NOT NULL, "region_id" INTEGER NOT NULL, "city_id" INTEGER NOT NULL, "browser_id" INTEGER NOT NULL, "os_id" INTEGER NOT NULL, "device_type_id" INTEGER NOT NULL, "language_id" INTEGER NOT NULL, "referrer_id" INTEGER NOT NULL, "path_id" INTEGER NOT NULL, "count" INTEGER NOT NULL, "unique_visitors" INTEGER, "bounces" INTEGER, PRIMARY KEY ("day", "domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id", "device_type_id", "language_id", "referrer_id", "path_id"));
+
+CREATE UNIQUE INDEX IF NOT EXISTS "ux_users_email" ON "users" ("email");
+CREATE UNIQUE INDEX IF NOT EXISTS "ux_domains_name" ON "domains" ("name");
+CREATE INDEX IF NOT EXISTS "idx_pageviews_domain_ts" ON "pageviews" ("domain_id", "ts" DESC);
+CREATE INDEX IF NOT EXISTS "idx_daily_pageviews_domain_day" ON "daily_pageviews" ("domain_id", "day" DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS "ux_regions_country_id_name" ON "regions" ("country_id", "name");
+CREATE UNIQUE INDEX IF NOT EXISTS "ux_cities_region_id_name" ON "cities" ("region_id", "name");
@@ -0,0 +1,2 @@
+CREATE TABLE "audit_log" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "ts" TIMESTAMP NOT NULL DEFAULT current_timestamp, "actor_id" VARCHAR, "action" VARCHAR NOT NULL, "target_type" VARCHAR, "target_id" VARCHAR, "ip" VARCHAR, "details" VARCHAR);
+CREATE INDEX "idx_audit_log_ts" ON "audit_log" ("ts" DESC);
@@ -0,0 +1,6 @@
+ALTER TABLE "users" ADD COLUMN "role" VARCHAR NOT NULL DEFAULT 'member';
+
+-- instances created before roles existed promote their first user to admin
+UPDATE "users" SET "role" = 'admin'
+WHERE "id" = (SELECT "id" FROM "users" ORDER BY "created_at" ASC LIMIT 1)
+AND NOT EXISTS (SELECT 1 FROM "users" WHERE "role" = 'admin');
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "idx_domains_team_id";
+ALTER TABLE "domains" DROP COLUMN "team_id";
+DROP TABLE IF EXISTS "team_invitations";
+DROP TABLE IF EXISTS "team_members";
+DROP TABLE IF EXISTS "teams";
@@ -0,0 +1,2 @@
+CREATE TABLE "shared_links" ("id" VARCHAR NOT NULL, "slug" VARCHAR NOT NULL, "domain_id" VARCHAR NOT NULL, "password_hash" VARCHAR NOT NULL, "panels" VARCHAR NOT NULL, "created_by" VARCHAR NOT NULL, "expires_at" TIMESTAMP, "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("id"), UNIQUE ("slug"));
+CREATE INDEX "idx_shared_links_domain_id" ON "shared_links" ("domain_id");
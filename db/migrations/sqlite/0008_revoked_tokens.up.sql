@@ -0,0 +1,2 @@
+CREATE TABLE "revoked_tokens" ("jti" VARCHAR NOT NULL, "expires_at" TIMESTAMP NOT NULL, "revoked_at" TIMESTAMP NOT NULL, PRIMARY KEY ("jti"));
+CREATE INDEX "idx_revoked_tokens_expires_at" ON "revoked_tokens" ("expires_at");
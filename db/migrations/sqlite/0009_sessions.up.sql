@@ -0,0 +1,5 @@
+CREATE TABLE "sessions" ("id" VARCHAR NOT NULL, "user_id" VARCHAR NOT NULL, "user_agent" VARCHAR NOT NULL, "ip" VARCHAR NOT NULL, "access_token_id" VARCHAR, "access_expires_at" TIMESTAMP, "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP, "last_used_at" TIMESTAMP NOT NULL, "expires_at" TIMESTAMP NOT NULL, "revoked_at" TIMESTAMP, PRIMARY KEY ("id"));
+CREATE INDEX "idx_sessions_user_id" ON "sessions" ("user_id");
+CREATE INDEX "idx_sessions_expires_at" ON "sessions" ("expires_at");
+CREATE TABLE "refresh_tokens" ("token_hash" VARCHAR NOT NULL, "session_id" VARCHAR NOT NULL, "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP, "used_at" TIMESTAMP, PRIMARY KEY ("token_hash"));
+CREATE INDEX "idx_refresh_tokens_session_id" ON "refresh_tokens" ("session_id");
@@ -0,0 +1,2 @@
+CREATE TABLE "login_attempts" ("key" VARCHAR NOT NULL, "failures" INTEGER NOT NULL DEFAULT 0, "last_failed_at" TIMESTAMP NOT NULL, "locked_until" TIMESTAMP, PRIMARY KEY ("key"));
+CREATE INDEX "idx_login_attempts_last_failed_at" ON "login_attempts" ("last_failed_at");
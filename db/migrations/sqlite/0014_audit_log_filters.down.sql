@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS "idx_audit_log_target";
+DROP INDEX IF EXISTS "idx_audit_log_action";
+DROP INDEX IF EXISTS "idx_audit_log_actor_id";
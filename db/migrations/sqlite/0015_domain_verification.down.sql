@@ -0,0 +1,5 @@
+ALTER TABLE "domains" DROP COLUMN "verification_error";
+ALTER TABLE "domains" DROP COLUMN "verification_failures";
+ALTER TABLE "domains" DROP COLUMN "verification_checked_at";
+ALTER TABLE "domains" DROP COLUMN "verified_at";
+ALTER TABLE "domains" DROP COLUMN "verification_method";
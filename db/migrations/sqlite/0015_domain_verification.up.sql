@@ -0,0 +1,5 @@
+ALTER TABLE "domains" ADD COLUMN "verification_method" VARCHAR;
+ALTER TABLE "domains" ADD COLUMN "verified_at" TIMESTAMP;
+ALTER TABLE "domains" ADD COLUMN "verification_checked_at" TIMESTAMP;
+ALTER TABLE "domains" ADD COLUMN "verification_failures" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "domains" ADD COLUMN "verification_error" VARCHAR;
@@ -0,0 +1,15 @@
+CREATE TABLE "daily_pageviews_old" ("day" date NOT NULL, "domain_id" VARCHAR NOT NULL, "country_id" INTEGER NOT NULL, "region_id" INTEGER NOT NULL, "city_id" INTEGER NOT NULL, "browser_id" INTEGER NOT NULL, "os_id" INTEGER NOT NULL, "device_type_id" INTEGER NOT NULL, "language_id" INTEGER NOT NULL, "referrer_id" INTEGER NOT NULL, "path_id" INTEGER NOT NULL, "count" INTEGER NOT NULL, "unique_visitors" INTEGER, "bounces" INTEGER, PRIMARY KEY ("day", "domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id", "device_type_id", "language_id", "referrer_id", "path_id"));
+INSERT INTO "daily_pageviews_old" ("day", "domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id", "device_type_id", "language_id", "referrer_id", "path_id", "count", "unique_visitors", "bounces")
+SELECT "day", "domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id", "device_type_id", "language_id", "referrer_id", "path_id",
+	SUM("count"), SUM("unique_visitors"), MAX("bounces")
+FROM "daily_pageviews"
+GROUP BY "day", "domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id", "device_type_id", "language_id", "referrer_id", "path_id";
+DROP TABLE "daily_pageviews";
+ALTER TABLE "daily_pageviews_old" RENAME TO "daily_pageviews";
+CREATE INDEX "idx_daily_pageviews_domain_day" ON "daily_pageviews" ("domain_id", "day" DESC);
+
+ALTER TABLE "pageviews" DROP COLUMN "hostname_id";
+ALTER TABLE "domains" DROP COLUMN "include_subdomains";
+DROP INDEX IF EXISTS "idx_domain_aliases_domain_id";
+DROP TABLE IF EXISTS "domain_aliases";
+DROP TABLE IF EXISTS "hostnames";
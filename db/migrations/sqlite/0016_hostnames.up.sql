@@ -0,0 +1,20 @@
+CREATE TABLE "hostnames" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "name" VARCHAR NOT NULL, UNIQUE ("name"));
+CREATE TABLE "domain_aliases" ("name" VARCHAR NOT NULL, "domain_id" VARCHAR NOT NULL, "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY ("name"));
+CREATE INDEX "idx_domain_aliases_domain_id" ON "domain_aliases" ("domain_id");
+ALTER TABLE "domains" ADD COLUMN "include_subdomains" BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- pageviews from before hostnames were recorded came from the domain's own name
+INSERT INTO "hostnames" ("name") SELECT "name" FROM "domains";
+ALTER TABLE "pageviews" ADD COLUMN "hostname_id" INTEGER NOT NULL DEFAULT 0;
+UPDATE "pageviews" SET "hostname_id" = COALESCE((SELECT h."id" FROM "hostnames" AS h JOIN "domains" AS d ON d."name" = h."name" WHERE d."id" = "pageviews"."domain_id"), 0);
+
+-- the hostname is part of the rollup key, sqlite can only change a primary key by rebuilding the table
+CREATE TABLE "daily_pageviews_new" ("day" date NOT NULL, "domain_id" VARCHAR NOT NULL, "country_id" INTEGER NOT NULL, "region_id" INTEGER NOT NULL, "city_id" INTEGER NOT NULL, "browser_id" INTEGER NOT NULL, "os_id" INTEGER NOT NULL, "device_type_id" INTEGER NOT NULL, "language_id" INTEGER NOT NULL, "referrer_id" INTEGER NOT NULL, "path_id" INTEGER NOT NULL, "hostname_id" INTEGER NOT NULL DEFAULT 0, "count" INTEGER NOT NULL, "unique_visitors" INTEGER, "bounces" INTEGER, PRIMARY KEY ("day", "domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id", "device_type_id", "language_id", "referrer_id", "path_id", "hostname_id"));
+INSERT INTO "daily_pageviews_new" ("day", "domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id", "device_type_id", "language_id", "referrer_id", "path_id", "hostname_id", "count", "unique_visitors", "bounces")
+SELECT "day", "domain_id", "country_id", "region_id", "city_id", "browser_id", "os_id", "device_type_id", "language_id", "referrer_id", "path_id",
+	COALESCE((SELECT h."id" FROM "hostnames" AS h JOIN "domains" AS d ON d."name" = h."name" WHERE d."id" = "daily_pageviews"."domain_id"), 0),
+	"count", "unique_visitors", "bounces"
+FROM "daily_pageviews";
+DROP TABLE "daily_pageviews";
+ALTER TABLE "daily_pageviews_new" RENAME TO "daily_pageviews";
+CREATE INDEX "idx_daily_pageviews_domain_day" ON "daily_pageviews" ("domain_id", "day" DESC);
@@ -0,0 +1,2 @@
+CREATE TABLE "link_clicks" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "ts" TIMESTAMP NOT NULL DEFAULT current_timestamp, "domain_id" VARCHAR NOT NULL, "kind" VARCHAR NOT NULL, "path_id" INTEGER NOT NULL, "country_id" INTEGER NOT NULL, "visitor_id" INTEGER NOT NULL, "url" VARCHAR NOT NULL, "target" VARCHAR NOT NULL);
+CREATE INDEX "idx_link_clicks_domain_ts" ON "link_clicks" ("domain_id", "ts" DESC);
@@ -0,0 +1,5 @@
+ALTER TABLE "pageviews" ADD COLUMN "engaged_ms" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "pageviews" ADD COLUMN "scroll_depth" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "daily_pageviews" ADD COLUMN "engaged_ms" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "daily_pageviews" ADD COLUMN "scroll_depth" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "daily_pageviews" ADD COLUMN "engagements" INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE "tracking_configs" DROP COLUMN "track_vitals";
+DROP TABLE IF EXISTS "daily_web_vitals";
+DROP TABLE IF EXISTS "web_vitals";
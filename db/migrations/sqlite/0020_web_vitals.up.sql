@@ -0,0 +1,5 @@
+CREATE TABLE "web_vitals" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "ts" TIMESTAMP NOT NULL DEFAULT current_timestamp, "domain_id" VARCHAR NOT NULL, "path_id" INTEGER NOT NULL, "device_type_id" INTEGER NOT NULL, "country_id" INTEGER NOT NULL, "lcp" REAL, "inp" REAL, "cls" REAL, "ttfb" REAL, "fcp" REAL);
+CREATE INDEX "idx_web_vitals_domain_ts" ON "web_vitals" ("domain_id", "ts" DESC);
+CREATE TABLE "daily_web_vitals" ("day" date NOT NULL, "domain_id" VARCHAR NOT NULL, "path_id" INTEGER NOT NULL, "device_type_id" INTEGER NOT NULL, "country_id" INTEGER NOT NULL, "metric" VARCHAR NOT NULL, "sketch" BLOB NOT NULL, PRIMARY KEY ("day", "domain_id", "path_id", "device_type_id", "country_id", "metric"));
+CREATE INDEX "idx_daily_web_vitals_domain_day" ON "daily_web_vitals" ("domain_id", "day" DESC);
+ALTER TABLE "tracking_configs" ADD COLUMN "track_vitals" BOOLEAN NOT NULL DEFAULT FALSE;
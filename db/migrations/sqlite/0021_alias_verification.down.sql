@@ -0,0 +1,3 @@
+ALTER TABLE "domain_aliases" DROP COLUMN "verified_at";
+ALTER TABLE "domain_aliases" DROP COLUMN "verification_method";
+ALTER TABLE "domain_aliases" DROP COLUMN "verified";
@@ -0,0 +1,4 @@
+-- aliases count pageviews once their owner proves they control them, like domains
+ALTER TABLE "domain_aliases" ADD COLUMN "verified" BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE "domain_aliases" ADD COLUMN "verification_method" VARCHAR;
+ALTER TABLE "domain_aliases" ADD COLUMN "verified_at" TIMESTAMP;
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+// Snapshot writes a transactionally consistent copy of the database to a new
+// sqlite file at path. sqlite databases are copied with VACUUM INTO, postgres
+// databases are dumped logically from a single repeatable read transaction.
+func (d *DB) Snapshot(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("snapshot %s already exists", path)
+	}
+
+	if d.Db.Dialect().Name().String() == "sqlite" {
+		_, err := d.Db.ExecContext(ctx, "VACUUM INTO '"+strings.ReplaceAll(path, "'", "''")+"'")
+		return err
+	}
+
+	snap, err := openSqlite("file:" + path + "?_fk=1")
+	if err != nil {
+		return err
+	}
+	defer snap.Close()
+
+	if _, err := snap.MigrateUp(ctx); err != nil {
+		return fmt.Errorf("preparing snapshot schema: %w", err)
+	}
+
+	return d.Db.RunInTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}, func(ctx context.Context, tx bun.Tx) error {
+		return copyAll(ctx, tx, snap, defaultCopyBatchSize)
+	})
+}
@@ -1,20 +1,39 @@
 package domain
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
 	"github.com/go-chi/chi/v5"
+	"github.com/zackb/updog/audit"
 	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/httpx"
 	"github.com/zackb/updog/httpx/middleware"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/team"
 )
 
 type Handler struct {
-	store Storage
-	auth  *auth.Service
+	store      Storage
+	teams      team.Storage
+	auditStore audit.Storage
+	auth       *auth.Service
+	verifier   *Verifier
 }
 
-func NewHandler(store Storage, auth *auth.Service) *Handler {
+func NewHandler(store Storage, teams team.Storage, auditStore audit.Storage, auth *auth.Service) *Handler {
 	return &Handler{
-		store: store,
-		auth:  auth,
+		store:      store,
+		teams:      teams,
+		auditStore: auditStore,
+		auth:       auth,
+		verifier:   NewVerifier(),
 	}
 }
 
@@ -22,8 +41,536 @@ func (h *Handler) Routes() chi.Router {
 	r := chi.NewRouter()
 	r.Group(func(protected chi.Router) {
 		protected.Use(middleware.AuthMiddleware(h.auth))
-		// protected.Get("/domains", ...)
+		protected.With(middleware.RequireScope(auth.ScopeStatsRead, auth.ScopeDomainsManage)).Get("/", h.handleListDomains)
+		protected.With(middleware.RequireScope(auth.ScopeStatsRead, auth.ScopeDomainsManage)).Get("/{id}", h.handleGetDomain)
+		protected.With(middleware.RequireScope(auth.ScopeStatsRead, auth.ScopeDomainsManage)).Get("/{id}/tracking", h.handleGetTracking)
+
+		protected.Group(func(manage chi.Router) {
+			manage.Use(middleware.RequireScope(auth.ScopeDomainsManage))
+			manage.Post("/", h.handleCreateDomain)
+			manage.Patch("/{id}", h.handleUpdateDomain)
+			manage.Put("/{id}", h.handleUpdateDomain)
+			manage.Delete("/{id}", h.handleDeleteDomain)
+			manage.Post("/{id}/verify", h.handleVerifyDomain)
+			manage.Post("/{id}/aliases/{alias}/verify", h.handleVerifyAlias)
+			manage.Post("/{id}/token", h.handleRotateToken)
+			manage.Put("/{id}/tracking", h.handleUpdateTracking)
+		})
 	})
 
 	return r
 }
+
+// domainRequest creates or updates a domain, fields left out are kept as they are
+type domainRequest struct {
+	Name              string          `json:"name"`
+	TeamID            *string         `json:"team_id"`
+	IncludeSubdomains *bool           `json:"include_subdomains"`
+	Aliases           *[]string       `json:"aliases"`
+	Tracking          *TrackingConfig `json:"tracking"`
+}
+
+func (h *Handler) handleListDomains(w http.ResponseWriter, r *http.Request) {
+	domains, err := h.store.ListDomainsByUser(r.Context(), httpx.UserIDFromRequest(r))
+	if err != nil {
+		log.Printf("Failed to list domains: %v", err)
+		httpx.JSONError(w, "Failed to list domains", http.StatusInternalServerError)
+		return
+	}
+	if t := middleware.TokenFromRequest(r); t != nil && t.DomainID != "" {
+		domains = slices.DeleteFunc(domains, func(d *Domain) bool { return !t.AllowsDomain(d.ID) })
+	}
+	if domains == nil {
+		domains = []*Domain{}
+	}
+	if err := LoadAliases(r.Context(), h.store, domains...); err != nil {
+		log.Printf("Failed to list aliases: %v", err)
+		httpx.JSONError(w, "Failed to list domains", http.StatusInternalServerError)
+		return
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(domains))
+}
+
+func (h *Handler) handleCreateDomain(w http.ResponseWriter, r *http.Request) {
+	if t := middleware.TokenFromRequest(r); t != nil && t.DomainID != "" {
+		httpx.JSONError(w, "API key is restricted to a domain", http.StatusForbidden)
+		return
+	}
+
+	var body domainRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	name, err := NormalizeName(body.Name)
+	if err != nil {
+		httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.nameAvailable(w, r, name) {
+		return
+	}
+
+	d := &Domain{
+		ID:                id.NewID(),
+		Name:              name,
+		UserID:            httpx.UserIDFromRequest(r),
+		VerificationToken: id.NewID(),
+	}
+	if body.TeamID != nil && *body.TeamID != "" {
+		if !h.teamAvailable(w, r, *body.TeamID) {
+			return
+		}
+		d.TeamID = *body.TeamID
+	}
+	if body.IncludeSubdomains != nil {
+		d.IncludeSubdomains = *body.IncludeSubdomains
+	}
+	d.Aliases = []string{}
+	if body.Aliases != nil {
+		if d.Aliases, err = h.parseAliases(w, r, d, *body.Aliases); err != nil {
+			return
+		}
+	}
+	tracking, ok := parseTracking(w, body, d)
+	if !ok {
+		return
+	}
+	if _, err := h.store.CreateDomain(r.Context(), d); err != nil {
+		log.Printf("Failed to create domain: %v", err)
+		httpx.JSONError(w, "Failed to create domain", http.StatusInternalServerError)
+		return
+	}
+	if err := h.store.SetAliases(r.Context(), d.ID, d.Aliases); err != nil {
+		log.Printf("Failed to set aliases: %v", err)
+		httpx.JSONError(w, "Failed to create domain", http.StatusInternalServerError)
+		return
+	}
+	d.UnverifiedAliases = d.Aliases
+	if tracking != nil {
+		if err := h.store.SaveTrackingConfig(r.Context(), tracking); err != nil {
+			log.Printf("Failed to save tracking config: %v", err)
+			httpx.JSONError(w, "Failed to create domain", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, d.UserID, audit.ActionDomainCreate, audit.TargetDomain, d.ID, map[string]any{
+		"name":               d.Name,
+		"team_id":            d.TeamID,
+		"include_subdomains": d.IncludeSubdomains,
+		"aliases":            d.Aliases,
+		"tracking":           tracking,
+	}))
+
+	w.WriteHeader(http.StatusCreated)
+	httpx.CheckError(w, json.NewEncoder(w).Encode(d))
+}
+
+func (h *Handler) handleGetDomain(w http.ResponseWriter, r *http.Request) {
+	d := h.domainForUser(w, r, team.RoleViewer)
+	if d == nil {
+		return
+	}
+	if err := LoadAliases(r.Context(), h.store, d); err != nil {
+		log.Printf("Failed to list aliases: %v", err)
+		httpx.JSONError(w, "Failed to read domain", http.StatusInternalServerError)
+		return
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(d))
+}
+
+// handleUpdateDomain renames a domain, which has to be verified again, moves it between teams,
+// changes the other hostnames counted as it or its tracking settings
+func (h *Handler) handleUpdateDomain(w http.ResponseWriter, r *http.Request) {
+	d := h.domainForUser(w, r, team.RoleEditor)
+	if d == nil {
+		return
+	}
+	if err := LoadAliases(r.Context(), h.store, d); err != nil {
+		log.Printf("Failed to list aliases: %v", err)
+		httpx.JSONError(w, "Failed to read domain", http.StatusInternalServerError)
+		return
+	}
+
+	var body domainRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	changed := map[string]any{}
+	if body.Name != "" {
+		name, err := NormalizeName(body.Name)
+		if err != nil {
+			httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if name != d.Name {
+			if !h.nameAvailable(w, r, name) {
+				return
+			}
+			changed["name"] = map[string]string{"from": d.Name, "to": name}
+			d.Name = name
+			d.Unverify()
+		}
+	}
+
+	if body.TeamID != nil && *body.TeamID != d.TeamID {
+		// only the domain's owner decides who else can see it
+		if d.UserID != httpx.UserIDFromRequest(r) {
+			httpx.JSONError(w, "Only the domain's owner can change its team", http.StatusForbidden)
+			return
+		}
+		if *body.TeamID != "" && !h.teamAvailable(w, r, *body.TeamID) {
+			return
+		}
+		changed["team_id"] = map[string]string{"from": d.TeamID, "to": *body.TeamID}
+		d.TeamID = *body.TeamID
+	}
+
+	if body.IncludeSubdomains != nil && *body.IncludeSubdomains != d.IncludeSubdomains {
+		changed["include_subdomains"] = map[string]bool{"from": d.IncludeSubdomains, "to": *body.IncludeSubdomains}
+		d.IncludeSubdomains = *body.IncludeSubdomains
+	}
+
+	var aliasesChanged bool
+	if body.Aliases != nil {
+		aliases, err := h.parseAliases(w, r, d, *body.Aliases)
+		if err != nil {
+			return
+		}
+		if !slices.Equal(aliases, d.Aliases) {
+			changed["aliases"] = map[string][]string{"from": d.Aliases, "to": aliases}
+			d.Aliases = aliases
+			aliasesChanged = true
+		}
+	}
+
+	tracking, ok := parseTracking(w, body, d)
+	if !ok {
+		return
+	}
+	if tracking != nil {
+		changed["tracking"] = tracking
+	}
+
+	if err := h.store.UpdateDomain(r.Context(), d); err != nil {
+		log.Printf("Failed to update domain: %v", err)
+		httpx.JSONError(w, "Failed to update domain", http.StatusInternalServerError)
+		return
+	}
+	if tracking != nil {
+		if err := h.store.SaveTrackingConfig(r.Context(), tracking); err != nil {
+			log.Printf("Failed to save tracking config: %v", err)
+			httpx.JSONError(w, "Failed to update domain", http.StatusInternalServerError)
+			return
+		}
+	}
+	if aliasesChanged {
+		if err := h.store.SetAliases(r.Context(), d.ID, d.Aliases); err != nil {
+			log.Printf("Failed to set aliases: %v", err)
+			httpx.JSONError(w, "Failed to update domain", http.StatusInternalServerError)
+			return
+		}
+		if err := LoadAliases(r.Context(), h.store, d); err != nil {
+			log.Printf("Failed to list aliases: %v", err)
+			httpx.JSONError(w, "Failed to update domain", http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(changed) > 0 {
+		audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, httpx.UserIDFromRequest(r), audit.ActionDomainUpdate, audit.TargetDomain, d.ID, changed))
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(d))
+}
+
+// handleDeleteDomain removes the domain and all of its collected data
+func (h *Handler) handleDeleteDomain(w http.ResponseWriter, r *http.Request) {
+	d := h.domainForUser(w, r, team.RoleOwner)
+	if d == nil {
+		return
+	}
+
+	if err := h.store.DeleteDomain(r.Context(), d.ID); err != nil {
+		log.Printf("Failed to delete domain: %v", err)
+		httpx.JSONError(w, "Failed to delete domain", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, httpx.UserIDFromRequest(r), audit.ActionDomainDelete, audit.TargetDomain, d.ID, map[string]any{
+		"name": d.Name,
+	}))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleVerifyDomain checks the domain with the method in the body, or each method until one passes
+func (h *Handler) handleVerifyDomain(w http.ResponseWriter, r *http.Request) {
+	d := h.domainForUser(w, r, team.RoleEditor)
+	if d == nil {
+		return
+	}
+
+	method, ok := parseMethod(w, r)
+	if !ok {
+		return
+	}
+
+	method, err := h.verifier.Verify(r.Context(), d, method)
+	if err != nil {
+		log.Printf("Verification failed for %s: %v", d.Name, err)
+		writeVerifyError(w, "Domain ownership could not be verified", err)
+		return
+	}
+
+	d.MarkVerified(method, time.Now().UTC())
+	if err := h.store.UpdateVerification(r.Context(), d); err != nil {
+		log.Printf("Failed to update domain: %v", err)
+		httpx.JSONError(w, "Failed to update domain", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, httpx.UserIDFromRequest(r), audit.ActionDomainVerify, audit.TargetDomain, d.ID, map[string]any{
+		"name":   d.Name,
+		"method": method,
+	}))
+	httpx.CheckError(w, json.NewEncoder(w).Encode(d))
+}
+
+// handleVerifyAlias checks an alias of the domain publishes the domain's token, with the method
+// in the body or each method until one passes, so the alias starts counting pageviews
+func (h *Handler) handleVerifyAlias(w http.ResponseWriter, r *http.Request) {
+	d := h.domainForUser(w, r, team.RoleEditor)
+	if d == nil {
+		return
+	}
+	method, ok := parseMethod(w, r)
+	if !ok {
+		return
+	}
+
+	name := chi.URLParam(r, "alias")
+	method, err := VerifyAlias(r.Context(), h.store, h.verifier, d, name, method)
+	var verr *VerifyError
+	switch {
+	case err == nil:
+	case errors.Is(err, sql.ErrNoRows):
+		httpx.JSONError(w, "Alias not found", http.StatusNotFound)
+		return
+	case errors.As(err, &verr):
+		log.Printf("Verification failed for %s: %v", name, err)
+		writeVerifyError(w, "Alias ownership could not be verified", err)
+		return
+	default:
+		log.Printf("Failed to verify alias: %v", err)
+		httpx.JSONError(w, "Failed to verify alias", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, httpx.UserIDFromRequest(r), audit.ActionDomainVerify, audit.TargetDomain, d.ID, map[string]any{
+		"name":   d.Name,
+		"alias":  name,
+		"method": method,
+	}))
+	if err := LoadAliases(r.Context(), h.store, d); err != nil {
+		log.Printf("Failed to list aliases: %v", err)
+		httpx.JSONError(w, "Failed to read domain", http.StatusInternalServerError)
+		return
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(d))
+}
+
+// handleRotateToken issues a new verification token, a verified domain stays verified
+// until re-verification with the new token fails
+func (h *Handler) handleRotateToken(w http.ResponseWriter, r *http.Request) {
+	d := h.domainForUser(w, r, team.RoleEditor)
+	if d == nil {
+		return
+	}
+
+	d.VerificationToken = id.NewID()
+	if err := h.store.UpdateDomain(r.Context(), d); err != nil {
+		log.Printf("Failed to rotate verification token: %v", err)
+		httpx.JSONError(w, "Failed to rotate verification token", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, httpx.UserIDFromRequest(r), audit.ActionDomainToken, audit.TargetDomain, d.ID, map[string]any{
+		"name": d.Name,
+	}))
+	httpx.CheckError(w, json.NewEncoder(w).Encode(d))
+}
+
+func (h *Handler) handleGetTracking(w http.ResponseWriter, r *http.Request) {
+	d := h.domainForUser(w, r, team.RoleViewer)
+	if d == nil {
+		return
+	}
+	c, err := ReadTrackingConfig(r.Context(), h.store, d.ID)
+	if err != nil {
+		log.Printf("Failed to read tracking config: %v", err)
+		httpx.JSONError(w, "Failed to read tracking config", http.StatusInternalServerError)
+		return
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(c))
+}
+
+// handleUpdateTracking replaces how the tracker script served for the domain behaves
+func (h *Handler) handleUpdateTracking(w http.ResponseWriter, r *http.Request) {
+	d := h.domainForUser(w, r, team.RoleEditor)
+	if d == nil {
+		return
+	}
+
+	var c TrackingConfig
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	c.DomainID = d.ID
+	if err := c.Normalize(); err != nil {
+		httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.store.SaveTrackingConfig(r.Context(), &c); err != nil {
+		log.Printf("Failed to save tracking config: %v", err)
+		httpx.JSONError(w, "Failed to save tracking config", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, httpx.UserIDFromRequest(r), audit.ActionDomainTracking, audit.TargetDomain, d.ID, c))
+	httpx.CheckError(w, json.NewEncoder(w).Encode(c))
+}
+
+// parseMethod reads the verification method from the optional body, writing a 400 if it's unsupported
+func parseMethod(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var body struct {
+		Method string `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return "", false
+	}
+	method, err := ParseMethod(body.Method)
+	if err != nil {
+		httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return method, true
+}
+
+// writeVerifyError writes a 422 with why each method failed
+func writeVerifyError(w http.ResponseWriter, msg string, err error) {
+	var verr *VerifyError
+	errors.As(err, &verr)
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	httpx.CheckError(w, json.NewEncoder(w).Encode(map[string]any{
+		"error":   msg,
+		"methods": verr.Messages(),
+	}))
+}
+
+// domainForUser reads the domain in the URL, writing a 404 if the caller can't
+// see it or a 403 if their role on it is below min
+func (h *Handler) domainForUser(w http.ResponseWriter, r *http.Request, min string) *Domain {
+	domainID := chi.URLParam(r, "id")
+	if t := middleware.TokenFromRequest(r); t != nil && !t.AllowsDomain(domainID) {
+		httpx.JSONError(w, "Domain not found", http.StatusNotFound)
+		return nil
+	}
+
+	d, role, err := h.store.ReadDomainForUser(r.Context(), domainID, httpx.UserIDFromRequest(r))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to read domain: %v", err)
+			httpx.JSONError(w, "Failed to read domain", http.StatusInternalServerError)
+			return nil
+		}
+		httpx.JSONError(w, "Domain not found", http.StatusNotFound)
+		return nil
+	}
+
+	// don't reveal that someone else's domain exists
+	if role == "" {
+		httpx.JSONError(w, "Domain not found", http.StatusNotFound)
+		return nil
+	}
+	if !team.RoleAtLeast(role, min) {
+		httpx.JSONError(w, "Forbidden", http.StatusForbidden)
+		return nil
+	}
+	return d
+}
+
+// teamAvailable writes a 403 unless the caller can add domains to teamID
+func (h *Handler) teamAvailable(w http.ResponseWriter, r *http.Request, teamID string) bool {
+	m, err := h.teams.ReadMember(r.Context(), teamID, httpx.UserIDFromRequest(r))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to read team member: %v", err)
+		httpx.JSONError(w, "Failed to read team", http.StatusInternalServerError)
+		return false
+	}
+	if err != nil || !team.RoleAtLeast(m.Role, team.RoleEditor) {
+		httpx.JSONError(w, "You can't add domains to that team", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// nameAvailable writes a 409 if the name is already tracked, as a domain or an alias of one
+func (h *Handler) nameAvailable(w http.ResponseWriter, r *http.Request, name string) bool {
+	_, err := h.store.ReadDomainByName(r.Context(), name)
+	if err == nil {
+		httpx.JSONError(w, "Domain already exists", http.StatusConflict)
+		return false
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to read domain: %v", err)
+		httpx.JSONError(w, "Failed to read domain", http.StatusInternalServerError)
+		return false
+	}
+	_, err = h.store.ReadDomainByAlias(r.Context(), name)
+	if err == nil {
+		httpx.JSONError(w, "Domain is an alias of another domain", http.StatusConflict)
+		return false
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to read domain: %v", err)
+		httpx.JSONError(w, "Failed to read domain", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// parseAliases checks the aliases for d, writing a 400 if one is invalid or a 409 if another domain tracks it
+func (h *Handler) parseAliases(w http.ResponseWriter, r *http.Request, d *Domain, names []string) ([]string, error) {
+	aliases, err := ParseAliases(r.Context(), h.store, d, names)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrInvalidAlias):
+		httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrHostnameTaken):
+		httpx.JSONError(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Failed to check aliases: %v", err)
+		httpx.JSONError(w, "Failed to check aliases", http.StatusInternalServerError)
+	}
+	return aliases, err
+}
+
+// parseTracking checks the tracking settings in body for d, writing a 400 if they can't be used.
+// It's nil if the body has none.
+func parseTracking(w http.ResponseWriter, body domainRequest, d *Domain) (*TrackingConfig, bool) {
+	if body.Tracking == nil {
+		return nil, true
+	}
+	c := body.Tracking
+	c.DomainID = d.ID
+	if err := c.Normalize(); err != nil {
+		httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return c, true
+}
@@ -0,0 +1,325 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/team"
+)
+
+// memoryStore keeps domains in memory and hands out copies, like a database would.
+// Team roles are keyed by team then user.
+type memoryStore struct {
+	Storage
+
+	domains  map[string]*Domain
+	aliases  map[string]*Alias
+	tracking map[string]*TrackingConfig
+	roles    map[string]map[string]string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		domains:  map[string]*Domain{},
+		aliases:  map[string]*Alias{},
+		tracking: map[string]*TrackingConfig{},
+		roles:    map[string]map[string]string{},
+	}
+}
+
+func (s *memoryStore) CreateDomain(ctx context.Context, d *Domain) (*Domain, error) {
+	saved := *d
+	s.domains[d.ID] = &saved
+	return d, nil
+}
+
+func (s *memoryStore) ReadDomain(ctx context.Context, domainID string) (*Domain, error) {
+	d, ok := s.domains[domainID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *d
+	return &found, nil
+}
+
+func (s *memoryStore) ReadDomainByName(ctx context.Context, name string) (*Domain, error) {
+	for _, d := range s.domains {
+		if d.Name == name {
+			return s.ReadDomain(ctx, d.ID)
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *memoryStore) UpdateDomain(ctx context.Context, d *Domain) error {
+	saved := *d
+	s.domains[d.ID] = &saved
+	return nil
+}
+
+func (s *memoryStore) UpdateVerification(ctx context.Context, d *Domain) error {
+	return s.UpdateDomain(ctx, d)
+}
+
+func (s *memoryStore) DeleteDomain(ctx context.Context, domainID string) error {
+	delete(s.domains, domainID)
+	delete(s.tracking, domainID)
+	return s.SetAliases(ctx, domainID, nil)
+}
+
+func (s *memoryStore) ListDomainsByUser(ctx context.Context, userID string) ([]*Domain, error) {
+	var domains []*Domain
+	for id := range s.domains {
+		if d, role, _ := s.ReadDomainForUser(ctx, id, userID); role != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains, nil
+}
+
+func (s *memoryStore) ReadDomainForUser(ctx context.Context, domainID, userID string) (*Domain, string, error) {
+	d, err := s.ReadDomain(ctx, domainID)
+	if err != nil {
+		return nil, "", err
+	}
+	if d.UserID == userID {
+		return d, team.RoleOwner, nil
+	}
+	return d, s.roles[d.TeamID][userID], nil
+}
+
+func (s *memoryStore) ReadDomainByAlias(ctx context.Context, name string) (*Domain, error) {
+	a, ok := s.aliases[name]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return s.ReadDomain(ctx, a.DomainID)
+}
+
+func (s *memoryStore) ReadAlias(ctx context.Context, name string) (*Alias, error) {
+	a, ok := s.aliases[name]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *a
+	return &found, nil
+}
+
+func (s *memoryStore) ListAliases(ctx context.Context, domainID string) ([]*Alias, error) {
+	aliases := []*Alias{}
+	for _, a := range s.aliases {
+		if a.DomainID == domainID {
+			found := *a
+			aliases = append(aliases, &found)
+		}
+	}
+	slices.SortFunc(aliases, func(a, b *Alias) int { return strings.Compare(a.Name, b.Name) })
+	return aliases, nil
+}
+
+func (s *memoryStore) SetAliases(ctx context.Context, domainID string, names []string) error {
+	for name, a := range s.aliases {
+		if a.DomainID == domainID && !slices.Contains(names, name) {
+			delete(s.aliases, name)
+		}
+	}
+	for _, name := range names {
+		if _, ok := s.aliases[name]; !ok {
+			s.aliases[name] = &Alias{Name: name, DomainID: domainID, CreatedAt: time.Now()}
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) UpdateAlias(ctx context.Context, a *Alias) error {
+	saved := *a
+	s.aliases[a.Name] = &saved
+	return nil
+}
+
+func (s *memoryStore) ReadTrackingConfig(ctx context.Context, domainID string) (*TrackingConfig, error) {
+	c, ok := s.tracking[domainID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *c
+	return &found, nil
+}
+
+func (s *memoryStore) SaveTrackingConfig(ctx context.Context, c *TrackingConfig) error {
+	saved := *c
+	s.tracking[c.DomainID] = &saved
+	return nil
+}
+
+// memoryTeams reads the members of the store's teams
+type memoryTeams struct {
+	team.Storage
+	store *memoryStore
+}
+
+func (t memoryTeams) ReadMember(ctx context.Context, teamID, userID string) (*team.Member, error) {
+	role, ok := t.store.roles[teamID][userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &team.Member{TeamID: teamID, UserID: userID, Role: role}, nil
+}
+
+type discardAudit struct{ audit.Storage }
+
+func (discardAudit) CreateAuditEntry(ctx context.Context, e *audit.Entry) error {
+	return nil
+}
+
+func newTestAuth(t *testing.T) *auth.Service {
+	key, err := jwk.New([]byte("0123456789abcdef0123456789abcdef"))
+	assert.NoError(t, err)
+	assert.NoError(t, key.Set(jwk.KeyIDKey, "test"))
+	assert.NoError(t, key.Set(jwk.AlgorithmKey, jwa.HS256))
+	set := jwk.NewSet()
+	set.Add(key)
+	b, err := json.Marshal(set)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, b, 0600))
+
+	a, err := auth.NewAuthService(path, time.Minute)
+	assert.NoError(t, err)
+	return a
+}
+
+func TestDomainAPI(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAuth(t)
+	store := newMemoryStore()
+	h := NewHandler(store, memoryTeams{store: store}, discardAudit{}, a)
+	api := h.Routes()
+
+	// the owner shares the team's domains with an editor and a viewer, the outsider isn't on it
+	const owner, editor, viewer, outsider = "owner", "editor", "viewer", "outsider"
+	teamID := "marketing"
+	store.roles[teamID] = map[string]string{owner: team.RoleOwner, editor: team.RoleEditor, viewer: team.RoleViewer}
+
+	call := func(userID, method, path string, body any) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		if body != nil {
+			assert.NoError(t, json.NewEncoder(&b).Encode(body))
+		}
+		access, _, err := a.CreateToken(userID, "", time.Time{})
+		assert.NoError(t, err)
+		r := httptest.NewRequest(method, path, &b)
+		r.Header.Set("Authorization", "Bearer "+access)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		return w
+	}
+
+	// create, with settings
+	w := call(owner, http.MethodPost, "/", map[string]any{
+		"name":     "https://Example.com/",
+		"team_id":  teamID,
+		"aliases":  []string{"www.example.com"},
+		"tracking": map[string]any{"hash_routing": true, "query_params": "page"},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var d Domain
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&d))
+	assert.Equal(t, "example.com", d.Name)
+	assert.Equal(t, []string{"www.example.com"}, d.Aliases)
+	assert.Equal(t, []string{"www.example.com"}, d.UnverifiedAliases)
+	c, err := store.ReadTrackingConfig(ctx, d.ID)
+	assert.NoError(t, err)
+	assert.True(t, c.HashRouting)
+	assert.Equal(t, "page", c.QueryParams)
+
+	assert.Equal(t, http.StatusBadRequest, call(owner, http.MethodPost, "/", map[string]any{"name": "not a domain"}).Code)
+	assert.Equal(t, http.StatusForbidden, call(outsider, http.MethodPost, "/", map[string]any{"name": "outside.com", "team_id": teamID}).Code)
+	assert.Equal(t, http.StatusConflict, call(outsider, http.MethodPost, "/", map[string]any{"name": "example.com"}).Code)
+	assert.Equal(t, http.StatusConflict, call(outsider, http.MethodPost, "/", map[string]any{"name": "www.example.com"}).Code)
+	assert.Equal(t, http.StatusBadRequest, call(owner, http.MethodPost, "/", map[string]any{
+		"name":     "other.example.com",
+		"tracking": map[string]any{"excluded_paths": "admin"},
+	}).Code)
+	_, err = store.ReadDomainByName(ctx, "other.example.com")
+	assert.Error(t, err, "nothing is created when the settings are invalid")
+
+	path := "/" + d.ID
+
+	// everyone on the team can read it, nobody else knows it exists
+	for _, u := range []string{owner, editor, viewer} {
+		assert.Equal(t, http.StatusOK, call(u, http.MethodGet, path, nil).Code)
+	}
+	assert.Equal(t, http.StatusNotFound, call(outsider, http.MethodGet, path, nil).Code)
+	w = call(viewer, http.MethodGet, "/", nil)
+	var listed []*Domain
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&listed))
+	if assert.Len(t, listed, 1) {
+		assert.Equal(t, []string{"www.example.com"}, listed[0].Aliases)
+	}
+
+	// aliases are verified with the domain's token, published on the alias
+	mux := http.NewServeMux()
+	mux.HandleFunc("www.example.com/updog_"+d.VerificationToken+".txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(d.VerificationToken))
+	})
+	h.verifier = testVerifier(mux, fakeResolver{})
+	assert.Equal(t, http.StatusForbidden, call(viewer, http.MethodPost, path+"/aliases/www.example.com/verify", nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(editor, http.MethodPost, path+"/aliases/example.net/verify", nil).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, call(editor, http.MethodPost, path+"/aliases/www.example.com/verify", map[string]any{"method": MethodDNS}).Code)
+	w = call(editor, http.MethodPost, path+"/aliases/www.example.com/verify", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&d))
+	assert.Empty(t, d.UnverifiedAliases)
+
+	// editors change settings, with PATCH or PUT
+	w = call(editor, http.MethodPatch, path, map[string]any{"include_subdomains": true})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = call(editor, http.MethodPut, path, map[string]any{
+		"aliases":  []string{},
+		"tracking": map[string]any{"track_outbound": true},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&d))
+	assert.True(t, d.IncludeSubdomains)
+	assert.Empty(t, d.Aliases)
+	c, err = store.ReadTrackingConfig(ctx, d.ID)
+	assert.NoError(t, err)
+	assert.True(t, c.TrackOutbound)
+	assert.False(t, c.HashRouting)
+
+	assert.Equal(t, http.StatusBadRequest, call(editor, http.MethodPatch, path, map[string]any{"tracking": map[string]any{"excluded_paths": "admin"}}).Code)
+	assert.Equal(t, http.StatusForbidden, call(editor, http.MethodPatch, path, map[string]any{"team_id": ""}).Code)
+	assert.Equal(t, http.StatusForbidden, call(viewer, http.MethodPatch, path, map[string]any{"include_subdomains": false}).Code)
+	assert.Equal(t, http.StatusNotFound, call(outsider, http.MethodPatch, path, map[string]any{"include_subdomains": false}).Code)
+
+	// renaming has to be verified again
+	w = call(owner, http.MethodPatch, path, map[string]any{"name": "example.org"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&d))
+	assert.Equal(t, "example.org", d.Name)
+	assert.False(t, d.Verified)
+
+	// only the owner deletes it
+	for _, u := range []string{editor, viewer} {
+		assert.Equal(t, http.StatusForbidden, call(u, http.MethodDelete, path, nil).Code)
+	}
+	assert.Equal(t, http.StatusNotFound, call(outsider, http.MethodDelete, path, nil).Code)
+	assert.Equal(t, http.StatusNoContent, call(owner, http.MethodDelete, path, nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(owner, http.MethodGet, path, nil).Code)
+}
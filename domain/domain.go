@@ -9,12 +9,26 @@ import (
 )
 
 type Domain struct {
-	ID   string `bun:",pk"`
-	Name string `bun:",unique,notnull"`
-
-	UserID            string `bun:"user_id,notnull"`
-	Verified          bool   `bun:"verified,notnull"`
-	VerificationToken string `bun:"verification_token,notnull"`
+	ID   string `bun:",pk" json:"id"`
+	Name string `bun:",unique,notnull" json:"name"`
+
+	UserID            string `bun:"user_id,notnull" json:"user_id"`
+	TeamID            string `bun:"team_id,nullzero" json:"team_id,omitempty"`
+	Verified          bool   `bun:"verified,notnull" json:"verified"`
+	VerificationToken string `bun:"verification_token,notnull" json:"verification_token"`
+	// VerificationMethod is the method that last proved ownership, re-verification uses it too
+	VerificationMethod    string    `bun:"verification_method,nullzero" json:"verification_method,omitempty"`
+	VerifiedAt            time.Time `bun:"verified_at,nullzero" json:"verified_at,omitzero"`
+	VerificationCheckedAt time.Time `bun:"verification_checked_at,nullzero" json:"verification_checked_at,omitzero"`
+	// VerificationFailures counts failed re-verifications in a row, VerificationError is the last one
+	VerificationFailures int    `bun:"verification_failures,notnull,default:0" json:"verification_failures"`
+	VerificationError    string `bun:"verification_error,nullzero" json:"verification_error,omitempty"`
+	// IncludeSubdomains counts pageviews from any subdomain of Name as this domain's
+	IncludeSubdomains bool `bun:"include_subdomains,notnull" json:"include_subdomains"`
+	// Aliases are other hostnames counted as this domain, loaded separately from domain_aliases.
+	// UnverifiedAliases are the ones that don't count until they're verified.
+	Aliases           []string `bun:"-" json:"aliases"`
+	UnverifiedAliases []string `bun:"-" json:"unverified_aliases"`
 
 	UpdatedAt time.Time `bun:",default:CURRENT_TIMESTAMP" json:"updated_at"`
 	CreatedAt time.Time `bun:",default:CURRENT_TIMESTAMP" json:"created_at"`
@@ -30,7 +44,9 @@ func (u *Domain) BeforeInsert(ctx context.Context, query *bun.InsertQuery) error
 	if u.VerificationToken == "" {
 		u.VerificationToken = id.NewID()
 	}
-	u.CreatedAt = time.Now()
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
 	return nil
 }
 
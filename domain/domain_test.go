@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeName(t *testing.T) {
+	for in, want := range map[string]string{
+		"example.com":                  "example.com",
+		"  Example.COM ":               "example.com",
+		"https://www.example.com/blog": "www.example.com",
+		"example.com/":                 "example.com",
+		"example.com.":                 "example.com",
+	} {
+		got, err := NormalizeName(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{"", "   ", "example.com:8080", "user@example.com", "exa mple.com"} {
+		_, err := NormalizeName(in)
+		assert.Error(t, err, in)
+	}
+}
@@ -0,0 +1,175 @@
+package domain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// MaxAliases is how many aliases a domain can have
+const MaxAliases = 20
+
+var (
+	ErrHostnameTaken = errors.New("hostname is already tracked by another domain")
+	ErrInvalidAlias  = errors.New("invalid alias")
+)
+
+// Alias is another hostname whose pageviews count as its domain's, such as a www. or legacy name.
+// Like a domain, it counts them once its owner proves they control it, with the domain's token.
+type Alias struct {
+	bun.BaseModel `bun:"table:domain_aliases"`
+
+	Name               string    `bun:",pk"`
+	DomainID           string    `bun:"domain_id,notnull"`
+	Verified           bool      `bun:"verified,notnull"`
+	VerificationMethod string    `bun:"verification_method,nullzero"`
+	VerifiedAt         time.Time `bun:"verified_at,nullzero"`
+	CreatedAt          time.Time `bun:",default:CURRENT_TIMESTAMP"`
+}
+
+// Resolve finds the domain host's pageviews belong to. A domain named host comes first,
+// then a domain with host as a verified alias, then the closest parent domain that includes its subdomains.
+func Resolve(ctx context.Context, store Storage, host string) (*Domain, error) {
+	d, err := store.ReadDomainByName(ctx, host)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return d, err
+	}
+	a, err := store.ReadAlias(ctx, host)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	// an unverified alias may be someone else's site, its pageviews go where they would without it
+	if err == nil && a.Verified {
+		return store.ReadDomain(ctx, a.DomainID)
+	}
+
+	// stop before the top level domain, nobody tracks all of .com
+	parent := host
+	for {
+		_, rest, ok := strings.Cut(parent, ".")
+		if !ok || !strings.Contains(rest, ".") {
+			return nil, sql.ErrNoRows
+		}
+		parent = rest
+
+		d, err := store.ReadDomainByName(ctx, parent)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if d.IncludeSubdomains {
+			return d, nil
+		}
+	}
+}
+
+// HostnameAvailable returns ErrHostnameTaken if name is tracked by a domain other than domainID,
+// either as its name or as one of its aliases. domainID is empty for a new domain.
+func HostnameAvailable(ctx context.Context, store Storage, name, domainID string) error {
+	for _, read := range []func(context.Context, string) (*Domain, error){store.ReadDomainByName, store.ReadDomainByAlias} {
+		d, err := read(ctx, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if d.ID != domainID {
+			return fmt.Errorf("%w: %s", ErrHostnameTaken, name)
+		}
+	}
+	return nil
+}
+
+// ParseAliases normalizes and deduplicates the aliases of d, checking no other domain tracks them.
+// Errors wrap ErrInvalidAlias or ErrHostnameTaken unless the database failed.
+func ParseAliases(ctx context.Context, store Storage, d *Domain, names []string) ([]string, error) {
+	aliases := []string{}
+	for _, n := range names {
+		if strings.TrimSpace(n) == "" {
+			continue
+		}
+		name, err := NormalizeName(n)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidAlias, n)
+		}
+		if name == d.Name {
+			return nil, fmt.Errorf("%w: %s is already the domain's name", ErrInvalidAlias, name)
+		}
+		if slices.Contains(aliases, name) {
+			continue
+		}
+		if err := HostnameAvailable(ctx, store, name, d.ID); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, name)
+	}
+	if len(aliases) > MaxAliases {
+		return nil, fmt.Errorf("%w: a domain can have at most %d", ErrInvalidAlias, MaxAliases)
+	}
+	slices.Sort(aliases)
+	return aliases, nil
+}
+
+// SplitList splits a list separated by commas, spaces or newlines, as typed into a form
+func SplitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+}
+
+// LoadAliases fills in the aliases of each domain and which of them aren't verified yet
+func LoadAliases(ctx context.Context, store Storage, domains ...*Domain) error {
+	for _, d := range domains {
+		aliases, err := store.ListAliases(ctx, d.ID)
+		if err != nil {
+			return err
+		}
+		d.Aliases = make([]string, 0, len(aliases))
+		d.UnverifiedAliases = []string{}
+		for _, a := range aliases {
+			d.Aliases = append(d.Aliases, a.Name)
+			if !a.Verified {
+				d.UnverifiedAliases = append(d.UnverifiedAliases, a.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// VerifiedAliases are the aliases of d whose pageviews count, once LoadAliases filled them in
+func (d *Domain) VerifiedAliases() []string {
+	return slices.DeleteFunc(slices.Clone(d.Aliases), func(name string) bool {
+		return slices.Contains(d.UnverifiedAliases, name)
+	})
+}
+
+// VerifyAlias checks the alias name of d publishes d's verification token with method, or any method
+// if it's empty, and saves it as verified. It returns the method that passed, sql.ErrNoRows if name
+// isn't an alias of d or a *VerifyError.
+func VerifyAlias(ctx context.Context, store Storage, v *Verifier, d *Domain, name, method string) (string, error) {
+	a, err := store.ReadAlias(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if a.DomainID != d.ID {
+		return "", sql.ErrNoRows
+	}
+
+	method, err = v.Verify(ctx, &Domain{Name: a.Name, VerificationToken: d.VerificationToken}, method)
+	if err != nil {
+		return "", err
+	}
+	a.Verified = true
+	a.VerificationMethod = method
+	a.VerifiedAt = time.Now().UTC()
+	return method, store.UpdateAlias(ctx, a)
+}
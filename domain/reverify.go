@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/zackb/updog/audit"
+)
+
+// ReverifyFailures is how many failed re-verifications in a row unverify a domain,
+// so a brief outage or a rotated token doesn't stop its analytics right away
+const ReverifyFailures = 3
+
+// MarkVerified records that method proved ownership of d at now
+func (d *Domain) MarkVerified(method string, now time.Time) {
+	d.Verified = true
+	d.VerificationMethod = method
+	d.VerifiedAt = now
+	d.VerificationCheckedAt = now
+	d.VerificationFailures = 0
+	d.VerificationError = ""
+}
+
+// Unverify makes d need verifying again, such as after it's renamed
+func (d *Domain) Unverify() {
+	d.Verified = false
+	d.VerificationMethod = ""
+	d.VerifiedAt = time.Time{}
+	d.VerificationFailures = 0
+	d.VerificationError = ""
+}
+
+// Reverify checks every verified domain still publishes its token, using the method that verified it.
+// Domains failing ReverifyFailures checks in a row are unverified and recorded in the audit log.
+func Reverify(ctx context.Context, store Storage, auditStore audit.Storage, v *Verifier, now time.Time) (checked, unverified int, err error) {
+	domains, err := store.ListVerifiedDomains(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, d := range domains {
+		method, err := v.Verify(ctx, d, d.VerificationMethod)
+		d.VerificationCheckedAt = now
+		if err == nil {
+			d.VerificationMethod = method
+			d.VerificationFailures = 0
+			d.VerificationError = ""
+		} else {
+			d.VerificationFailures++
+			d.VerificationError = err.Error()
+			if d.VerificationFailures >= ReverifyFailures {
+				log.Printf("Unverifying %s after %d failed checks: %v", d.Name, d.VerificationFailures, err)
+				d.Unverify()
+				d.VerificationError = err.Error()
+				unverified++
+				audit.Record(ctx, auditStore, audit.NewEntry(nil, "", audit.ActionDomainUnverify, audit.TargetDomain, d.ID, map[string]any{
+					"name":  d.Name,
+					"error": err.Error(),
+				}))
+			}
+		}
+
+		if err := store.UpdateVerification(ctx, d); err != nil {
+			return checked, unverified, err
+		}
+		checked++
+	}
+	return checked, unverified, nil
+}
@@ -8,8 +8,28 @@ type Storage interface {
 	CreateDomain(ctx context.Context, d *Domain) (*Domain, error)
 	ReadDomain(ctx context.Context, domainID string) (*Domain, error)
 	ReadDomainByName(ctx context.Context, name string) (*Domain, error)
+	UpdateDomain(ctx context.Context, d *Domain) error
 	DeleteDomain(ctx context.Context, domainID string) error
 	ListDomains(ctx context.Context, limit, offset int) ([]*Domain, error)
+	// ListDomainsByUser lists the domains userID owns or can access through a team
 	ListDomainsByUser(ctx context.Context, userID string) ([]*Domain, error)
-	VerifyDomain(ctx context.Context, domainID string) error
+	ListDomainsByTeam(ctx context.Context, teamID string) ([]*Domain, error)
+	// ReadDomainForUser reads a domain and the team role userID has on it,
+	// the domain's owner is always team.RoleOwner and the role is empty without access
+	ReadDomainForUser(ctx context.Context, domainID, userID string) (*Domain, string, error)
+	// ListVerifiedDomains lists every verified domain, for re-verifying them
+	ListVerifiedDomains(ctx context.Context) ([]*Domain, error)
+	// UpdateVerification saves only the verification state of d
+	UpdateVerification(ctx context.Context, d *Domain) error
+	// ReadDomainByAlias reads the domain that name is an alias of, verified or not
+	ReadDomainByAlias(ctx context.Context, name string) (*Domain, error)
+	ReadAlias(ctx context.Context, name string) (*Alias, error)
+	ListAliases(ctx context.Context, domainID string) ([]*Alias, error)
+	// SetAliases replaces every alias of domainID with names, aliases it already had stay verified
+	SetAliases(ctx context.Context, domainID string, names []string) error
+	// UpdateAlias saves only the verification state of a
+	UpdateAlias(ctx context.Context, a *Alias) error
+	ReadTrackingConfig(ctx context.Context, domainID string) (*TrackingConfig, error)
+	// SaveTrackingConfig creates or replaces the tracking config of c.DomainID
+	SaveTrackingConfig(ctx context.Context, c *TrackingConfig) error
 }
@@ -0,0 +1,173 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// DefaultDownloadExtensions are the files counted as downloads until a domain picks its own
+var DefaultDownloadExtensions = []string{
+	"7z", "apk", "avi", "csv", "dmg", "doc", "docx", "epub", "exe", "gz", "iso", "key", "mov", "mp3", "mp4",
+	"msi", "pdf", "pkg", "ppt", "pptx", "rar", "tar", "tgz", "txt", "wav", "xls", "xlsx", "xz", "zip",
+}
+
+// maxTrackingItems is how long each list of a tracking config can be
+const maxTrackingItems = 100
+
+var ErrInvalidTracking = errors.New("invalid tracking config")
+
+// TrackingConfig is how the tracker script served for a domain behaves on its pages.
+// The lists are comma separated, like the panels of a shared link.
+type TrackingConfig struct {
+	bun.BaseModel `bun:"table:tracking_configs"`
+
+	DomainID string `bun:",pk" json:"domain_id"`
+	// HashRouting counts the URL fragment as part of the path, for single page apps routing with #/
+	HashRouting    bool `bun:"hash_routing,notnull" json:"hash_routing"`
+	TrackOutbound  bool `bun:"track_outbound,notnull" json:"track_outbound"`
+	TrackDownloads bool `bun:"track_downloads,notnull" json:"track_downloads"`
+	// TrackVitals measures the Core Web Vitals of each page load
+	TrackVitals bool `bun:"track_vitals,notnull" json:"track_vitals"`
+	// DownloadExtensions are the file extensions counted as downloads, without the dot
+	DownloadExtensions string `bun:"download_extensions,notnull" json:"download_extensions"`
+	// ExcludedPaths are globs of paths that are never tracked, * matches any characters and ? one
+	ExcludedPaths string `bun:"excluded_paths,notnull" json:"excluded_paths"`
+	// QueryParams are the query parameters kept in tracked paths, every other one is dropped
+	QueryParams string    `bun:"query_params,notnull" json:"query_params"`
+	UpdatedAt   time.Time `bun:",default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// DefaultTrackingConfig is the config of a domain that hasn't saved one
+func DefaultTrackingConfig(domainID string) *TrackingConfig {
+	return &TrackingConfig{
+		DomainID:           domainID,
+		DownloadExtensions: strings.Join(DefaultDownloadExtensions, ","),
+	}
+}
+
+// ReadTrackingConfig reads the domain's tracking config, or the default one if it has none
+func ReadTrackingConfig(ctx context.Context, store Storage, domainID string) (*TrackingConfig, error) {
+	c, err := store.ReadTrackingConfig(ctx, domainID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultTrackingConfig(domainID), nil
+	}
+	return c, err
+}
+
+// Extensions lists the download extensions
+func (c *TrackingConfig) Extensions() []string {
+	return splitList(c.DownloadExtensions)
+}
+
+// Excluded lists the excluded path globs
+func (c *TrackingConfig) Excluded() []string {
+	return splitList(c.ExcludedPaths)
+}
+
+// Params lists the query parameters kept in paths
+func (c *TrackingConfig) Params() []string {
+	return splitList(c.QueryParams)
+}
+
+// Normalize cleans up the lists of c, which may have been typed by hand, returning an error
+// wrapping ErrInvalidTracking if one has an entry that can't be used
+func (c *TrackingConfig) Normalize() error {
+	var exts []string
+	for _, e := range SplitList(c.DownloadExtensions) {
+		e = strings.ToLower(strings.TrimPrefix(e, "."))
+		if e == "" || len(e) > 10 || strings.ContainsFunc(e, func(r rune) bool {
+			return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+		}) {
+			return fmt.Errorf("%w: %q is not a file extension", ErrInvalidTracking, e)
+		}
+		exts = appendNew(exts, e)
+	}
+
+	var paths []string
+	for _, p := range SplitList(c.ExcludedPaths) {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("%w: excluded path %q must start with /", ErrInvalidTracking, p)
+		}
+		paths = appendNew(paths, p)
+	}
+
+	var params []string
+	for _, p := range SplitList(c.QueryParams) {
+		if strings.ContainsAny(p, "&=?#") {
+			return fmt.Errorf("%w: %q is not a query parameter name", ErrInvalidTracking, p)
+		}
+		params = appendNew(params, p)
+	}
+
+	if len(exts) > maxTrackingItems || len(paths) > maxTrackingItems || len(params) > maxTrackingItems {
+		return fmt.Errorf("%w: lists can have at most %d entries", ErrInvalidTracking, maxTrackingItems)
+	}
+	c.DownloadExtensions = strings.Join(exts, ",")
+	c.ExcludedPaths = strings.Join(paths, ",")
+	c.QueryParams = strings.Join(params, ",")
+	return nil
+}
+
+// ScriptConfig is the configuration embedded in the tracker script, which sends events to endpoint
+func (c *TrackingConfig) ScriptConfig(endpoint string) map[string]any {
+	downloads := []string{}
+	if c.TrackDownloads {
+		downloads = nonNil(c.Extensions())
+	}
+	return map[string]any{
+		"endpoint": endpoint,
+		// the per-domain script sends the first pageview itself, no snippet is needed
+		"auto":      true,
+		"hash":      c.HashRouting,
+		"exclude":   nonNil(c.Excluded()),
+		"params":    nonNil(c.Params()),
+		"outbound":  c.TrackOutbound,
+		"downloads": downloads,
+		"vitals":    c.TrackVitals,
+	}
+}
+
+// TrackerScript is the tracker with c's configuration queued ahead of any calls the page makes,
+// and an ETag that changes whenever it does
+func (c *TrackingConfig) TrackerScript(endpoint string, tracker []byte) ([]byte, string, error) {
+	cfg, err := json.Marshal(c.ScriptConfig(endpoint))
+	if err != nil {
+		return nil, "", err
+	}
+	script := []byte("window._uaq=window._uaq||[];window._uaq.unshift(['config'," + string(cfg) + "]);\n")
+	script = append(script, tracker...)
+
+	sum := sha256.Sum256(script)
+	return script, `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func appendNew(list []string, s string) []string {
+	if slices.Contains(list, s) {
+		return list
+	}
+	return append(list, s)
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackingConfigNormalize(t *testing.T) {
+	c := &TrackingConfig{
+		DownloadExtensions: ".PDF, zip\nzip",
+		ExcludedPaths:      "/admin/*,  /preview",
+		QueryParams:        "page q",
+	}
+	assert.NoError(t, c.Normalize())
+	assert.Equal(t, []string{"pdf", "zip"}, c.Extensions())
+	assert.Equal(t, []string{"/admin/*", "/preview"}, c.Excluded())
+	assert.Equal(t, []string{"page", "q"}, c.Params())
+
+	for _, bad := range []*TrackingConfig{
+		{DownloadExtensions: "tar.gz"},
+		{ExcludedPaths: "admin"},
+		{QueryParams: "a=b"},
+	} {
+		assert.ErrorIs(t, bad.Normalize(), ErrInvalidTracking)
+	}
+}
+
+func TestTrackerScript(t *testing.T) {
+	tracker := []byte("(function(){})();")
+	c := DefaultTrackingConfig("d1")
+
+	script, etag, err := c.TrackerScript("https://updog.example.com", tracker)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasSuffix(script, tracker))
+	assert.Contains(t, string(script), `"endpoint":"https://updog.example.com"`)
+	// downloads aren't tracked until they're turned on
+	assert.Contains(t, string(script), `"downloads":[]`)
+	assert.Contains(t, string(script), `"vitals":false`)
+
+	_, same, err := c.TrackerScript("https://updog.example.com", tracker)
+	assert.NoError(t, err)
+	assert.Equal(t, etag, same)
+
+	c.TrackDownloads = true
+	script, changed, err := c.TrackerScript("https://updog.example.com", tracker)
+	assert.NoError(t, err)
+	assert.NotEqual(t, etag, changed)
+	assert.Contains(t, string(script), `"downloads":["7z","apk"`)
+}
@@ -0,0 +1,272 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ways of proving ownership of a domain
+const (
+	// MethodDNS is a TXT record on the domain, TXTPrefix followed by the token
+	MethodDNS = "dns"
+	// MethodMeta is a meta tag named MetaName on the homepage with the token as its content
+	MethodMeta = "meta"
+	// MethodFile is a file at VerificationURL
+	MethodFile = "file"
+)
+
+// Methods are tried in this order when no method is asked for
+var Methods = []string{MethodDNS, MethodMeta, MethodFile}
+
+const (
+	TXTPrefix = "updog-verification="
+	MetaName  = "updog-verification"
+)
+
+// how much of the homepage is searched for the meta tag
+const maxPageBytes = 512 << 10
+
+var ErrNotVerified = errors.New("domain ownership not verified")
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// Resolver looks up TXT records, *net.Resolver is one
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Verifier checks that the owner of a domain published its verification token
+type Verifier struct {
+	Client   *http.Client
+	Resolver Resolver
+}
+
+// NewVerifier returns a verifier using the system resolver and a client with a timeout
+func NewVerifier() *Verifier {
+	return &Verifier{
+		Client:   defaultClient,
+		Resolver: net.DefaultResolver,
+	}
+}
+
+// VerifyError holds why each method that was tried failed
+type VerifyError struct {
+	Errors map[string]error
+}
+
+func (e *VerifyError) Error() string {
+	var msgs []string
+	for _, m := range Methods {
+		if err, ok := e.Errors[m]; ok {
+			msgs = append(msgs, m+": "+err.Error())
+		}
+	}
+	return ErrNotVerified.Error() + ": " + strings.Join(msgs, "; ")
+}
+
+func (e *VerifyError) Unwrap() error {
+	return ErrNotVerified
+}
+
+// Messages are the failures by method, for showing to the owner
+func (e *VerifyError) Messages() map[string]string {
+	msgs := make(map[string]string, len(e.Errors))
+	for m, err := range e.Errors {
+		msgs[m] = err.Error()
+	}
+	return msgs
+}
+
+// ParseMethod checks s names a method, empty means any
+func ParseMethod(s string) (string, error) {
+	if s == "" || slices.Contains(Methods, s) {
+		return s, nil
+	}
+	return "", fmt.Errorf("unsupported verification method: %s", s)
+}
+
+// VerificationURL is where the owner of d publishes its verification file
+func (d *Domain) VerificationURL() string {
+	return "https://" + d.Name + "/updog_" + d.VerificationToken + ".txt"
+}
+
+// VerificationTXT is the TXT record the owner of d adds to its DNS
+func (d *Domain) VerificationTXT() string {
+	return TXTPrefix + d.VerificationToken
+}
+
+// VerificationMeta is the tag the owner of d adds to the head of its homepage
+func (d *Domain) VerificationMeta() string {
+	return `<meta name="` + MetaName + `" content="` + d.VerificationToken + `">`
+}
+
+// Verify checks d with method, or with each method until one passes if method is empty.
+// It returns the method that passed or a *VerifyError.
+func (v *Verifier) Verify(ctx context.Context, d *Domain, method string) (string, error) {
+	methods := Methods
+	if method != "" {
+		methods = []string{method}
+	}
+
+	verr := &VerifyError{Errors: make(map[string]error, len(methods))}
+	for _, m := range methods {
+		var err error
+		switch m {
+		case MethodDNS:
+			err = v.verifyDNS(ctx, d)
+		case MethodMeta:
+			err = v.verifyMeta(ctx, d)
+		case MethodFile:
+			err = v.verifyFile(ctx, d)
+		default:
+			err = fmt.Errorf("unsupported verification method: %s", m)
+		}
+		if err == nil {
+			return m, nil
+		}
+		verr.Errors[m] = err
+	}
+	return "", verr
+}
+
+func (v *Verifier) verifyDNS(ctx context.Context, d *Domain) error {
+	resolver := v.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	records, err := resolver.LookupTXT(ctx, d.Name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return fmt.Errorf("no TXT records found for %s", d.Name)
+		}
+		return fmt.Errorf("looking up TXT records for %s: %v", d.Name, err)
+	}
+	want := d.VerificationTXT()
+	for _, r := range records {
+		if strings.TrimSpace(r) == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("no TXT record %q found for %s", want, d.Name)
+}
+
+func (v *Verifier) verifyMeta(ctx context.Context, d *Domain) error {
+	page := "https://" + d.Name + "/"
+	resp, err := v.get(ctx, page, "text/html")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes))
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", page, err)
+	}
+	content, ok := findMeta(string(body), MetaName)
+	if !ok {
+		return fmt.Errorf("no %s meta tag found at %s", MetaName, page)
+	}
+	if content != d.VerificationToken {
+		return fmt.Errorf("the %s meta tag at %s has a different token", MetaName, page)
+	}
+	return nil
+}
+
+func (v *Verifier) verifyFile(ctx context.Context, d *Domain) error {
+	u := d.VerificationURL()
+	resp, err := v.get(ctx, u, "text/plain")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// sites that answer every path with a page must not pass, the file holds the token
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes))
+	if err != nil {
+		return fmt.Errorf("reading %s: %v", u, err)
+	}
+	if strings.TrimSpace(string(body)) != d.VerificationToken {
+		return fmt.Errorf("%s doesn't contain the verification token", u)
+	}
+	return nil
+}
+
+// get fetches u, anything but a 200 after redirects is an error
+func (v *Verifier) get(ctx context.Context, u, accept string) (*http.Response, error) {
+	client := v.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request for %s: %v", u, err)
+	}
+
+	// set a realistic User-Agent and Accept header
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Updog/1.0)")
+	req.Header.Set("Accept", accept)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return nil, fmt.Errorf("fetching %s: %v", u, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned %d", u, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+var (
+	metaTagRe = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attrRe    = regexp.MustCompile(`(?s)([a-zA-Z][\w:-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// findMeta returns the content of the first meta tag named name in page
+func findMeta(page, name string) (string, bool) {
+	for _, tag := range metaTagRe.FindAllString(page, -1) {
+		attrs := map[string]string{}
+		for _, m := range attrRe.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3] + m[4])
+		}
+		if strings.EqualFold(strings.TrimSpace(attrs["name"]), name) {
+			return strings.TrimSpace(attrs["content"]), true
+		}
+	}
+	return "", false
+}
+
+// NormalizeName lowercases a domain name and strips a scheme or path pasted along with it
+func NormalizeName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if strings.Contains(name, "://") {
+		u, err := url.Parse(name)
+		if err != nil {
+			return "", fmt.Errorf("invalid domain name: %s", name)
+		}
+		name = u.Host
+	}
+	name, _, _ = strings.Cut(name, "/")
+	name = strings.TrimSuffix(name, ".")
+
+	if name == "" || strings.ContainsAny(name, " :@?#") {
+		return "", fmt.Errorf("invalid domain name: %q", name)
+	}
+	return name, nil
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, ok := f[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// testVerifier serves requests for every host with mux and resolves with records
+func testVerifier(mux http.Handler, records fakeResolver) *Verifier {
+	return &Verifier{
+		Client: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			return w.Result(), nil
+		})},
+		Resolver: records,
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	d := &Domain{Name: "example.com", VerificationToken: "tok"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("example.com/updog_tok.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tok\n"))
+	})
+	mux.HandleFunc("example.com/updog_new.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>Not Found</html>"))
+	})
+	mux.HandleFunc("example.com/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><META content='tok' Name="updog-verification"></head></html>`))
+	})
+	v := testVerifier(mux, fakeResolver{"example.com": {"v=spf1 -all", "updog-verification=tok"}})
+
+	for _, m := range Methods {
+		method, err := v.Verify(ctx, d, m)
+		assert.NoError(t, err, m)
+		assert.Equal(t, m, method)
+	}
+	method, err := v.Verify(ctx, d, "")
+	assert.NoError(t, err)
+	assert.Equal(t, MethodDNS, method)
+
+	// each method says why it failed
+	other := &Domain{Name: "other.com", VerificationToken: "tok"}
+	_, err = v.Verify(ctx, other, "")
+	assert.ErrorIs(t, err, ErrNotVerified)
+	var verr *VerifyError
+	if assert.True(t, errors.As(err, &verr)) {
+		msgs := verr.Messages()
+		assert.Equal(t, "no TXT records found for other.com", msgs[MethodDNS])
+		assert.Equal(t, "https://other.com/ returned 404", msgs[MethodMeta])
+		assert.Equal(t, "https://other.com/updog_tok.txt returned 404", msgs[MethodFile])
+	}
+
+	// a different token doesn't count
+	d.VerificationToken = "new"
+	_, err = v.Verify(ctx, d, MethodDNS)
+	assert.ErrorContains(t, err, `no TXT record "updog-verification=new" found`)
+	_, err = v.Verify(ctx, d, MethodMeta)
+	assert.ErrorContains(t, err, "has a different token")
+	_, err = v.Verify(ctx, d, MethodFile)
+	assert.ErrorContains(t, err, "https://example.com/updog_new.txt doesn't contain the verification token")
+}
+
+func TestFindMeta(t *testing.T) {
+	content, ok := findMeta(`<meta charset="utf-8"><meta name=updog-verification content="a&amp;b" />`, MetaName)
+	assert.True(t, ok)
+	assert.Equal(t, "a&b", content)
+
+	_, ok = findMeta(`<meta name="description" content="updog-verification">`, MetaName)
+	assert.False(t, ok)
+}
+
+func TestParseMethod(t *testing.T) {
+	for _, m := range append([]string{""}, Methods...) {
+		got, err := ParseMethod(m)
+		assert.NoError(t, err)
+		assert.Equal(t, m, got)
+	}
+	_, err := ParseMethod("email")
+	assert.Error(t, err)
+}
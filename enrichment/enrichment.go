@@ -3,12 +3,11 @@ package enrichment
 import (
 	"hash/crc32"
 	"log"
-	"net"
 	"net/http"
-	"strings"
 
 	"github.com/zackb/updog/enrichment/geo"
 	"github.com/zackb/updog/enrichment/ua"
+	"github.com/zackb/updog/httpx"
 	"github.com/zackb/updog/pageview"
 )
 
@@ -38,7 +37,7 @@ func (e *Enricher) Enrich(req *http.Request) (*Enrichment, error) {
 
 	res := &Enrichment{}
 
-	ip := getClientIP(req)
+	ip := httpx.ClientIP(req)
 	userAgent := req.UserAgent()
 
 	entry, err := e.g.Lookup(ip)
@@ -57,25 +56,3 @@ func (e *Enricher) Enrich(req *http.Request) (*Enrichment, error) {
 
 	return res, nil
 }
-
-// getClientIP extracts the client's real IP address from the request
-// checks X-Forwarded-For, X-Real-IP, and falls back to RemoteAddr
-func getClientIP(r *http.Request) string {
-	// 1. Check X-Forwarded-For (may be comma-separated)
-	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
-		ips := strings.Split(fwd, ",")
-		return strings.TrimSpace(ips[0]) // first IP is the original client
-	}
-
-	// 2. Check X-Real-IP
-	if real := r.Header.Get("X-Real-IP"); real != "" {
-		return real
-	}
-
-	// 3. Fallback to RemoteAddr (strip port)
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		host = r.RemoteAddr
-	}
-	return host
-}
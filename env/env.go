@@ -4,14 +4,37 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
-	EnvHttpPort      = "HTTP_PORT"
-	EnvDsn           = "DATABASE_URL"
-	EnvMaxmindCityDb = "MAXMIND_CITY_DB"
-	EnvTLSCert       = "TLS_CERT_PATH"
-	EnvTLSKey        = "TLS_KEY_PATH"
+	EnvHttpPort       = "HTTP_PORT"
+	EnvDsn            = "DATABASE_URL"
+	EnvMaxmindCityDb  = "MAXMIND_CITY_DB"
+	EnvTLSCert        = "TLS_CERT_PATH"
+	EnvTLSKey         = "TLS_KEY_PATH"
+	EnvJWKSPath       = "JWKS_PATH"
+	EnvBackupDir      = "BACKUP_DIR"
+	EnvBackupCron     = "BACKUP_CRON"
+	EnvBackupKeep     = "BACKUP_KEEP"
+	EnvBaseURL        = "BASE_URL"
+	EnvAccessTTL      = "ACCESS_TOKEN_TTL"
+	EnvSessionTTL     = "SESSION_TTL"
+	EnvSMTPHost       = "SMTP_HOST"
+	EnvSMTPPort       = "SMTP_PORT"
+	EnvSMTPUsername   = "SMTP_USERNAME"
+	EnvSMTPPassword   = "SMTP_PASSWORD"
+	EnvMailFrom       = "MAIL_FROM"
+	EnvTrustedProxies = "TRUSTED_PROXIES"
+
+	EnvOIDCIssuer           = "OIDC_ISSUER"
+	EnvOIDCClientID         = "OIDC_CLIENT_ID"
+	EnvOIDCClientSecret     = "OIDC_CLIENT_SECRET"
+	EnvOIDCRedirectURL      = "OIDC_REDIRECT_URL"
+	EnvOIDCName             = "OIDC_NAME"
+	EnvOIDCAllowedDomains   = "OIDC_ALLOWED_DOMAINS"
+	EnvDisablePasswordLogin = "DISABLE_PASSWORD_LOGIN"
 )
 
 var ecache = map[string]string{}
@@ -41,6 +64,30 @@ func GetInt(name string, def int) int {
 	return i
 }
 
+func GetDuration(name string, def time.Duration) time.Duration {
+	s := os.Getenv(name)
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Fatalf("ERROR: failed parsing env %s %s %s\n", name, s, err.Error())
+	}
+	return d
+}
+
+func GetBool(name string, def bool) bool {
+	s := os.Getenv(name)
+	if s == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		log.Fatalf("ERROR: failed parsing env %s %s %s\n", name, s, err.Error())
+	}
+	return b
+}
+
 func IsDev() bool {
 	s := GetString("DEV", "false")
 	if s == "true" || s == "1" {
@@ -68,3 +115,104 @@ func GetTLSCert() string {
 func GetTLSKey() string {
 	return GetString(EnvTLSKey, "")
 }
+
+func GetJWKSPath() string {
+	return GetString(EnvJWKSPath, "jwks.json")
+}
+
+// GetBackupDir is where scheduled backups are written, scheduled backups are disabled if empty
+func GetBackupDir() string {
+	return GetString(EnvBackupDir, "")
+}
+
+func GetBackupCron() string {
+	return GetString(EnvBackupCron, "0 3 * * *")
+}
+
+// GetBackupKeep is the number of scheduled backups to keep when rotating
+func GetBackupKeep() int {
+	return GetInt(EnvBackupKeep, 7)
+}
+
+// GetBaseURL is the public URL of this instance used in links. Pages derive it from the request when
+// it's empty, but links in emails are only ever built from it.
+func GetBaseURL() string {
+	return GetString(EnvBaseURL, "")
+}
+
+// GetAccessTTL is how long an access token is valid before it has to be refreshed
+func GetAccessTTL() time.Duration {
+	return GetDuration(EnvAccessTTL, 15*time.Minute)
+}
+
+// GetSessionTTL is how long a session lasts without being refreshed
+func GetSessionTTL() time.Duration {
+	return GetDuration(EnvSessionTTL, 30*24*time.Hour)
+}
+
+// GetSMTPHost is the mail server, emails are only logged if it's empty
+func GetSMTPHost() string {
+	return GetString(EnvSMTPHost, "")
+}
+
+func GetSMTPPort() int {
+	return GetInt(EnvSMTPPort, 587)
+}
+
+func GetSMTPUsername() string {
+	return GetString(EnvSMTPUsername, "")
+}
+
+func GetSMTPPassword() string {
+	return GetString(EnvSMTPPassword, "")
+}
+
+// GetMailFrom is the sender address of emails
+func GetMailFrom() string {
+	return GetString(EnvMailFrom, "Updog <updog@localhost>")
+}
+
+// GetOIDCIssuer is the OpenID Connect provider for single sign-on, which is off if it's empty
+func GetOIDCIssuer() string {
+	return GetString(EnvOIDCIssuer, "")
+}
+
+func GetOIDCClientID() string {
+	return GetString(EnvOIDCClientID, "")
+}
+
+func GetOIDCClientSecret() string {
+	return GetString(EnvOIDCClientSecret, "")
+}
+
+// GetOIDCRedirectURL is the callback registered with the provider, empty to derive it from BASE_URL or the request
+func GetOIDCRedirectURL() string {
+	return GetString(EnvOIDCRedirectURL, "")
+}
+
+// GetOIDCName labels the single sign-on button
+func GetOIDCName() string {
+	return GetString(EnvOIDCName, "SSO")
+}
+
+// GetTrustedProxies are the comma separated IPs or CIDR ranges of reverse proxies whose
+// X-Forwarded-For, X-Real-IP and X-Forwarded-Proto headers are believed, none if empty
+func GetTrustedProxies() string {
+	return GetString(EnvTrustedProxies, "")
+}
+
+// GetOIDCAllowedDomains are the email domains that can sign in with single sign-on, any if empty
+func GetOIDCAllowedDomains() []string {
+	var domains []string
+	for _, d := range strings.Split(GetString(EnvOIDCAllowedDomains, ""), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, strings.ToLower(d))
+		}
+	}
+	return domains
+}
+
+// IsPasswordLoginDisabled is true if users can only sign in with single sign-on
+func IsPasswordLoginDisabled() bool {
+	return GetBool(EnvDisablePasswordLogin, false)
+}
@@ -0,0 +1,69 @@
+package frontend
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/zackb/updog/apikey"
+	"github.com/zackb/updog/audit"
+)
+
+// createAPIKey creates a key and shows it, it can't be shown again
+func (f *Frontend) createAPIKey(req *UpdogRequest) error {
+	if req.R.Method != http.MethodPost {
+		return NewUpError("Method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	name := strings.TrimSpace(req.R.FormValue("name"))
+	if name == "" {
+		return NewUpError("Key name is required", http.StatusBadRequest)
+	}
+
+	// optionally restrict the key to one of the user's domains
+	domainID := req.R.FormValue("domain_id")
+	if domainID != "" {
+		_, role, err := f.db.DomainStorage().ReadDomainForUser(req.R.Context(), domainID, req.User.ID)
+		if err != nil || role == "" {
+			return NewUpError("Domain not found", http.StatusBadRequest)
+		}
+	}
+
+	k, secret := apikey.New(req.User.ID, name, req.R.Form["scopes"], domainID)
+	if k.Scopes == "" {
+		return NewUpError("Select at least one scope", http.StatusBadRequest)
+	}
+
+	if err := f.db.APIKeyStorage().CreateKey(req.R.Context(), k); err != nil {
+		log.Printf("Failed to create api key: %v", err)
+		return NewUpError("Failed to create API key", http.StatusInternalServerError)
+	}
+
+	audit.Record(req.R.Context(), f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionAPIKeyCreate, audit.TargetUser, req.User.ID, map[string]any{
+		"key_id":    k.ID,
+		"name":      k.Name,
+		"scopes":    k.ScopeList(),
+		"domain_id": k.DomainID,
+	}))
+
+	return f.renderSettings(req, secret)
+}
+
+func (f *Frontend) revokeAPIKey(req *UpdogRequest) error {
+	if req.R.Method != http.MethodPost {
+		return NewUpError("Method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	keyID := req.R.FormValue("key_id")
+	if err := f.db.APIKeyStorage().DeleteKey(req.R.Context(), req.User.ID, keyID); err != nil {
+		log.Printf("Failed to delete api key: %v", err)
+		return NewUpError("Failed to revoke API key", http.StatusInternalServerError)
+	}
+
+	audit.Record(req.R.Context(), f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionAPIKeyRevoke, audit.TargetUser, req.User.ID, map[string]any{
+		"key_id": keyID,
+	}))
+
+	http.Redirect(req.W, req.R, "/settings", http.StatusSeeOther)
+	return nil
+}
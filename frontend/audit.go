@@ -0,0 +1,123 @@
+package frontend
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/zackb/updog/audit"
+)
+
+// auditPageSize is how many entries the audit log shows at a time
+const auditPageSize = 50
+
+// auditLog shows the audit log to admins, filtered by the query
+func (f *Frontend) auditLog(req *UpdogRequest) error {
+
+	ctx := req.R.Context()
+
+	if !req.User.IsAdmin() {
+		return NewUpError("Forbidden", http.StatusForbidden)
+	}
+
+	q := req.R.URL.Query()
+	filter, err := audit.FilterFromQuery(q)
+	if err != nil {
+		return NewUpError(err.Error(), http.StatusBadRequest)
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	data := PageData{
+		Title:   "Audit Log",
+		User:    req.User,
+		Slug:    "admin",
+		Domains: req.Domains,
+		Stats: &DashboardStats{
+			SelectedDomain: req.SelectedDomain,
+		},
+	}
+
+	// admins filter by email, the api by id
+	actor := strings.TrimSpace(q.Get("actor"))
+	if actor != "" && filter.ActorID == "" {
+		u, err := f.db.UserStorage().ReadUserByEmail(ctx, actor)
+		if err != nil {
+			data.Error = "No user has the email " + actor
+		} else {
+			filter.ActorID = u.ID
+		}
+	}
+
+	var entries []*audit.Entry
+	if data.Error == "" {
+		entries, err = f.db.AuditStorage().ListAuditEntries(ctx, filter, auditPageSize+1, offset)
+		if err != nil {
+			log.Printf("Failed to list audit entries: %v", err)
+			return NewUpError("Failed to load the audit log", http.StatusInternalServerError)
+		}
+	}
+	more := len(entries) > auditPageSize
+	if more {
+		entries = entries[:auditPageSize]
+	}
+
+	users, err := f.db.UserStorage().ListUsers(ctx, 1000, 0)
+	if err != nil {
+		log.Printf("Failed to list users: %v", err)
+	}
+	emails := make(map[string]string, len(users))
+	for _, u := range users {
+		emails[u.ID] = u.Email
+	}
+
+	// pages keep the filter and only move the offset
+	page := func(offset int) string {
+		p := url.Values{}
+		for k, v := range q {
+			if k != "offset" && len(v) > 0 && v[0] != "" {
+				p.Set(k, v[0])
+			}
+		}
+		if offset > 0 {
+			p.Set("offset", strconv.Itoa(offset))
+		}
+		return "/admin/audit?" + p.Encode()
+	}
+	export := url.Values{"format": {"csv"}, "limit": {"1000"}}
+	for k, v := range map[string]string{"actor_id": filter.ActorID, "action": filter.Action, "target_type": filter.TargetType,
+		"target_id": filter.TargetID, "from": q.Get("from"), "to": q.Get("to")} {
+		if v != "" {
+			export.Set(k, v)
+		}
+	}
+
+	data.Data = map[string]any{
+		"Entries":     entries,
+		"Emails":      emails,
+		"Actions":     audit.Actions,
+		"Categories":  audit.Categories(),
+		"TargetTypes": []string{audit.TargetDomain, audit.TargetUser, audit.TargetTeam, audit.TargetSetting},
+		"Query": map[string]string{
+			"actor":       actor,
+			"action":      filter.Action,
+			"target_type": filter.TargetType,
+			"target_id":   filter.TargetID,
+			"from":        q.Get("from"),
+			"to":          q.Get("to"),
+		},
+		"ExportURL": "/api/v1/audit?" + export.Encode(),
+	}
+	if offset > 0 {
+		data.Data["NewerURL"] = page(max(offset-auditPageSize, 0))
+	}
+	if more {
+		data.Data["OlderURL"] = page(offset + auditPageSize)
+	}
+
+	return tmpl.ExecuteTemplate(req.W, "audit.html", data)
+}
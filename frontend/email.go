@@ -0,0 +1,123 @@
+package frontend
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/env"
+	"github.com/zackb/updog/user"
+)
+
+// forgotPassword emails a reset link, the page reads the same whether or not the account exists
+func (f *Frontend) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	if env.IsPasswordLoginDisabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := PageData{Title: "Forgot Password"}
+
+	if r.Method == http.MethodPost {
+		if err := f.emails.SendPasswordReset(r.Context(), r.FormValue("email")); err != nil {
+			log.Printf("Failed to send password reset: %v", err)
+		}
+		data.Message = "If the email belongs to an account, a reset link is on its way."
+	}
+
+	tmpl.ExecuteTemplate(w, "forgot_password.html", data)
+}
+
+// resetPassword sets a new password with the link from the reset email and logs out every session
+func (f *Frontend) resetPassword(w http.ResponseWriter, r *http.Request) {
+	if env.IsPasswordLoginDisabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	token := r.FormValue("token")
+	data := PageData{
+		Title: "Reset Password",
+		Data:  map[string]any{"Token": token},
+	}
+
+	if _, err := f.emails.CheckPasswordReset(ctx, token); err != nil {
+		if !errors.Is(err, user.ErrInvalidLink) {
+			log.Printf("Failed to check password reset: %v", err)
+		}
+		data.Error = user.ErrInvalidLink.Error()
+		data.Data["Invalid"] = true
+		tmpl.ExecuteTemplate(w, "reset_password.html", data)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		password := r.FormValue("password")
+		if password == "" || password != r.FormValue("confirm_password") {
+			data.Error = "Passwords don't match"
+			tmpl.ExecuteTemplate(w, "reset_password.html", data)
+			return
+		}
+
+		u, err := f.emails.ResetPassword(ctx, token, password)
+		if err != nil {
+			log.Printf("Failed to reset password: %v", err)
+			data.Error = "Failed to reset password"
+			tmpl.ExecuteTemplate(w, "reset_password.html", data)
+			return
+		}
+		if err := f.sessions.RevokeAll(ctx, u.ID); err != nil {
+			log.Printf("Failed to revoke sessions: %v", err)
+		}
+		audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(r, u.ID, audit.ActionUserReset, audit.TargetUser, u.ID, nil))
+
+		f.renderLogin(w, PageData{
+			Title:   "Login",
+			Message: "Your password has been reset, sign in with the new one.",
+		})
+		return
+	}
+
+	tmpl.ExecuteTemplate(w, "reset_password.html", data)
+}
+
+// verifyEmail confirms the user's email with the link from the confirmation email
+func (f *Frontend) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	data := PageData{Title: "Confirm Email"}
+
+	u, err := f.emails.VerifyEmail(r.Context(), r.FormValue("token"))
+	if err != nil {
+		if !errors.Is(err, user.ErrInvalidLink) {
+			log.Printf("Failed to verify email: %v", err)
+		}
+		data.Error = user.ErrInvalidLink.Error()
+	} else {
+		audit.Record(r.Context(), f.db.AuditStorage(), audit.NewEntry(r, u.ID, audit.ActionUserEmailVerify, audit.TargetUser, u.ID, map[string]any{
+			"email": u.Email,
+		}))
+		data.Message = "Thanks, " + u.Email + " is confirmed."
+	}
+
+	tmpl.ExecuteTemplate(w, "verify_email.html", data)
+}
+
+// resendVerification sends the user another confirmation email
+func (f *Frontend) resendVerification(req *UpdogRequest) error {
+	if req.R.Method != http.MethodPost {
+		return NewUpError("Method not allowed", http.StatusMethodNotAllowed)
+	}
+	if req.User.EmailVerified {
+		http.Redirect(req.W, req.R, "/settings", http.StatusSeeOther)
+		return nil
+	}
+
+	if err := f.emails.SendVerification(req.R.Context(), req.User); err != nil {
+		log.Printf("Failed to send verification email: %v", err)
+		return NewUpError("Failed to send email", http.StatusInternalServerError)
+	}
+
+	http.Redirect(req.W, req.R, "/settings?verification=sent", http.StatusSeeOther)
+	return nil
+}
@@ -1,21 +1,36 @@
 package frontend
 
 import (
+	"database/sql"
 	"embed"
+	"errors"
+	"fmt"
 	"html/template"
 	"io/fs"
 	"log"
 	"net/http"
+	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
+	"github.com/zackb/updog/apikey"
+	"github.com/zackb/updog/audit"
 	"github.com/zackb/updog/auth"
 	"github.com/zackb/updog/db"
 	"github.com/zackb/updog/domain"
 	"github.com/zackb/updog/env"
+	"github.com/zackb/updog/httpx"
 	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/lockout"
+	"github.com/zackb/updog/mail"
+	"github.com/zackb/updog/oidc"
 	"github.com/zackb/updog/pageview"
+	"github.com/zackb/updog/session"
 	"github.com/zackb/updog/settings"
+	"github.com/zackb/updog/share"
+	"github.com/zackb/updog/team"
+	"github.com/zackb/updog/user"
 )
 
 //go:embed views/*.html
@@ -29,14 +44,23 @@ var tmpl = template.Must(template.New("").Funcs(Funcs).
 
 var staticHandler http.Handler
 
+// staticFiles are the files under public, from disk in dev mode
+var staticFiles fs.FS
+
 type Frontend struct {
 	auth          *auth.Service
+	sessions      *session.Manager
 	db            *db.DB
 	ps            pageview.Storage
+	sender        mail.Sender
+	emails        *user.Emails
+	oidc          *oidc.Provider
+	guard         *lockout.Guard
+	verifier      *domain.Verifier
 	staticHandler http.Handler
 }
 
-func NewFrontend(authSvc *auth.Service, database *db.DB) (*Frontend, error) {
+func NewFrontend(authSvc *auth.Service, database *db.DB, sessions *session.Manager, sender mail.Sender) (*Frontend, error) {
 	if err := initTemplatesAndStatic(); err != nil {
 		log.Fatalf("Failed to initialize templates and static files: %v", err)
 		return nil, err
@@ -44,8 +68,13 @@ func NewFrontend(authSvc *auth.Service, database *db.DB) (*Frontend, error) {
 
 	return &Frontend{
 		auth:          authSvc,
+		sessions:      sessions,
 		db:            database,
 		ps:            database.PageviewStorage(),
+		sender:        sender,
+		emails:        user.NewEmails(database.UserStorage(), authSvc, sender),
+		guard:         lockout.NewGuard(database.LockoutStorage(), database.AuditStorage()),
+		verifier:      domain.NewVerifier(),
 		staticHandler: staticHandler,
 	}, nil
 }
@@ -55,16 +84,49 @@ func (f *Frontend) Routes(mux *http.ServeMux) {
 	// serve static files from the public directory
 	mux.Handle("/static/", http.StripPrefix("/static/", staticHandler))
 
+	// the tracker with a domain's configuration
+	mux.HandleFunc("/js/{script}", f.trackerScript)
+
 	mux.HandleFunc("/logout", f.logout)
 	mux.HandleFunc("/join", f.join)
 	mux.HandleFunc("/login", f.login)
+	mux.HandleFunc("/login/2fa", f.loginTwoFactor)
+	mux.HandleFunc("/login/oidc", f.loginOIDC)
+	mux.HandleFunc("/login/oidc/callback", f.oidcCallback)
+	mux.HandleFunc("/forgot-password", f.forgotPassword)
+	mux.HandleFunc("/reset-password", f.resetPassword)
+	mux.HandleFunc("/verify-email", f.verifyEmail)
 	mux.HandleFunc("/dashboard", f.WithAuthenticated(f.WithUpdog(f.dashboard)))
 	mux.HandleFunc("/realtime", f.WithAuthenticated(f.WithUpdog(f.realtime)))
 	mux.HandleFunc("/domains", f.WithAuthenticated(f.WithUpdog(f.domains)))
 	mux.HandleFunc("/domains/verify", f.WithAuthenticated(f.WithUpdog(f.verifyDomain)))
+	mux.HandleFunc("/domains/reset", f.WithAuthenticated(f.WithUpdog(f.resetDomain)))
+	mux.HandleFunc("/domains/delete", f.WithAuthenticated(f.WithUpdog(f.deleteDomain)))
+	mux.HandleFunc("/domains/hostnames", f.WithAuthenticated(f.WithUpdog(f.domainHostnames)))
+	mux.HandleFunc("/domains/aliases/verify", f.WithAuthenticated(f.WithUpdog(f.verifyAlias)))
+	mux.HandleFunc("/domains/tracking", f.WithAuthenticated(f.WithUpdog(f.domainTracking)))
 	mux.HandleFunc("/visitors", f.WithAuthenticated(f.WithUpdog(f.visitors)))
 	mux.HandleFunc("/pages", f.WithAuthenticated(f.WithUpdog(f.pages)))
+	mux.HandleFunc("/performance", f.WithAuthenticated(f.WithUpdog(f.performance)))
 	mux.HandleFunc("/settings", f.WithAuthenticated(f.WithUpdog(f.settings)))
+	mux.HandleFunc("/settings/keys", f.WithAuthenticated(f.WithUpdog(f.createAPIKey)))
+	mux.HandleFunc("/settings/keys/revoke", f.WithAuthenticated(f.WithUpdog(f.revokeAPIKey)))
+	mux.HandleFunc("/settings/sessions/revoke", f.WithAuthenticated(f.WithUpdog(f.revokeSession)))
+	mux.HandleFunc("/settings/2fa", f.WithAuthenticated(f.WithUpdog(f.twoFactor)))
+	mux.HandleFunc("/settings/email/resend", f.WithAuthenticated(f.WithUpdog(f.resendVerification)))
+	mux.HandleFunc("/admin", f.WithAuthenticated(f.WithUpdog(f.admin)))
+	mux.HandleFunc("/admin/audit", f.WithAuthenticated(f.WithUpdog(f.auditLog)))
+	mux.HandleFunc("/teams", f.WithAuthenticated(f.WithUpdog(f.teams)))
+	mux.HandleFunc("/teams/invite", f.WithAuthenticated(f.WithUpdog(f.inviteToTeam)))
+	mux.HandleFunc("/teams/revoke", f.WithAuthenticated(f.WithUpdog(f.revokeInvitation)))
+	mux.HandleFunc("/teams/members", f.WithAuthenticated(f.WithUpdog(f.updateMember)))
+	mux.HandleFunc("/teams/delete", f.WithAuthenticated(f.WithUpdog(f.deleteTeam)))
+	mux.HandleFunc("/invitations/accept", f.WithAuthenticated(f.acceptInvitation))
+	mux.HandleFunc("/domains/share", f.WithAuthenticated(f.WithUpdog(f.createShare)))
+	mux.HandleFunc("/domains/share/revoke", f.WithAuthenticated(f.WithUpdog(f.revokeShare)))
+	mux.HandleFunc("/share/{slug}", f.WithShare(share.PanelDashboard, f.dashboard))
+	mux.HandleFunc("/share/{slug}/pages", f.WithShare(share.PanelPages, f.pages))
+	mux.HandleFunc("/share/{slug}/visitors", f.WithShare(share.PanelVisitors, f.visitors))
 	mux.HandleFunc("/", f.index)
 }
 
@@ -133,11 +195,20 @@ func (f *Frontend) dashboard(req *UpdogRequest) error {
 		} else {
 			stats.DeviceUsage = deviceUsage
 		}
+
+		// hostnames
+		hostnames, err := f.ps.GetHostnames(ctx, req.SelectedDomain.ID, req.Start, req.End)
+		if err != nil {
+			log.Printf("Failed to get hostnames: %v", err)
+		} else {
+			stats.Hostnames = hostnames
+		}
 	}
 
 	data := PageData{
 		Title:   "Dashboard",
 		User:    req.User,
+		Share:   req.Share,
 		Stats:   stats,
 		Slug:    "dashboard",
 		Domains: req.Domains,
@@ -168,30 +239,91 @@ func (f *Frontend) domains(req *UpdogRequest) error {
 	// POST create domain
 	if req.R.Method == http.MethodPost {
 		// create new domain
-		name := req.R.FormValue("name")
-		if name == "" {
-			return NewUpError("Domain name is required", http.StatusBadRequest)
+		name, err := domain.NormalizeName(req.R.FormValue("name"))
+		if err != nil {
+			return NewUpError("A valid domain name is required", http.StatusBadRequest)
+		}
+		if err := domain.HostnameAvailable(ctx, f.db.DomainStorage(), name, ""); err != nil {
+			if errors.Is(err, domain.ErrHostnameTaken) {
+				return NewUpError("That domain is already tracked", http.StatusConflict)
+			}
+			log.Printf("Failed to read domain: %v", err)
+			return NewUpError("Failed to create domain", http.StatusInternalServerError)
+		}
+
+		// optionally share it with a team the user can edit
+		teamID := req.R.FormValue("team_id")
+		if teamID != "" {
+			m, err := f.db.TeamStorage().ReadMember(ctx, teamID, req.User.ID)
+			if err != nil || !team.RoleAtLeast(m.Role, team.RoleEditor) {
+				return NewUpError("Team not found", http.StatusBadRequest)
+			}
 		}
 
 		domain := &domain.Domain{
 			ID:                id.NewID(),
 			Name:              name,
 			UserID:            req.User.ID,
+			TeamID:            teamID,
 			VerificationToken: id.NewID(),
 			Verified:          false,
 		}
 
-		_, err := f.db.DomainStorage().CreateDomain(ctx, domain)
+		_, err = f.db.DomainStorage().CreateDomain(ctx, domain)
 		if err != nil {
 			log.Printf("Failed to create domain: %v", err)
 			return NewUpError("Failed to create domain", http.StatusInternalServerError)
 		}
 
+		audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionDomainCreate, audit.TargetDomain, domain.ID, map[string]any{
+			"name":    domain.Name,
+			"team_id": domain.TeamID,
+		}))
+
 		http.Redirect(req.W, req.R, "/domains", http.StatusSeeOther)
 
 		return nil
 	}
 
+	memberships, err := f.db.TeamStorage().ListTeamsByUser(ctx, req.User.ID)
+	if err != nil {
+		log.Printf("Failed to list teams: %v", err)
+		return NewUpError("Failed to load teams", http.StatusInternalServerError)
+	}
+
+	// the user's role on each domain decides which actions are shown
+	teamRoles := make(map[string]string, len(memberships))
+	var teams []*team.Team
+	for _, m := range memberships {
+		teamRoles[m.TeamID] = m.Role
+		if team.RoleAtLeast(m.Role, team.RoleEditor) {
+			teams = append(teams, m.Team)
+		}
+	}
+	if err := domain.LoadAliases(ctx, f.db.DomainStorage(), req.Domains...); err != nil {
+		log.Printf("Failed to list aliases: %v", err)
+	}
+
+	roles := make(map[string]string, len(req.Domains))
+	links := make(map[string][]*share.Link)
+	tracking := make(map[string]*domain.TrackingConfig, len(req.Domains))
+	for _, d := range req.Domains {
+		if tracking[d.ID], err = domain.ReadTrackingConfig(ctx, f.db.DomainStorage(), d.ID); err != nil {
+			log.Printf("Failed to read tracking config: %v", err)
+			tracking[d.ID] = domain.DefaultTrackingConfig(d.ID)
+		}
+		if d.UserID == req.User.ID {
+			roles[d.ID] = team.RoleOwner
+		} else {
+			roles[d.ID] = teamRoles[d.TeamID]
+		}
+		if roles[d.ID] == team.RoleOwner {
+			if links[d.ID], err = f.db.ShareStorage().ListLinksByDomain(ctx, d.ID); err != nil {
+				log.Printf("Failed to list shared links: %v", err)
+			}
+		}
+	}
+
 	data := PageData{
 		Title:   "Domains",
 		User:    req.User,
@@ -200,6 +332,15 @@ func (f *Frontend) domains(req *UpdogRequest) error {
 		Stats: &DashboardStats{
 			SelectedDomain: req.SelectedDomain,
 		},
+		Data: map[string]any{
+			"Roles":     roles,
+			"Teams":     teams,
+			"Links":     links,
+			"Tracking":  tracking,
+			"BaseURL":   httpx.BaseURL(req.R),
+			"ShareBase": share.URL(httpx.BaseURL(req.R), ""),
+			"Panels":    share.Panels,
+		},
 	}
 
 	return tmpl.ExecuteTemplate(req.W, "domains.html", data)
@@ -209,56 +350,234 @@ func (f *Frontend) verifyDomain(req *UpdogRequest) error {
 
 	ctx := req.R.Context()
 
-	if req.R.Method != http.MethodPost {
-		return NewUpError("Method not allowed", http.StatusMethodNotAllowed)
+	d, err := f.domainFromForm(req, team.RoleEditor)
+	if err != nil {
+		return err
 	}
 
-	domainID := req.R.FormValue("domain_id")
-	if domainID == "" {
-		return NewUpError("Domain ID is required", http.StatusBadRequest)
+	method, err := domain.ParseMethod(req.R.FormValue("method"))
+	if err != nil {
+		return NewUpError(err.Error(), http.StatusBadRequest)
 	}
 
-	d, err := f.db.DomainStorage().ReadDomain(ctx, domainID)
+	// verify ownership with the chosen method or whichever the owner set up,
+	// a failure is kept on the domain so the domains page can show why
+	now := time.Now().UTC()
+	method, err = f.verifier.Verify(ctx, d, method)
+	if err != nil {
+		log.Printf("Verification failed for %s: %v", d.Name, err)
+		d.VerificationCheckedAt = now
+		d.VerificationError = err.Error()
+	} else {
+		d.MarkVerified(method, now)
+	}
+
+	if err := f.db.DomainStorage().UpdateVerification(ctx, d); err != nil {
+		log.Printf("Failed to update domain: %v", err)
+		return NewUpError("Failed to update domain", http.StatusInternalServerError)
+	}
+
+	if d.Verified {
+		audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionDomainVerify, audit.TargetDomain, d.ID, map[string]any{
+			"name":   d.Name,
+			"method": method,
+		}))
+	}
+
+	http.Redirect(req.W, req.R, "/domains", http.StatusSeeOther)
+
+	return nil
+}
+
+// resetDomain deletes all pageviews and rollups for a domain but keeps the domain
+func (f *Frontend) resetDomain(req *UpdogRequest) error {
+	d, err := f.domainFromForm(req, team.RoleOwner)
 	if err != nil {
-		log.Printf("Failed to read domain: %v", err)
-		return NewUpError("Failed to read domain", http.StatusInternalServerError)
+		return err
 	}
 
-	// verify ownership by checking for the file
-	verificationURL := "https://" + d.Name + "/updog_" + d.VerificationToken + ".txt"
-	client := &http.Client{}
-	hreq, err := http.NewRequest("GET", verificationURL, nil)
+	result, err := f.ps.PurgePageviews(req.R.Context(), d.ID, pageview.PurgeCriteria{})
 	if err != nil {
-		return NewUpError("Failed to create verification request", http.StatusInternalServerError)
+		log.Printf("Failed to reset domain stats: %v", err)
+		return NewUpError("Failed to reset domain stats", http.StatusInternalServerError)
 	}
 
-	// set a realistic User-Agent and Accept header
-	hreq.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Updog/1.0)")
-	hreq.Header.Set("Accept", "text/plain")
+	audit.Record(req.R.Context(), f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionDomainResetStats, audit.TargetDomain, d.ID, map[string]any{
+		"name":   d.Name,
+		"result": result,
+	}))
+
+	http.Redirect(req.W, req.R, "/domains", http.StatusSeeOther)
+	return nil
+}
+
+// deleteDomain removes a domain and all of its collected data
+func (f *Frontend) deleteDomain(req *UpdogRequest) error {
+	d, err := f.domainFromForm(req, team.RoleOwner)
+	if err != nil {
+		return err
+	}
 
-	resp, err := client.Do(hreq)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		log.Printf("Verification failed for %s %d: %v", d.Name, resp.StatusCode, err)
-		return NewUpError("Verification file not found", http.StatusBadRequest)
+	if err := f.db.DomainStorage().DeleteDomain(req.R.Context(), d.ID); err != nil {
+		log.Printf("Failed to delete domain: %v", err)
+		return NewUpError("Failed to delete domain", http.StatusInternalServerError)
 	}
-	defer resp.Body.Close()
 
-	err = f.db.DomainStorage().VerifyDomain(ctx, domainID)
+	audit.Record(req.R.Context(), f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionDomainDelete, audit.TargetDomain, d.ID, map[string]any{
+		"name": d.Name,
+	}))
 
+	http.Redirect(req.W, req.R, "/domains", http.StatusSeeOther)
+	return nil
+}
+
+// domainHostnames sets which other hostnames are counted as a domain, its subdomains and aliases
+func (f *Frontend) domainHostnames(req *UpdogRequest) error {
+	ctx := req.R.Context()
+	store := f.db.DomainStorage()
+
+	d, err := f.domainFromForm(req, team.RoleEditor)
 	if err != nil {
-		log.Printf("Failed to update domain: %v", err)
+		return err
+	}
+	if err := domain.LoadAliases(ctx, store, d); err != nil {
+		log.Printf("Failed to list aliases: %v", err)
 		return NewUpError("Failed to update domain", http.StatusInternalServerError)
 	}
 
+	aliases, err := domain.ParseAliases(ctx, store, d, domain.SplitList(req.R.FormValue("aliases")))
+	switch {
+	case err == nil:
+	case errors.Is(err, domain.ErrInvalidAlias):
+		return NewUpError(err.Error(), http.StatusBadRequest)
+	case errors.Is(err, domain.ErrHostnameTaken):
+		return NewUpError(err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Failed to check aliases: %v", err)
+		return NewUpError("Failed to update domain", http.StatusInternalServerError)
+	}
+
+	changed := map[string]any{}
+	if include := req.R.FormValue("include_subdomains") != ""; include != d.IncludeSubdomains {
+		changed["include_subdomains"] = map[string]bool{"from": d.IncludeSubdomains, "to": include}
+		d.IncludeSubdomains = include
+		if err := store.UpdateDomain(ctx, d); err != nil {
+			log.Printf("Failed to update domain: %v", err)
+			return NewUpError("Failed to update domain", http.StatusInternalServerError)
+		}
+	}
+	if !slices.Equal(aliases, d.Aliases) {
+		changed["aliases"] = map[string][]string{"from": d.Aliases, "to": aliases}
+		if err := store.SetAliases(ctx, d.ID, aliases); err != nil {
+			log.Printf("Failed to set aliases: %v", err)
+			return NewUpError("Failed to update domain", http.StatusInternalServerError)
+		}
+	}
+
+	if len(changed) > 0 {
+		audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionDomainUpdate, audit.TargetDomain, d.ID, changed))
+	}
+
 	http.Redirect(req.W, req.R, "/domains", http.StatusSeeOther)
+	return nil
+}
+
+// verifyAlias checks the posted alias publishes its domain's token with any method
+func (f *Frontend) verifyAlias(req *UpdogRequest) error {
+	ctx := req.R.Context()
+
+	d, err := f.domainFromForm(req, team.RoleEditor)
+	if err != nil {
+		return err
+	}
 
+	name := req.R.FormValue("alias")
+	method, err := domain.VerifyAlias(ctx, f.db.DomainStorage(), f.verifier, d, name, "")
+	var verr *domain.VerifyError
+	switch {
+	case err == nil:
+	case errors.Is(err, sql.ErrNoRows):
+		return NewUpError("Alias not found", http.StatusNotFound)
+	case errors.As(err, &verr):
+		log.Printf("Verification failed for %s: %v", name, err)
+		return NewUpError(fmt.Sprintf("%s could not be verified: %v", name, err), http.StatusUnprocessableEntity)
+	default:
+		log.Printf("Failed to verify alias: %v", err)
+		return NewUpError("Failed to verify alias", http.StatusInternalServerError)
+	}
+
+	audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionDomainVerify, audit.TargetDomain, d.ID, map[string]any{
+		"name":   d.Name,
+		"alias":  name,
+		"method": method,
+	}))
+
+	http.Redirect(req.W, req.R, "/domains", http.StatusSeeOther)
 	return nil
 }
 
+// domainFromForm returns the posted domain if the user's role on it is at least minRole
+func (f *Frontend) domainFromForm(req *UpdogRequest, minRole string) (*domain.Domain, error) {
+	if req.R.Method != http.MethodPost {
+		return nil, NewUpError("Method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	domainID := req.R.FormValue("domain_id")
+	if domainID == "" {
+		return nil, NewUpError("Domain ID is required", http.StatusBadRequest)
+	}
+
+	d, role, err := f.db.DomainStorage().ReadDomainForUser(req.R.Context(), domainID, req.User.ID)
+	if err != nil || role == "" {
+		return nil, NewUpError("Domain not found", http.StatusNotFound)
+	}
+	if !team.RoleAtLeast(role, minRole) {
+		return nil, NewUpError("Forbidden", http.StatusForbidden)
+	}
+	return d, nil
+}
+
 func (f *Frontend) settings(req *UpdogRequest) error {
 
 	ctx := req.R.Context()
 
+	// POST update settings
+	if req.R.Method == http.MethodPost {
+		// instance settings are for admins only
+		if !req.User.IsAdmin() {
+			return NewUpError("Forbidden", http.StatusForbidden)
+		}
+		for _, key := range []string{settings.SettingDisableSignups, settings.SettingRequire2FA} {
+			from, err := f.db.ReadValueAsBool(ctx, key)
+			if err != nil {
+				log.Printf("Failed to read settings: %v", err)
+			}
+			to := req.R.FormValue(key) == "on"
+			if err := f.db.SetValueAsBool(ctx, key, to); err != nil {
+				log.Printf("Failed to update settings: %v", err)
+				return NewUpError("Failed to update settings", http.StatusInternalServerError)
+			}
+			if from != to {
+				audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionSettingsUpdate, audit.TargetSetting, key, map[string]any{
+					"from": from,
+					"to":   to,
+				}))
+			}
+		}
+
+		// redirect to refresh the page and show updated state
+		http.Redirect(req.W, req.R, "/settings", http.StatusSeeOther)
+		return nil
+	}
+
+	return f.renderSettings(req, "")
+}
+
+// renderSettings shows the settings page, newKey is an API key that was just created
+func (f *Frontend) renderSettings(req *UpdogRequest, newKey string) error {
+
+	ctx := req.R.Context()
+
 	data := PageData{
 		Title:   "Settings",
 		User:    req.User,
@@ -267,40 +586,105 @@ func (f *Frontend) settings(req *UpdogRequest) error {
 		Stats: &DashboardStats{
 			SelectedDomain: req.SelectedDomain,
 		},
+		Data: map[string]any{
+			"NewKey":           newKey,
+			"Scopes":           apikey.Scopes,
+			"VerificationSent": req.R.URL.Query().Get("verification") == "sent",
+		},
 	}
-
-	// POST update settings
-	if req.R.Method == http.MethodPost {
-		disableSignups := req.R.FormValue(settings.SettingDisableSignups) == "on"
-		if err := f.db.SetValueAsBool(ctx, settings.SettingDisableSignups, disableSignups); err != nil {
-			log.Printf("Failed to update settings: %v", err)
-			return NewUpError("Failed to update settings", http.StatusInternalServerError)
+	if req.User.IsAdmin() {
+		disableSignups, err := f.db.ReadValueAsBool(ctx, settings.SettingDisableSignups)
+		if err != nil {
+			log.Printf("Failed to read settings: %v", err)
+			data.Error = "Failed to load settings"
 		}
+		data.Data["DisableSignups"] = disableSignups
+		data.Data["Require2FA"] = f.twoFactorRequired(ctx)
+	}
 
-		// redirect to refresh the page and show updated state
-		http.Redirect(req.W, req.R, "/settings", http.StatusSeeOther)
-		return nil
+	keys, err := f.db.APIKeyStorage().ListKeysByUser(ctx, req.User.ID)
+	if err != nil {
+		log.Printf("Failed to list api keys: %v", err)
+		data.Error = "Failed to load API keys"
 	}
+	data.Data["APIKeys"] = keys
 
-	// GET settings
-	disableSignups, err := f.db.ReadValueAsBool(ctx, settings.SettingDisableSignups)
+	sessions, err := f.db.SessionStorage().ListSessionsByUser(ctx, req.User.ID)
 	if err != nil {
-		log.Printf("Failed to read settings: %v", err)
-		data.Error = "Failed to load settings"
+		log.Printf("Failed to list sessions: %v", err)
+		data.Error = "Failed to load sessions"
+	}
+	data.Data["Sessions"] = sessions
+	if token := tokenFromRequest(req.R); token != nil {
+		data.Data["CurrentSessionID"] = token.SessionID
 	}
 
-	data.Data = map[string]any{
-		"DisableSignups": disableSignups,
+	domainNames := make(map[string]string, len(req.Domains))
+	for _, d := range req.Domains {
+		domainNames[d.ID] = d.Name
 	}
+	data.Data["DomainNames"] = domainNames
 
 	return tmpl.ExecuteTemplate(req.W, "settings.html", data)
 }
 
+// admin shows an overview of the whole instance
+func (f *Frontend) admin(req *UpdogRequest) error {
+
+	ctx := req.R.Context()
+
+	if !req.User.IsAdmin() {
+		return NewUpError("Forbidden", http.StatusForbidden)
+	}
+
+	stats, err := f.db.InstanceStats(ctx)
+	if err != nil {
+		log.Printf("Failed to read instance stats: %v", err)
+		return NewUpError("Failed to load instance stats", http.StatusInternalServerError)
+	}
+
+	users, err := f.db.UserStorage().ListUsers(ctx, 1000, 0)
+	if err != nil {
+		log.Printf("Failed to list users: %v", err)
+		return NewUpError("Failed to load users", http.StatusInternalServerError)
+	}
+
+	domains, err := f.db.DomainStorage().ListDomains(ctx, 1000, 0)
+	if err != nil {
+		log.Printf("Failed to list domains: %v", err)
+		return NewUpError("Failed to load domains", http.StatusInternalServerError)
+	}
+
+	owners := make(map[string]string, len(users))
+	for _, u := range users {
+		owners[u.ID] = u.Email
+	}
+
+	data := PageData{
+		Title:   "Admin",
+		User:    req.User,
+		Slug:    "admin",
+		Domains: req.Domains,
+		Stats: &DashboardStats{
+			SelectedDomain: req.SelectedDomain,
+		},
+		Data: map[string]any{
+			"Instance":   stats,
+			"Users":      users,
+			"AllDomains": domains,
+			"Owners":     owners,
+		},
+	}
+
+	return tmpl.ExecuteTemplate(req.W, "admin.html", data)
+}
+
 func (f *Frontend) visitors(req *UpdogRequest) error {
 
 	data := PageData{
 		Title:   "Visitors",
 		User:    req.User,
+		Share:   req.Share,
 		Slug:    "visitors",
 		Domains: req.Domains,
 		Stats: &DashboardStats{
@@ -324,6 +708,7 @@ func (f *Frontend) pages(req *UpdogRequest) error {
 	data := PageData{
 		Title:   "Pages",
 		User:    req.User,
+		Share:   req.Share,
 		Slug:    "pages",
 		Domains: req.Domains,
 		Stats: &DashboardStats{
@@ -339,11 +724,67 @@ func (f *Frontend) pages(req *UpdogRequest) error {
 		} else {
 			data.Stats.TopPages = topPages
 		}
+
+		// links clicked on the pages
+		outbound, err := f.ps.GetLinks(ctx, req.SelectedDomain.ID, pageview.LinkOutbound, req.Start, req.End, 100)
+		if err != nil {
+			log.Printf("Failed to get outbound links: %v", err)
+		} else {
+			data.Stats.Outbound = outbound
+		}
+		downloads, err := f.ps.GetLinks(ctx, req.SelectedDomain.ID, pageview.LinkDownload, req.Start, req.End, 100)
+		if err != nil {
+			log.Printf("Failed to get downloads: %v", err)
+		} else {
+			data.Stats.Downloads = downloads
+		}
 	}
 
 	return tmpl.ExecuteTemplate(req.W, "pages.html", data)
 }
 
+// deviceTypes are the devices the performance view can be narrowed down to
+var deviceTypes = []string{"Desktop", "Mobile", "Tablet"}
+
+func (f *Frontend) performance(req *UpdogRequest) error {
+
+	ctx := req.R.Context()
+	filter := pageview.VitalsFilter{Device: req.R.URL.Query().Get("device")}
+
+	data := PageData{
+		Title:   "Performance",
+		User:    req.User,
+		Share:   req.Share,
+		Slug:    "performance",
+		Domains: req.Domains,
+		Stats: &DashboardStats{
+			SelectedDomain: req.SelectedDomain,
+		},
+		Data: map[string]any{
+			"Device":  filter.Device,
+			"Devices": deviceTypes,
+		},
+	}
+
+	if req.SelectedDomain != nil {
+		daily, err := f.ps.GetDailyVitals(ctx, req.SelectedDomain.ID, req.Start, req.End, filter)
+		if err != nil {
+			log.Printf("Failed to get daily vitals: %v", err)
+		} else {
+			data.Stats.DailyVitals = daily
+		}
+
+		pages, err := f.ps.GetPageVitals(ctx, req.SelectedDomain.ID, req.Start, req.End, filter, 100)
+		if err != nil {
+			log.Printf("Failed to get page vitals: %v", err)
+		} else {
+			data.Stats.PageVitals = pages
+		}
+	}
+
+	return tmpl.ExecuteTemplate(req.W, "performance.html", data)
+}
+
 func (f *Frontend) index(w http.ResponseWriter, r *http.Request) {
 
 	if f.auth.IsAuthenticated(r) != nil {
@@ -368,7 +809,8 @@ func initTemplatesAndStatic() error {
 			ParseGlob(filepath.Join("frontend", "views", "*.html")))
 
 		// serve static files from disk
-		staticHandler = http.FileServer(http.Dir(filepath.Join("frontend", "public")))
+		staticFiles = os.DirFS(filepath.Join("frontend", "public"))
+		staticHandler = http.FileServer(http.FS(staticFiles))
 	} else {
 		// production from embedded FS
 		tmpl = template.Must(template.New("").Funcs(Funcs).
@@ -379,6 +821,7 @@ func initTemplatesAndStatic() error {
 		if err != nil {
 			return err
 		}
+		staticFiles = staticSub
 		staticHandler = http.FileServer(http.FS(staticSub))
 	}
 	return nil
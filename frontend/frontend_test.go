@@ -0,0 +1,213 @@
+package frontend
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/apikey"
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/db"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/mail"
+	"github.com/zackb/updog/session"
+	"github.com/zackb/updog/share"
+	"github.com/zackb/updog/team"
+	"github.com/zackb/updog/totp"
+	"github.com/zackb/updog/user"
+)
+
+// newTestFrontend serves the frontend from a fresh database with user signed up
+func newTestFrontend(t *testing.T, u *user.User) (*Frontend, *http.ServeMux) {
+	database, err := db.NewFileDB(filepath.Join(t.TempDir(), "test.db"))
+	assert.NoError(t, err)
+
+	key, err := jwk.New([]byte("0123456789abcdef0123456789abcdef"))
+	assert.NoError(t, err)
+	assert.NoError(t, key.Set(jwk.KeyIDKey, "test"))
+	assert.NoError(t, key.Set(jwk.AlgorithmKey, jwa.HS256))
+	set := jwk.NewSet()
+	set.Add(key)
+	b, err := json.Marshal(set)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, b, 0600))
+
+	authSvc, err := auth.NewAuthService(path, time.Hour)
+	assert.NoError(t, err)
+	authSvc.SetAPIKeyValidator(apikey.NewValidator(database.APIKeyStorage()))
+	authSvc.SetRevocationStore(database.RevocationStorage())
+	authSvc.SetUserChecker(database.UserStorage())
+	sessions := session.NewManager(database.SessionStorage(), authSvc, time.Hour)
+
+	f, err := NewFrontend(authSvc, database, sessions, mail.NewSender())
+	assert.NoError(t, err)
+	assert.NoError(t, database.UserStorage().CreateUser(context.Background(), u))
+
+	mux := http.NewServeMux()
+	f.Routes(mux)
+	return f, mux
+}
+
+func TestWithAuthenticated_RejectsAPIKeys(t *testing.T) {
+	u := &user.User{Email: "owner@example.com", Name: "Owner"}
+	f, mux := newTestFrontend(t, u)
+	ctx := context.Background()
+
+	k, secret := apikey.New(u.ID, "stats", []string{auth.ScopeStatsRead}, "")
+	assert.NoError(t, f.db.APIKeyStorage().CreateKey(ctx, k))
+
+	form := url.Values{"name": {"escalated"}, "scopes": {auth.ScopeAccount, auth.ScopeDomainsManage}}
+	r := httptest.NewRequest(http.MethodPost, "/settings/keys", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "Bearer "+secret)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Location"), "/login"))
+	keys, err := f.db.APIKeyStorage().ListKeysByUser(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
+
+func TestTwoFactor_DisableWithoutPassword(t *testing.T) {
+	// signed up with single sign-on, there's no password to confirm with
+	u := &user.User{Email: "sso@example.com", Name: "SSO", TOTPSecret: totp.NewSecret(), TOTPEnabled: true}
+	f, mux := newTestFrontend(t, u)
+	ctx := context.Background()
+
+	disable := func(signedInAt time.Time) *httptest.ResponseRecorder {
+		access, _, err := f.auth.CreateToken(u.ID, "", signedInAt)
+		assert.NoError(t, err)
+		code, err := totp.Code(u.TOTPSecret, totp.Step(time.Now()))
+		assert.NoError(t, err)
+
+		form := url.Values{"action": {"disable"}, "code": {code}}
+		r := httptest.NewRequest(http.MethodPost, "/settings/2fa", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(&http.Cookie{Name: session.AccessTokenCookie, Value: access})
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	// a code alone isn't enough long after signing in
+	w := disable(time.Now().Add(-time.Hour))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Sign out and in again")
+	read, err := f.db.UserStorage().ReadUser(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.True(t, read.TOTPEnabled)
+
+	// having just signed in stands in for the password
+	w = disable(time.Now())
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	read, err = f.db.UserStorage().ReadUser(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.False(t, read.TOTPEnabled)
+}
+
+func TestTrackerScript_Cache(t *testing.T) {
+	f, mux := newTestFrontend(t, &user.User{Email: "owner@example.com", Name: "Owner"})
+	d := &domain.Domain{ID: id.NewID(), Name: "example.com"}
+	_, err := f.db.DomainStorage().CreateDomain(context.Background(), d)
+	assert.NoError(t, err)
+
+	get := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/js/"+d.ID+".js", nil)
+		r.Host = "evil.example"
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	// the script names the host the request did, shared caches must not keep it
+	t.Setenv("BASE_URL", "")
+	w := get()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "private, max-age="+trackerMaxAge, w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Body.String(), "http://evil.example")
+
+	t.Setenv("BASE_URL", "https://updog.example.com/")
+	w = get()
+	assert.Equal(t, "public, max-age="+trackerMaxAge, w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Body.String(), "https://updog.example.com")
+	assert.NotContains(t, w.Body.String(), "evil.example")
+}
+
+func TestShareLinks(t *testing.T) {
+	alice := &user.User{Email: "alice@example.com", Name: "Alice"}
+	f, mux := newTestFrontend(t, alice)
+	ctx := context.Background()
+
+	// bob edits the domain through a team, carol has nothing to do with it
+	bob := &user.User{Email: "bob@example.com", Name: "Bob"}
+	carol := &user.User{Email: "carol@example.com", Name: "Carol"}
+	assert.NoError(t, f.db.UserStorage().CreateUser(ctx, bob))
+	assert.NoError(t, f.db.UserStorage().CreateUser(ctx, carol))
+	marketing := &team.Team{ID: id.NewID(), Name: "Marketing"}
+	assert.NoError(t, f.db.TeamStorage().CreateTeam(ctx, marketing, alice.ID))
+	inv, _ := team.NewInvitation(marketing.ID, bob.Email, team.RoleEditor, alice.ID)
+	assert.NoError(t, f.db.TeamStorage().CreateInvitation(ctx, inv))
+	assert.NoError(t, f.db.TeamStorage().AcceptInvitation(ctx, inv, bob.ID))
+	d := &domain.Domain{ID: id.NewID(), Name: "example.com", UserID: alice.ID, TeamID: marketing.ID}
+	_, err := f.db.DomainStorage().CreateDomain(ctx, d)
+	assert.NoError(t, err)
+
+	send := func(u *user.User, method, target string, form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if u != nil {
+			access, _, err := f.auth.CreateToken(u.ID, "", time.Now())
+			assert.NoError(t, err)
+			r.AddCookie(&http.Cookie{Name: session.AccessTokenCookie, Value: access})
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	links := func() []*share.Link {
+		links, err := f.db.ShareStorage().ListLinksByDomain(ctx, d.ID)
+		assert.NoError(t, err)
+		return links
+	}
+	create := url.Values{"domain_id": {d.ID}, "panels": {share.PanelDashboard}}
+
+	// only the owner shares the domain
+	assert.Equal(t, http.StatusNotFound, send(carol, http.MethodPost, "/domains/share", create).Code)
+	assert.Equal(t, http.StatusForbidden, send(bob, http.MethodPost, "/domains/share", create).Code)
+	assert.Equal(t, http.StatusBadRequest, send(alice, http.MethodPost, "/domains/share", url.Values{"domain_id": {d.ID}}).Code)
+	assert.Equal(t, http.StatusSeeOther, send(alice, http.MethodPost, "/domains/share", create).Code)
+	if !assert.Len(t, links(), 1) {
+		return
+	}
+	l := links()[0]
+
+	// and sees its links on the domains page
+	assert.Contains(t, send(alice, http.MethodGet, "/domains", nil).Body.String(), l.Slug)
+	assert.NotContains(t, send(bob, http.MethodGet, "/domains", nil).Body.String(), l.Slug)
+
+	// anyone with the link sees the panels it shares
+	assert.Equal(t, http.StatusOK, send(nil, http.MethodGet, "/share/"+l.Slug, nil).Code)
+	assert.Equal(t, http.StatusNotFound, send(nil, http.MethodGet, "/share/"+l.Slug+"/pages", nil).Code)
+
+	// until the owner revokes it
+	revoke := url.Values{"domain_id": {d.ID}, "link_id": {l.ID}}
+	assert.Equal(t, http.StatusForbidden, send(bob, http.MethodPost, "/domains/share/revoke", revoke).Code)
+	assert.Len(t, links(), 1)
+	assert.Equal(t, http.StatusSeeOther, send(alice, http.MethodPost, "/domains/share/revoke", revoke).Code)
+	assert.Empty(t, links())
+	assert.Equal(t, http.StatusNotFound, send(nil, http.MethodGet, "/share/"+l.Slug, nil).Code)
+}
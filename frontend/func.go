@@ -1,16 +1,68 @@
 package frontend
 
 import (
+	"fmt"
 	"html/template"
 	"strings"
+	"time"
 
 	"github.com/zackb/updog/pageview"
 )
 
 var Funcs template.FuncMap = template.FuncMap{
 	"lower": strings.ToLower,
+	"join":  strings.Join,
 	"mul": func(a, b float64) float64 {
 		return a * b
 	},
 	"RenderSVG": pageview.RenderSVG,
+	"bytes":     formatBytes,
+	"duration":  formatDuration,
+	"vital":     formatVital,
+	"rating":    vitalRating,
+}
+
+// formatBytes renders a size like 1.5 MB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatDuration renders a time spent like 1m 05s, or 42s under a minute
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	return fmt.Sprintf("%dm %02ds", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// formatVital renders a p75 like 1.85 s, 120 ms or 0.08 for CLS, which has no unit, and - if nothing was measured
+func formatVital(metric string, v *float64) string {
+	switch {
+	case v == nil:
+		return "-"
+	case metric == pageview.VitalCLS:
+		return fmt.Sprintf("%.2f", *v)
+	case *v >= 1000:
+		return fmt.Sprintf("%.2f s", *v/1000)
+	default:
+		return fmt.Sprintf("%.0f ms", *v)
+	}
+}
+
+// vitalRating is the CSS class rating a p75, empty if nothing was measured
+func vitalRating(metric string, v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return "rating-" + pageview.Rating(metric, *v)
 }
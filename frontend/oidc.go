@@ -0,0 +1,197 @@
+package frontend
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/env"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/oidc"
+	"github.com/zackb/updog/session"
+	"github.com/zackb/updog/settings"
+)
+
+// oidcCookie keeps the sign in request while the user is at the provider
+const oidcCookie = "oidc"
+
+// oidcRequestTTL is how long the user has to sign in at the provider
+const oidcRequestTTL = 10 * time.Minute
+
+// SetOIDCProvider turns on single sign-on with p
+func (f *Frontend) SetOIDCProvider(p *oidc.Provider) {
+	f.oidc = p
+}
+
+// renderLogin shows the login page with the sign in methods that are enabled
+func (f *Frontend) renderLogin(w http.ResponseWriter, data PageData) {
+	if data.Data == nil {
+		data.Data = map[string]any{}
+	}
+	if f.oidc != nil {
+		data.Data["OIDCName"] = f.oidc.Config().Name
+	}
+	data.Data["PasswordLogin"] = !env.IsPasswordLoginDisabled()
+	tmpl.ExecuteTemplate(w, "login.html", data)
+}
+
+// loginOIDC sends the user to the provider to sign in
+func (f *Frontend) loginOIDC(w http.ResponseWriter, r *http.Request) {
+	if f.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	req := oidc.NewAuthRequest(r.FormValue("next"))
+	binding := url.Values{
+		"nonce":    {req.Nonce},
+		"verifier": {req.Verifier},
+		"next":     {req.Next},
+	}
+	// signed so the callback can trust it, the state is its subject
+	token, _, err := f.auth.CreateChallenge(req.State, auth.PurposeOIDC, binding.Encode(), oidcRequestTTL)
+	if err != nil {
+		log.Printf("Failed to create oidc request: %v", err)
+		f.renderLogin(w, PageData{Title: "Login", Error: "Internal error"})
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    token,
+		Path:     "/login/oidc",
+		MaxAge:   int(oidcRequestTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   !env.IsDev(),
+		// the provider redirects back from another site
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, f.oidc.AuthURL(req, f.oidcRedirectURL(r)), http.StatusFound)
+}
+
+// oidcCallback finishes signing in when the provider redirects back
+func (f *Frontend) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	if f.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	data := PageData{Title: "Login"}
+
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: "/login/oidc", MaxAge: -1})
+	req, err := f.oidcRequest(r)
+	if err != nil {
+		data.Error = "Your sign in expired, please try again"
+		f.renderLogin(w, data)
+		return
+	}
+	data.Next = req.Next
+
+	if e := r.FormValue("error"); e != "" {
+		log.Printf("Single sign-on failed: %s %s", e, r.FormValue("error_description"))
+		data.Error = "Single sign-on failed"
+		f.renderLogin(w, data)
+		return
+	}
+
+	claims, err := f.oidc.Exchange(ctx, req, r.FormValue("code"), f.oidcRedirectURL(r))
+	if err != nil {
+		log.Printf("Failed to exchange oidc code: %v", err)
+		data.Error = "Single sign-on failed"
+		f.renderLogin(w, data)
+		return
+	}
+
+	disableSignups, err := f.db.ReadValueAsBool(ctx, settings.SettingDisableSignups)
+	if err != nil {
+		log.Printf("Failed to read settings: %v", err)
+	}
+	u, err := oidc.Provision(ctx, f.db.UserStorage(), f.oidc.Issuer(), claims, f.oidc.Config().AllowedDomains, !disableSignups)
+	if err != nil {
+		if errors.Is(err, oidc.ErrNoEmail) || errors.Is(err, oidc.ErrDomainNotAllowed) || errors.Is(err, oidc.ErrDomainNotVerified) ||
+			errors.Is(err, oidc.ErrEmailNotVerified) ||
+			errors.Is(err, oidc.ErrAccountLinked) || errors.Is(err, oidc.ErrSignupsDisabled) {
+			audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(r, "", audit.ActionLoginFailed, "", "", map[string]any{
+				"email":  claims.Email,
+				"method": audit.LoginOIDC,
+				"reason": err.Error(),
+			}))
+			data.Error = err.Error()
+		} else {
+			log.Printf("Failed to provision oidc user: %v", err)
+			data.Error = "Internal error"
+		}
+		f.renderLogin(w, data)
+		return
+	}
+	if u.Disabled {
+		data.Error = "Your account is disabled"
+		f.renderLogin(w, data)
+		return
+	}
+
+	// two-factor authentication still applies to users who turned it on
+	if u.TOTPEnabled {
+		challenge, _, err := f.auth.CreateChallenge(u.ID, auth.PurposeTwoFactor, audit.LoginOIDC, auth.ChallengeTTL)
+		if err != nil {
+			log.Printf("Failed to create challenge: %v", err)
+			data.Error = "Internal error"
+			f.renderLogin(w, data)
+			return
+		}
+		data.Data = map[string]any{"Challenge": challenge}
+		tmpl.ExecuteTemplate(w, "login_2fa.html", data)
+		return
+	}
+
+	tokens, err := f.sessions.Start(ctx, u.ID, r)
+	if err != nil {
+		log.Printf("Failed to start session: %v", err)
+		data.Error = "Internal error"
+		f.renderLogin(w, data)
+		return
+	}
+
+	audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(r, u.ID, audit.ActionLogin, audit.TargetUser, u.ID, map[string]any{
+		"method": audit.LoginOIDC,
+	}))
+	session.SetCookies(w, tokens)
+	http.Redirect(w, r, safeNext(data.Next), http.StatusSeeOther)
+}
+
+// oidcRequest reads the sign in request from the cookie and checks the provider returned its state
+func (f *Frontend) oidcRequest(r *http.Request) (*oidc.AuthRequest, error) {
+	cookie, err := r.Cookie(oidcCookie)
+	if err != nil {
+		return nil, err
+	}
+	token, err := f.auth.ValidateChallenge(r.Context(), cookie.Value, auth.PurposeOIDC)
+	if err != nil {
+		return nil, err
+	}
+	if token.ClientId != r.FormValue("state") {
+		return nil, errors.New("state doesn't match")
+	}
+	binding, err := url.ParseQuery(token.Binding)
+	if err != nil {
+		return nil, err
+	}
+	return &oidc.AuthRequest{
+		State:    token.ClientId,
+		Nonce:    binding.Get("nonce"),
+		Verifier: binding.Get("verifier"),
+		Next:     binding.Get("next"),
+	}, nil
+}
+
+func (f *Frontend) oidcRedirectURL(r *http.Request) string {
+	if u := f.oidc.Config().RedirectURL; u != "" {
+		return u
+	}
+	return httpx.BaseURL(r) + "/login/oidc/callback"
+}
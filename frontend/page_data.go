@@ -3,6 +3,7 @@ package frontend
 import (
 	"github.com/zackb/updog/domain"
 	"github.com/zackb/updog/pageview"
+	"github.com/zackb/updog/share"
 	"github.com/zackb/updog/user"
 )
 
@@ -15,6 +16,11 @@ type DashboardStats struct {
 	MaxViews        int64
 	TopPages        []*pageview.PageStats
 	DeviceUsage     []*pageview.DeviceStats
+	Hostnames       []*pageview.HostnameStats
+	Outbound        []*pageview.LinkStats
+	Downloads       []*pageview.LinkStats
+	PageVitals      []*pageview.PageVitals
+	DailyVitals     []*pageview.VitalsPoint
 }
 
 type PageData struct {
@@ -27,7 +33,25 @@ type PageData struct {
 	Stats             *DashboardStats
 	Slug              string
 	Error             string
+	Next              string
+	Share             *share.Link
 	Data              map[string]any
 	AdditionalScripts []string
 	AdditionalStyles  []string
 }
+
+// ShowsPanel is false for panels a shared link hides
+func (p PageData) ShowsPanel(panel string) bool {
+	return p.Share == nil || p.Share.Allows(panel)
+}
+
+// PanelURL links to a panel, within the shared link if there is one
+func (p PageData) PanelURL(panel string) string {
+	if p.Share == nil {
+		return "/" + panel
+	}
+	if panel == share.PanelDashboard {
+		return "/share/" + p.Share.Slug
+	}
+	return "/share/" + p.Share.Slug + "/" + panel
+}
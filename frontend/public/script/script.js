@@ -1,3 +1,19 @@
+// refreshing is the refresh in flight, requests that expire together share it
+let refreshing = null;
+
+/**
+ * fetch that refreshes an expired session once and retries
+ */
+async function apiFetch(url) {
+  let res = await fetch(url);
+  if (res.status === 401 && !window.updogApi) {
+    refreshing ??= fetch('/api/v1/auth/refresh', { method: 'POST' }).finally(() => { refreshing = null; });
+    const refreshed = await refreshing;
+    if (refreshed.ok) res = await fetch(url);
+  }
+  return res;
+}
+
 async function loadVisitors() {
   const params = new URLSearchParams();
 
@@ -11,7 +27,9 @@ async function loadVisitors() {
   if (fromParam) params.set('from', fromParam);
   if (toParam) params.set('to', toParam);
 
-  const res = await fetch('/api/v1/pageviews/visitors?' + params.toString());
+  // shared dashboards read from the public share api
+  const api = window.updogApi || '/api/v1/pageviews';
+  const res = await apiFetch(api + '/visitors?' + params.toString());
   if (!res.ok) throw new Error('Failed to fetch visitors');
 
   return res.json();
@@ -35,7 +53,7 @@ function loadRealtimePageviews() {
     }
 
     // Fetch pageviews from API
-    fetch('/api/v1/pageviews' + queryParams)
+    apiFetch('/api/v1/pageviews' + queryParams)
         .then(response => {
             if (!response.ok) {
                 throw new Error('Failed to fetch pageviews');
@@ -331,6 +349,16 @@ function reloadWithDateRange(from, to) {
     window.location.href = url.toString();
 }
 
+function reloadWithParam(name, value) {
+    const url = new URL(window.location.href);
+    if (value) {
+        url.searchParams.set(name, value);
+    } else {
+        url.searchParams.delete(name);
+    }
+    window.location.href = url.toString();
+}
+
 function formatDate(date) {
     return date.toLocaleDateString(undefined, { month: 'short', day: 'numeric' });
 }
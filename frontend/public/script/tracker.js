@@ -1,51 +1,211 @@
-(function(window){
-  var CONFIG = {endpoint: 'https://updog.bartel.com'};
+(function(window, document){
+  // events go back to wherever the tracker was loaded from unless configured otherwise
+  var script = document.currentScript;
+  var CONFIG = {
+    endpoint: script && script.src ? new URL(script.src).origin : '',
+    auto: false,      // send the first pageview without being asked
+    hash: false,      // count the fragment as part of the path, for hash routing
+    exclude: [],      // globs of paths that are never tracked
+    params: [],       // query parameters kept in the path
+    outbound: false,  // report clicks on links to other sites
+    downloads: [],    // extensions of the files whose links are reported as downloads
+    vitals: false     // measure the Core Web Vitals of the page load
+  };
+  var queue = window._uaq = window._uaq || [];
+  var last, domain;
+  // the tracked page, how long it's been visible and how far down it's been scrolled
+  var page, engaged, visibleSince, scrolled;
+  // the page the browser loaded, null if it isn't tracked, and the vitals measured on it so far
+  var landing, vitals = {}, vitalsSent;
 
-  function trackPageview(data){
+  // sendBeacon outlives the page, which matters for clicks that leave it
+  function send(route, data){
     if(navigator.sendBeacon){
-      try { navigator.sendBeacon(CONFIG.endpoint + '/view', JSON.stringify(data)); return; }
+      try { navigator.sendBeacon(CONFIG.endpoint + '/' + route, JSON.stringify(data)); return; }
       catch(e){ /* fallback below */ }
     }
     var img = new Image();
-    img.src = CONFIG.endpoint + '/view.gif' +
-              '?domain=' + encodeURIComponent(data.domain) +
-              '&path=' + encodeURIComponent(data.path) +
-              '&ref=' + encodeURIComponent(data.ref);
+    img.src = CONFIG.endpoint + '/' + route + '.gif?' + Object.keys(data).map(function(key){
+      return key + '=' + encodeURIComponent(data[key]);
+    }).join('&');
   }
 
-  // Process queued events
-  (window._uaq || []).forEach(function(args){
-    if(args[0]==='pageview') trackPageview(args[1]);
-    else if(args[0]==='config') Object.assign(CONFIG, args[1]);
-  });
+  // * matches any characters and ? one, like the purge API
+  function matches(glob, path){
+    var re = glob.replace(/[.+^${}()|[\]\\]/g, '\\$&').replace(/\*/g, '.*').replace(/\?/g, '.');
+    return new RegExp('^' + re + '$').test(path);
+  }
+
+  // the path being viewed, with the allowed query parameters and the fragment when hash routing
+  function currentPath(){
+    var path = location.pathname;
+    if(CONFIG.params.length){
+      var kept = [];
+      new URLSearchParams(location.search).forEach(function(value, key){
+        if(CONFIG.params.indexOf(key) !== -1) kept.push(encodeURIComponent(key) + '=' + encodeURIComponent(value));
+      });
+      if(kept.length) path += '?' + kept.join('&');
+    }
+    if(CONFIG.hash && location.hash) path += location.hash;
+    return path;
+  }
+
+  function excluded(path){
+    var page = path.replace(/\?[^#]*/, '');
+    for(var i = 0; i < CONFIG.exclude.length; i++){
+      if(matches(CONFIG.exclude[i], page)) return true;
+    }
+    return false;
+  }
+
+  function scrollDepth(){
+    var height = document.documentElement.scrollHeight;
+    return height ? Math.min(100, Math.round((window.scrollY + window.innerHeight) / height * 100)) : 100;
+  }
+
+  // report the engagement with the page so far, the totals are sent so repeats are harmless
+  function engage(){
+    if(!page) return;
+    var total = engaged + (visibleSince ? Date.now() - visibleSince : 0);
+    if(total > 0) send('engage', {domain: page.domain, path: page.path, engaged: total, scroll: scrolled});
+  }
+
+  function trackPageview(data){
+    data = data || {};
+    var path = data.path || currentPath();
+    engage();
+    page = null;
+    last = path;
+    domain = data.domain || location.hostname;
+    var skip = excluded(path);
+    // vitals describe the page the browser loaded, not later SPA navigations
+    if(landing === undefined) landing = skip ? null : {domain: domain, path: path};
+    if(skip) return;
+    send('view', {
+      domain: domain,
+      path: path,
+      ref: data.ref !== undefined ? data.ref : document.referrer
+    });
+    page = {domain: domain, path: path};
+    engaged = 0;
+    visibleSince = document.visibilityState === 'hidden' ? 0 : Date.now();
+    scrolled = scrollDepth();
+  }
 
-  // Override push for future events
-  window._uaq.push = function(args){
+  // a click on a link to a file with one of the download extensions, or to another site
+  function trackLink(e){
+    var a = e.target.closest && e.target.closest('a[href]');
+    if(!a) return;
+    var url;
+    try { url = new URL(a.href, location.href); } catch(err){ return; }
+    if(url.protocol !== 'http:' && url.protocol !== 'https:') return;
+
+    var file = url.pathname.split('/').pop();
+    var ext = file.indexOf('.') !== -1 ? file.split('.').pop().toLowerCase() : '';
+    var type = ext && CONFIG.downloads.indexOf(ext) !== -1 ? 'download' :
+               CONFIG.outbound && url.hostname !== location.hostname ? 'outbound' : '';
+    var path = last || currentPath();
+    if(!type || excluded(path)) return;
+    send('link', {domain: domain || location.hostname, path: path, type: type, url: url.href});
+  }
+
+  // true if the browser supports entries of type
+  function observe(type, fn, opts){
+    try {
+      new PerformanceObserver(function(list){
+        list.getEntries().forEach(fn);
+      }).observe(Object.assign({type: type, buffered: true}, opts));
+      return true;
+    } catch(e){ return false; }
+  }
+
+  // the vitals are measured the way web-vitals does, roughly
+  function measureVitals(){
+    var nav = performance.getEntriesByType && performance.getEntriesByType('navigation')[0];
+    if(nav && nav.responseStart > 0) vitals.ttfb = Math.round(nav.responseStart);
+    observe('paint', function(e){
+      if(e.name === 'first-contentful-paint') vitals.fcp = Math.round(e.startTime);
+    });
+    observe('largest-contentful-paint', function(e){
+      vitals.lcp = Math.round(e.startTime);
+    });
+    // CLS is the worst burst of shifts under a second apart and 5 seconds long, not caused by input
+    var burst = 0, first = 0, prev = 0;
+    if(observe('layout-shift', function(e){
+      if(e.hadRecentInput) return;
+      if(prev && e.startTime - prev < 1000 && e.startTime - first < 5000) burst += e.value;
+      else { burst = e.value; first = e.startTime; }
+      prev = e.startTime;
+      vitals.cls = Math.max(vitals.cls || 0, Math.round(burst * 10000) / 10000);
+    })) vitals.cls = 0;
+    // INP is the slowest interaction, which it is for pages with under 50 of them
+    observe('event', function(e){
+      if(e.interactionId) vitals.inp = Math.max(vitals.inp || 0, Math.round(e.duration));
+    }, {durationThreshold: 40});
+  }
+
+  // the vitals are sent once, when the page is first hidden, as LCP and CLS can grow until then
+  function reportVitals(){
+    if(!CONFIG.vitals || !landing || vitalsSent || !Object.keys(vitals).length) return;
+    vitalsSent = true;
+    send('vitals', Object.assign({domain: landing.domain, path: landing.path}, vitals));
+  }
+
+  function handle(args){
     if(args[0]==='pageview') trackPageview(args[1]);
     else if(args[0]==='config') Object.assign(CONFIG, args[1]);
-  };
+  }
+
+  // Process queued events, then handle future ones as they're pushed
+  queue.forEach(handle);
+  queue.push = handle;
+
+  if(CONFIG.vitals && window.PerformanceObserver) measureVitals();
+  if(CONFIG.auto) trackPageview();
+
+  // SPA, only count navigation that changed the tracked path
+  function navigate(){
+    if(currentPath() !== last) trackPageview();
+  }
 
-  // SPA
   (function(history){
     var push = history.pushState;
     history.pushState = function(){
       push.apply(history, arguments);
-      window._uaq.push(['pageview', {
-        domain: location.hostname,
-        path: location.pathname,
-        ref: document.referrer
-      }]);
+      navigate();
     };
   })(history);
 
   // Back/forward navigation
-  window.addEventListener('popstate', function(){
-    window._uaq.push(['pageview', {
-      domain: location.hostname,
-      path: location.pathname,
-      ref: document.referrer
-    }]);
+  window.addEventListener('popstate', navigate);
+  window.addEventListener('hashchange', function(){
+    if(CONFIG.hash) navigate();
+  });
+
+  // Engagement is reported whenever the page is hidden, which may be the last chance to
+  window.addEventListener('scroll', function(){
+    if(page) scrolled = Math.max(scrolled, scrollDepth());
+  }, {passive: true});
+  document.addEventListener('visibilitychange', function(){
+    if(document.visibilityState === 'hidden') reportVitals();
+    if(!page) return;
+    if(document.visibilityState === 'hidden'){
+      if(visibleSince) engaged += Date.now() - visibleSince;
+      visibleSince = 0;
+      engage();
+    } else {
+      visibleSince = Date.now();
+    }
+  });
+  window.addEventListener('pagehide', function(){
+    reportVitals();
+    if(visibleSince) engage();
   });
 
-})(window);
+  // Links opened with the middle button don't fire click
+  document.addEventListener('click', trackLink, true);
+  document.addEventListener('auxclick', function(e){
+    if(e.button === 1) trackLink(e);
+  }, true);
 
+})(window, document);
@@ -1 +1 @@
-(function(n){var t={endpoint:"https://updog.bartel.com"};function a(e){if(navigator.sendBeacon)try{navigator.sendBeacon(t.endpoint+"/view",JSON.stringify(e));return}catch{}var o=new Image;o.src=t.endpoint+"/view.gif?domain="+encodeURIComponent(e.domain)+"&path="+encodeURIComponent(e.path)+"&ref="+encodeURIComponent(e.ref)}(n._uaq||[]).forEach(function(e){e[0]==="pageview"?a(e[1]):e[0]==="config"&&Object.assign(t,e[1])}),n._uaq.push=function(e){e[0]==="pageview"?a(e[1]):e[0]==="config"&&Object.assign(t,e[1])},(function(e){var o=e.pushState;e.pushState=function(){o.apply(e,arguments),n._uaq.push(["pageview",{domain:location.hostname,path:location.pathname,ref:document.referrer}])}})(history),n.addEventListener("popstate",function(){n._uaq.push(["pageview",{domain:location.hostname,path:location.pathname,ref:document.referrer}])})})(window);
+(function(n,r){var p=r.currentScript,t={endpoint:p&&p.src?new URL(p.src).origin:"",auto:!1,hash:!1,exclude:[],params:[],outbound:!1,downloads:[],vitals:!1},h=n._uaq=n._uaq||[],c,l,P,E,V,S,L,W={},X;function v(e,o){if(navigator.sendBeacon)try{navigator.sendBeacon(t.endpoint+"/"+e,JSON.stringify(o));return}catch{}var a=new Image;a.src=t.endpoint+"/"+e+".gif?"+Object.keys(o).map(function(i){return i+"="+encodeURIComponent(o[i])}).join("&")}function g(e,o){var a=e.replace(/[.+^${}()|[\]\\]/g,"\\$&").replace(/\*/g,".*").replace(/\?/g,".");return new RegExp("^"+a+"$").test(o)}function u(){var e=location.pathname;if(t.params.length){var o=[];new URLSearchParams(location.search).forEach(function(a,i){t.params.indexOf(i)!==-1&&o.push(encodeURIComponent(i)+"="+encodeURIComponent(a))}),o.length&&(e+="?"+o.join("&"))}return t.hash&&location.hash&&(e+=location.hash),e}function m(e){for(var o=e.replace(/\?[^#]*/,""),a=0;a<t.exclude.length;a++)if(g(t.exclude[a],o))return!0;return!1}function x(){var e=r.documentElement.scrollHeight;return e?Math.min(100,Math.round((n.scrollY+n.innerHeight)/e*100)):100}function q(){if(P){var e=E+(V?Date.now()-V:0);e>0&&v("engage",{domain:P.domain,path:P.path,engaged:e,scroll:S})}}function s(e){e=e||{};var o=e.path||u();q(),P=null,c=o,l=e.domain||location.hostname;var a=m(o);L===void 0&&(L=a?null:{domain:l,path:o}),!a&&(v("view",{domain:l,path:o,ref:e.ref!==void 0?e.ref:r.referrer}),P={domain:l,path:o},E=0,V=r.visibilityState==="hidden"?0:Date.now(),S=x())}function k(e){var o=e.target.closest&&e.target.closest("a[href]");if(o){var a;try{a=new URL(o.href,location.href)}catch{return}if(!(a.protocol!=="http:"&&a.protocol!=="https:")){var i=a.pathname.split("/").pop(),w=i.indexOf(".")!==-1?i.split(".").pop().toLowerCase():"",y=w&&t.downloads.indexOf(w)!==-1?"download":t.outbound&&a.hostname!==location.hostname?"outbound":"",b=c||u();!y||m(b)||v("link",{domain:l||location.hostname,path:b,type:y,url:a.href})}}}function O(e,o,a){try{return new PerformanceObserver(function(i){i.getEntries().forEach(o)}).observe(Object.assign({type:e,buffered:!0},a)),!0}catch{return!1}}function M(){var e=performance.getEntriesByType&&performance.getEntriesByType("navigation")[0];e&&e.responseStart>0&&(W.ttfb=Math.round(e.responseStart)),O("paint",function(y){y.name==="first-contentful-paint"&&(W.fcp=Math.round(y.startTime))}),O("largest-contentful-paint",function(y){W.lcp=Math.round(y.startTime)});var o=0,a=0,i=0;O("layout-shift",function(y){y.hadRecentInput||(i&&y.startTime-i<1e3&&y.startTime-a<5e3?o+=y.value:(o=y.value,a=y.startTime),i=y.startTime,W.cls=Math.max(W.cls||0,Math.round(o*1e4)/1e4))})&&(W.cls=0),O("event",function(y){y.interactionId&&(W.inp=Math.max(W.inp||0,Math.round(y.duration)))},{durationThreshold:40})}function R(){!t.vitals||!L||X||!Object.keys(W).length||(X=!0,v("vitals",Object.assign({domain:L.domain,path:L.path},W)))}function d(e){e[0]==="pageview"?s(e[1]):e[0]==="config"&&Object.assign(t,e[1])}h.forEach(d),h.push=d,t.vitals&&n.PerformanceObserver&&M(),t.auto&&s();function f(){u()!==c&&s()}(function(e){var o=e.pushState;e.pushState=function(){o.apply(e,arguments),f()}})(history),n.addEventListener("popstate",f),n.addEventListener("hashchange",function(){t.hash&&f()}),n.addEventListener("scroll",function(){P&&(S=Math.max(S,x()))},{passive:!0}),r.addEventListener("visibilitychange",function(){r.visibilityState==="hidden"&&R(),P&&(r.visibilityState==="hidden"?(V&&(E+=Date.now()-V),V=0,q()):V=Date.now())}),n.addEventListener("pagehide",function(){R(),V&&q()}),r.addEventListener("click",k,!0),r.addEventListener("auxclick",function(e){e.button===1&&k(e)},!0)})(window,document);
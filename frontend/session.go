@@ -0,0 +1,41 @@
+package frontend
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/session"
+)
+
+// revokeSession signs one of the user's devices out
+func (f *Frontend) revokeSession(req *UpdogRequest) error {
+	if req.R.Method != http.MethodPost {
+		return NewUpError("Method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	sessionID := req.R.FormValue("session_id")
+	err := f.sessions.Revoke(req.R.Context(), req.User.ID, sessionID)
+	if errors.Is(err, session.ErrNotFound) {
+		return NewUpError("Session not found", http.StatusNotFound)
+	}
+	if err != nil {
+		log.Printf("Failed to revoke session: %v", err)
+		return NewUpError("Failed to revoke session", http.StatusInternalServerError)
+	}
+
+	audit.Record(req.R.Context(), f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionSessionRevoke, audit.TargetUser, req.User.ID, map[string]any{
+		"session_id": sessionID,
+	}))
+
+	// revoking this device signs it out
+	if token := tokenFromRequest(req.R); token != nil && token.SessionID == sessionID {
+		session.ClearCookies(req.W)
+		http.Redirect(req.W, req.R, "/login", http.StatusSeeOther)
+		return nil
+	}
+
+	http.Redirect(req.W, req.R, "/settings", http.StatusSeeOther)
+	return nil
+}
@@ -0,0 +1,144 @@
+package frontend
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/env"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/share"
+	"github.com/zackb/updog/team"
+)
+
+// WithShare serves a read-only panel of a shared link without an account,
+// asking for the password first if the link has one
+func (f *Frontend) WithShare(panel string, h UpdogHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		l, err := f.db.ShareStorage().ReadLinkBySlug(ctx, r.PathValue("slug"))
+		if err != nil || l.Expired() || !l.Allows(panel) {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !l.Authorized(r) {
+			data := PageData{
+				Title: "Shared Dashboard",
+				Data:  map[string]any{"Action": r.URL.Path},
+			}
+			if r.Method == http.MethodPost {
+				if l.CheckPassword(r.FormValue("password")) {
+					http.SetCookie(w, &http.Cookie{
+						Name:     l.CookieName(),
+						Value:    l.AccessToken(),
+						Path:     "/",
+						HttpOnly: true,
+						Secure:   !env.IsDev(),
+						Expires:  l.ExpiresAt,
+					})
+					http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+					return
+				}
+				data.Error = "Incorrect password"
+			}
+			tmpl.ExecuteTemplate(w, "share_password.html", data)
+			return
+		}
+
+		d, err := f.db.DomainStorage().ReadDomain(ctx, l.DomainID)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		start, end, err := httpx.ParseTimeParams(r)
+		if err != nil {
+			http.Error(w, "Invalid time parameters", http.StatusBadRequest)
+			return
+		}
+
+		req := &UpdogRequest{
+			W:              w,
+			R:              r,
+			Domains:        []*domain.Domain{d},
+			SelectedDomain: d,
+			Start:          start,
+			End:            end,
+			Share:          l,
+		}
+
+		if err := h(req); err != nil {
+			writeUpError(w, err)
+		}
+	}
+}
+
+// createShare creates a shared link for a domain the user owns
+func (f *Frontend) createShare(req *UpdogRequest) error {
+	d, err := f.domainFromForm(req, team.RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	// the link works through the end of the chosen day
+	var expiresAt time.Time
+	if expires := req.R.FormValue("expires"); expires != "" {
+		day, err := time.Parse("2006-01-02", expires)
+		if err != nil {
+			return NewUpError("Invalid expiry date", http.StatusBadRequest)
+		}
+		expiresAt = day.AddDate(0, 0, 1)
+		if expiresAt.Before(time.Now()) {
+			return NewUpError("Expiry date is in the past", http.StatusBadRequest)
+		}
+	}
+
+	l, err := share.NewLink(d.ID, req.User.ID, req.R.FormValue("password"), expiresAt, req.R.Form["panels"])
+	if errors.Is(err, share.ErrNoPanels) {
+		return NewUpError("Choose at least one panel to share", http.StatusBadRequest)
+	}
+	if err != nil {
+		log.Printf("Failed to create shared link: %v", err)
+		return NewUpError("Failed to create shared link", http.StatusInternalServerError)
+	}
+	if err := f.db.ShareStorage().CreateLink(req.R.Context(), l); err != nil {
+		log.Printf("Failed to create shared link: %v", err)
+		return NewUpError("Failed to create shared link", http.StatusInternalServerError)
+	}
+
+	audit.Record(req.R.Context(), f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionShareCreate, audit.TargetDomain, d.ID, map[string]any{
+		"link_id":    l.ID,
+		"panels":     l.PanelList(),
+		"password":   l.HasPassword(),
+		"expires_at": l.ExpiresAt,
+	}))
+
+	http.Redirect(req.W, req.R, "/domains", http.StatusSeeOther)
+	return nil
+}
+
+// revokeShare deletes a shared link, it stops working immediately
+func (f *Frontend) revokeShare(req *UpdogRequest) error {
+	d, err := f.domainFromForm(req, team.RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	linkID := req.R.FormValue("link_id")
+	if err := f.db.ShareStorage().DeleteLink(req.R.Context(), d.ID, linkID); err != nil {
+		log.Printf("Failed to delete shared link: %v", err)
+		return NewUpError("Failed to revoke shared link", http.StatusInternalServerError)
+	}
+
+	audit.Record(req.R.Context(), f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionShareRevoke, audit.TargetDomain, d.ID, map[string]any{
+		"link_id": linkID,
+	}))
+
+	http.Redirect(req.W, req.R, "/domains", http.StatusSeeOther)
+	return nil
+}
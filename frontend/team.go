@@ -0,0 +1,280 @@
+package frontend
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/team"
+)
+
+// teamView is a team the user belongs to, members and invitations are only loaded for owners
+type teamView struct {
+	Team        *team.Team
+	Role        string
+	Members     []*team.Member
+	Invitations []*team.Invitation
+}
+
+func (t *teamView) IsOwner() bool {
+	return t.Role == team.RoleOwner
+}
+
+func (f *Frontend) teams(req *UpdogRequest) error {
+
+	ctx := req.R.Context()
+
+	// POST create team
+	if req.R.Method == http.MethodPost {
+		name := strings.TrimSpace(req.R.FormValue("name"))
+		if name == "" {
+			return NewUpError("Team name is required", http.StatusBadRequest)
+		}
+
+		t := &team.Team{ID: id.NewID(), Name: name}
+		if err := f.db.TeamStorage().CreateTeam(ctx, t, req.User.ID); err != nil {
+			log.Printf("Failed to create team: %v", err)
+			return NewUpError("Failed to create team", http.StatusInternalServerError)
+		}
+
+		audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionTeamCreate, audit.TargetTeam, t.ID, map[string]any{
+			"name": t.Name,
+		}))
+
+		http.Redirect(req.W, req.R, "/teams", http.StatusSeeOther)
+		return nil
+	}
+
+	return f.renderTeams(req, "")
+}
+
+// inviteToTeam creates and emails an invitation and shows its link, the token can't be shown again
+func (f *Frontend) inviteToTeam(req *UpdogRequest) error {
+	m, err := f.teamMemberFromForm(req, team.RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	email := strings.TrimSpace(req.R.FormValue("email"))
+	if !strings.Contains(email, "@") {
+		return NewUpError("A valid email is required", http.StatusBadRequest)
+	}
+	role := req.R.FormValue("role")
+	if !team.ValidRole(role) {
+		return NewUpError("Invalid role", http.StatusBadRequest)
+	}
+
+	inv, token := team.NewInvitation(m.TeamID, email, role, req.User.ID)
+	if err := f.db.TeamStorage().CreateInvitation(req.R.Context(), inv); err != nil {
+		log.Printf("Failed to create invitation: %v", err)
+		return NewUpError("Failed to create invitation", http.StatusInternalServerError)
+	}
+
+	audit.Record(req.R.Context(), f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionTeamInvite, audit.TargetTeam, m.TeamID, map[string]any{
+		"email": inv.Email,
+		"role":  inv.Role,
+	}))
+
+	inviteURL := team.InvitationURL(httpx.BaseURL(req.R), token)
+	t, err := f.db.TeamStorage().ReadTeam(req.R.Context(), m.TeamID)
+	if err == nil {
+		err = team.SendInvitation(req.R.Context(), f.sender, t, inv, token)
+	}
+	if err != nil {
+		log.Printf("Failed to send invitation: %v", err)
+	}
+
+	return f.renderTeams(req, inviteURL)
+}
+
+func (f *Frontend) revokeInvitation(req *UpdogRequest) error {
+	m, err := f.teamMemberFromForm(req, team.RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	invitationID := req.R.FormValue("invitation_id")
+	if err := f.db.TeamStorage().DeleteInvitation(req.R.Context(), m.TeamID, invitationID); err != nil {
+		log.Printf("Failed to delete invitation: %v", err)
+		return NewUpError("Failed to revoke invitation", http.StatusInternalServerError)
+	}
+
+	audit.Record(req.R.Context(), f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionTeamInviteRevoke, audit.TargetTeam, m.TeamID, map[string]any{
+		"invitation_id": invitationID,
+	}))
+
+	http.Redirect(req.W, req.R, "/teams", http.StatusSeeOther)
+	return nil
+}
+
+// updateMember changes a member's role, or removes them if the form asks to
+func (f *Frontend) updateMember(req *UpdogRequest) error {
+	userID := req.R.FormValue("user_id")
+	remove := req.R.FormValue("remove") != ""
+
+	// anyone can leave a team, only owners can change others
+	min := team.RoleOwner
+	if remove && userID == req.User.ID {
+		min = team.RoleViewer
+	}
+	m, err := f.teamMemberFromForm(req, min)
+	if err != nil {
+		return err
+	}
+
+	ctx := req.R.Context()
+	target, err := f.db.TeamStorage().ReadMember(ctx, m.TeamID, userID)
+	if err != nil {
+		return NewUpError("Member not found", http.StatusNotFound)
+	}
+
+	action := audit.ActionTeamMemberRemove
+	if remove {
+		err = team.Remove(ctx, f.db.TeamStorage(), target)
+	} else {
+		role := req.R.FormValue("role")
+		if !team.ValidRole(role) {
+			return NewUpError("Invalid role", http.StatusBadRequest)
+		}
+		action = audit.ActionTeamMemberUpdate
+		err = team.SetRole(ctx, f.db.TeamStorage(), target, role)
+	}
+	if errors.Is(err, team.ErrLastOwner) {
+		return NewUpError(err.Error(), http.StatusConflict)
+	}
+	if err != nil {
+		log.Printf("Failed to update team member: %v", err)
+		return NewUpError("Failed to update team member", http.StatusInternalServerError)
+	}
+
+	audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, action, audit.TargetTeam, m.TeamID, map[string]any{
+		"user_id": target.UserID,
+		"role":    target.Role,
+	}))
+
+	http.Redirect(req.W, req.R, "/teams", http.StatusSeeOther)
+	return nil
+}
+
+// deleteTeam removes a team, its domains stay with their owners
+func (f *Frontend) deleteTeam(req *UpdogRequest) error {
+	m, err := f.teamMemberFromForm(req, team.RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	if err := f.db.TeamStorage().DeleteTeam(req.R.Context(), m.TeamID); err != nil {
+		log.Printf("Failed to delete team: %v", err)
+		return NewUpError("Failed to delete team", http.StatusInternalServerError)
+	}
+
+	audit.Record(req.R.Context(), f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionTeamDelete, audit.TargetTeam, m.TeamID, nil))
+
+	http.Redirect(req.W, req.R, "/teams", http.StatusSeeOther)
+	return nil
+}
+
+// acceptInvitation shows who invited the user and joins the team on POST
+func (f *Frontend) acceptInvitation(w http.ResponseWriter, r *http.Request) {
+	u := f.userFromRequest(r)
+	token := r.FormValue("token")
+
+	data := PageData{
+		Title: "Join Team",
+		User:  u,
+		Data:  map[string]any{"Token": token},
+	}
+
+	if r.Method == http.MethodPost {
+		inv, err := team.Accept(r.Context(), f.db.TeamStorage(), token, u)
+		if err == nil {
+			audit.Record(r.Context(), f.db.AuditStorage(), audit.NewEntry(r, u.ID, audit.ActionTeamJoin, audit.TargetTeam, inv.TeamID, map[string]any{
+				"role": inv.Role,
+			}))
+			http.Redirect(w, r, "/teams", http.StatusSeeOther)
+			return
+		}
+		if errors.Is(err, team.ErrInvitationInvalid) || errors.Is(err, team.ErrWrongRecipient) || errors.Is(err, team.ErrEmailNotVerified) {
+			data.Error = err.Error()
+		} else {
+			log.Printf("Failed to accept invitation: %v", err)
+			data.Error = "Failed to accept invitation"
+		}
+	}
+
+	inv, err := f.db.TeamStorage().ReadInvitationByToken(r.Context(), token)
+	if err != nil || !inv.Pending() {
+		data.Error = team.ErrInvitationInvalid.Error()
+	} else {
+		data.Data["Invitation"] = inv
+	}
+
+	tmpl.ExecuteTemplate(w, "invitation.html", data)
+}
+
+func (f *Frontend) renderTeams(req *UpdogRequest, inviteURL string) error {
+
+	ctx := req.R.Context()
+
+	memberships, err := f.db.TeamStorage().ListTeamsByUser(ctx, req.User.ID)
+	if err != nil {
+		log.Printf("Failed to list teams: %v", err)
+		return NewUpError("Failed to load teams", http.StatusInternalServerError)
+	}
+
+	teams := make([]*teamView, len(memberships))
+	for i, m := range memberships {
+		tv := &teamView{Team: m.Team, Role: m.Role}
+		if tv.IsOwner() {
+			if tv.Members, err = f.db.TeamStorage().ListMembers(ctx, m.TeamID); err != nil {
+				log.Printf("Failed to list members: %v", err)
+			}
+			if tv.Invitations, err = f.db.TeamStorage().ListInvitations(ctx, m.TeamID); err != nil {
+				log.Printf("Failed to list invitations: %v", err)
+			}
+		}
+		teams[i] = tv
+	}
+
+	data := PageData{
+		Title:   "Teams",
+		User:    req.User,
+		Slug:    "teams",
+		Domains: req.Domains,
+		Stats: &DashboardStats{
+			SelectedDomain: req.SelectedDomain,
+		},
+		Data: map[string]any{
+			"Teams":     teams,
+			"InviteURL": inviteURL,
+			"Roles":     []string{team.RoleViewer, team.RoleEditor, team.RoleOwner},
+		},
+	}
+
+	return tmpl.ExecuteTemplate(req.W, "teams.html", data)
+}
+
+// teamMemberFromForm returns the user's membership of the posted team if their role is at least min
+func (f *Frontend) teamMemberFromForm(req *UpdogRequest, min string) (*team.Member, error) {
+	if req.R.Method != http.MethodPost {
+		return nil, NewUpError("Method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	teamID := req.R.FormValue("team_id")
+	if teamID == "" {
+		return nil, NewUpError("Team ID is required", http.StatusBadRequest)
+	}
+
+	m, err := f.db.TeamStorage().ReadMember(req.R.Context(), teamID, req.User.ID)
+	if err != nil {
+		return nil, NewUpError("Team not found", http.StatusNotFound)
+	}
+	if !team.RoleAtLeast(m.Role, min) {
+		return nil, NewUpError("Forbidden", http.StatusForbidden)
+	}
+	return m, nil
+}
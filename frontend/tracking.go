@@ -0,0 +1,101 @@
+package frontend
+
+import (
+	"bytes"
+	"io/fs"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/mail"
+	"github.com/zackb/updog/team"
+)
+
+// how long browsers use a tracker script before checking its ETag again
+const trackerMaxAge = "300"
+
+// trackerScript serves /js/<domain id>.js, the tracker with the domain's configuration embedded
+// so the page needs no snippet. It's cached and revalidated with an ETag, only by browsers unless BASE_URL is set.
+func (f *Frontend) trackerScript(w http.ResponseWriter, r *http.Request) {
+	domainID, ok := strings.CutSuffix(r.PathValue("script"), ".js")
+	if !ok || domainID == "" {
+		http.NotFound(w, r)
+		return
+	}
+	ctx := r.Context()
+
+	d, err := f.db.DomainStorage().ReadDomain(ctx, domainID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	c, err := domain.ReadTrackingConfig(ctx, f.db.DomainStorage(), d.ID)
+	if err != nil {
+		log.Printf("Failed to read tracking config: %v", err)
+		http.Error(w, "Failed to read tracking config", http.StatusInternalServerError)
+		return
+	}
+	tracker, err := fs.ReadFile(staticFiles, "script/ua.js")
+	if err != nil {
+		log.Printf("Failed to read tracker: %v", err)
+		http.Error(w, "Failed to read tracker", http.StatusInternalServerError)
+		return
+	}
+
+	// without BASE_URL the script sends pageviews to whichever host the request named,
+	// so shared caches mustn't hand it to anyone else
+	cache := "public, max-age=" + trackerMaxAge
+	base, err := mail.BaseURL()
+	if err != nil {
+		base = httpx.BaseURL(r)
+		cache = "private, max-age=" + trackerMaxAge
+	}
+	script, etag, err := c.TrackerScript(base, tracker)
+	if err != nil {
+		log.Printf("Failed to build tracker: %v", err)
+		http.Error(w, "Failed to build tracker", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", cache)
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(script))
+}
+
+// domainTracking saves how the tracker served for a domain behaves
+func (f *Frontend) domainTracking(req *UpdogRequest) error {
+	ctx := req.R.Context()
+
+	d, err := f.domainFromForm(req, team.RoleEditor)
+	if err != nil {
+		return err
+	}
+
+	c := &domain.TrackingConfig{
+		DomainID:           d.ID,
+		HashRouting:        req.R.FormValue("hash_routing") != "",
+		TrackOutbound:      req.R.FormValue("track_outbound") != "",
+		TrackDownloads:     req.R.FormValue("track_downloads") != "",
+		TrackVitals:        req.R.FormValue("track_vitals") != "",
+		DownloadExtensions: req.R.FormValue("download_extensions"),
+		ExcludedPaths:      req.R.FormValue("excluded_paths"),
+		QueryParams:        req.R.FormValue("query_params"),
+	}
+	if err := c.Normalize(); err != nil {
+		return NewUpError(err.Error(), http.StatusBadRequest)
+	}
+	if err := f.db.DomainStorage().SaveTrackingConfig(ctx, c); err != nil {
+		log.Printf("Failed to save tracking config: %v", err)
+		return NewUpError("Failed to save tracking config", http.StatusInternalServerError)
+	}
+
+	audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(req.R, req.User.ID, audit.ActionDomainTracking, audit.TargetDomain, d.ID, c))
+
+	http.Redirect(req.W, req.R, "/domains", http.StatusSeeOther)
+	return nil
+}
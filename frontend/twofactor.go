@@ -0,0 +1,124 @@
+package frontend
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/settings"
+	"github.com/zackb/updog/totp"
+)
+
+// twoFactorIssuer names the account in authenticator apps
+const twoFactorIssuer = "Updog"
+
+// twoFactor enrolls the user in two-factor authentication, or manages it once enabled
+func (f *Frontend) twoFactor(req *UpdogRequest) error {
+	ctx := req.R.Context()
+	u := req.User
+	code := req.R.FormValue("code")
+
+	if req.R.Method != http.MethodPost {
+		// keep the same secret until enrollment is confirmed, so reloading doesn't invalidate a scanned code
+		if !u.TOTPEnabled && u.TOTPSecret == "" {
+			u.TOTPSecret = totp.NewSecret()
+			if err := f.db.UserStorage().UpdateUser(ctx, u); err != nil {
+				log.Printf("Failed to update user: %v", err)
+				return NewUpError("Failed to start two-factor setup", http.StatusInternalServerError)
+			}
+		}
+		return f.renderTwoFactor(req, nil, "")
+	}
+
+	var codes []string
+	var action string
+	switch req.R.FormValue("action") {
+	case "enable":
+		var ok bool
+		if codes, ok = u.EnableTwoFactor(code, time.Now()); !ok {
+			return f.renderTwoFactor(req, nil, "Invalid code, check the time on your device and try again")
+		}
+		action = audit.ActionUser2FAEnable
+	case "disable":
+		// without a password having just signed in stands in for it
+		var signedInAt time.Time
+		if t := tokenFromRequest(req.R); t != nil {
+			signedInAt = t.SignedInAt
+		}
+		if !u.Reauthenticated(req.R.FormValue("password"), "", signedInAt, time.Now()) {
+			if !u.HasPassword() {
+				return f.renderTwoFactor(req, nil, "Sign out and in again to disable two-factor authentication")
+			}
+			return f.renderTwoFactor(req, nil, "Invalid password or code")
+		}
+		if !u.CheckSecondFactor(code, time.Now()) {
+			return f.renderTwoFactor(req, nil, "Invalid password or code")
+		}
+		u.DisableTwoFactor()
+		action = audit.ActionUser2FADisable
+	case "recovery":
+		if !u.CheckSecondFactor(code, time.Now()) {
+			return f.renderTwoFactor(req, nil, "Invalid code")
+		}
+		codes = u.ResetRecoveryCodes()
+		action = audit.ActionUserRecovery
+	default:
+		return NewUpError("Unknown action", http.StatusBadRequest)
+	}
+
+	if err := f.db.UserStorage().UpdateUser(ctx, u); err != nil {
+		log.Printf("Failed to update user: %v", err)
+		return NewUpError("Failed to update two-factor authentication", http.StatusInternalServerError)
+	}
+	audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(req.R, u.ID, action, audit.TargetUser, u.ID, nil))
+
+	if codes == nil {
+		http.Redirect(req.W, req.R, "/settings/2fa", http.StatusSeeOther)
+		return nil
+	}
+	return f.renderTwoFactor(req, codes, "")
+}
+
+// renderTwoFactor shows the two-factor page, recoveryCodes were just created and can't be shown again
+func (f *Frontend) renderTwoFactor(req *UpdogRequest, recoveryCodes []string, errMsg string) error {
+	u := req.User
+
+	data := PageData{
+		Title:   "Two-Factor Authentication",
+		User:    u,
+		Slug:    "settings",
+		Domains: req.Domains,
+		Error:   errMsg,
+		Stats: &DashboardStats{
+			SelectedDomain: req.SelectedDomain,
+		},
+		Data: map[string]any{
+			"RecoveryCodes": recoveryCodes,
+			"Required":      f.twoFactorRequired(req.R.Context()),
+		},
+	}
+
+	if !u.TOTPEnabled {
+		svg, err := totp.QRCodeSVG(totp.URL(twoFactorIssuer, u.Email, u.TOTPSecret))
+		if err != nil {
+			log.Printf("Failed to render qr code: %v", err)
+		}
+		// the svg is generated here from the secret, not user input
+		data.Data["QRCode"] = template.HTML(svg)
+		data.Data["Secret"] = u.TOTPSecret
+	}
+
+	return tmpl.ExecuteTemplate(req.W, "twofactor.html", data)
+}
+
+// twoFactorRequired is true if an admin requires every user to set up two-factor authentication
+func (f *Frontend) twoFactorRequired(ctx context.Context) bool {
+	required, err := f.db.ReadValueAsBool(ctx, settings.SettingRequire2FA)
+	if err != nil {
+		log.Printf("Failed to read settings: %v", err)
+	}
+	return required
+}
@@ -4,15 +4,21 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/zackb/updog/auth"
 	"github.com/zackb/updog/domain"
 	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/session"
+	"github.com/zackb/updog/share"
 	"github.com/zackb/updog/user"
 )
 
 const (
-	contextKeyUser = "user"
+	contextKeyUser  = "user"
+	contextKeyToken = "token"
 )
 
 type UpdogRequest struct {
@@ -22,6 +28,8 @@ type UpdogRequest struct {
 	Domains        []*domain.Domain
 	SelectedDomain *domain.Domain
 	Start, End     time.Time
+	// Share is set when the request is for a shared link rather than a user
+	Share *share.Link
 }
 
 type UpdogHandler func(*UpdogRequest) error
@@ -45,22 +53,60 @@ func (e *UpError) Error() string {
 func (f *Frontend) WithAuthenticated(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		token := f.auth.IsAuthenticated(r)
+		// pages are for people signed in with a session, an API key would get every scope through them
+		if token != nil && token.APIKeyID != "" {
+			token = nil
+		}
 		if token == nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			token = f.refreshSession(w, r)
+		}
+		if token == nil {
+			http.Redirect(w, r, loginURL(r), http.StatusSeeOther)
 			return
 		}
 
 		user, err := f.db.UserStorage().ReadUser(r.Context(), token.ClientId)
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		if err != nil || user.Disabled {
+			http.Redirect(w, r, loginURL(r), http.StatusSeeOther)
+			return
+		}
+
+		// users have to set up two-factor authentication before anything else if it's required
+		if !user.TOTPEnabled && r.URL.Path != "/settings/2fa" && f.twoFactorRequired(r.Context()) {
+			http.Redirect(w, r, "/settings/2fa", http.StatusSeeOther)
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), contextKeyUser, user)
+		ctx = context.WithValue(ctx, contextKeyToken, token)
 		next(w, r.WithContext(ctx))
 	}
 }
 
+// refreshSession issues new tokens from the refresh token cookie once the access token has expired
+func (f *Frontend) refreshSession(w http.ResponseWriter, r *http.Request) *auth.Token {
+	refreshToken := session.RefreshTokenFromRequest(r)
+	if refreshToken == "" {
+		return nil
+	}
+
+	tokens, err := f.sessions.Refresh(r.Context(), refreshToken, r)
+	if err != nil {
+		log.Printf("Failed to refresh session: %v", err)
+		session.ClearCookies(w)
+		return nil
+	}
+
+	session.SetCookies(w, tokens)
+	return &auth.Token{
+		ClientId:   tokens.Session.UserID,
+		Expiry:     tokens.ExpiresAt,
+		ID:         tokens.Session.AccessTokenID,
+		SessionID:  tokens.Session.ID,
+		SignedInAt: tokens.Session.CreatedAt,
+	}
+}
+
 func (f *Frontend) WithUpdog(h UpdogHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := f.userFromRequest(r)
@@ -94,18 +140,20 @@ func (f *Frontend) WithUpdog(h UpdogHandler) http.HandlerFunc {
 		req.End = end
 
 		if err := h(req); err != nil {
-			log.Printf("Handler error: %v", err)
-			if upErr, ok := err.(*UpError); ok {
-				http.Error(w, upErr.Message, upErr.HTTPStatus)
-				return
-			} else {
-				http.Error(w, "Something went wrong", http.StatusInternalServerError)
-			}
-
+			writeUpError(w, err)
 		}
 	}
 }
 
+func writeUpError(w http.ResponseWriter, err error) {
+	log.Printf("Handler error: %v", err)
+	if upErr, ok := err.(*UpError); ok {
+		http.Error(w, upErr.Message, upErr.HTTPStatus)
+		return
+	}
+	http.Error(w, "Something went wrong", http.StatusInternalServerError)
+}
+
 func (f *Frontend) getDomainsAndSelected(r *http.Request, user *user.User) ([]*domain.Domain, *domain.Domain, error) {
 	domains, err := f.db.DomainStorage().ListDomainsByUser(r.Context(), user.ID)
 	if err != nil {
@@ -143,6 +191,30 @@ func (f *Frontend) getDomainsAndSelected(r *http.Request, user *user.User) ([]*d
 	return domains, selectedDomain, nil
 }
 
+// loginURL sends the user back to the page they asked for after logging in
+func loginURL(r *http.Request) string {
+	if r.Method != http.MethodGet || r.URL.Path == "/dashboard" {
+		return "/login"
+	}
+	return "/login?next=" + url.QueryEscape(r.URL.RequestURI())
+}
+
+// safeNext returns next if it's a path on this site, otherwise the dashboard
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/dashboard"
+	}
+	return next
+}
+
+// tokenFromRequest is the token the request was authenticated with
+func tokenFromRequest(r *http.Request) *auth.Token {
+	if t, ok := r.Context().Value(contextKeyToken).(*auth.Token); ok {
+		return t
+	}
+	return nil
+}
+
 func (f *Frontend) userFromRequest(r *http.Request) *user.User {
 	if u, ok := r.Context().Value(contextKeyUser).(*user.User); ok {
 		return u
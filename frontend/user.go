@@ -3,22 +3,30 @@ package frontend
 import (
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/auth"
 	"github.com/zackb/updog/env"
 	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/lockout"
+	"github.com/zackb/updog/session"
 	"github.com/zackb/updog/settings"
 	"github.com/zackb/updog/user"
 )
 
 func (f *Frontend) logout(w http.ResponseWriter, r *http.Request) {
-	// clear the authentication cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    "",
-		HttpOnly: true,
-		Secure:   !env.IsDev(),
-		MaxAge:   -1,
-	})
+	// revoke the token and its session so copies of them can't be used either
+	token := f.auth.IsAuthenticated(r)
+	if err := f.sessions.Logout(r.Context(), token, session.RefreshTokenFromRequest(r)); err != nil {
+		log.Printf("Failed to revoke token: %v", err)
+	}
+	if token != nil {
+		audit.Record(r.Context(), f.db.AuditStorage(), audit.NewEntry(r, token.ClientId, audit.ActionLogout, audit.TargetUser, token.ClientId, nil))
+	}
+
+	// clear the authentication cookies
+	session.ClearCookies(w)
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -27,53 +35,166 @@ func (f *Frontend) login(w http.ResponseWriter, r *http.Request) {
 
 	data := PageData{
 		Title: "Login",
+		Next:  r.FormValue("next"),
 	}
 
 	if r.Method == http.MethodPost {
+		if env.IsPasswordLoginDisabled() {
+			data.Error = "Password login is disabled"
+			f.renderLogin(w, data)
+			return
+		}
+
 		email := r.FormValue("email")
 		password := r.FormValue("password")
 
-		// find user by email
-		user, err := f.db.UserStorage().ReadUserByEmail(r.Context(), email)
+		// locked out emails and addresses aren't checked, whether or not an account has the email
+		keys := lockout.LoginKeys(r, email)
+		if wait := f.guard.Wait(r.Context(), keys...); wait > 0 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			data.Error = lockout.Message
+			f.renderLogin(w, data)
+			return
+		}
+
+		// find user by email and validate password, which takes as long without an account
+		u, err := f.db.UserStorage().ReadUserByEmail(r.Context(), email)
 		if err != nil {
+			u = nil
+		}
+		if !user.CheckLogin(u, password) || u.Disabled {
+			var userID string
+			if u != nil {
+				userID = u.ID
+			}
+			f.guard.Fail(r, userID, keys...)
+			audit.Record(r.Context(), f.db.AuditStorage(), audit.NewEntry(r, userID, audit.ActionLoginFailed, audit.TargetUser, userID, map[string]any{
+				"email":  email,
+				"method": audit.LoginPassword,
+			}))
 			data.Error = "Invalid email or password"
-			tmpl.ExecuteTemplate(w, "login.html", data)
+			f.renderLogin(w, data)
 			return
 		}
+		f.guard.Succeed(r.Context(), lockout.EmailKey(email))
 
-		// validate password
-		if user.EncryptedPassword == "" || !user.Validate(password) {
-			data.Error = "Invalid email or password"
-			tmpl.ExecuteTemplate(w, "login.html", data)
+		// ask for the second factor before starting a session
+		if u.TOTPEnabled {
+			challenge, _, err := f.auth.CreateChallenge(u.ID, auth.PurposeTwoFactor, audit.LoginPassword, auth.ChallengeTTL)
+			if err != nil {
+				log.Printf("Failed to create challenge: %v", err)
+				data.Error = "Internal error"
+				f.renderLogin(w, data)
+				return
+			}
+			data.Data = map[string]any{"Challenge": challenge}
+			tmpl.ExecuteTemplate(w, "login_2fa.html", data)
 			return
 		}
 
-		// user is validated, create a token
-		token, _, err := f.auth.CreateToken(user.ID)
+		// user is validated, start a session
+		tokens, err := f.sessions.Start(r.Context(), u.ID, r)
 		if err != nil {
+			log.Printf("Failed to start session: %v", err)
 			data.Error = "Internal error"
-			tmpl.ExecuteTemplate(w, "login.html", data)
+			f.renderLogin(w, data)
 			return
 		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:     "token",
-			Value:    token,
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   !env.IsDev(),
-		})
+		audit.Record(r.Context(), f.db.AuditStorage(), audit.NewEntry(r, u.ID, audit.ActionLogin, audit.TargetUser, u.ID, map[string]any{
+			"method": audit.LoginPassword,
+		}))
+		session.SetCookies(w, tokens)
+
+		http.Redirect(w, r, safeNext(data.Next), http.StatusSeeOther)
+		return
+	}
+
+	f.renderLogin(w, data)
+}
+
+// loginTwoFactor is the second step of logging in for users with two-factor authentication
+func (f *Frontend) loginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	ctx := r.Context()
+	data := PageData{
+		Title: "Two-Factor Authentication",
+		Next:  r.FormValue("next"),
+		Data:  map[string]any{"Challenge": r.FormValue("challenge")},
+	}
+
+	challenge, err := f.auth.ValidateChallenge(ctx, r.FormValue("challenge"), auth.PurposeTwoFactor)
+	if err != nil {
+		data.Error = "Your login expired, please sign in again"
+		f.renderLogin(w, data)
+		return
+	}
+	u, err := f.db.UserStorage().ReadUser(ctx, challenge.ClientId)
+	if err != nil || u.Disabled {
+		data.Error = "Invalid email or password"
+		f.renderLogin(w, data)
+		return
+	}
+	keys := lockout.TwoFactorKeys(r, u.ID)
+	if wait := f.guard.Wait(ctx, keys...); wait > 0 {
+		w.WriteHeader(http.StatusTooManyRequests)
+		data.Error = lockout.Message
+		tmpl.ExecuteTemplate(w, "login_2fa.html", data)
+		return
+	}
+	if !u.CheckSecondFactor(r.FormValue("code"), time.Now()) {
+		f.guard.Fail(r, u.ID, keys...)
+		audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(r, u.ID, audit.ActionLoginFailed, audit.TargetUser, u.ID, map[string]any{
+			"method":     challenge.Binding,
+			"two_factor": true,
+		}))
+		data.Error = "Invalid code"
+		tmpl.ExecuteTemplate(w, "login_2fa.html", data)
+		return
+	}
+	f.guard.Succeed(ctx, lockout.UserKey(u.ID))
+
+	// the code and the challenge can't be used again
+	if err := f.db.UserStorage().UpdateUser(ctx, u); err != nil {
+		log.Printf("Failed to update user: %v", err)
+		data.Error = "Internal error"
+		tmpl.ExecuteTemplate(w, "login_2fa.html", data)
+		return
+	}
+	if err := f.auth.Revoke(ctx, challenge); err != nil {
+		log.Printf("Failed to revoke challenge: %v", err)
+	}
 
-		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+	tokens, err := f.sessions.Start(ctx, u.ID, r)
+	if err != nil {
+		log.Printf("Failed to start session: %v", err)
+		data.Error = "Internal error"
+		f.renderLogin(w, data)
 		return
 	}
 
-	tmpl.ExecuteTemplate(w, "login.html", data)
+	audit.Record(ctx, f.db.AuditStorage(), audit.NewEntry(r, u.ID, audit.ActionLogin, audit.TargetUser, u.ID, map[string]any{
+		"method":     challenge.Binding,
+		"two_factor": true,
+	}))
+	session.SetCookies(w, tokens)
+	http.Redirect(w, r, safeNext(data.Next), http.StatusSeeOther)
 }
 
 func (f *Frontend) join(w http.ResponseWriter, r *http.Request) {
+	// accounts are created by signing in with single sign-on instead
+	if env.IsPasswordLoginDisabled() {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
 	data := PageData{
 		Title: "Sign Up",
+		Next:  r.FormValue("next"),
 	}
 
 	disableSignups, err := f.db.ReadValueAsBool(r.Context(), settings.SettingDisableSignups)
@@ -124,18 +245,19 @@ func (f *Frontend) join(w http.ResponseWriter, r *http.Request) {
 			tmpl.ExecuteTemplate(w, "signup.html", data)
 			return
 		}
+		audit.Record(r.Context(), f.db.AuditStorage(), audit.NewEntry(r, u.ID, audit.ActionUserCreate, audit.TargetUser, u.ID, map[string]any{
+			"email": u.Email,
+		}))
+
+		if err := f.emails.SendVerification(r.Context(), u); err != nil {
+			log.Printf("Failed to send verification email: %v", err)
+		}
 
 		// Auto login after signup
-		token, _, err := f.auth.CreateToken(u.ID)
+		tokens, err := f.sessions.Start(r.Context(), u.ID, r)
 		if err == nil {
-			http.SetCookie(w, &http.Cookie{
-				Name:     "token",
-				Value:    token,
-				Path:     "/",
-				HttpOnly: true,
-				Secure:   !env.IsDev(),
-			})
-			http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+			session.SetCookies(w, tokens)
+			http.Redirect(w, r, safeNext(data.Next), http.StatusSeeOther)
 			return
 		}
 
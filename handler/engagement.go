@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/db"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/pageview"
+)
+
+type EngagementRequest struct {
+	Domain string `json:"domain"`
+	Path   string `json:"path"`
+	// Engaged is how many milliseconds the page has been visible
+	Engaged int64 `json:"engaged"`
+	// Scroll is the furthest the page has been scrolled, as a percentage
+	Scroll int64 `json:"scroll"`
+}
+
+// EngagementHandler attaches the engagement pings the tracker sends as a page is hidden to its pageview
+func EngagementHandler(d *db.DB, ds domain.Storage, en Enricher, a *auth.Service, gif bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req EngagementRequest
+		if !decode(w, r, &req, func(q url.Values) {
+			req.Domain = q.Get("domain")
+			req.Path = q.Get("path")
+			req.Engaged, _ = strconv.ParseInt(q.Get("engaged"), 10, 64)
+			req.Scroll, _ = strconv.ParseInt(q.Get("scroll"), 10, 64)
+		}) {
+			return
+		}
+
+		if req.Domain == "" || req.Path == "" {
+			httpx.JSONError(w, "missing required parameters", http.StatusBadRequest)
+			return
+		}
+
+		e := pageview.Engagement{EngagedMS: req.Engaged, ScrollDepth: req.Scroll}
+		if err := e.Normalize(); err != nil {
+			httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// the visitor is identified the same way as for the pageview
+		in := resolve(w, r, ds, en, a, req.Domain)
+		if in == nil {
+			return
+		}
+
+		since := time.Now().UTC().Add(-pageview.MaxEngagementAge)
+		found, err := d.RecordEngagement(r.Context(), in.domain.ID, in.entry.VisitorID, req.Path, since, e)
+		if err != nil {
+			log.Printf("Failed to record engagement: %v", err)
+			httpx.JSONError(w, "failed to record engagement", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			httpx.JSONError(w, "pageview not found", http.StatusNotFound)
+			return
+		}
+
+		respond(w, gif)
+	}
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/enrichment"
+	"github.com/zackb/updog/httpx"
+)
+
+// Enricher looks up what a tracking request tells about its visitor
+type Enricher interface {
+	Enrich(r *http.Request) (*enrichment.Enrichment, error)
+}
+
+// ingest is a tracking request for a known domain, ready to be recorded
+type ingest struct {
+	// host is the normalized hostname the request was sent from
+	host   string
+	domain *domain.Domain
+	entry  *enrichment.Enrichment
+}
+
+// decode reads a tracking request from the JSON body of a POST, or with fromQuery from the query string of a beacon
+func decode(w http.ResponseWriter, r *http.Request, req any, fromQuery func(q url.Values)) bool {
+	if r.Method != http.MethodPost {
+		fromQuery(r.URL.Query())
+		return true
+	}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		httpx.JSONError(w, "invalid JSON", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// resolve finds the domain a tracking request for name belongs to, which may be one of its aliases or a
+// subdomain it includes, checks the API key of server-side requests and enriches r. It writes an error
+// and returns nil if the request can't be recorded.
+func resolve(w http.ResponseWriter, r *http.Request, ds domain.Storage, en Enricher, a *auth.Service, name string) *ingest {
+	host, err := domain.NormalizeName(name)
+	if err != nil {
+		httpx.JSONError(w, "domain not found", http.StatusNotFound)
+		return nil
+	}
+	d, _ := domain.Resolve(r.Context(), ds, host)
+	if d == nil {
+		httpx.JSONError(w, "domain not found", http.StatusNotFound)
+		return nil
+	}
+
+	if r.Header.Get("Authorization") != "" && !authorizeIngest(w, r, a, ds, d.ID) {
+		return nil
+	}
+
+	entry, err := en.Enrich(r)
+	if httpx.CheckError(w, err) {
+		return nil
+	}
+	return &ingest{host: host, domain: d, entry: entry}
+}
+
+// authorizeIngest checks the API key of a server-side request, writing an error if it can't send them for domainID
+func authorizeIngest(w http.ResponseWriter, r *http.Request, a *auth.Service, ds domain.Storage, domainID string) bool {
+	token := a.IsAuthenticated(r)
+	if token == nil {
+		httpx.JSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if !token.HasScope(auth.ScopeIngestWrite) || !token.AllowsDomain(domainID) {
+		httpx.JSONError(w, "Insufficient scope", http.StatusForbidden)
+		return false
+	}
+	if _, role, err := ds.ReadDomainForUser(r.Context(), domainID, token.ClientId); err != nil || role == "" {
+		httpx.JSONError(w, "Insufficient scope", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// respond acknowledges a tracking request, with a transparent pixel if it was loaded as an image
+func respond(w http.ResponseWriter, gif bool) {
+	if !gif {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Write([]byte{
+		0x47, 0x49, 0x46, 0x38, 0x39, 0x61,
+		0x01, 0x00, 0x01, 0x00,
+		0x80, 0x00, 0x00,
+		0x00, 0x00, 0x00,
+		0xFF, 0xFF, 0xFF,
+		0x21, 0xF9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0x2C, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00,
+		0x02, 0x02, 0x44, 0x01, 0x00, 0x3B,
+	})
+}
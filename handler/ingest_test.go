@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/apikey"
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/db"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/enrichment"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/pageview"
+	"github.com/zackb/updog/user"
+)
+
+// fixedEnricher places every visitor in the same spot without a geo database
+type fixedEnricher struct{}
+
+func (fixedEnricher) Enrich(r *http.Request) (*enrichment.Enrichment, error) {
+	return &enrichment.Enrichment{
+		Country:    &pageview.Country{Name: "US"},
+		Browser:    "Firefox",
+		OS:         "Linux",
+		DeviceType: "desktop",
+		VisitorID:  42,
+	}, nil
+}
+
+func newTestAuth(t *testing.T) *auth.Service {
+	key, err := jwk.New([]byte("0123456789abcdef0123456789abcdef"))
+	assert.NoError(t, err)
+	assert.NoError(t, key.Set(jwk.KeyIDKey, "test"))
+	assert.NoError(t, key.Set(jwk.AlgorithmKey, jwa.HS256))
+	set := jwk.NewSet()
+	set.Add(key)
+	b, err := json.Marshal(set)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, b, 0600))
+
+	a, err := auth.NewAuthService(path, time.Minute)
+	assert.NoError(t, err)
+	return a
+}
+
+func TestIngest(t *testing.T) {
+	store, err := db.NewFileDB(filepath.Join(t.TempDir(), "test.db"))
+	assert.NoError(t, err)
+	ctx := context.Background()
+	a := newTestAuth(t)
+	a.SetAPIKeyValidator(apikey.NewValidator(store))
+
+	owner := &user.User{Email: "owner@example.com"}
+	assert.NoError(t, store.CreateUser(ctx, owner))
+	d := &domain.Domain{ID: id.NewID(), Name: "example.com", UserID: owner.ID, IncludeSubdomains: true}
+	_, err = store.CreateDomain(ctx, d)
+	assert.NoError(t, err)
+
+	var en fixedEnricher
+	mux := http.NewServeMux()
+	mux.Handle("/view", Handler(store, store, en, a, false))
+	mux.Handle("/view.gif", Handler(store, store, en, a, true))
+	mux.Handle("/link", LinkHandler(store, store, en, a, false))
+	mux.Handle("/engage", EngagementHandler(store, store, en, a, false))
+	mux.Handle("/vitals", VitalsHandler(store, store, en, a, false))
+
+	send := func(method, target, body, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	count := func(model any) int {
+		n, err := store.Db.NewSelect().Model(model).Where("domain_id = ?", d.ID).Count(ctx)
+		assert.NoError(t, err)
+		return n
+	}
+
+	t.Run("pageviews", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send(http.MethodPost, "/view", `{"domain":"example.com","path":"/","ref":"https://news.example.org/item"}`, "").Code)
+		w := send(http.MethodGet, "/view.gif?domain=Blog.Example.com&path=/post", "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/gif", w.Header().Get("Content-Type"))
+		assert.Equal(t, 2, count((*pageview.Pageview)(nil)))
+
+		// the subdomain is counted under the domain, by its own hostname
+		var pv pageview.Pageview
+		assert.NoError(t, store.Db.NewSelect().Model(&pv).Relation("Hostname").Relation("Path").Where("path.path = ?", "/post").Scan(ctx))
+		assert.Equal(t, d.ID, pv.DomainID)
+		assert.Equal(t, "blog.example.com", pv.Hostname.Name)
+		assert.Equal(t, int64(42), pv.VisitorID)
+
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/view", `{"domain":`, "").Code)
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/view?domain=example.com", "", "").Code)
+		assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/view?domain=example.net&path=/", "", "").Code)
+		assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/view?domain=not+a+domain&path=/", "", "").Code)
+		assert.Equal(t, 2, count((*pageview.Pageview)(nil)))
+	})
+
+	t.Run("api keys", func(t *testing.T) {
+		ingest, secret := apikey.New(owner.ID, "server", []string{auth.ScopeIngestWrite}, "")
+		assert.NoError(t, store.CreateKey(ctx, ingest))
+		stats, statsSecret := apikey.New(owner.ID, "stats", []string{auth.ScopeStatsRead}, "")
+		assert.NoError(t, store.CreateKey(ctx, stats))
+		outsider := &user.User{Email: "outsider@example.com"}
+		assert.NoError(t, store.CreateUser(ctx, outsider))
+		other, otherSecret := apikey.New(outsider.ID, "server", []string{auth.ScopeIngestWrite}, "")
+		assert.NoError(t, store.CreateKey(ctx, other))
+
+		body := `{"domain":"example.com","path":"/server"}`
+		assert.Equal(t, http.StatusUnauthorized, send(http.MethodPost, "/view", body, auth.APIKeyPrefix+"nope").Code)
+		assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "/view", body, statsSecret).Code)
+		assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "/view", body, otherSecret).Code)
+		assert.Equal(t, http.StatusForbidden, send(http.MethodPost, "/link", `{"domain":"example.com","path":"/","type":"outbound","url":"https://example.org"}`, otherSecret).Code)
+		assert.Equal(t, http.StatusNoContent, send(http.MethodPost, "/view", body, secret).Code)
+		assert.Equal(t, 3, count((*pageview.Pageview)(nil)))
+	})
+
+	t.Run("links", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send(http.MethodGet, "/link?domain=example.com&path=/&type=download&url=https://cdn.example.com/app.zip?v=1", "", "").Code)
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/link", `{"domain":"example.com","path":"/","type":"mailto","url":"mailto:a@example.com"}`, "").Code)
+		assert.Equal(t, http.StatusNotFound, send(http.MethodPost, "/link", `{"domain":"example.net","path":"/","type":"outbound","url":"https://example.org"}`, "").Code)
+
+		var clicks []*pageview.LinkClick
+		assert.NoError(t, store.Db.NewSelect().Model(&clicks).Scan(ctx))
+		if assert.Len(t, clicks, 1) {
+			assert.Equal(t, "https://cdn.example.com/app.zip", clicks[0].URL)
+			assert.Equal(t, d.ID, clicks[0].DomainID)
+		}
+	})
+
+	t.Run("engagement", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/engage?domain=example.com&path=/never&engaged=1000&scroll=50", "", "").Code)
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/engage", `{"domain":"example.com","path":"/","engaged":-1}`, "").Code)
+		assert.Equal(t, http.StatusNoContent, send(http.MethodPost, "/engage", `{"domain":"example.com","path":"/","engaged":1500,"scroll":80}`, "").Code)
+
+		var pv pageview.Pageview
+		assert.NoError(t, store.Db.NewSelect().Model(&pv).Relation("Path").Where("path.path = ?", "/").Scan(ctx))
+		assert.Equal(t, int64(1500), pv.EngagedMS)
+		assert.Equal(t, int64(80), pv.ScrollDepth)
+	})
+
+	t.Run("vitals", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, send(http.MethodGet, "/vitals?domain=example.com&path=/&lcp=1200&cls=0.05", "", "").Code)
+		assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/vitals", `{"domain":"example.com","path":"/"}`, "").Code)
+		assert.Equal(t, 1, count((*pageview.WebVital)(nil)))
+	})
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/db"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/pageview"
+)
+
+type LinkRequest struct {
+	Domain string `json:"domain"`
+	// Path is the page the link was clicked on
+	Path string `json:"path"`
+	Kind string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// LinkHandler handles the outbound link and download clicks the tracker reports
+func LinkHandler(d *db.DB, ds domain.Storage, en Enricher, a *auth.Service, gif bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req LinkRequest
+		if !decode(w, r, &req, func(q url.Values) {
+			req.Domain = q.Get("domain")
+			req.Path = q.Get("path")
+			req.Kind = q.Get("type")
+			req.URL = q.Get("url")
+		}) {
+			return
+		}
+
+		if req.Domain == "" || req.Path == "" || req.URL == "" {
+			httpx.JSONError(w, "missing required parameters", http.StatusBadRequest)
+			return
+		}
+
+		click, err := pageview.ParseLink(req.Kind, req.URL)
+		if err != nil {
+			httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		in := resolve(w, r, ds, en, a, req.Domain)
+		if in == nil {
+			return
+		}
+
+		country := in.entry.Country
+		_ = db.GetOrCreateDimension(r.Context(), d, country, "name", country.Name)
+
+		path := &pageview.Path{Path: req.Path}
+		_ = db.GetOrCreateDimension(r.Context(), d, path, "path", path.Path)
+
+		click.DomainID = in.domain.ID
+		click.PathID = path.ID
+		click.CountryID = country.ID
+		click.VisitorID = in.entry.VisitorID
+		click.Timestamp = time.Now().UTC()
+
+		if _, err := d.Db.NewInsert().Model(click).Exec(r.Context()); err != nil {
+			httpx.JSONError(w, "failed to insert link click", http.StatusInternalServerError)
+			return
+		}
+
+		respond(w, gif)
+	}
+}
@@ -1,16 +1,15 @@
 package handler
 
 import (
-	"encoding/json"
 	"log"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/zackb/updog/auth"
 	"github.com/zackb/updog/db"
 	"github.com/zackb/updog/domain"
-	"github.com/zackb/updog/enrichment"
 	"github.com/zackb/updog/httpx"
 	"github.com/zackb/updog/pageview"
 )
@@ -21,21 +20,18 @@ type PageviewRequest struct {
 	Referrer string `json:"ref"`
 }
 
-// Handler handles incoming pageview tracking requests.
-func Handler(d *db.DB, ds domain.Storage, en *enrichment.Enricher, gif bool) http.HandlerFunc {
+// Handler handles incoming pageview tracking requests. Browsers send them
+// anonymously, servers can authenticate with an API key with the ingest scope.
+func Handler(d *db.DB, ds domain.Storage, en Enricher, a *auth.Service, gif bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		var req PageviewRequest
-
-		if r.Method == http.MethodPost {
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-				httpx.JSONError(w, "invalid JSON", http.StatusBadRequest)
-				return
-			}
-		} else {
-			req.Domain = r.URL.Query().Get("domain")
-			req.Path = r.URL.Query().Get("path")
-			req.Referrer = r.URL.Query().Get("ref")
+		if !decode(w, r, &req, func(q url.Values) {
+			req.Domain = q.Get("domain")
+			req.Path = q.Get("path")
+			req.Referrer = q.Get("ref")
+		}) {
+			return
 		}
 
 		if req.Domain == "" || req.Path == "" {
@@ -67,17 +63,11 @@ func Handler(d *db.DB, ds domain.Storage, en *enrichment.Enricher, gif bool) htt
 			}
 		}
 
-		dsomain, _ := ds.ReadDomainByName(r.Context(), req.Domain)
-		if dsomain == nil {
-			httpx.JSONError(w, "domain not found", http.StatusNotFound)
-			return
-		}
-
-		entry, err := en.Enrich(r)
-
-		if httpx.CheckError(w, err) {
+		in := resolve(w, r, ds, en, a, req.Domain)
+		if in == nil {
 			return
 		}
+		entry := in.entry
 
 		country := entry.Country
 		_ = db.GetOrCreateDimension(r.Context(), d, country, "name", country.Name)
@@ -86,7 +76,7 @@ func Handler(d *db.DB, ds domain.Storage, en *enrichment.Enricher, gif bool) htt
 
 		if region != nil {
 			region.CountryID = country.ID
-			err = db.GetOrCreateRegion(r.Context(), d, region)
+			err := db.GetOrCreateRegion(r.Context(), d, region)
 			if err != nil {
 				log.Printf("Failed to get or create region: %v", err)
 			}
@@ -97,7 +87,7 @@ func Handler(d *db.DB, ds domain.Storage, en *enrichment.Enricher, gif bool) htt
 		city := entry.City
 		if city != nil {
 			city.RegionID = region.ID
-			err = db.GetOrCreateCity(r.Context(), d, city)
+			err := db.GetOrCreateCity(r.Context(), d, city)
 			if err != nil {
 				log.Printf("Failed to get or create city: %v", err)
 			}
@@ -130,10 +120,14 @@ func Handler(d *db.DB, ds domain.Storage, en *enrichment.Enricher, gif bool) htt
 		path := &pageview.Path{Path: req.Path}
 		_ = db.GetOrCreateDimension(r.Context(), d, path, "path", path.Path)
 
+		hostname := &pageview.Hostname{Name: in.host}
+		_ = db.GetOrCreateDimension(r.Context(), d, hostname, "name", hostname.Name)
+
 		// Insert Pageview
 		pv := &pageview.Pageview{
-			DomainID:     dsomain.ID,
+			DomainID:     in.domain.ID,
 			PathID:       path.ID,
+			HostnameID:   hostname.ID,
 			CountryID:    country.ID,
 			RegionID:     region.ID,
 			CityID:       city.ID,
@@ -153,21 +147,6 @@ func Handler(d *db.DB, ds domain.Storage, en *enrichment.Enricher, gif bool) htt
 			return
 		}
 
-		if gif {
-			w.Header().Set("Content-Type", "image/gif")
-			w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-			w.Write([]byte{
-				0x47, 0x49, 0x46, 0x38, 0x39, 0x61,
-				0x01, 0x00, 0x01, 0x00,
-				0x80, 0x00, 0x00,
-				0x00, 0x00, 0x00,
-				0xFF, 0xFF, 0xFF,
-				0x21, 0xF9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00,
-				0x2C, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00,
-				0x02, 0x02, 0x44, 0x01, 0x00, 0x3B,
-			})
-		} else {
-			w.WriteHeader(http.StatusNoContent)
-		}
+		respond(w, gif)
 	}
 }
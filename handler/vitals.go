@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/db"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/pageview"
+)
+
+// VitalsRequest carries the Core Web Vitals of a pageview, those the browser couldn't measure are left out
+type VitalsRequest struct {
+	Domain string   `json:"domain"`
+	Path   string   `json:"path"`
+	LCP    *float64 `json:"lcp"`
+	INP    *float64 `json:"inp"`
+	CLS    *float64 `json:"cls"`
+	TTFB   *float64 `json:"ttfb"`
+	FCP    *float64 `json:"fcp"`
+}
+
+// VitalsHandler records the Core Web Vitals the tracker measures once a page is first hidden
+func VitalsHandler(d *db.DB, ds domain.Storage, en Enricher, a *auth.Service, gif bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req VitalsRequest
+		if !decode(w, r, &req, func(q url.Values) {
+			req.Domain = q.Get("domain")
+			req.Path = q.Get("path")
+			req.LCP = queryFloat(q.Get("lcp"))
+			req.INP = queryFloat(q.Get("inp"))
+			req.CLS = queryFloat(q.Get("cls"))
+			req.TTFB = queryFloat(q.Get("ttfb"))
+			req.FCP = queryFloat(q.Get("fcp"))
+		}) {
+			return
+		}
+
+		if req.Domain == "" || req.Path == "" {
+			httpx.JSONError(w, "missing required parameters", http.StatusBadRequest)
+			return
+		}
+
+		vital := &pageview.WebVital{LCP: req.LCP, INP: req.INP, CLS: req.CLS, TTFB: req.TTFB, FCP: req.FCP}
+		if err := vital.Normalize(); err != nil {
+			httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		in := resolve(w, r, ds, en, a, req.Domain)
+		if in == nil {
+			return
+		}
+
+		country := in.entry.Country
+		_ = db.GetOrCreateDimension(r.Context(), d, country, "name", country.Name)
+
+		deviceType := &pageview.DeviceType{Name: in.entry.DeviceType}
+		_ = db.GetOrCreateDimension(r.Context(), d, deviceType, "name", deviceType.Name)
+
+		path := &pageview.Path{Path: req.Path}
+		_ = db.GetOrCreateDimension(r.Context(), d, path, "path", path.Path)
+
+		vital.DomainID = in.domain.ID
+		vital.PathID = path.ID
+		vital.DeviceTypeID = deviceType.ID
+		vital.CountryID = country.ID
+		vital.Timestamp = time.Now().UTC()
+
+		if _, err := d.Db.NewInsert().Model(vital).Exec(r.Context()); err != nil {
+			httpx.JSONError(w, "failed to insert web vitals", http.StatusInternalServerError)
+			return
+		}
+
+		respond(w, gif)
+	}
+}
+
+// queryFloat parses an optional query parameter, nil if it's missing or not a number
+func queryFloat(s string) *float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
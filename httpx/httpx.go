@@ -2,8 +2,15 @@ package httpx
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/zackb/updog/env"
 )
 
 const (
@@ -48,3 +55,113 @@ func UserIDFromRequest(r *http.Request) string {
 	}
 	return ""
 }
+
+// trustedProxies are the reverse proxies whose forwarding headers are believed, set once at startup
+var trustedProxies []netip.Prefix
+
+// untrustedForwarding warns once that forwarding headers are ignored as no proxy is trusted
+var untrustedForwarding sync.Once
+
+// ParseTrustedProxies parses comma separated IPs or CIDR ranges, such as TRUSTED_PROXIES
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, entry := range strings.Split(s, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(entry)
+			if aerr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		proxies = append(proxies, p.Masked())
+	}
+	return proxies, nil
+}
+
+// SetTrustedProxies sets the reverse proxies whose forwarding headers are believed,
+// before the server starts
+func SetTrustedProxies(proxies []netip.Prefix) {
+	trustedProxies = proxies
+}
+
+// fromTrustedProxy is true if r was forwarded by one of the trusted proxies, only then
+// can its forwarding headers be believed as anyone else could set them to whatever they like
+func fromTrustedProxy(r *http.Request) bool {
+	if trusted(remoteHost(r)) {
+		return true
+	}
+	if len(trustedProxies) == 0 && (r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("X-Real-IP") != "") {
+		untrustedForwarding.Do(func() {
+			log.Printf("WARNING: ignoring X-Forwarded-For from %s, set TRUSTED_PROXIES to the addresses of your reverse proxies so visitors' own addresses are used", remoteHost(r))
+		})
+	}
+	return false
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientIP extracts the client's real IP address from the request.
+// X-Forwarded-For and X-Real-IP are only believed from trusted proxies, otherwise it's RemoteAddr.
+func ClientIP(r *http.Request) string {
+	host := remoteHost(r)
+	if !fromTrustedProxy(r) {
+		return host
+	}
+
+	// each proxy appends who it got the request from, the client is the last one that isn't a proxy
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		ips := strings.Split(fwd, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if ip == "" {
+				continue
+			}
+			if i == 0 || !trusted(ip) {
+				return ip
+			}
+		}
+	}
+
+	if real := r.Header.Get("X-Real-IP"); real != "" {
+		return strings.TrimSpace(real)
+	}
+	return host
+}
+
+// trusted is true if ip is one of the trusted proxies
+func trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// BaseURL is the public URL of the instance, BASE_URL if set otherwise taken from the request.
+// X-Forwarded-Proto is only believed from trusted proxies.
+func BaseURL(r *http.Request) string {
+	if base := env.GetBaseURL(); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || (r.Header.Get("X-Forwarded-Proto") == "https" && fromTrustedProxy(r)) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
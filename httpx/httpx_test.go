@@ -0,0 +1,59 @@
+package httpx
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies(" 10.0.0.0/8, 192.0.2.1,,::1 ")
+	assert.NoError(t, err)
+	if assert.Len(t, proxies, 3) {
+		assert.Equal(t, "10.0.0.0/8", proxies[0].String())
+		assert.Equal(t, "192.0.2.1/32", proxies[1].String())
+		assert.Equal(t, "::1/128", proxies[2].String())
+	}
+
+	_, err = ParseTrustedProxies("10.0.0.0/8,proxy.internal")
+	assert.Error(t, err)
+
+	proxies, err = ParseTrustedProxies("")
+	assert.NoError(t, err)
+	assert.Empty(t, proxies)
+}
+
+func TestBaseURL_ForwardedProto(t *testing.T) {
+	t.Setenv("BASE_URL", "")
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Host = "updog.example.com"
+	r.RemoteAddr = "10.1.2.3:1234"
+	r.Header.Set("X-Forwarded-Proto", "https")
+
+	// anyone could send the header
+	assert.Equal(t, "http://updog.example.com", BaseURL(r))
+
+	proxies, err := ParseTrustedProxies("10.0.0.0/8")
+	assert.NoError(t, err)
+	SetTrustedProxies(proxies)
+	t.Cleanup(func() { SetTrustedProxies(nil) })
+	assert.Equal(t, "https://updog.example.com", BaseURL(r))
+
+	t.Setenv("BASE_URL", "https://stats.example.com/")
+	assert.Equal(t, "https://stats.example.com", BaseURL(r))
+}
+
+func TestParseEndTimeParam(t *testing.T) {
+	end, err := ParseEndTimeParam("2025-11-29")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 11, 30, 0, 0, 0, 0, time.UTC), end)
+
+	end, err = ParseEndTimeParam("2025-11-29T19:42:07Z")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 11, 29, 19, 42, 7, 0, time.UTC), end)
+
+	_, err = ParseEndTimeParam("yesterday")
+	assert.Error(t, err)
+}
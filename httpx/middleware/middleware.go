@@ -9,6 +9,10 @@ import (
 	"github.com/zackb/updog/httpx"
 )
 
+type contextKey string
+
+const contextKeyToken contextKey = "token"
+
 func LoggerMiddleware(next http.Handler) http.Handler {
 	return mw.Logger(next)
 }
@@ -53,7 +57,28 @@ func AuthMiddleware(a *auth.Service) func(http.Handler) http.Handler {
 			}
 
 			ctx := context.WithValue(r.Context(), httpx.ContextKeyUserID, token.ClientId)
+			ctx = context.WithValue(ctx, contextKeyToken, token)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// RequireScope rejects tokens that grant none of scopes, it must come after AuthMiddleware
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := TokenFromRequest(r)
+			if token == nil || !token.HasScope(scopes...) {
+				httpx.JSONError(w, "Insufficient scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TokenFromRequest returns the token AuthMiddleware authenticated the request with
+func TokenFromRequest(r *http.Request) *auth.Token {
+	t, _ := r.Context().Value(contextKeyToken).(*auth.Token)
+	return t
+}
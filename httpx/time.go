@@ -62,3 +62,12 @@ func ParseTimeParam(param string) (time.Time, error) {
 
 	return time.Time{}, fmt.Errorf("invalid time format: %s", param)
 }
+
+// ParseEndTimeParam parses the end of a range like ParseTimeParam. The end is exclusive, so a date
+// on its own becomes the start of the next day and that whole day is included.
+func ParseEndTimeParam(param string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", param); err == nil {
+		return t.AddDate(0, 0, 1).UTC(), nil
+	}
+	return ParseTimeParam(param)
+}
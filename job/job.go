@@ -6,7 +6,10 @@ import (
 	"time"
 
 	"github.com/robfig/cron/v3"
+	"github.com/zackb/updog/backup"
 	"github.com/zackb/updog/db"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/lockout"
 )
 
 type Job struct {
@@ -61,6 +64,79 @@ func (s *Scheduler) AddDefaultJobs(store *db.DB) {
 		log.Println("Error adding daily rollup job to scheduler:", err)
 	}
 
+	// forget revoked tokens once they've expired anyway, hourly
+	revocationJob := &Job{
+		Func: func() {
+			n, err := store.RevocationStorage().DeleteExpiredRevocations(context.Background(), time.Now().UTC())
+			if err != nil {
+				log.Println("Error deleting expired token revocations:", err)
+			} else if n > 0 {
+				log.Printf("Deleted %d expired token revocation(s).", n)
+			}
+		},
+		CronExpr: "17 * * * *",
+	}
+
+	err = s.AddJob(revocationJob)
+	if err != nil {
+		log.Println("Error adding token revocation cleanup job to scheduler:", err)
+	}
+
+	// delete expired and revoked sessions with their refresh tokens, hourly
+	sessionJob := &Job{
+		Func: func() {
+			n, err := store.SessionStorage().DeleteExpiredSessions(context.Background(), time.Now().UTC())
+			if err != nil {
+				log.Println("Error deleting expired sessions:", err)
+			} else if n > 0 {
+				log.Printf("Deleted %d expired session(s).", n)
+			}
+		},
+		CronExpr: "23 * * * *",
+	}
+
+	err = s.AddJob(sessionJob)
+	if err != nil {
+		log.Println("Error adding session cleanup job to scheduler:", err)
+	}
+
+	// forget failed logins that are no longer counted or locked, hourly
+	lockoutJob := &Job{
+		Func: func() {
+			now := time.Now().UTC()
+			n, err := store.LockoutStorage().DeleteStaleLoginAttempts(context.Background(), lockout.Stale(now), now)
+			if err != nil {
+				log.Println("Error deleting stale login attempts:", err)
+			} else if n > 0 {
+				log.Printf("Deleted %d stale login attempt(s).", n)
+			}
+		},
+		CronExpr: "29 * * * *",
+	}
+
+	err = s.AddJob(lockoutJob)
+	if err != nil {
+		log.Println("Error adding login attempt cleanup job to scheduler:", err)
+	}
+
+	// check verified domains still publish their tokens, daily
+	reverifyJob := &Job{
+		Func: func() {
+			checked, unverified, err := domain.Reverify(context.Background(), store.DomainStorage(), store.AuditStorage(), domain.NewVerifier(), time.Now().UTC())
+			if err != nil {
+				log.Println("Error re-verifying domains:", err)
+			} else {
+				log.Printf("Re-verified %d domain(s), %d unverified.", checked, unverified)
+			}
+		},
+		CronExpr: "41 3 * * *",
+	}
+
+	err = s.AddJob(reverifyJob)
+	if err != nil {
+		log.Println("Error adding domain re-verification job to scheduler:", err)
+	}
+
 	// test job runs every 15 minutes
 	testJob := &Job{
 		Func: func() {
@@ -75,6 +151,28 @@ func (s *Scheduler) AddDefaultJobs(store *db.DB) {
 	}
 }
 
+// AddBackupJob schedules a backup into dir, keeping only the newest keep archives.
+func (s *Scheduler) AddBackupJob(store *db.DB, dir, cronExpr string, keep int, opts backup.Options) error {
+	backupJob := &Job{
+		Func: func() {
+			log.Println("Starting scheduled backup job...")
+			path, err := backup.CreateFile(context.Background(), store, dir, opts)
+			if err != nil {
+				log.Println("Error running backup job:", err)
+				return
+			}
+			log.Println("Backup written to", path)
+
+			if err := backup.Rotate(dir, keep); err != nil {
+				log.Println("Error rotating backups:", err)
+			}
+		},
+		CronExpr: cronExpr,
+	}
+
+	return s.AddJob(backupJob)
+}
+
 func (s *Scheduler) Start() {
 	s.c.Start()
 }
@@ -0,0 +1,183 @@
+// Package lockout slows down password guessing by locking out emails, IPs and accounts
+// for longer and longer after repeated failed attempts
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/httpx"
+)
+
+// Message is shown while locked out, the same whether or not the account exists
+const Message = "Too many failed attempts, please try again later"
+
+// Kinds of keys attempts are counted against
+const (
+	KindEmail = "email"
+	KindIP    = "ip"
+	KindUser  = "user"
+)
+
+// Policy is how many attempts are free before a key is locked, and for how long.
+// Each failure after that doubles the lock, up to Max. Failures are forgotten after Window.
+type Policy struct {
+	Free   int
+	Base   time.Duration
+	Max    time.Duration
+	Window time.Duration
+}
+
+var (
+	// EmailPolicy protects an account from guessing its password
+	EmailPolicy = Policy{Free: 5, Base: time.Minute, Max: time.Hour, Window: 24 * time.Hour}
+	// IPPolicy slows down trying many accounts from one address, which may be shared
+	IPPolicy = Policy{Free: 20, Base: time.Minute, Max: time.Hour, Window: 24 * time.Hour}
+	// TwoFactorPolicy protects the second factor of a user whose password is known
+	TwoFactorPolicy = Policy{Free: 5, Base: time.Minute, Max: time.Hour, Window: 24 * time.Hour}
+)
+
+// lockFor is how long the failures'th failure locks for
+func (p Policy) lockFor(failures int) time.Duration {
+	if failures < p.Free {
+		return 0
+	}
+	d := p.Base
+	for i := p.Free; i < failures && d < p.Max; i++ {
+		d *= 2
+	}
+	return min(d, p.Max)
+}
+
+// Key is something failed attempts are counted against
+type Key struct {
+	Kind   string
+	Value  string
+	Policy Policy
+}
+
+func (k Key) String() string {
+	return k.Kind + ":" + k.Value
+}
+
+func EmailKey(email string) Key {
+	return Key{Kind: KindEmail, Value: strings.ToLower(strings.TrimSpace(email)), Policy: EmailPolicy}
+}
+
+func IPKey(ip string) Key {
+	return Key{Kind: KindIP, Value: ip, Policy: IPPolicy}
+}
+
+// UserKey counts failed second factor codes of a user
+func UserKey(userID string) Key {
+	return Key{Kind: KindUser, Value: userID, Policy: TwoFactorPolicy}
+}
+
+// LoginKeys are the keys a password login for email from r counts against
+func LoginKeys(r *http.Request, email string) []Key {
+	return []Key{EmailKey(email), IPKey(httpx.ClientIP(r))}
+}
+
+// TwoFactorKeys are the keys a second factor code for userID from r counts against
+func TwoFactorKeys(r *http.Request, userID string) []Key {
+	return []Key{UserKey(userID), IPKey(httpx.ClientIP(r))}
+}
+
+// Attempt is the failed attempts counted against a key
+type Attempt struct {
+	bun.BaseModel `bun:"table:login_attempts"`
+
+	Key          string    `bun:",pk" json:"key"`
+	Failures     int       `bun:",notnull" json:"failures"`
+	LastFailedAt time.Time `bun:",notnull" json:"last_failed_at"`
+	LockedUntil  time.Time `bun:",nullzero" json:"locked_until"`
+}
+
+// Guard counts failed attempts. Storage errors are logged and let the attempt through,
+// logging in shouldn't break because of them.
+type Guard struct {
+	store      Storage
+	auditStore audit.Storage
+}
+
+func NewGuard(store Storage, auditStore audit.Storage) *Guard {
+	return &Guard{
+		store:      store,
+		auditStore: auditStore,
+	}
+}
+
+// Wait is how long until none of keys is locked, 0 if an attempt can be made now
+func (g *Guard) Wait(ctx context.Context, keys ...Key) time.Duration {
+	var wait time.Duration
+	now := time.Now().UTC()
+	for _, key := range keys {
+		a, err := g.store.ReadLoginAttempt(ctx, key.String())
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to read login attempts: %v", err)
+			continue
+		}
+		if a.LockedUntil.After(now) {
+			wait = max(wait, a.LockedUntil.Sub(now))
+		}
+	}
+	return wait
+}
+
+// Fail counts a failed attempt from r against keys and audits the lockouts it causes.
+// userID is the account the attempt was for, empty if there's none.
+func (g *Guard) Fail(r *http.Request, userID string, keys ...Key) {
+	ctx := r.Context()
+	now := time.Now().UTC()
+	for _, key := range keys {
+		// counted in one statement so parallel guesses can't overwrite each other's failures
+		a, err := g.store.FailLoginAttempt(ctx, key.String(), now, now.Add(-key.Policy.Window))
+		if err != nil {
+			log.Printf("Failed to save login attempts: %v", err)
+			continue
+		}
+
+		lock := key.Policy.lockFor(a.Failures)
+		if lock > 0 {
+			a.LockedUntil = now.Add(lock)
+			if err := g.store.LockLoginAttempt(ctx, a.Key, a.LockedUntil); err != nil {
+				log.Printf("Failed to save login attempts: %v", err)
+				continue
+			}
+
+			targetType, targetID := key.Kind, key.Value
+			if userID != "" && key.Kind != KindIP {
+				targetType, targetID = audit.TargetUser, userID
+			}
+			audit.Record(ctx, g.auditStore, audit.NewEntry(r, userID, audit.ActionLoginLockout, targetType, targetID, map[string]any{
+				"key":          key.String(),
+				"failures":     a.Failures,
+				"locked_until": a.LockedUntil,
+			}))
+		}
+	}
+}
+
+// Succeed forgets the failed attempts against keys after a successful attempt
+func (g *Guard) Succeed(ctx context.Context, keys ...Key) {
+	for _, key := range keys {
+		if err := g.store.DeleteLoginAttempt(ctx, key.String()); err != nil {
+			log.Printf("Failed to reset login attempts: %v", err)
+		}
+	}
+}
+
+// Stale is when failures that started before are forgotten by cleanup
+func Stale(now time.Time) time.Time {
+	return now.Add(-max(EmailPolicy.Window, IPPolicy.Window, TwoFactorPolicy.Window))
+}
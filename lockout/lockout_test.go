@@ -0,0 +1,41 @@
+package lockout
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/httpx"
+)
+
+func TestLockFor(t *testing.T) {
+	p := Policy{Free: 3, Base: time.Minute, Max: 10 * time.Minute}
+	assert.Equal(t, time.Duration(0), p.lockFor(2))
+	assert.Equal(t, time.Minute, p.lockFor(3))
+	assert.Equal(t, 2*time.Minute, p.lockFor(4))
+	assert.Equal(t, 8*time.Minute, p.lockFor(6))
+	assert.Equal(t, 10*time.Minute, p.lockFor(7))
+	assert.Equal(t, 10*time.Minute, p.lockFor(1000))
+}
+
+func TestLoginKeys_ForwardedFor(t *testing.T) {
+	r := httptest.NewRequest("POST", "/login", nil)
+	r.RemoteAddr = "198.51.100.7:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.1")
+	r.Header.Set("X-Real-IP", "203.0.113.2")
+
+	// a client can't pick its own address to dodge the per-address lock
+	assert.Equal(t, IPKey("198.51.100.7"), LoginKeys(r, "alice@example.com")[1])
+
+	// behind a proxy the address it was forwarded for counts, skipping proxies and ignoring what the client claimed
+	proxies, err := httpx.ParseTrustedProxies("198.51.100.0/24, 10.0.0.1")
+	assert.NoError(t, err)
+	httpx.SetTrustedProxies(proxies)
+	t.Cleanup(func() { httpx.SetTrustedProxies(nil) })
+	r.Header.Set("X-Forwarded-For", "203.0.113.9, 203.0.113.1, 10.0.0.1")
+	assert.Equal(t, IPKey("203.0.113.1"), LoginKeys(r, "alice@example.com")[1])
+
+	r.Header.Del("X-Forwarded-For")
+	assert.Equal(t, IPKey("203.0.113.2"), TwoFactorKeys(r, "user-1")[1])
+}
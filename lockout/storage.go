@@ -0,0 +1,18 @@
+package lockout
+
+import (
+	"context"
+	"time"
+)
+
+type Storage interface {
+	ReadLoginAttempt(ctx context.Context, key string) (*Attempt, error)
+	// FailLoginAttempt atomically counts a failure against key at now, starting over if the last one was before windowStart,
+	// and returns the attempt after counting it
+	FailLoginAttempt(ctx context.Context, key string, now, windowStart time.Time) (*Attempt, error)
+	// LockLoginAttempt locks key until, unless it's already locked for longer
+	LockLoginAttempt(ctx context.Context, key string, until time.Time) error
+	DeleteLoginAttempt(ctx context.Context, key string) error
+	// DeleteStaleLoginAttempts deletes attempts last failed before, that aren't locked at now
+	DeleteStaleLoginAttempts(ctx context.Context, before, now time.Time) (int, error)
+}
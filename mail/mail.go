@@ -0,0 +1,118 @@
+// Package mail sends the emails updog needs, such as account confirmations and invitations
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/zackb/updog/env"
+)
+
+// ErrNoBaseURL is returned for emails with links while BASE_URL isn't set. Links aren't built from the
+// request's Host header, or anyone asking for an email could point its link at their own server.
+var ErrNoBaseURL = errors.New("BASE_URL must be set to send emails with links")
+
+// BaseURL is the public URL of the instance that links in emails point to
+func BaseURL() (string, error) {
+	base := strings.TrimSuffix(env.GetBaseURL(), "/")
+	if base == "" {
+		return "", ErrNoBaseURL
+	}
+	return base, nil
+}
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// NewSender sends through the SMTP server in the environment, or only logs messages if there's none
+func NewSender() Sender {
+	host := env.GetSMTPHost()
+	if host == "" {
+		return LogSender{}
+	}
+	return &SMTPSender{
+		Addr:     net.JoinHostPort(host, fmt.Sprint(env.GetSMTPPort())),
+		Username: env.GetSMTPUsername(),
+		Password: env.GetSMTPPassword(),
+		From:     env.GetMailFrom(),
+	}
+}
+
+// LogSender writes messages to the log instead of sending them, for development
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, msg *Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPSender sends messages through an SMTP server, using STARTTLS when the server offers it
+type SMTPSender struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg *Message) error {
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", s.From, err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", msg.To, err)
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	// net/smtp doesn't take a context, run it in the background so callers aren't held up past their deadline
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.Addr, auth, from.Address, []string{to.Address}, format(from, to, msg))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// format builds the message with its headers, lines end in CRLF as SMTP requires
+func format(from, to *mail.Address, msg *Message) []byte {
+	var b strings.Builder
+	header := func(k, v string) {
+		b.WriteString(k + ": " + v + "\r\n")
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,77 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSMTP accepts a single message on a local port and sends what it received on the channel
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		c := textproto.NewConn(conn)
+		var transcript strings.Builder
+
+		c.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+			transcript.WriteString(line + "\n")
+			switch {
+			case strings.HasPrefix(line, "EHLO"), strings.HasPrefix(line, "HELO"):
+				c.PrintfLine("250 localhost")
+			case line == "DATA":
+				c.PrintfLine("354 go ahead")
+				data, err := c.ReadDotLines()
+				if err != nil {
+					return
+				}
+				transcript.WriteString(strings.Join(data, "\n"))
+				c.PrintfLine("250 queued")
+			case line == "QUIT":
+				c.PrintfLine("221 bye")
+				received <- transcript.String()
+				return
+			default:
+				c.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return l.Addr().String(), received
+}
+
+func TestSMTPSender(t *testing.T) {
+	addr, received := fakeSMTP(t)
+
+	s := &SMTPSender{Addr: addr, From: "Updog <updog@example.com>"}
+	err := s.Send(context.Background(), VerifyEmail("alice@example.com", "https://updog.example.com/verify-email?token=abc"))
+	assert.NoError(t, err)
+
+	transcript := <-received
+	assert.Contains(t, transcript, "MAIL FROM:<updog@example.com>")
+	assert.Contains(t, transcript, "RCPT TO:<alice@example.com>")
+	assert.Contains(t, transcript, "Subject: Confirm your email address")
+	assert.Contains(t, transcript, "https://updog.example.com/verify-email?token=abc")
+}
+
+func TestSMTPSenderRejectsInvalidAddresses(t *testing.T) {
+	s := &SMTPSender{Addr: "127.0.0.1:1", From: "updog@example.com"}
+	err := s.Send(context.Background(), &Message{To: "not an address\r\nBcc: x@example.com"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package mail
+
+import "fmt"
+
+// VerifyEmail asks the owner of to to confirm their address by opening link
+func VerifyEmail(to, link string) *Message {
+	return &Message{
+		To:      to,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf(`Confirm this is your email address for Updog by opening the link below:
+
+%s
+
+If you didn't sign up or change your email, you can ignore this message.
+`, link),
+	}
+}
+
+// ResetPassword sends a link to set a new password
+func ResetPassword(to, link string) *Message {
+	return &Message{
+		To:      to,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(`Someone asked to reset the password of your Updog account. Open the link below to choose a new one:
+
+%s
+
+The link works once and expires in an hour. If you didn't ask for it, you can ignore this message, your password hasn't changed.
+`, link),
+	}
+}
+
+// Invitation invites to to join teamName
+func Invitation(to, teamName, role, link string) *Message {
+	return &Message{
+		To:      to,
+		Subject: fmt.Sprintf("You've been invited to join %s", teamName),
+		Body: fmt.Sprintf(`You've been invited to join the team %s on Updog as %s.
+
+Accept the invitation by opening the link below, logged in with this email address:
+
+%s
+`, teamName, role, link),
+	}
+}
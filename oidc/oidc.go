@@ -0,0 +1,318 @@
+// Package oidc signs users in with an OpenID Connect provider using the authorization code flow with PKCE
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/zackb/updog/env"
+)
+
+// keysRefresh limits how often the provider's keys are fetched again for a token signed by an unknown key
+const keysRefresh = time.Minute
+
+var ErrInvalidToken = errors.New("invalid id token")
+
+// Config is the client registered with the provider
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered with the provider, derived from each request if empty
+	RedirectURL string
+	// Name labels the sign in button
+	Name string
+	// AllowedDomains limits sign in to emails at these domains, any if empty
+	AllowedDomains []string
+}
+
+// ConfigFromEnv reads the provider from the environment, nil if single sign-on isn't configured
+func ConfigFromEnv() *Config {
+	if env.GetOIDCIssuer() == "" {
+		return nil
+	}
+	return &Config{
+		Issuer:         env.GetOIDCIssuer(),
+		ClientID:       env.GetOIDCClientID(),
+		ClientSecret:   env.GetOIDCClientSecret(),
+		RedirectURL:    env.GetOIDCRedirectURL(),
+		Name:           env.GetOIDCName(),
+		AllowedDomains: env.GetOIDCAllowedDomains(),
+	}
+}
+
+// metadata is the part of the provider's discovery document we use
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is a discovered OpenID Connect provider
+type Provider struct {
+	config   *Config
+	client   *http.Client
+	metadata metadata
+
+	mu          sync.Mutex
+	keys        jwk.Set
+	keysFetched time.Time
+}
+
+// NewProvider discovers the provider's endpoints from its issuer URL
+func NewProvider(ctx context.Context, config *Config, client *http.Client) (*Provider, error) {
+	if config.ClientID == "" {
+		return nil, errors.New("oidc client id is required")
+	}
+
+	p := &Provider{config: config, client: client}
+	discovery := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, discovery, &p.metadata); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(p.metadata.Issuer, "/") != strings.TrimSuffix(config.Issuer, "/") {
+		return nil, fmt.Errorf("oidc discovery: issuer %q doesn't match %q", p.metadata.Issuer, config.Issuer)
+	}
+	if p.metadata.AuthorizationEndpoint == "" || p.metadata.TokenEndpoint == "" || p.metadata.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: provider metadata is incomplete")
+	}
+	return p, nil
+}
+
+func (p *Provider) Config() *Config {
+	return p.config
+}
+
+// Issuer identifies the provider in the accounts linked to it
+func (p *Provider) Issuer() string {
+	return p.metadata.Issuer
+}
+
+// AuthRequest is what the callback needs to finish a sign in started with AuthURL,
+// it's kept in the browser until the provider redirects back
+type AuthRequest struct {
+	State    string
+	Nonce    string
+	Verifier string
+	// Next is the page to go to after signing in
+	Next string
+}
+
+func NewAuthRequest(next string) *AuthRequest {
+	return &AuthRequest{
+		State:    randomString(),
+		Nonce:    randomString(),
+		Verifier: randomString(),
+		Next:     next,
+	}
+}
+
+// AuthURL is the provider's page to sign in at, it redirects back to redirectURL with a code
+func (p *Provider) AuthURL(req *AuthRequest, redirectURL string) string {
+	challenge := sha256.Sum256([]byte(req.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {"openid email profile"},
+		"state":                 {req.State},
+		"nonce":                 {req.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.metadata.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Claims identify the user who signed in
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Exchange redeems the code from the provider's redirect and validates the id token it returns
+func (p *Provider) Exchange(ctx context.Context, req *AuthRequest, code, redirectURL string) (*Claims, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"code_verifier": {req.Verifier},
+		"client_id":     {p.config.ClientID},
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		r.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("oidc token response: %w", err)
+	}
+	if body.Error != "" {
+		return nil, fmt.Errorf("oidc token request: %s %s", body.Error, body.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return nil, fmt.Errorf("oidc token request: status %d without an id token", resp.StatusCode)
+	}
+
+	return p.verify(ctx, body.IDToken, req.Nonce)
+}
+
+// verify checks the id token's signature, issuer, audience, expiry and nonce
+func (p *Provider) verify(ctx context.Context, raw, nonce string) (*Claims, error) {
+	keys, err := p.keySet(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	token, err := p.parse(raw, keys)
+	if err != nil {
+		// the provider may have rotated its keys
+		if keys, refreshed, _ := p.refreshKeys(ctx); refreshed {
+			token, err = p.parse(raw, keys)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if v, _ := token.Get("nonce"); v != nonce {
+		return nil, fmt.Errorf("%w: nonce doesn't match", ErrInvalidToken)
+	}
+	if len(token.Audience()) > 1 {
+		if v, _ := token.Get("azp"); v != p.config.ClientID {
+			return nil, fmt.Errorf("%w: authorized party doesn't match", ErrInvalidToken)
+		}
+	}
+	if token.Subject() == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+
+	claims := &Claims{Subject: token.Subject()}
+	if v, ok := token.Get("email"); ok {
+		claims.Email, _ = v.(string)
+	}
+	if v, ok := token.Get("name"); ok {
+		claims.Name, _ = v.(string)
+	}
+	// some providers send it as a string
+	if v, ok := token.Get("email_verified"); ok {
+		switch v := v.(type) {
+		case bool:
+			claims.EmailVerified = v
+		case string:
+			claims.EmailVerified = v == "true"
+		}
+	}
+	return claims, nil
+}
+
+func (p *Provider) parse(raw string, keys jwk.Set) (jwt.Token, error) {
+	return jwt.Parse([]byte(raw),
+		jwt.WithKeySet(keys),
+		jwt.UseDefaultKey(true),
+		jwt.InferAlgorithmFromKey(true),
+		jwt.WithValidate(true),
+		jwt.WithIssuer(p.metadata.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithAcceptableSkew(time.Minute),
+	)
+}
+
+// keySet returns the provider's signing keys, fetching them the first time
+func (p *Provider) keySet(ctx context.Context, refresh bool) (jwk.Set, error) {
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+	if keys != nil && !refresh {
+		return keys, nil
+	}
+
+	fetched, err := jwk.Fetch(ctx, p.metadata.JWKSURI, jwk.WithHTTPClient(p.client))
+	if err != nil {
+		return nil, fmt.Errorf("oidc keys: %w", err)
+	}
+	// a symmetric key would be public here, tokens signed with it could be forged
+	keys = jwk.NewSet()
+	for i := 0; i < fetched.Len(); i++ {
+		key, _ := fetched.Get(i)
+		if key.KeyType() != jwa.OctetSeq {
+			keys.Add(key)
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.keysFetched = time.Now()
+	p.mu.Unlock()
+	return keys, nil
+}
+
+// refreshKeys fetches the keys again unless that was done recently
+func (p *Provider) refreshKeys(ctx context.Context) (jwk.Set, bool, error) {
+	p.mu.Lock()
+	recent := time.Since(p.keysFetched) < keysRefresh
+	p.mu.Unlock()
+	if recent {
+		return nil, false, nil
+	}
+	keys, err := p.keySet(ctx, true)
+	return keys, err == nil, err
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v any) error {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
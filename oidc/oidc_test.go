@@ -0,0 +1,127 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/auth"
+)
+
+// mockProvider is a local OpenID Connect provider that issues id tokens for code
+type mockProvider struct {
+	*httptest.Server
+	key jwk.Key
+	// codes maps an issued code to the PKCE challenge and nonce of its request
+	codes map[string][2]string
+	// claims are added to every id token
+	claims map[string]any
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := auth.GenerateKey(jwa.ES256, "mock")
+	assert.NoError(t, err)
+	m := &mockProvider{key: key, codes: map[string][2]string{}, claims: map[string]any{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		pub, _ := jwk.PublicKeyOf(m.key)
+		set := jwk.NewSet()
+		set.Add(pub)
+		json.NewEncoder(w).Encode(set)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		issued, ok := m.codes[r.FormValue("code")]
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != issued[0] {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.idToken(t, issued[1])})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// authorize signs the user in like the provider's login page, returning the code from the redirect
+func (m *mockProvider) authorize(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	assert.NoError(t, err)
+	q := u.Query()
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+	code := "code-" + q.Get("state")
+	m.codes[code] = [2]string{q.Get("code_challenge"), q.Get("nonce")}
+	return code
+}
+
+func (m *mockProvider) idToken(t *testing.T, nonce string) string {
+	token := jwt.New()
+	_ = token.Set(jwt.IssuerKey, m.URL)
+	_ = token.Set(jwt.SubjectKey, "user-1")
+	_ = token.Set(jwt.AudienceKey, "updog")
+	_ = token.Set(jwt.ExpirationKey, time.Now().Add(time.Minute))
+	_ = token.Set(jwt.IssuedAtKey, time.Now())
+	_ = token.Set("nonce", nonce)
+	_ = token.Set("email", "alice@example.com")
+	_ = token.Set("email_verified", true)
+	for k, v := range m.claims {
+		_ = token.Set(k, v)
+	}
+	signed, err := jwt.Sign(token, jwa.ES256, m.key)
+	assert.NoError(t, err)
+	return string(signed)
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockProvider(t)
+	ctx := context.Background()
+	redirect := "https://updog.example.com/login/oidc/callback"
+
+	p, err := NewProvider(ctx, &Config{Issuer: m.URL, ClientID: "updog"}, m.Client())
+	assert.NoError(t, err)
+
+	req := NewAuthRequest("/dashboard")
+	code := m.authorize(t, p.AuthURL(req, redirect))
+	claims, err := p.Exchange(ctx, req, code, redirect)
+	assert.NoError(t, err)
+	assert.Equal(t, &Claims{Subject: "user-1", Email: "alice@example.com", EmailVerified: true}, claims)
+
+	// the code is only good with the verifier of the request it was issued for
+	other := NewAuthRequest("")
+	_, err = p.Exchange(ctx, other, code, redirect)
+	assert.Error(t, err)
+
+	// the id token has to be for this request and this client
+	other.Verifier = req.Verifier
+	_, err = p.Exchange(ctx, other, code, redirect)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	m.claims[jwt.AudienceKey] = "someone-else"
+	_, err = p.Exchange(ctx, req, code, redirect)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestAllowedEmail(t *testing.T) {
+	assert.True(t, AllowedEmail("alice@example.com", nil))
+	assert.True(t, AllowedEmail("alice@Example.com", []string{"example.com"}))
+	assert.False(t, AllowedEmail("alice@example.com.evil.com", []string{"example.com"}))
+}
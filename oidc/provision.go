@@ -0,0 +1,102 @@
+package oidc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/user"
+)
+
+var (
+	ErrNoEmail           = errors.New("the identity provider didn't share your email address")
+	ErrDomainNotAllowed  = errors.New("your email domain isn't allowed to sign in")
+	ErrDomainNotVerified = errors.New("the identity provider has to confirm your email before your email domain is allowed to sign in")
+	ErrEmailNotVerified  = errors.New("an account with your email exists, the identity provider has to confirm the email before it can be linked")
+	ErrAccountLinked     = errors.New("the account with your email is linked to another identity")
+	ErrSignupsDisabled   = errors.New("signups are currently disabled")
+)
+
+// Provision finds the user who signed in at issuer, linking an existing account with the same
+// verified email or creating one if allowSignup. When allowedDomains is set only verified emails
+// are let in, an unverified email says nothing about the domain. The caller refuses disabled users.
+func Provision(ctx context.Context, store user.Storage, issuer string, claims *Claims, allowedDomains []string, allowSignup bool) (*user.User, error) {
+	email := strings.TrimSpace(claims.Email)
+	if !strings.Contains(email, "@") {
+		return nil, ErrNoEmail
+	}
+	if !AllowedEmail(email, allowedDomains) {
+		return nil, ErrDomainNotAllowed
+	}
+	if len(allowedDomains) > 0 && !claims.EmailVerified {
+		return nil, ErrDomainNotVerified
+	}
+
+	u, err := store.ReadUserByOIDCSubject(ctx, issuer, claims.Subject)
+	if err == nil {
+		if claims.EmailVerified && strings.EqualFold(u.Email, email) && !u.EmailVerified {
+			u.EmailVerified = true
+			if err := store.UpdateUser(ctx, u); err != nil {
+				return nil, err
+			}
+		}
+		return u, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	u, err = store.ReadUserByEmail(ctx, email)
+	if err == nil {
+		// otherwise anyone who can set an email at the provider could take over the account
+		if !claims.EmailVerified {
+			return nil, ErrEmailNotVerified
+		}
+		if u.OIDCSubject != "" && u.OIDCIssuer == issuer {
+			return nil, ErrAccountLinked
+		}
+		u.OIDCIssuer = issuer
+		u.OIDCSubject = claims.Subject
+		u.EmailVerified = true
+		if err := store.UpdateUser(ctx, u); err != nil {
+			return nil, err
+		}
+		return u, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if !allowSignup {
+		return nil, ErrSignupsDisabled
+	}
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name = user.NameFromEmail(email)
+	}
+	u = &user.User{
+		ID:            id.NewID(),
+		Email:         email,
+		Name:          name,
+		Initials:      user.InitialsFromName(name),
+		EmailVerified: claims.EmailVerified,
+		OIDCIssuer:    issuer,
+		OIDCSubject:   claims.Subject,
+	}
+	if err := store.CreateUser(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// AllowedEmail is true if email is at one of domains, or domains is empty
+func AllowedEmail(email string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	return at >= 0 && slices.Contains(domains, strings.ToLower(email[at+1:]))
+}
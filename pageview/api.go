@@ -3,27 +3,33 @@ package pageview
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/zackb/updog/audit"
 	"github.com/zackb/updog/auth"
 	"github.com/zackb/updog/domain"
 	"github.com/zackb/updog/httpx"
 	"github.com/zackb/updog/httpx/middleware"
+	"github.com/zackb/updog/team"
 )
 
 type Handler struct {
 	store       Storage
 	domainStore domain.Storage
+	auditStore  audit.Storage
 	auth        *auth.Service
 }
 
-func NewHandler(store Storage, domainStore domain.Storage, auth *auth.Service) *Handler {
+func NewHandler(store Storage, domainStore domain.Storage, auditStore audit.Storage, auth *auth.Service) *Handler {
 	return &Handler{
 		store:       store,
 		domainStore: domainStore,
+		auditStore:  auditStore,
 		auth:        auth,
 	}
 }
@@ -33,14 +39,30 @@ func (h *Handler) Routes() chi.Router {
 
 	r.Group(func(protected chi.Router) {
 		protected.Use(middleware.AuthMiddleware(h.auth))
-		protected.Get("/", h.WithApi(h.handleListPageviews))
-		protected.Get("/visitors", h.WithApi(h.handleGetVisitors))
-		protected.Get("/hourly", h.WithApi(h.handleGetHourlyStats))
-		protected.Get("/daily", h.WithApi(h.handleGetDailyStats))
-		protected.Get("/monthly", h.WithApi(h.handleGetMonthlyStats))
-		protected.Get("/stats", h.WithApi(h.handleGetAggregatedStats))
-		// TODO: remove this
-		protected.Get("/rollup", h.handleRollup)
+
+		protected.Group(func(read chi.Router) {
+			read.Use(middleware.RequireScope(auth.ScopeStatsRead))
+			read.Get("/", h.WithApi(h.handleListPageviews))
+			read.Get("/visitors", h.WithApi(h.handleGetVisitors))
+			read.Get("/hourly", h.WithApi(h.handleGetHourlyStats))
+			read.Get("/daily", h.WithApi(h.handleGetDailyStats))
+			read.Get("/monthly", h.WithApi(h.handleGetMonthlyStats))
+			read.Get("/stats", h.WithApi(h.handleGetAggregatedStats))
+			read.Get("/hostnames", h.WithApi(h.handleGetHostnames))
+			read.Get("/outbound", h.WithApi(h.handleGetLinks(LinkOutbound)))
+			read.Get("/downloads", h.WithApi(h.handleGetLinks(LinkDownload)))
+			read.Get("/vitals", h.WithApi(h.handleGetPageVitals))
+			read.Get("/vitals/daily", h.WithApi(h.handleGetDailyVitals))
+			read.Get("/export", h.WithApi(h.handleExport))
+		})
+
+		protected.Group(func(manage chi.Router) {
+			manage.Use(middleware.RequireScope(auth.ScopeDomainsManage))
+			manage.Post("/purge", h.WithApi(h.handlePurge))
+			manage.Post("/reset", h.WithApi(h.handleReset))
+			// TODO: remove this
+			manage.Get("/rollup", h.handleRollup)
+		})
 	})
 
 	return r
@@ -85,6 +107,137 @@ func (h *Handler) handleListPageviews(req *ApiRequest) error {
 	return json.NewEncoder(req.W).Encode(dtos)
 }
 
+func (h *Handler) handleExport(req *ApiRequest) error {
+	q := req.R.URL.Query()
+
+	format, err := ParseExportFormat(q.Get("format"))
+	if err != nil {
+		return NewApiError(err.Error(), http.StatusBadRequest)
+	}
+	kind, err := ParseExportKind(q.Get("type"))
+	if err != nil {
+		return NewApiError(err.Error(), http.StatusBadRequest)
+	}
+
+	name := req.DomainID
+	if d, err := h.domainStore.ReadDomain(req.R.Context(), req.DomainID); err == nil {
+		name = d.Name
+	}
+	filename := fmt.Sprintf("%s-%s-%s-%s.%s", name, kind, req.From.Format("20060102"), req.To.Format("20060102"), format.Extension())
+
+	// the last day is exported in full
+	end := req.To
+	if t := q.Get("to"); t != "" {
+		if end, err = httpx.ParseEndTimeParam(t); err != nil {
+			return NewApiError(err.Error(), http.StatusBadRequest)
+		}
+	}
+
+	req.W.Header().Set("Content-Type", format.ContentType())
+	req.W.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// the response is streamed, once rows are written errors can only be logged
+	w := &writeTracker{w: req.W}
+	err = Export(req.R.Context(), h.store, req.DomainID, kind, format, req.From, end, w)
+	if err != nil {
+		log.Println("Error exporting pageviews:", err)
+		if !w.wrote {
+			return NewApiError("Error exporting pageviews", http.StatusInternalServerError)
+		}
+	}
+	return nil
+}
+
+// writeTracker records whether anything has been written to the response yet
+type writeTracker struct {
+	w     io.Writer
+	wrote bool
+}
+
+func (t *writeTracker) Write(p []byte) (int, error) {
+	t.wrote = true
+	return t.w.Write(p)
+}
+
+type purgeRequest struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Path    string `json:"path"`
+	Country string `json:"country"`
+}
+
+// handlePurge deletes the pageviews matching the criteria in the request body
+func (h *Handler) handlePurge(req *ApiRequest) error {
+	if err := requireExplicitDomain(req.R); err != nil {
+		return err
+	}
+
+	var body purgeRequest
+	if err := json.NewDecoder(req.R.Body).Decode(&body); err != nil {
+		return NewApiError("Invalid request body", http.StatusBadRequest)
+	}
+
+	c := PurgeCriteria{
+		PathPattern: body.Path,
+		Country:     body.Country,
+	}
+	var err error
+	if body.From != "" {
+		if c.From, err = httpx.ParseTimeParam(body.From); err != nil {
+			return NewApiError("Invalid 'from' date", http.StatusBadRequest)
+		}
+	}
+	if body.To != "" {
+		if c.To, err = httpx.ParseTimeParam(body.To); err != nil {
+			return NewApiError("Invalid 'to' date", http.StatusBadRequest)
+		}
+	}
+	if !c.From.IsZero() && !c.To.IsZero() && !c.From.Before(c.To) {
+		return NewApiError("'from' must be before 'to'", http.StatusBadRequest)
+	}
+	// an empty purge would wipe everything, that has to be asked for with reset
+	if c.IsEmpty() {
+		return NewApiError("At least one of from, to, path or country is required", http.StatusBadRequest)
+	}
+
+	return h.purge(req, audit.ActionPageviewsPurge, c)
+}
+
+// handleReset deletes all of a domain's pageviews and rollups
+func (h *Handler) handleReset(req *ApiRequest) error {
+	if err := requireExplicitDomain(req.R); err != nil {
+		return err
+	}
+	return h.purge(req, audit.ActionDomainResetStats, PurgeCriteria{})
+}
+
+func (h *Handler) purge(req *ApiRequest, action string, c PurgeCriteria) error {
+	if !team.RoleAtLeast(req.Role, team.RoleOwner) {
+		return NewApiError("Only owners can delete data", http.StatusForbidden)
+	}
+
+	result, err := h.store.PurgePageviews(req.R.Context(), req.DomainID, c)
+	if err != nil {
+		log.Println("Error purging pageviews:", err)
+		return NewApiError("Error purging pageviews", http.StatusInternalServerError)
+	}
+
+	audit.Record(req.R.Context(), h.auditStore, audit.NewEntry(req.R, httpx.UserIDFromRequest(req.R), action, audit.TargetDomain, req.DomainID, map[string]any{
+		"criteria": c,
+		"result":   result,
+	}))
+
+	return json.NewEncoder(req.W).Encode(result)
+}
+
+// requireExplicitDomain guards destructive endpoints from falling back to the default domain
+func requireExplicitDomain(r *http.Request) error {
+	if r.URL.Query().Get("domain_id") == "" && r.URL.Query().Get("domain") == "" {
+		return NewApiError("domain_id or domain is required", http.StatusBadRequest)
+	}
+	return nil
+}
+
 func (h *Handler) handleGetHourlyStats(req *ApiRequest) error {
 	return h.handleGetStats(req, h.store.GetHourlyStats)
 }
@@ -108,6 +261,16 @@ func (h *Handler) handleGetAggregatedStats(req *ApiRequest) error {
 	return json.NewEncoder(req.W).Encode(stats)
 }
 
+// handleGetHostnames breaks the domain's traffic down by the hostnames it was sent from
+func (h *Handler) handleGetHostnames(req *ApiRequest) error {
+	stats, err := h.store.GetHostnames(req.R.Context(), req.DomainID, req.From, req.To)
+	if err != nil {
+		log.Println("Error reading hostnames:", err)
+		return NewApiError("Error reading hostnames", http.StatusInternalServerError)
+	}
+	return json.NewEncoder(req.W).Encode(stats)
+}
+
 func (h *Handler) handleGetStats(req *ApiRequest, statsFunc func(context.Context, string, time.Time, time.Time) ([]*AggregatedPoint, error)) error {
 	stats, err := statsFunc(req.R.Context(), req.DomainID, req.From, req.To)
 	if err != nil {
@@ -115,3 +278,39 @@ func (h *Handler) handleGetStats(req *ApiRequest, statsFunc func(context.Context
 	}
 	return json.NewEncoder(req.W).Encode(stats)
 }
+
+// handleGetLinks reports the outbound links or downloads of kind clicked on each page
+func (h *Handler) handleGetLinks(kind string) ApiHandler {
+	return func(req *ApiRequest) error {
+		stats, err := h.store.GetLinks(req.R.Context(), req.DomainID, kind, req.From, req.To, 1000)
+		if err != nil {
+			log.Println("Error reading links:", err)
+			return NewApiError("Error reading links", http.StatusInternalServerError)
+		}
+		return json.NewEncoder(req.W).Encode(stats)
+	}
+}
+
+// vitalsFilter reads the optional device and country filters of a vitals request
+func vitalsFilter(req *ApiRequest) VitalsFilter {
+	q := req.R.URL.Query()
+	return VitalsFilter{Device: q.Get("device"), Country: q.Get("country")}
+}
+
+func (h *Handler) handleGetPageVitals(req *ApiRequest) error {
+	stats, err := h.store.GetPageVitals(req.R.Context(), req.DomainID, req.From, req.To, vitalsFilter(req), 1000)
+	if err != nil {
+		log.Println("Error reading page vitals:", err)
+		return NewApiError("Error reading vitals", http.StatusInternalServerError)
+	}
+	return json.NewEncoder(req.W).Encode(stats)
+}
+
+func (h *Handler) handleGetDailyVitals(req *ApiRequest) error {
+	stats, err := h.store.GetDailyVitals(req.R.Context(), req.DomainID, req.From, req.To, vitalsFilter(req))
+	if err != nil {
+		log.Println("Error reading daily vitals:", err)
+		return NewApiError("Error reading vitals", http.StatusInternalServerError)
+	}
+	return json.NewEncoder(req.W).Encode(stats)
+}
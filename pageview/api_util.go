@@ -1,6 +1,8 @@
 package pageview
 
 import (
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"os/user"
@@ -8,6 +10,7 @@ import (
 
 	"github.com/zackb/updog/domain"
 	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/httpx/middleware"
 )
 
 type ApiRequest struct {
@@ -15,6 +18,8 @@ type ApiRequest struct {
 	R        *http.Request
 	User     *user.User
 	DomainID string
+	// Role is the caller's team role on the domain
+	Role     string
 	From, To time.Time
 }
 
@@ -53,16 +58,43 @@ func (h *Handler) WithApi(a ApiHandler) http.HandlerFunc {
 
 		domainID, err := h.resolveDomainID(r, userID)
 
-		if err != nil || domainID == "" {
+		// api keys restricted to a domain default to it and can't read others
+		if t := middleware.TokenFromRequest(r); t != nil && t.DomainID != "" {
+			if r.URL.Query().Get("domain_id") == "" && r.URL.Query().Get("domain") == "" {
+				domainID = t.DomainID
+			} else if !t.AllowsDomain(domainID) {
+				httpx.JSONError(w, "API key is restricted to another domain", http.StatusForbidden)
+				return
+			}
+		}
+
+		if err != nil {
 			log.Printf("Failed to resolve domain: %v", err)
 			httpx.JSONError(w, "Failed to resolve domain", http.StatusInternalServerError)
 			return
 		}
+		// unknown and other people's domains look the same
+		if domainID == "" {
+			httpx.JSONError(w, "Domain not found", http.StatusNotFound)
+			return
+		}
+
+		_, role, err := h.domainStore.ReadDomainForUser(r.Context(), domainID, userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to resolve domain role: %v", err)
+			httpx.JSONError(w, "Failed to resolve domain", http.StatusInternalServerError)
+			return
+		}
+		if role == "" {
+			httpx.JSONError(w, "Domain not found", http.StatusNotFound)
+			return
+		}
 
 		apiReq := &ApiRequest{
 			W:        w,
 			R:        r,
 			DomainID: domainID,
+			Role:     role,
 			From:     from,
 			To:       to,
 		}
@@ -79,7 +111,7 @@ func (h *Handler) WithApi(a ApiHandler) http.HandlerFunc {
 	}
 }
 
-// resolveDomainID determines the domain ID to use based on the request parameters and user ownership.
+// resolveDomainID determines the domain ID to use based on the request parameters and the domains the user can access.
 func (h *Handler) resolveDomainID(r *http.Request, userID string) (string, error) {
 	domains, err := h.domainStore.ListDomainsByUser(r.Context(), userID)
 	if err != nil {
@@ -93,7 +125,7 @@ func (h *Handler) resolveDomainID(r *http.Request, userID string) (string, error
 				return d.ID, nil
 			}
 		}
-		// user requested a domain they don't own or doesn't exist
+		// user requested a domain they can't access or doesn't exist
 		return "", nil
 	}
 
@@ -104,7 +136,7 @@ func (h *Handler) resolveDomainID(r *http.Request, userID string) (string, error
 				return d.ID, nil
 			}
 		}
-		// user requested a domain they don't own or doesn't exist
+		// user requested a domain they can't access or doesn't exist
 		return "", nil
 	}
 
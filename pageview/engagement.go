@@ -0,0 +1,32 @@
+package pageview
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// MaxEngagementAge is how long after a pageview its engagement can still be reported
+	MaxEngagementAge = 12 * time.Hour
+	// maxEngagedTime caps the time a page can count as visible, for tabs left open in the foreground
+	maxEngagedTime = time.Hour
+)
+
+var ErrInvalidEngagement = errors.New("invalid engagement")
+
+// Engagement is how long a page was visible and how far down it was scrolled, as a percentage.
+// The tracker reports the totals so far each time the page is hidden, so the largest values win.
+type Engagement struct {
+	EngagedMS   int64
+	ScrollDepth int64
+}
+
+// Normalize clamps e to sensible values, returning ErrInvalidEngagement if it's negative
+func (e *Engagement) Normalize() error {
+	if e.EngagedMS < 0 || e.ScrollDepth < 0 {
+		return ErrInvalidEngagement
+	}
+	e.EngagedMS = min(e.EngagedMS, maxEngagedTime.Milliseconds())
+	e.ScrollDepth = min(e.ScrollDepth, 100)
+	return nil
+}
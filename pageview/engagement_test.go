@@ -0,0 +1,17 @@
+package pageview
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngagementNormalize(t *testing.T) {
+	e := Engagement{EngagedMS: (2 * time.Hour).Milliseconds(), ScrollDepth: 140}
+	assert.NoError(t, e.Normalize())
+	assert.Equal(t, Engagement{EngagedMS: time.Hour.Milliseconds(), ScrollDepth: 100}, e)
+
+	e = Engagement{EngagedMS: -1}
+	assert.ErrorIs(t, e.Normalize(), ErrInvalidEngagement)
+}
@@ -0,0 +1,215 @@
+package pageview
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type ExportFormat string
+
+const (
+	ExportCSV     ExportFormat = "csv"
+	ExportNDJSON  ExportFormat = "ndjson"
+	ExportParquet ExportFormat = "parquet"
+)
+
+type ExportKind string
+
+const (
+	// ExportKindPageviews is raw pageviews, one row per view
+	ExportKindPageviews ExportKind = "pageviews"
+	// ExportKindDaily is the daily rollups
+	ExportKindDaily ExportKind = "daily"
+)
+
+// rows per parquet row group, bounds how much is buffered before flushing to the writer
+const parquetRowGroupSize = 10000
+
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch s {
+	case "", "csv":
+		return ExportCSV, nil
+	case "ndjson", "jsonl":
+		return ExportNDJSON, nil
+	case "parquet":
+		return ExportParquet, nil
+	}
+	return "", fmt.Errorf("unsupported export format: %s", s)
+}
+
+func ParseExportKind(s string) (ExportKind, error) {
+	switch s {
+	case "", "pageviews":
+		return ExportKindPageviews, nil
+	case "daily":
+		return ExportKindDaily, nil
+	}
+	return "", fmt.Errorf("unsupported export type: %s", s)
+}
+
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportNDJSON:
+		return "application/x-ndjson"
+	case ExportParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+func (f ExportFormat) Extension() string {
+	if f == ExportNDJSON {
+		return "jsonl"
+	}
+	return string(f)
+}
+
+// ExportRow is a row that can be written as csv
+type ExportRow interface {
+	CSVHeader() []string
+	CSVRecord() []string
+}
+
+type exportWriter[T ExportRow] interface {
+	Write(row T) error
+	Close() error
+}
+
+// Export streams the kind of rows for domainID from start up to end to w in format, end is exclusive.
+func Export(ctx context.Context, store Storage, domainID string, kind ExportKind, format ExportFormat, start, end time.Time, w io.Writer) error {
+	switch kind {
+	case ExportKindDaily:
+		ew := newExportWriter[DailyPageviewDTO](format, w)
+		err := store.ExportDailyPageviews(ctx, domainID, start, end, func(row *DailyPageviewDTO) error {
+			return ew.Write(*row)
+		})
+		if err != nil {
+			return err
+		}
+		return ew.Close()
+
+	default:
+		ew := newExportWriter[PageviewDTO](format, w)
+		err := store.ExportPageviews(ctx, domainID, start, end, func(row *PageviewDTO) error {
+			return ew.Write(*row)
+		})
+		if err != nil {
+			return err
+		}
+		return ew.Close()
+	}
+}
+
+func newExportWriter[T ExportRow](format ExportFormat, w io.Writer) exportWriter[T] {
+	switch format {
+	case ExportNDJSON:
+		return &ndjsonWriter[T]{enc: json.NewEncoder(w)}
+	case ExportParquet:
+		return &parquetWriter[T]{w: parquet.NewGenericWriter[T](w, parquet.MaxRowsPerRowGroup(parquetRowGroupSize))}
+	}
+	return &csvWriter[T]{w: csv.NewWriter(w)}
+}
+
+type csvWriter[T ExportRow] struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (c *csvWriter[T]) Write(row T) error {
+	if !c.wroteHeader {
+		if err := c.w.Write(row.CSVHeader()); err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+	return c.w.Write(row.CSVRecord())
+}
+
+func (c *csvWriter[T]) Close() error {
+	// header only for an empty export
+	if !c.wroteHeader {
+		var zero T
+		if err := c.w.Write(zero.CSVHeader()); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonWriter[T ExportRow] struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter[T]) Write(row T) error {
+	return n.enc.Encode(row)
+}
+
+func (n *ndjsonWriter[T]) Close() error {
+	return nil
+}
+
+type parquetWriter[T ExportRow] struct {
+	w *parquet.GenericWriter[T]
+}
+
+func (p *parquetWriter[T]) Write(row T) error {
+	_, err := p.w.Write([]T{row})
+	return err
+}
+
+func (p *parquetWriter[T]) Close() error {
+	return p.w.Close()
+}
+
+func (PageviewDTO) CSVHeader() []string {
+	return []string{"timestamp", "domain_id", "country", "region", "city", "browser", "os", "device", "language", "referrer", "path", "hostname"}
+}
+
+func (p PageviewDTO) CSVRecord() []string {
+	return []string{
+		p.Timestamp.UTC().Format(time.RFC3339),
+		p.DomainID,
+		p.Country,
+		p.Region,
+		p.City,
+		p.Browser,
+		p.OS,
+		p.Device,
+		p.Language,
+		p.Referrer,
+		p.Path,
+		p.Hostname,
+	}
+}
+
+func (DailyPageviewDTO) CSVHeader() []string {
+	return []string{"day", "domain_id", "country", "region", "city", "browser", "os", "device", "language", "referrer", "path", "hostname", "pageviews", "unique_visitors", "bounces"}
+}
+
+func (d DailyPageviewDTO) CSVRecord() []string {
+	return []string{
+		d.Day.UTC().Format("2006-01-02"),
+		d.DomainID,
+		d.Country,
+		d.Region,
+		d.City,
+		d.Browser,
+		d.OS,
+		d.Device,
+		d.Language,
+		d.Referrer,
+		d.Path,
+		d.Hostname,
+		strconv.FormatInt(d.Count, 10),
+		strconv.FormatInt(d.UniqueVisitors, 10),
+		strconv.FormatInt(d.Bounces, 10),
+	}
+}
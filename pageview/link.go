@@ -0,0 +1,74 @@
+package pageview
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// kinds of link clicks the tracker reports
+const (
+	LinkOutbound = "outbound"
+	LinkDownload = "download"
+)
+
+// maxLinkURL is how much of a clicked URL is kept
+const maxLinkURL = 2048
+
+var ErrInvalidLink = errors.New("invalid link")
+
+// LinkClick is a visitor following a link off the site, or downloading a file, from one of its pages
+type LinkClick struct {
+	bun.BaseModel `bun:"table:link_clicks"`
+
+	ID        int64     `bun:",pk,autoincrement"`
+	Timestamp time.Time `bun:"ts,notnull,default:current_timestamp"`
+	DomainID  string    `bun:"domain_id,notnull"`
+	Kind      string    `bun:"kind,notnull"`
+	// PathID is the page the link is on
+	PathID    int64 `bun:"path_id,notnull"`
+	CountryID int64 `bun:"country_id,notnull"`
+	VisitorID int64 `bun:"visitor_id,notnull"`
+	// URL is where the link goes, without its query or fragment
+	URL string `bun:"url,notnull"`
+	// Target is what's reported, the host of an outbound link or the name of a downloaded file
+	Target string `bun:"target,notnull"`
+}
+
+// LinkStats is how often a link was clicked on a page
+type LinkStats struct {
+	Target      string `bun:"target" json:"target"`
+	Path        string `bun:"path" json:"path"`
+	Count       int64  `bun:"count" json:"clicks"`
+	UniqueCount int64  `bun:"unique_count" json:"unique_visitors"`
+}
+
+// ParseLink fills in the URL and target of a click of kind on rawURL. The query and fragment are dropped,
+// they can carry tokens or personal data and don't tell links apart.
+func ParseLink(kind, rawURL string) (*LinkClick, error) {
+	if kind != LinkOutbound && kind != LinkDownload {
+		return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidLink, kind)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: %q is not a web URL", ErrInvalidLink, rawURL)
+	}
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+	u.Host = strings.ToLower(u.Host)
+
+	click := &LinkClick{Kind: kind, URL: u.String(), Target: u.Hostname()}
+	if len(click.URL) > maxLinkURL {
+		click.URL = click.URL[:maxLinkURL]
+	}
+	if kind == LinkDownload {
+		if click.Target = path.Base(u.Path); click.Target == "/" || click.Target == "." {
+			return nil, fmt.Errorf("%w: %q has no file name", ErrInvalidLink, rawURL)
+		}
+	}
+	return click, nil
+}
@@ -0,0 +1,27 @@
+package pageview
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLink(t *testing.T) {
+	click, err := ParseLink(LinkOutbound, "https://user:pw@Docs.Example.org:8443/a/b?token=secret#top")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://docs.example.org:8443/a/b", click.URL)
+	assert.Equal(t, "docs.example.org", click.Target)
+
+	click, err = ParseLink(LinkDownload, "https://example.com/files/My%20Report.pdf?v=2")
+	assert.NoError(t, err)
+	assert.Equal(t, "My Report.pdf", click.Target)
+
+	for kind, url := range map[string]string{
+		"click":      "https://example.com/",
+		LinkOutbound: "mailto:me@example.com",
+		LinkDownload: "https://example.com/",
+	} {
+		_, err := ParseLink(kind, url)
+		assert.ErrorIs(t, err, ErrInvalidLink, url)
+	}
+}
@@ -83,6 +83,13 @@ type Path struct {
 	Path string `bun:",unique,notnull"`
 }
 
+type Hostname struct {
+	bun.BaseModel `bun:"table:hostnames"`
+
+	ID   int64  `bun:",pk,autoincrement"`
+	Name string `bun:",unique,notnull"` // the host the pageview was sent from, a domain may have several
+}
+
 type Pageview struct {
 	bun.BaseModel `bun:"table:pageviews"`
 
@@ -102,6 +109,11 @@ type Pageview struct {
 	ReferrerID   int64  `bun:"referrer_id"`
 	VisitorID    int64  `bun:"visitor_id,notnull"`
 	PathID       int64  `bun:"path_id"`
+	HostnameID   int64  `bun:"hostname_id,notnull"`
+
+	// engagement reported by the tracker while the page was open
+	EngagedMS   int64 `bun:"engaged_ms,notnull"`
+	ScrollDepth int64 `bun:"scroll_depth,notnull"`
 
 	// relations
 	Domain     *domain.Domain   `bun:"rel:belongs-to,join:domain_id=id"`
@@ -114,6 +126,7 @@ type Pageview struct {
 	Language   *Language        `bun:"rel:belongs-to,join:language_id=id"`
 	Referrer   *Referrer        `bun:"rel:belongs-to,join:referrer_id=id"`
 	Path       *Path            `bun:"rel:belongs-to,join:path_id=id"`
+	Hostname   *Hostname        `bun:"rel:belongs-to,join:hostname_id=id"`
 }
 
 type DailyPageview struct {
@@ -130,10 +143,15 @@ type DailyPageview struct {
 	LanguageID   int64     `bun:",pk"`
 	ReferrerID   int64     `bun:",pk"`
 	PathID       int64     `bun:",pk"`
+	HostnameID   int64     `bun:",pk"`
 
 	Count          int64 `bun:"count,notnull"`
 	UniqueVisitors int64 `bun:"unique_visitors"`
 	Bounces        int64 `bun:"bounces"`
+	// sums over the pageviews that reported engagement, of which there are Engagements
+	EngagedMS   int64 `bun:"engaged_ms,notnull"`
+	ScrollDepth int64 `bun:"scroll_depth,notnull"`
+	Engagements int64 `bun:"engagements,notnull"`
 
 	// relations
 	Domain     *domain.Domain   `bun:"rel:belongs-to,join:domain_id=id"`
@@ -146,6 +164,7 @@ type DailyPageview struct {
 	Language   *Language        `bun:"rel:belongs-to,join:language_id=id"`
 	Referrer   *Referrer        `bun:"rel:belongs-to,join:referrer_id=id"`
 	Path       *Path            `bun:"rel:belongs-to,join:path_id=id"`
+	Hostname   *Hostname        `bun:"rel:belongs-to,join:hostname_id=id"`
 }
 
 type PageStats struct {
@@ -153,6 +172,33 @@ type PageStats struct {
 	Count       int64
 	UniqueCount int64
 	BounceRate  float64
+	// totals of the pageviews that reported engagement, of which there are Engagements
+	EngagedMS   int64 `bun:"engaged_ms"`
+	ScrollDepth int64 `bun:"scroll_depth"`
+	Engagements int64 `bun:"engagements"`
+}
+
+// AvgEngagedTime is how long the page was visible on average
+func (s *PageStats) AvgEngagedTime() time.Duration {
+	if s.Engagements == 0 {
+		return 0
+	}
+	return time.Duration(s.EngagedMS/s.Engagements) * time.Millisecond
+}
+
+// AvgScrollDepth is the percentage of the page scrolled through on average
+func (s *PageStats) AvgScrollDepth() float64 {
+	if s.Engagements == 0 {
+		return 0
+	}
+	return float64(s.ScrollDepth) / float64(s.Engagements)
+}
+
+// HostnameStats is a domain's traffic from one of its hostnames
+type HostnameStats struct {
+	Hostname    string `json:"hostname"`
+	Count       int64  `json:"pageviews"`
+	UniqueCount int64  `json:"unique_visitors"`
 }
 
 type DeviceStats struct {
@@ -183,17 +229,37 @@ type AggregatedGeoPoint struct {
 }
 
 type PageviewDTO struct {
-	Timestamp time.Time `json:"timestamp"`
-	DomainID  string    `json:"domain_id"`
-	Country   string    `json:"country"`
-	Region    string    `json:"region"`
-	City      string    `json:"city"`
-	Browser   string    `json:"browser"`
-	OS        string    `json:"os"`
-	Device    string    `json:"device"`
-	Language  string    `json:"language"`
-	Referrer  string    `json:"referrer"`
-	Path      string    `json:"path"`
+	Timestamp time.Time `json:"timestamp" parquet:"timestamp,timestamp(millisecond)"`
+	DomainID  string    `json:"domain_id" parquet:"domain_id"`
+	Country   string    `json:"country" parquet:"country"`
+	Region    string    `json:"region" parquet:"region"`
+	City      string    `json:"city" parquet:"city"`
+	Browser   string    `json:"browser" parquet:"browser"`
+	OS        string    `json:"os" parquet:"os"`
+	Device    string    `json:"device" parquet:"device"`
+	Language  string    `json:"language" parquet:"language"`
+	Referrer  string    `json:"referrer" parquet:"referrer"`
+	Path      string    `json:"path" parquet:"path"`
+	Hostname  string    `json:"hostname" parquet:"hostname"`
+}
+
+// DailyPageviewDTO is a denormalized daily rollup row
+type DailyPageviewDTO struct {
+	Day            time.Time `json:"day" parquet:"day,date"`
+	DomainID       string    `json:"domain_id" parquet:"domain_id"`
+	Country        string    `json:"country" parquet:"country"`
+	Region         string    `json:"region" parquet:"region"`
+	City           string    `json:"city" parquet:"city"`
+	Browser        string    `json:"browser" parquet:"browser"`
+	OS             string    `json:"os" parquet:"os"`
+	Device         string    `json:"device" parquet:"device"`
+	Language       string    `json:"language" parquet:"language"`
+	Referrer       string    `json:"referrer" parquet:"referrer"`
+	Path           string    `json:"path" parquet:"path"`
+	Hostname       string    `json:"hostname" parquet:"hostname"`
+	Count          int64     `json:"pageviews" parquet:"pageviews"`
+	UniqueVisitors int64     `json:"unique_visitors" parquet:"unique_visitors"`
+	Bounces        int64     `json:"bounces" parquet:"bounces"`
 }
 
 func ToPageviewDTOs(pvs []*Pageview) []*PageviewDTO {
@@ -237,6 +303,52 @@ func ToPageviewDTO(pv *Pageview) *PageviewDTO {
 	if pv.Path != nil {
 		dto.Path = pv.Path.Path
 	}
+	if pv.Hostname != nil {
+		dto.Hostname = pv.Hostname.Name
+	}
+
+	return dto
+}
+
+func ToDailyPageviewDTO(dp *DailyPageview) *DailyPageviewDTO {
+	dto := &DailyPageviewDTO{
+		Day:            dp.Day,
+		DomainID:       dp.DomainID,
+		Count:          dp.Count,
+		UniqueVisitors: dp.UniqueVisitors,
+		Bounces:        dp.Bounces,
+	}
+
+	if dp.Country != nil {
+		dto.Country = dp.Country.Name
+	}
+	if dp.Region != nil {
+		dto.Region = dp.Region.Name
+	}
+	if dp.City != nil {
+		dto.City = dp.City.Name
+	}
+	if dp.Browser != nil {
+		dto.Browser = dp.Browser.Name
+	}
+	if dp.OS != nil {
+		dto.OS = dp.OS.Name
+	}
+	if dp.DeviceType != nil {
+		dto.Device = dp.DeviceType.Name
+	}
+	if dp.Language != nil {
+		dto.Language = dp.Language.Code
+	}
+	if dp.Referrer != nil {
+		dto.Referrer = dp.Referrer.Host
+	}
+	if dp.Path != nil {
+		dto.Path = dp.Path.Path
+	}
+	if dp.Hostname != nil {
+		dto.Hostname = dp.Hostname.Name
+	}
 
 	return dto
 }
@@ -0,0 +1,49 @@
+package pageview
+
+import (
+	"strings"
+	"time"
+)
+
+// PurgeCriteria selects the pageviews of a domain to delete. Zero fields
+// match everything, so an empty criteria resets all of a domain's stats.
+type PurgeCriteria struct {
+	// From is inclusive and To is exclusive
+	From time.Time `json:"from,omitzero"`
+	To   time.Time `json:"to,omitzero"`
+	// PathPattern is a glob where * matches any run of characters and ? a single character
+	PathPattern string `json:"path,omitempty"`
+	// Country is the ISO country code as stored by enrichment
+	Country string `json:"country,omitempty"`
+}
+
+// IsEmpty is true when the criteria matches every pageview
+func (c PurgeCriteria) IsEmpty() bool {
+	return c.From.IsZero() && c.To.IsZero() && c.PathPattern == "" && c.Country == ""
+}
+
+type PurgeResult struct {
+	Pageviews      int64 `json:"pageviews"`
+	DailyPageviews int64 `json:"daily_pageviews"`
+	LinkClicks     int64 `json:"link_clicks"`
+	WebVitals      int64 `json:"web_vitals"`
+}
+
+// GlobToLike converts a path glob to a LIKE pattern escaped with '\'
+func GlobToLike(glob string) string {
+	var b strings.Builder
+	for _, r := range glob {
+		switch r {
+		case '\\', '%', '_':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case '*':
+			b.WriteRune('%')
+		case '?':
+			b.WriteRune('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,164 @@
+package pageview
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// sketchAccuracy is the relative error of the quantiles a Sketch answers
+const sketchAccuracy = 0.01
+
+// sketchMinValue is the smallest value that's bucketed, anything below counts as zero
+const sketchMinValue = 1e-6
+
+// sketchVersion prefixes the binary encoding so it can change
+const sketchVersion = 1
+
+var (
+	sketchGamma    = (1 + sketchAccuracy) / (1 - sketchAccuracy)
+	sketchLogGamma = math.Log(sketchGamma)
+)
+
+// Sketch summarizes a distribution of non-negative values so its quantiles can be read within
+// sketchAccuracy, like a DDSketch. Values are counted in buckets growing logarithmically, so a
+// sketch stays small however many values it holds and sketches of different days or pages merge
+// without losing accuracy.
+type Sketch struct {
+	bins  map[int32]uint64
+	zeros uint64
+	count uint64
+}
+
+func NewSketch() *Sketch {
+	return &Sketch{bins: map[int32]uint64{}}
+}
+
+// Add counts v, negative values count as zero
+func (s *Sketch) Add(v float64) {
+	s.count++
+	if v < sketchMinValue {
+		s.zeros++
+		return
+	}
+	s.bins[int32(math.Ceil(math.Log(v)/sketchLogGamma))]++
+}
+
+// Merge adds the values counted by o to s
+func (s *Sketch) Merge(o *Sketch) {
+	s.count += o.count
+	s.zeros += o.zeros
+	for k, n := range o.bins {
+		s.bins[k] += n
+	}
+}
+
+// Count is how many values s holds
+func (s *Sketch) Count() int64 {
+	return int64(s.count)
+}
+
+// Quantile estimates the value below which the fraction q of the values fall, 0 if s is empty
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(s.count-1))
+	if rank < s.zeros {
+		return 0
+	}
+	seen := s.zeros
+	keys := s.keys()
+	for _, k := range keys {
+		seen += s.bins[k]
+		if seen > rank {
+			return bucketValue(k)
+		}
+	}
+	return bucketValue(keys[len(keys)-1])
+}
+
+// bucketValue is the value in the middle of bucket k, whose relative error is at most sketchAccuracy
+func bucketValue(k int32) float64 {
+	return 2 * math.Pow(sketchGamma, float64(k)) / (sketchGamma + 1)
+}
+
+func (s *Sketch) keys() []int32 {
+	keys := make([]int32, 0, len(s.bins))
+	for k := range s.bins {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// MarshalBinary encodes s as the version, the zero count and each bucket with its count, as varints
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	b := []byte{sketchVersion}
+	b = binary.AppendUvarint(b, s.zeros)
+	b = binary.AppendUvarint(b, uint64(len(s.bins)))
+	for _, k := range s.keys() {
+		b = binary.AppendVarint(b, int64(k))
+		b = binary.AppendUvarint(b, s.bins[k])
+	}
+	return b, nil
+}
+
+func (s *Sketch) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 || b[0] != sketchVersion {
+		return errors.New("sketch: unsupported encoding")
+	}
+	b = b[1:]
+	next := func() (uint64, error) {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return 0, errors.New("sketch: truncated")
+		}
+		b = b[n:]
+		return v, nil
+	}
+
+	*s = Sketch{bins: map[int32]uint64{}}
+	var err error
+	if s.zeros, err = next(); err != nil {
+		return err
+	}
+	s.count = s.zeros
+	bins, err := next()
+	if err != nil {
+		return err
+	}
+	for range bins {
+		k, n := binary.Varint(b)
+		if n <= 0 {
+			return errors.New("sketch: truncated")
+		}
+		b = b[n:]
+		c, err := next()
+		if err != nil {
+			return err
+		}
+		s.bins[int32(k)] += c
+		s.count += c
+	}
+	return nil
+}
+
+// Value stores s in a BLOB or BYTEA column
+func (s *Sketch) Value() (driver.Value, error) {
+	return s.MarshalBinary()
+}
+
+func (s *Sketch) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		return s.UnmarshalBinary(v)
+	case string:
+		return s.UnmarshalBinary([]byte(v))
+	default:
+		return fmt.Errorf("sketch: can't scan %T", src)
+	}
+}
@@ -0,0 +1,55 @@
+package pageview
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSketchQuantile(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var values []float64
+	a, b := NewSketch(), NewSketch()
+	for i := 0; i < 10000; i++ {
+		v := math.Exp(r.NormFloat64()) * 1500
+		if i%10 == 0 {
+			v = 0
+		}
+		values = append(values, v)
+		// half the values go into each sketch, which merge to the same as one
+		if i%2 == 0 {
+			a.Add(v)
+		} else {
+			b.Add(v)
+		}
+	}
+	a.Merge(b)
+	assert.Equal(t, int64(len(values)), a.Count())
+
+	slices.Sort(values)
+	for _, q := range []float64{0.5, 0.75, 0.99} {
+		want := values[int(q*float64(len(values)-1))]
+		assert.InEpsilon(t, want, a.Quantile(q), sketchAccuracy, q)
+	}
+	assert.Zero(t, a.Quantile(0.05))
+	assert.Zero(t, NewSketch().Quantile(0.75))
+}
+
+func TestSketchEncoding(t *testing.T) {
+	s := NewSketch()
+	for _, v := range []float64{0, 0.01, 0.2, 120, 2500, 2500, 40000} {
+		s.Add(v)
+	}
+	b, err := s.MarshalBinary()
+	assert.NoError(t, err)
+
+	decoded := &Sketch{}
+	assert.NoError(t, decoded.Scan(b))
+	assert.Equal(t, s, decoded)
+
+	assert.Error(t, decoded.UnmarshalBinary(b[:len(b)-1]))
+	assert.Error(t, decoded.Scan(42))
+}
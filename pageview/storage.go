@@ -11,7 +11,19 @@ type Storage interface {
 	GetAggregatedStats(ctx context.Context, domainID string, start, end time.Time) (*AggregatedStats, error)
 	GetTopPages(ctx context.Context, domainID string, start, end time.Time, limit int) ([]*PageStats, error)
 	GetDeviceUsage(ctx context.Context, domainID string, start, end time.Time) ([]*DeviceStats, error)
+	GetHostnames(ctx context.Context, domainID string, start, end time.Time) ([]*HostnameStats, error)
+	// GetLinks reports the outbound links or downloads of kind clicked on each page
+	GetLinks(ctx context.Context, domainID, kind string, start, end time.Time, limit int) ([]*LinkStats, error)
+	// GetPageVitals and GetDailyVitals report the 75th percentile of each Core Web Vital per page and per day
+	GetPageVitals(ctx context.Context, domainID string, start, end time.Time, f VitalsFilter, limit int) ([]*PageVitals, error)
+	GetDailyVitals(ctx context.Context, domainID string, start, end time.Time, f VitalsFilter) ([]*VitalsPoint, error)
 	RunDailyRollup(ctx context.Context, dayStart time.Time) error
+	// PurgePageviews deletes the domain's pageviews matching c and keeps the rollups consistent
+	PurgePageviews(ctx context.Context, domainID string, c PurgeCriteria) (*PurgeResult, error)
+
+	// streaming exports call fn for each row in order, in batches so the whole range is never held in memory
+	ExportPageviews(ctx context.Context, domainID string, start, end time.Time, fn func(*PageviewDTO) error) error
+	ExportDailyPageviews(ctx context.Context, domainID string, start, end time.Time, fn func(*DailyPageviewDTO) error) error
 
 	GetHourlyStats(ctx context.Context, domainID string, start, end time.Time) ([]*AggregatedPoint, error)
 	GetDailyStats(ctx context.Context, domainID string, start, end time.Time) ([]*AggregatedPoint, error)
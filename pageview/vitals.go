@@ -0,0 +1,200 @@
+package pageview
+
+import (
+	"errors"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Core Web Vitals the tracker measures. CLS has no unit, the others are in milliseconds.
+const (
+	VitalLCP  = "lcp"
+	VitalINP  = "inp"
+	VitalCLS  = "cls"
+	VitalTTFB = "ttfb"
+	VitalFCP  = "fcp"
+)
+
+var Vitals = []string{VitalLCP, VitalINP, VitalCLS, VitalTTFB, VitalFCP}
+
+// vitalLimits are the largest plausible value of each vital, anything above is a measuring error
+var vitalLimits = map[string]float64{
+	VitalLCP:  60_000,
+	VitalINP:  60_000,
+	VitalCLS:  50,
+	VitalTTFB: 60_000,
+	VitalFCP:  60_000,
+}
+
+// vitalThresholds are the values up to which a vital is good, and above which it's poor
+var vitalThresholds = map[string][2]float64{
+	VitalLCP:  {2500, 4000},
+	VitalINP:  {200, 500},
+	VitalCLS:  {0.1, 0.25},
+	VitalTTFB: {800, 1800},
+	VitalFCP:  {1800, 3000},
+}
+
+// Ratings of a vital's value
+const (
+	RatingGood = "good"
+	RatingFair = "needs-improvement"
+	RatingPoor = "poor"
+)
+
+// vitalsQuantile is the percentile vitals are reported at, a page is good if 3 in 4 views are
+const vitalsQuantile = 0.75
+
+var ErrInvalidVitals = errors.New("invalid web vitals")
+
+// WebVital is the vitals measured on one pageview, those the browser couldn't measure are nil
+type WebVital struct {
+	bun.BaseModel `bun:"table:web_vitals"`
+
+	ID           int64     `bun:",pk,autoincrement"`
+	Timestamp    time.Time `bun:"ts,notnull,default:current_timestamp"`
+	DomainID     string    `bun:"domain_id,notnull"`
+	PathID       int64     `bun:"path_id,notnull"`
+	DeviceTypeID int64     `bun:"device_type_id,notnull"`
+	CountryID    int64     `bun:"country_id,notnull"`
+
+	LCP  *float64 `bun:"lcp"`
+	INP  *float64 `bun:"inp"`
+	CLS  *float64 `bun:"cls"`
+	TTFB *float64 `bun:"ttfb"`
+	FCP  *float64 `bun:"fcp"`
+}
+
+// Values are the vitals of v by name
+func (v *WebVital) Values() map[string]*float64 {
+	values := map[string]*float64{}
+	for name, f := range v.fields() {
+		values[name] = *f
+	}
+	return values
+}
+
+func (v *WebVital) fields() map[string]**float64 {
+	return map[string]**float64{
+		VitalLCP:  &v.LCP,
+		VitalINP:  &v.INP,
+		VitalCLS:  &v.CLS,
+		VitalTTFB: &v.TTFB,
+		VitalFCP:  &v.FCP,
+	}
+}
+
+// Normalize drops implausible vitals, returning ErrInvalidVitals if none are left
+func (v *WebVital) Normalize() error {
+	var valid bool
+	for name, f := range v.fields() {
+		if *f == nil {
+			continue
+		}
+		// written so NaN fails too
+		if !(**f >= 0 && **f <= vitalLimits[name]) {
+			*f = nil
+			continue
+		}
+		valid = true
+	}
+	if !valid {
+		return ErrInvalidVitals
+	}
+	return nil
+}
+
+// DailyVital sketches the values of one vital over a day of pageviews sharing the same dimensions
+type DailyVital struct {
+	bun.BaseModel `bun:"table:daily_web_vitals"`
+
+	Day          time.Time `bun:",pk,type:date"`
+	DomainID     string    `bun:",pk,notnull"`
+	PathID       int64     `bun:",pk"`
+	DeviceTypeID int64     `bun:",pk"`
+	CountryID    int64     `bun:",pk"`
+	Metric       string    `bun:",pk"`
+	Sketch       *Sketch   `bun:"sketch,notnull"`
+}
+
+// VitalsFilter narrows vitals down to a device type and country, empty fields match all
+type VitalsFilter struct {
+	Device  string `json:"device,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+// VitalsSummary is the 75th percentile of each vital over some pageviews, nil if none measured it
+type VitalsSummary struct {
+	// Samples is how many pageviews reported vitals
+	Samples int64    `json:"samples"`
+	LCP     *float64 `json:"lcp"`
+	INP     *float64 `json:"inp"`
+	CLS     *float64 `json:"cls"`
+	TTFB    *float64 `json:"ttfb"`
+	FCP     *float64 `json:"fcp"`
+}
+
+// PageVitals summarizes the vitals of a page
+type PageVitals struct {
+	Path string `json:"path"`
+	VitalsSummary
+}
+
+// VitalsPoint summarizes the vitals of a day
+type VitalsPoint struct {
+	Time time.Time `json:"timestamp"`
+	VitalsSummary
+}
+
+// VitalsSketches merges the sketches of each vital
+type VitalsSketches map[string]*Sketch
+
+// Add merges s into the sketch of metric
+func (v VitalsSketches) Add(metric string, s *Sketch) {
+	if v[metric] == nil {
+		v[metric] = NewSketch()
+	}
+	v[metric].Merge(s)
+}
+
+// Record counts one measured value of metric
+func (v VitalsSketches) Record(metric string, value float64) {
+	if v[metric] == nil {
+		v[metric] = NewSketch()
+	}
+	v[metric].Add(value)
+}
+
+// Summary reads the 75th percentile of each vital
+func (v VitalsSketches) Summary() VitalsSummary {
+	var summary VitalsSummary
+	p75 := func(metric string) *float64 {
+		s := v[metric]
+		if s == nil || s.Count() == 0 {
+			return nil
+		}
+		summary.Samples = max(summary.Samples, s.Count())
+		q := s.Quantile(vitalsQuantile)
+		return &q
+	}
+	summary.LCP = p75(VitalLCP)
+	summary.INP = p75(VitalINP)
+	summary.CLS = p75(VitalCLS)
+	summary.TTFB = p75(VitalTTFB)
+	summary.FCP = p75(VitalFCP)
+	return summary
+}
+
+// Rating tells whether value is good, needs improvement or is poor for metric
+func Rating(metric string, value float64) string {
+	t := vitalThresholds[metric]
+	switch {
+	case value <= t[0]:
+		return RatingGood
+	case value <= t[1]:
+		return RatingFair
+	default:
+		return RatingPoor
+	}
+}
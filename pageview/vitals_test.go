@@ -0,0 +1,32 @@
+package pageview
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebVitalNormalize(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+
+	v := &WebVital{LCP: f(1200), INP: f(-5), CLS: f(math.NaN()), TTFB: f(90_000)}
+	assert.NoError(t, v.Normalize())
+	assert.Equal(t, 1200.0, *v.LCP)
+	assert.Nil(t, v.INP)
+	assert.Nil(t, v.CLS)
+	assert.Nil(t, v.TTFB)
+	assert.Nil(t, v.FCP)
+
+	v = &WebVital{CLS: f(100)}
+	assert.ErrorIs(t, v.Normalize(), ErrInvalidVitals)
+	assert.ErrorIs(t, (&WebVital{}).Normalize(), ErrInvalidVitals)
+}
+
+func TestRating(t *testing.T) {
+	assert.Equal(t, RatingGood, Rating(VitalLCP, 2500))
+	assert.Equal(t, RatingFair, Rating(VitalLCP, 3000))
+	assert.Equal(t, RatingPoor, Rating(VitalLCP, 4001))
+	assert.Equal(t, RatingGood, Rating(VitalCLS, 0.05))
+	assert.Equal(t, RatingPoor, Rating(VitalINP, 600))
+}
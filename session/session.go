@@ -0,0 +1,371 @@
+package session
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/env"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/user"
+)
+
+// Cookie names for browsers, API clients get the same tokens in the response body
+const (
+	AccessTokenCookie  = "token"
+	RefreshTokenCookie = "refresh_token"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused means a refresh token was presented twice, so it may have been stolen
+	ErrRefreshTokenReused = errors.New("refresh token was already used, the session has been revoked")
+	ErrNotFound           = errors.New("session not found")
+)
+
+// Session is a signed in device, it lasts as long as it keeps refreshing its access token
+type Session struct {
+	bun.BaseModel `bun:"table:sessions"`
+
+	ID        string `bun:",pk"`
+	UserID    string `bun:",notnull"`
+	UserAgent string `bun:",notnull"`
+	IP        string `bun:",notnull"`
+	// AccessTokenID is the jti of the latest access token, it's revoked with the session
+	AccessTokenID   string    `bun:",nullzero"`
+	AccessExpiresAt time.Time `bun:",nullzero"`
+	CreatedAt       time.Time `bun:",default:CURRENT_TIMESTAMP"`
+	LastUsedAt      time.Time `bun:",notnull"`
+	ExpiresAt       time.Time `bun:",notnull"`
+	RevokedAt       time.Time `bun:",nullzero"`
+
+	User *user.User `bun:"rel:belongs-to,join:user_id=id"`
+}
+
+// Active is true until the session is revoked or expires
+func (s *Session) Active() bool {
+	return s.RevokedAt.IsZero() && time.Now().Before(s.ExpiresAt)
+}
+
+// RefreshToken is one link in a session's chain of refresh tokens, only its hash is stored.
+// Used tokens are kept so presenting one again can be detected.
+type RefreshToken struct {
+	bun.BaseModel `bun:"table:refresh_tokens"`
+
+	TokenHash string    `bun:",pk"`
+	SessionID string    `bun:",notnull"`
+	CreatedAt time.Time `bun:",default:CURRENT_TIMESTAMP"`
+	UsedAt    time.Time `bun:",nullzero"`
+
+	Session *Session `bun:"rel:belongs-to,join:session_id=id"`
+}
+
+// Tokens are issued when signing in and on every refresh
+type Tokens struct {
+	AccessToken      string `json:"token"`
+	ExpiresAt        int64  `json:"expires_at"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresAt int64  `json:"refresh_expires_at"`
+
+	Session *Session `json:"-"`
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RefreshGrace is how long a refresh token keeps returning the tokens it was just exchanged for,
+// so requests racing to refresh the same session don't look like a stolen token
+const RefreshGrace = 10 * time.Second
+
+// Manager signs users in and rotates their refresh tokens
+type Manager struct {
+	store    Storage
+	auth     *auth.Service
+	lifetime time.Duration
+
+	mu         sync.Mutex
+	grace      time.Duration
+	refreshing map[string]*refreshCall
+}
+
+// refreshCall is a refresh in progress, or one that finished less than the grace ago
+type refreshCall struct {
+	done       chan struct{}
+	tokens     *Tokens
+	err        error
+	finishedAt time.Time
+}
+
+// NewManager creates a Manager whose sessions expire after being unused for lifetime
+func NewManager(store Storage, a *auth.Service, lifetime time.Duration) *Manager {
+	return &Manager{
+		store:      store,
+		auth:       a,
+		lifetime:   lifetime,
+		grace:      RefreshGrace,
+		refreshing: map[string]*refreshCall{},
+	}
+}
+
+// SetRefreshGrace changes how long a used refresh token returns the tokens it was exchanged for,
+// concurrent refreshes with the same token share their tokens even without a grace
+func (m *Manager) SetRefreshGrace(grace time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.grace = grace
+}
+
+// Start creates a session for the device making r
+func (m *Manager) Start(ctx context.Context, userID string, r *http.Request) (*Tokens, error) {
+	now := time.Now().UTC()
+	s := &Session{
+		ID:         id.NewID(),
+		UserID:     userID,
+		UserAgent:  r.UserAgent(),
+		IP:         httpx.ClientIP(r),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(m.lifetime),
+	}
+
+	tokens, err := m.issue(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.store.CreateSession(ctx, s, HashToken(tokens.RefreshToken)); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Refresh exchanges a refresh token for new tokens. Presenting a used refresh token
+// revokes its whole session, as either the holder or a thief has a newer one, unless it was
+// used within the grace: requests racing to refresh get the same new tokens.
+func (m *Manager) Refresh(ctx context.Context, refreshToken string, r *http.Request) (*Tokens, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	hash := HashToken(refreshToken)
+
+	m.mu.Lock()
+	now := time.Now()
+	for h, c := range m.refreshing {
+		if !c.finishedAt.IsZero() && now.Sub(c.finishedAt) >= m.grace {
+			delete(m.refreshing, h)
+		}
+	}
+	if c, ok := m.refreshing[hash]; ok {
+		m.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.tokens, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c := &refreshCall{done: make(chan struct{})}
+	m.refreshing[hash] = c
+	m.mu.Unlock()
+
+	// the requests waiting on this one shouldn't fail because it went away
+	c.tokens, c.err = m.refresh(context.WithoutCancel(ctx), hash, r)
+
+	m.mu.Lock()
+	c.finishedAt = time.Now()
+	if c.err != nil {
+		delete(m.refreshing, hash)
+	}
+	m.mu.Unlock()
+	close(c.done)
+	return c.tokens, c.err
+}
+
+// refresh rotates the refresh token hashed as hash
+func (m *Manager) refresh(ctx context.Context, hash string, r *http.Request) (*Tokens, error) {
+	rt, err := m.store.ReadRefreshToken(ctx, hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := rt.Session
+	if s == nil || !s.Active() || s.User == nil || s.User.Disabled {
+		return nil, ErrInvalidRefreshToken
+	}
+	if !rt.UsedAt.IsZero() {
+		return nil, m.reused(ctx, s)
+	}
+
+	now := time.Now().UTC()
+	s.LastUsedAt = now
+	s.ExpiresAt = now.Add(m.lifetime)
+	s.IP = httpx.ClientIP(r)
+	s.UserAgent = r.UserAgent()
+
+	tokens, err := m.issue(s)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.store.RotateRefreshToken(ctx, s, rt.TokenHash, HashToken(tokens.RefreshToken))
+	if errors.Is(err, ErrRefreshTokenReused) {
+		return nil, m.reused(ctx, s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Revoke signs a device out, userID guards against revoking another user's session
+func (m *Manager) Revoke(ctx context.Context, userID, sessionID string) error {
+	s, err := m.store.ReadSession(ctx, sessionID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && s.UserID != userID) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return m.revoke(ctx, s)
+}
+
+// RevokeAll revokes every active session of userID, such as after their password is reset
+func (m *Manager) RevokeAll(ctx context.Context, userID string) error {
+	sessions, err := m.store.ListSessionsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if err := m.revoke(ctx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Logout revokes the access token t and the session it or refreshToken belongs to, either may be empty
+func (m *Manager) Logout(ctx context.Context, t *auth.Token, refreshToken string) error {
+	if t != nil {
+		if err := m.auth.Revoke(ctx, t); err != nil {
+			return err
+		}
+		if t.SessionID != "" {
+			return m.Revoke(ctx, t.ClientId, t.SessionID)
+		}
+	}
+	if refreshToken != "" {
+		rt, err := m.store.ReadRefreshToken(ctx, HashToken(refreshToken))
+		if err == nil && rt.Session != nil {
+			return m.revoke(ctx, rt.Session)
+		}
+	}
+	return nil
+}
+
+// issue creates an access token and the next refresh token for s
+func (m *Manager) issue(s *Session) (*Tokens, error) {
+	access, token, err := m.auth.CreateToken(s.UserID, s.ID, s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.AccessTokenID = token.ID
+	s.AccessExpiresAt = time.Unix(token.Expiry, 0).UTC()
+
+	return &Tokens{
+		AccessToken:      access,
+		ExpiresAt:        token.Expiry,
+		RefreshToken:     id.NewID() + id.NewID() + id.NewID(),
+		RefreshExpiresAt: s.ExpiresAt.Unix(),
+		Session:          s,
+	}, nil
+}
+
+func (m *Manager) reused(ctx context.Context, s *Session) error {
+	if err := m.revoke(ctx, s); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// revoke ends s and its latest access token, earlier access tokens expired before it was refreshed
+func (m *Manager) revoke(ctx context.Context, s *Session) error {
+	if err := m.store.RevokeSession(ctx, s.ID, time.Now().UTC()); err != nil {
+		return err
+	}
+	if s.AccessTokenID == "" || s.AccessExpiresAt.Before(time.Now()) {
+		return nil
+	}
+	return m.auth.Revoke(ctx, &auth.Token{
+		ClientId: s.UserID,
+		ID:       s.AccessTokenID,
+		Expiry:   s.AccessExpiresAt.Unix(),
+	})
+}
+
+// SetCookies signs a browser in with tokens
+func SetCookies(w http.ResponseWriter, tokens *Tokens) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     AccessTokenCookie,
+		Value:    tokens.AccessToken,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   !env.IsDev(),
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     RefreshTokenCookie,
+		Value:    tokens.RefreshToken,
+		Path:     "/",
+		Expires:  time.Unix(tokens.RefreshExpiresAt, 0),
+		HttpOnly: true,
+		Secure:   !env.IsDev(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearCookies signs a browser out
+func ClearCookies(w http.ResponseWriter) {
+	for _, name := range []string{AccessTokenCookie, RefreshTokenCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   !env.IsDev(),
+			MaxAge:   -1,
+		})
+	}
+}
+
+// RefreshTokenFromRequest reads the refresh token cookie
+func RefreshTokenFromRequest(r *http.Request) string {
+	cookie, err := r.Cookie(RefreshTokenCookie)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// BeforeInsertHook for Session to set ID.
+var _ bun.BeforeInsertHook = (*Session)(nil)
+
+func (s *Session) BeforeInsert(ctx context.Context, query *bun.InsertQuery) error {
+	if s.ID == "" {
+		s.ID = id.NewID()
+	}
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/user"
+)
+
+// memoryStore keeps sessions and refresh tokens in memory and counts rotations
+type memoryStore struct {
+	Storage
+
+	mu        sync.Mutex
+	users     map[string]*user.User
+	sessions  map[string]*Session
+	tokens    map[string]*RefreshToken
+	rotations int
+}
+
+func newMemoryStore(users ...*user.User) *memoryStore {
+	s := &memoryStore{users: map[string]*user.User{}, sessions: map[string]*Session{}, tokens: map[string]*RefreshToken{}}
+	for _, u := range users {
+		s.users[u.ID] = u
+	}
+	return s
+}
+
+func (m *memoryStore) CreateSession(ctx context.Context, s *Session, refreshHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := *s
+	m.sessions[s.ID] = &saved
+	m.tokens[refreshHash] = &RefreshToken{TokenHash: refreshHash, SessionID: s.ID, CreatedAt: time.Now()}
+	return nil
+}
+
+func (m *memoryStore) ReadSession(ctx context.Context, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *s
+	return &found, nil
+}
+
+func (m *memoryStore) ReadRefreshToken(ctx context.Context, hash string) (*RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rt, ok := m.tokens[hash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *rt
+	s := *m.sessions[rt.SessionID]
+	s.User = m.users[s.UserID]
+	found.Session = &s
+	return &found, nil
+}
+
+func (m *memoryStore) RotateRefreshToken(ctx context.Context, s *Session, oldHash, newHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rt := m.tokens[oldHash]
+	if !rt.UsedAt.IsZero() {
+		return ErrRefreshTokenReused
+	}
+	rt.UsedAt = time.Now()
+	m.tokens[newHash] = &RefreshToken{TokenHash: newHash, SessionID: s.ID, CreatedAt: time.Now()}
+	saved := *s
+	saved.User = nil
+	m.sessions[s.ID] = &saved
+	m.rotations++
+	return nil
+}
+
+func (m *memoryStore) ListSessionsByUser(ctx context.Context, userID string) ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sessions []*Session
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.Active() {
+			found := *s
+			sessions = append(sessions, &found)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+func (m *memoryStore) RevokeSession(ctx context.Context, id string, revokedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.sessions[id]; ok {
+		s.RevokedAt = revokedAt
+	}
+	return nil
+}
+
+// memoryRevocations keeps revoked token ids in memory
+type memoryRevocations struct {
+	auth.RevocationStore
+
+	mu      sync.Mutex
+	revoked map[string]bool
+}
+
+func (r *memoryRevocations) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revoked[jti] = true
+	return nil
+}
+
+func (r *memoryRevocations) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.revoked[jti], nil
+}
+
+func newTestAuth(t *testing.T) *auth.Service {
+	key, err := jwk.New([]byte("0123456789abcdef0123456789abcdef"))
+	assert.NoError(t, err)
+	assert.NoError(t, key.Set(jwk.KeyIDKey, "test"))
+	assert.NoError(t, key.Set(jwk.AlgorithmKey, jwa.HS256))
+	set := jwk.NewSet()
+	set.Add(key)
+	b, err := json.Marshal(set)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, b, 0600))
+
+	a, err := auth.NewAuthService(path, time.Minute)
+	assert.NoError(t, err)
+	a.SetRevocationStore(&memoryRevocations{revoked: map[string]bool{}})
+	return a
+}
+
+func TestRefresh_ReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	alice := &user.User{ID: "alice"}
+	store := newMemoryStore(alice)
+	a := newTestAuth(t)
+	m := NewManager(store, a, time.Hour)
+	r := httptest.NewRequest("POST", "/api/v1/auth/refresh", nil)
+
+	first, err := m.Start(ctx, alice.ID, r)
+	assert.NoError(t, err)
+	second, err := m.Refresh(ctx, first.RefreshToken, r)
+	assert.NoError(t, err)
+	third, err := m.Refresh(ctx, second.RefreshToken, r)
+	assert.NoError(t, err)
+
+	// the first token coming back means someone kept a copy, so every token descended from it stops working
+	m.SetRefreshGrace(0)
+	_, err = m.Refresh(ctx, first.RefreshToken, r)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	_, err = m.Refresh(ctx, third.RefreshToken, r)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, err = a.ValidateToken(ctx, third.AccessToken)
+	assert.ErrorIs(t, err, auth.ErrTokenRevoked)
+
+	s, err := store.ReadSession(ctx, first.Session.ID)
+	assert.NoError(t, err)
+	assert.False(t, s.Active())
+	assert.Equal(t, 2, store.rotations)
+}
+
+func TestRefresh_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	alice := &user.User{ID: "alice"}
+	store := newMemoryStore(alice)
+	a := newTestAuth(t)
+	m := NewManager(store, a, time.Hour)
+	r := httptest.NewRequest("POST", "/api/v1/auth/refresh", nil)
+
+	first, err := m.Start(ctx, alice.ID, r)
+	assert.NoError(t, err)
+
+	// every request racing to refresh gets the result of a single rotation
+	const n = 10
+	var wg sync.WaitGroup
+	results := make([]*Tokens, n)
+	for i := range n {
+		wg.Go(func() {
+			tokens, err := m.Refresh(ctx, first.RefreshToken, r)
+			assert.NoError(t, err)
+			results[i] = tokens
+		})
+	}
+	wg.Wait()
+	assert.Equal(t, 1, store.rotations)
+	for _, tokens := range results {
+		if assert.NotNil(t, tokens) {
+			assert.Equal(t, results[0].RefreshToken, tokens.RefreshToken)
+			assert.Equal(t, results[0].AccessToken, tokens.AccessToken)
+		}
+	}
+
+	// failures aren't shared, a bad token is looked up again each time
+	_, err = m.Refresh(ctx, "nope", r)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, err = m.Refresh(ctx, "", r)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// once the grace is over the shared result is forgotten and the old token counts as reused
+	m.SetRefreshGrace(0)
+	_, err = m.Refresh(ctx, first.RefreshToken, r)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	assert.Equal(t, 1, store.rotations)
+}
+
+func TestRevokeAll(t *testing.T) {
+	ctx := context.Background()
+	alice := &user.User{ID: "alice"}
+	bob := &user.User{ID: "bob"}
+	store := newMemoryStore(alice, bob)
+	a := newTestAuth(t)
+	m := NewManager(store, a, time.Hour)
+	r := httptest.NewRequest("POST", "/api/v1/auth/login", nil)
+
+	laptop, err := m.Start(ctx, alice.ID, r)
+	assert.NoError(t, err)
+	phone, err := m.Start(ctx, alice.ID, r)
+	assert.NoError(t, err)
+	other, err := m.Start(ctx, bob.ID, r)
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.RevokeAll(ctx, alice.ID))
+	for _, tokens := range []*Tokens{laptop, phone} {
+		_, err = m.Refresh(ctx, tokens.RefreshToken, r)
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+		_, err = a.ValidateToken(ctx, tokens.AccessToken)
+		assert.ErrorIs(t, err, auth.ErrTokenRevoked)
+	}
+	sessions, err := store.ListSessionsByUser(ctx, alice.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	// other users stay signed in
+	_, err = a.ValidateToken(ctx, other.AccessToken)
+	assert.NoError(t, err)
+	_, err = m.Refresh(ctx, other.RefreshToken, r)
+	assert.NoError(t, err)
+
+	// and there's nothing left to revoke the second time
+	assert.NoError(t, m.RevokeAll(ctx, alice.ID))
+}
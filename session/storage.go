@@ -0,0 +1,22 @@
+package session
+
+import (
+	"context"
+	"time"
+)
+
+type Storage interface {
+	// CreateSession stores s with its first refresh token
+	CreateSession(ctx context.Context, s *Session, refreshHash string) error
+	ReadSession(ctx context.Context, id string) (*Session, error)
+	// ReadRefreshToken reads a refresh token with its session and the session's user
+	ReadRefreshToken(ctx context.Context, hash string) (*RefreshToken, error)
+	// RotateRefreshToken marks oldHash used, stores newHash and saves s.
+	// It returns ErrRefreshTokenReused if oldHash was used in the meantime.
+	RotateRefreshToken(ctx context.Context, s *Session, oldHash, newHash string) error
+	// ListSessionsByUser lists the user's active sessions, most recently used first
+	ListSessionsByUser(ctx context.Context, userID string) ([]*Session, error)
+	RevokeSession(ctx context.Context, id string, revokedAt time.Time) error
+	// DeleteExpiredSessions deletes expired and revoked sessions and their refresh tokens
+	DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error)
+}
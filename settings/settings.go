@@ -9,6 +9,8 @@ import (
 
 const (
 	SettingDisableSignups = "disable_signups"
+	// SettingRequire2FA makes every user set up two-factor authentication
+	SettingRequire2FA = "require_2fa"
 )
 
 type Settings struct {
@@ -23,7 +25,9 @@ type Settings struct {
 var _ bun.BeforeInsertHook = (*Settings)(nil)
 
 func (u *Settings) BeforeInsert(ctx context.Context, query *bun.InsertQuery) error {
-	u.CreatedAt = time.Now()
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
 	return nil
 }
 
@@ -0,0 +1,186 @@
+package share
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/pageview"
+)
+
+type contextKey string
+
+const contextKeyLink contextKey = "share_link"
+
+// Handler serves the stats of shared links without authentication
+type Handler struct {
+	store         Storage
+	pageviewStore pageview.Storage
+	domainStore   domain.Storage
+}
+
+func NewHandler(store Storage, pageviewStore pageview.Storage, domainStore domain.Storage) *Handler {
+	return &Handler{
+		store:         store,
+		pageviewStore: pageviewStore,
+		domainStore:   domainStore,
+	}
+}
+
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Route("/{slug}", func(shared chi.Router) {
+		shared.Use(h.linkMiddleware)
+		shared.Get("/", h.handleGetLink)
+		shared.With(requirePanel(PanelDashboard)).Get("/stats", h.handleGetAggregatedStats)
+		shared.With(requirePanel(PanelDashboard)).Get("/hourly", h.handleGetStats(h.pageviewStore.GetHourlyStats))
+		shared.With(requirePanel(PanelDashboard)).Get("/daily", h.handleGetStats(h.pageviewStore.GetDailyStats))
+		shared.With(requirePanel(PanelDashboard)).Get("/monthly", h.handleGetStats(h.pageviewStore.GetMonthlyStats))
+		shared.With(requirePanel(PanelPages)).Get("/pages", h.handleGetTopPages)
+		shared.With(requirePanel(PanelVisitors)).Get("/visitors", h.handleGetVisitors)
+	})
+	return r
+}
+
+// linkMiddleware resolves the link in the URL, expired and unknown links are not found
+func (h *Handler) linkMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l, err := h.store.ReadLinkBySlug(r.Context(), chi.URLParam(r, "slug"))
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Failed to read shared link: %v", err)
+			}
+			httpx.JSONError(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if l.Expired() {
+			httpx.JSONError(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if !l.Authorized(r) {
+			httpx.JSONError(w, "Password required", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyLink, l)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func requirePanel(panel string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !linkFromRequest(r).Allows(panel) {
+				httpx.JSONError(w, "Not found", http.StatusNotFound)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func linkFromRequest(r *http.Request) *Link {
+	l, _ := r.Context().Value(contextKeyLink).(*Link)
+	return l
+}
+
+func (h *Handler) handleGetLink(w http.ResponseWriter, r *http.Request) {
+	l := linkFromRequest(r)
+
+	d, err := h.domainStore.ReadDomain(r.Context(), l.DomainID)
+	if err != nil {
+		log.Printf("Failed to read shared domain: %v", err)
+		httpx.JSONError(w, "Failed to read domain", http.StatusInternalServerError)
+		return
+	}
+
+	info := map[string]any{
+		"domain": d.Name,
+		"panels": l.PanelList(),
+	}
+	if !l.ExpiresAt.IsZero() {
+		info["expires_at"] = l.ExpiresAt
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(info))
+}
+
+func (h *Handler) handleGetAggregatedStats(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := timeParams(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := h.pageviewStore.GetAggregatedStats(r.Context(), linkFromRequest(r).DomainID, from, to)
+	if err != nil {
+		log.Println("Error reading stats:", err)
+		httpx.JSONError(w, "Error reading stats", http.StatusInternalServerError)
+		return
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(stats))
+}
+
+func (h *Handler) handleGetStats(statsFunc func(context.Context, string, time.Time, time.Time) ([]*pageview.AggregatedPoint, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, ok := timeParams(w, r)
+		if !ok {
+			return
+		}
+
+		stats, err := statsFunc(r.Context(), linkFromRequest(r).DomainID, from, to)
+		if err != nil {
+			httpx.JSONError(w, "Error reading stats", http.StatusInternalServerError)
+			return
+		}
+		httpx.CheckError(w, json.NewEncoder(w).Encode(stats))
+	}
+}
+
+func (h *Handler) handleGetTopPages(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := timeParams(w, r)
+	if !ok {
+		return
+	}
+
+	limit := 100
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n < limit {
+		limit = n
+	}
+
+	pages, err := h.pageviewStore.GetTopPages(r.Context(), linkFromRequest(r).DomainID, from, to, limit)
+	if err != nil {
+		httpx.JSONError(w, "Error reading pages", http.StatusInternalServerError)
+		return
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(pages))
+}
+
+func (h *Handler) handleGetVisitors(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := timeParams(w, r)
+	if !ok {
+		return
+	}
+
+	visitors, err := h.pageviewStore.GetGeoStats(r.Context(), linkFromRequest(r).DomainID, from, to)
+	if err != nil {
+		httpx.JSONError(w, "Error reading visitors", http.StatusInternalServerError)
+		return
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(visitors))
+}
+
+func timeParams(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	from, to, err := httpx.ParseTimeParams(r)
+	if err != nil {
+		httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
@@ -0,0 +1,135 @@
+package share
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/domain"
+	"github.com/zackb/updog/pageview"
+)
+
+// memoryStore keeps links in memory by slug
+type memoryStore map[string]*Link
+
+func (s memoryStore) CreateLink(ctx context.Context, l *Link) error {
+	s[l.Slug] = l
+	return nil
+}
+
+func (s memoryStore) ReadLinkBySlug(ctx context.Context, slug string) (*Link, error) {
+	if l, ok := s[slug]; ok {
+		return l, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s memoryStore) ListLinksByDomain(ctx context.Context, domainID string) ([]*Link, error) {
+	var links []*Link
+	for _, l := range s {
+		if l.DomainID == domainID {
+			links = append(links, l)
+		}
+	}
+	return links, nil
+}
+
+func (s memoryStore) DeleteLink(ctx context.Context, domainID, linkID string) error {
+	for slug, l := range s {
+		if l.ID == linkID && l.DomainID == domainID {
+			delete(s, slug)
+		}
+	}
+	return nil
+}
+
+// fixedStats reports the same stats for whichever domain is asked about, remembering which it was
+type fixedStats struct {
+	pageview.Storage
+	domainID string
+}
+
+func (p *fixedStats) GetAggregatedStats(ctx context.Context, domainID string, start, end time.Time) (*pageview.AggregatedStats, error) {
+	p.domainID = domainID
+	return &pageview.AggregatedStats{}, nil
+}
+
+func (p *fixedStats) GetTopPages(ctx context.Context, domainID string, start, end time.Time, limit int) ([]*pageview.PageStats, error) {
+	p.domainID = domainID
+	return []*pageview.PageStats{}, nil
+}
+
+type memoryDomains struct {
+	domain.Storage
+	domains map[string]*domain.Domain
+}
+
+func (d memoryDomains) ReadDomain(ctx context.Context, domainID string) (*domain.Domain, error) {
+	if found, ok := d.domains[domainID]; ok {
+		return found, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func TestSharedLinkAPI(t *testing.T) {
+	ctx := context.Background()
+	store := memoryStore{}
+	stats := &fixedStats{}
+	site := &domain.Domain{ID: "site", Name: "example.com"}
+	api := NewHandler(store, stats, memoryDomains{domains: map[string]*domain.Domain{site.ID: site}}).Routes()
+
+	get := func(path, password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if password != "" {
+			r.Header.Set(PasswordHeader, password)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		return w
+	}
+
+	open, err := NewLink(site.ID, "alice", "", time.Time{}, []string{PanelDashboard})
+	assert.NoError(t, err)
+	assert.NoError(t, store.CreateLink(ctx, open))
+
+	// the link says what it shares, and only that
+	w := get("/"+open.Slug+"/", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var info struct {
+		Domain string   `json:"domain"`
+		Panels []string `json:"panels"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&info))
+	assert.Equal(t, "example.com", info.Domain)
+	assert.Equal(t, []string{PanelDashboard}, info.Panels)
+	assert.Equal(t, http.StatusOK, get("/"+open.Slug+"/stats", "").Code)
+	assert.Equal(t, site.ID, stats.domainID)
+	assert.Equal(t, http.StatusNotFound, get("/"+open.Slug+"/pages", "").Code)
+	assert.Equal(t, http.StatusBadRequest, get("/"+open.Slug+"/stats?from=yesterday", "").Code)
+	assert.Equal(t, http.StatusNotFound, get("/unknown/stats", "").Code)
+
+	// a password is asked for on every endpoint
+	locked, err := NewLink(site.ID, "alice", "secret", time.Time{}, Panels)
+	assert.NoError(t, err)
+	assert.NoError(t, store.CreateLink(ctx, locked))
+	assert.Equal(t, http.StatusUnauthorized, get("/"+locked.Slug+"/pages", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/"+locked.Slug+"/pages", "wrong").Code)
+	assert.Equal(t, http.StatusOK, get("/"+locked.Slug+"/pages", "secret").Code)
+
+	// expired and revoked links are gone
+	expired, err := NewLink(site.ID, "alice", "", time.Now().Add(-time.Minute), Panels)
+	assert.NoError(t, err)
+	assert.NoError(t, store.CreateLink(ctx, expired))
+	assert.Equal(t, http.StatusNotFound, get("/"+expired.Slug+"/", "").Code)
+
+	assert.NoError(t, store.DeleteLink(ctx, "other", open.ID))
+	assert.Equal(t, http.StatusOK, get("/"+open.Slug+"/stats", "").Code)
+	assert.NoError(t, store.DeleteLink(ctx, site.ID, open.ID))
+	assert.Equal(t, http.StatusNotFound, get("/"+open.Slug+"/", "").Code)
+	assert.Equal(t, http.StatusNotFound, get("/"+open.Slug+"/stats", "").Code)
+}
@@ -0,0 +1,153 @@
+package share
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/id"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Panels of the dashboard a link can expose
+const (
+	PanelDashboard = "dashboard"
+	PanelPages     = "pages"
+	PanelVisitors  = "visitors"
+)
+
+var Panels = []string{PanelDashboard, PanelPages, PanelVisitors}
+
+// ErrNoPanels is returned for a link that wouldn't show anything
+var ErrNoPanels = errors.New("choose at least one panel to share")
+
+// PasswordHeader lets API clients send the password of a protected link
+const PasswordHeader = "X-Share-Password"
+
+// Link is a public, read-only view of a domain's stats
+type Link struct {
+	bun.BaseModel `bun:"table:shared_links"`
+
+	ID           string    `bun:",pk" json:"id"`
+	Slug         string    `bun:",notnull,unique" json:"slug"`
+	DomainID     string    `bun:",notnull" json:"domain_id"`
+	PasswordHash string    `bun:",notnull" json:"-"`
+	Panels       string    `bun:",notnull" json:"panels"`
+	CreatedBy    string    `bun:",notnull" json:"created_by"`
+	ExpiresAt    time.Time `bun:",nullzero" json:"expires_at,omitzero"`
+	CreatedAt    time.Time `bun:",default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// NewLink creates a link with a random slug showing the known panels of panels,
+// ErrNoPanels if there are none. An empty password means none is needed.
+func NewLink(domainID, createdBy, password string, expiresAt time.Time, panels []string) (*Link, error) {
+	l := &Link{
+		ID:        id.NewID(),
+		Slug:      id.NewID(),
+		DomainID:  domainID,
+		CreatedBy: createdBy,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now().UTC(),
+	}
+	var selected []string
+	for _, p := range Panels {
+		if slices.Contains(panels, p) {
+			selected = append(selected, p)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, ErrNoPanels
+	}
+	// every panel is stored as none
+	if len(selected) < len(Panels) {
+		l.Panels = strings.Join(selected, ",")
+	}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		l.PasswordHash = string(hash)
+	}
+	return l, nil
+}
+
+// URL is the public address of the shared dashboard
+func URL(baseURL, slug string) string {
+	return baseURL + "/share/" + slug
+}
+
+// Allows is true if the panel is shown by the link
+func (l *Link) Allows(panel string) bool {
+	if l.Panels == "" {
+		return true
+	}
+	return slices.Contains(strings.Split(l.Panels, ","), panel)
+}
+
+// PanelList is the panels the link shows
+func (l *Link) PanelList() []string {
+	if l.Panels == "" {
+		return Panels
+	}
+	return strings.Split(l.Panels, ",")
+}
+
+func (l *Link) Expired() bool {
+	return !l.ExpiresAt.IsZero() && !time.Now().Before(l.ExpiresAt)
+}
+
+func (l *Link) HasPassword() bool {
+	return l.PasswordHash != ""
+}
+
+func (l *Link) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(l.PasswordHash), []byte(password)) == nil
+}
+
+// CookieName is the cookie that remembers the password was entered
+func (l *Link) CookieName() string {
+	return "share_" + l.Slug
+}
+
+// AccessToken is the cookie value for the link, it changes with the password
+func (l *Link) AccessToken() string {
+	sum := sha256.Sum256([]byte(l.ID + ":" + l.PasswordHash))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authorized is true if the request may see the link's stats
+func (l *Link) Authorized(r *http.Request) bool {
+	if !l.HasPassword() {
+		return true
+	}
+	if c, err := r.Cookie(l.CookieName()); err == nil {
+		if subtle.ConstantTimeCompare([]byte(c.Value), []byte(l.AccessToken())) == 1 {
+			return true
+		}
+	}
+	if pw := r.Header.Get(PasswordHeader); pw != "" {
+		return l.CheckPassword(pw)
+	}
+	return false
+}
+
+// BeforeInsertHook for Link to set ID.
+var _ bun.BeforeInsertHook = (*Link)(nil)
+
+func (l *Link) BeforeInsert(ctx context.Context, query *bun.InsertQuery) error {
+	if l.ID == "" {
+		l.ID = id.NewID()
+	}
+	if l.CreatedAt.IsZero() {
+		l.CreatedAt = time.Now()
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package share
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLink_Panels(t *testing.T) {
+	l, err := NewLink("d", "u", "", time.Time{}, []string{PanelVisitors, "bogus", PanelDashboard})
+	assert.NoError(t, err)
+	assert.Equal(t, "dashboard,visitors", l.Panels)
+	assert.True(t, l.Allows(PanelVisitors))
+	assert.False(t, l.Allows(PanelPages))
+
+	// every panel is stored as none
+	l, err = NewLink("d", "u", "", time.Time{}, Panels)
+	assert.NoError(t, err)
+	assert.Empty(t, l.Panels)
+	assert.True(t, l.Allows(PanelPages))
+	assert.False(t, l.Expired())
+
+	// a link without panels isn't a link to everything
+	for _, panels := range [][]string{nil, {}, {"bogus"}} {
+		_, err = NewLink("d", "u", "", time.Time{}, panels)
+		assert.ErrorIs(t, err, ErrNoPanels)
+	}
+}
+
+func TestLink_Authorized(t *testing.T) {
+	l, err := NewLink("d", "u", "secret", time.Now().Add(time.Hour), Panels)
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	assert.False(t, l.Authorized(r))
+
+	r.Header.Set(PasswordHeader, "wrong")
+	assert.False(t, l.Authorized(r))
+	r.Header.Set(PasswordHeader, "secret")
+	assert.True(t, l.Authorized(r))
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: l.CookieName(), Value: l.AccessToken()})
+	assert.True(t, l.Authorized(r))
+}
@@ -0,0 +1,11 @@
+package share
+
+import "context"
+
+type Storage interface {
+	CreateLink(ctx context.Context, l *Link) error
+	ReadLinkBySlug(ctx context.Context, slug string) (*Link, error)
+	ListLinksByDomain(ctx context.Context, domainID string) ([]*Link, error)
+	// DeleteLink revokes a link, domainID guards against deleting another domain's link
+	DeleteLink(ctx context.Context, domainID, linkID string) error
+}
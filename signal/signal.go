@@ -24,3 +24,15 @@ func Stop(h handler) chan int {
 	}()
 	return closed
 }
+
+// Reload calls h on every hangup signal
+func Reload(h handler) {
+	go func() {
+		sighup := make(chan os.Signal, 1)
+		signal.Notify(sighup, syscall.SIGHUP)
+
+		for range sighup {
+			h()
+		}
+	}()
+}
@@ -0,0 +1,410 @@
+package team
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/httpx"
+	"github.com/zackb/updog/httpx/middleware"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/mail"
+	"github.com/zackb/updog/user"
+)
+
+type Handler struct {
+	store      Storage
+	userStore  user.Storage
+	auditStore audit.Storage
+	auth       *auth.Service
+	sender     mail.Sender
+}
+
+func NewHandler(store Storage, userStore user.Storage, auditStore audit.Storage, auth *auth.Service, sender mail.Sender) *Handler {
+	return &Handler{
+		store:      store,
+		userStore:  userStore,
+		auditStore: auditStore,
+		auth:       auth,
+		sender:     sender,
+	}
+}
+
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Group(func(protected chi.Router) {
+		protected.Use(middleware.AuthMiddleware(h.auth), middleware.RequireScope(auth.ScopeAccount))
+		protected.Get("/", h.handleListTeams)
+		protected.Post("/", h.handleCreateTeam)
+		protected.Post("/invitations/accept", h.handleAcceptInvitation)
+		protected.Get("/{id}", h.handleGetTeam)
+		protected.Patch("/{id}", h.handleUpdateTeam)
+		protected.Delete("/{id}", h.handleDeleteTeam)
+		protected.Get("/{id}/invitations", h.handleListInvitations)
+		protected.Post("/{id}/invitations", h.handleCreateInvitation)
+		protected.Delete("/{id}/invitations/{invitationID}", h.handleDeleteInvitation)
+		protected.Patch("/{id}/members/{userID}", h.handleUpdateMember)
+		protected.Delete("/{id}/members/{userID}", h.handleRemoveMember)
+	})
+
+	return r
+}
+
+type teamResponse struct {
+	*Team
+	Role    string    `json:"role"`
+	Members []*Member `json:"members,omitempty"`
+}
+
+func (h *Handler) handleListTeams(w http.ResponseWriter, r *http.Request) {
+	memberships, err := h.store.ListTeamsByUser(r.Context(), httpx.UserIDFromRequest(r))
+	if err != nil {
+		log.Printf("Failed to list teams: %v", err)
+		httpx.JSONError(w, "Failed to list teams", http.StatusInternalServerError)
+		return
+	}
+
+	teams := make([]*teamResponse, len(memberships))
+	for i, m := range memberships {
+		teams[i] = &teamResponse{Team: m.Team, Role: m.Role}
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(teams))
+}
+
+func (h *Handler) handleCreateTeam(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		httpx.JSONError(w, "Team name is required", http.StatusBadRequest)
+		return
+	}
+
+	userID := httpx.UserIDFromRequest(r)
+	t := &Team{ID: id.NewID(), Name: name}
+	if err := h.store.CreateTeam(r.Context(), t, userID); err != nil {
+		log.Printf("Failed to create team: %v", err)
+		httpx.JSONError(w, "Failed to create team", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, userID, audit.ActionTeamCreate, audit.TargetTeam, t.ID, map[string]any{
+		"name": t.Name,
+	}))
+
+	w.WriteHeader(http.StatusCreated)
+	httpx.CheckError(w, json.NewEncoder(w).Encode(&teamResponse{Team: t, Role: RoleOwner}))
+}
+
+func (h *Handler) handleGetTeam(w http.ResponseWriter, r *http.Request) {
+	t, m := h.teamForUser(w, r, RoleViewer)
+	if t == nil {
+		return
+	}
+
+	members, err := h.store.ListMembers(r.Context(), t.ID)
+	if err != nil {
+		log.Printf("Failed to list members: %v", err)
+		httpx.JSONError(w, "Failed to list members", http.StatusInternalServerError)
+		return
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(&teamResponse{Team: t, Role: m.Role, Members: members}))
+}
+
+func (h *Handler) handleUpdateTeam(w http.ResponseWriter, r *http.Request) {
+	t, m := h.teamForUser(w, r, RoleOwner)
+	if t == nil {
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if name := strings.TrimSpace(body.Name); name != "" {
+		t.Name = name
+	}
+
+	if err := h.store.UpdateTeam(r.Context(), t); err != nil {
+		log.Printf("Failed to update team: %v", err)
+		httpx.JSONError(w, "Failed to update team", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, m.UserID, audit.ActionTeamUpdate, audit.TargetTeam, t.ID, map[string]any{
+		"name": t.Name,
+	}))
+	httpx.CheckError(w, json.NewEncoder(w).Encode(&teamResponse{Team: t, Role: m.Role}))
+}
+
+// handleDeleteTeam removes the team, its domains go back to being visible only to their owners
+func (h *Handler) handleDeleteTeam(w http.ResponseWriter, r *http.Request) {
+	t, m := h.teamForUser(w, r, RoleOwner)
+	if t == nil {
+		return
+	}
+
+	if err := h.store.DeleteTeam(r.Context(), t.ID); err != nil {
+		log.Printf("Failed to delete team: %v", err)
+		httpx.JSONError(w, "Failed to delete team", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, m.UserID, audit.ActionTeamDelete, audit.TargetTeam, t.ID, map[string]any{
+		"name": t.Name,
+	}))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleListInvitations(w http.ResponseWriter, r *http.Request) {
+	t, _ := h.teamForUser(w, r, RoleOwner)
+	if t == nil {
+		return
+	}
+
+	invitations, err := h.store.ListInvitations(r.Context(), t.ID)
+	if err != nil {
+		log.Printf("Failed to list invitations: %v", err)
+		httpx.JSONError(w, "Failed to list invitations", http.StatusInternalServerError)
+		return
+	}
+	if invitations == nil {
+		invitations = []*Invitation{}
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(invitations))
+}
+
+// handleCreateInvitation emails and returns the invitation link, the token can't be read back later
+func (h *Handler) handleCreateInvitation(w http.ResponseWriter, r *http.Request) {
+	t, m := h.teamForUser(w, r, RoleOwner)
+	if t == nil {
+		return
+	}
+
+	var body struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !strings.Contains(body.Email, "@") {
+		httpx.JSONError(w, "A valid email is required", http.StatusBadRequest)
+		return
+	}
+	if body.Role == "" {
+		body.Role = RoleViewer
+	}
+	if !ValidRole(body.Role) {
+		httpx.JSONError(w, "Role must be owner, editor or viewer", http.StatusBadRequest)
+		return
+	}
+
+	inv, token := NewInvitation(t.ID, body.Email, body.Role, m.UserID)
+	if err := h.store.CreateInvitation(r.Context(), inv); err != nil {
+		log.Printf("Failed to create invitation: %v", err)
+		httpx.JSONError(w, "Failed to create invitation", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, m.UserID, audit.ActionTeamInvite, audit.TargetTeam, t.ID, map[string]any{
+		"email": inv.Email,
+		"role":  inv.Role,
+	}))
+
+	link := InvitationURL(httpx.BaseURL(r), token)
+	if err := SendInvitation(r.Context(), h.sender, t, inv, token); err != nil {
+		log.Printf("Failed to send invitation: %v", err)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	httpx.CheckError(w, json.NewEncoder(w).Encode(map[string]any{
+		"invitation": inv,
+		"url":        link,
+	}))
+}
+
+func (h *Handler) handleDeleteInvitation(w http.ResponseWriter, r *http.Request) {
+	t, m := h.teamForUser(w, r, RoleOwner)
+	if t == nil {
+		return
+	}
+
+	invitationID := chi.URLParam(r, "invitationID")
+	if err := h.store.DeleteInvitation(r.Context(), t.ID, invitationID); err != nil {
+		log.Printf("Failed to delete invitation: %v", err)
+		httpx.JSONError(w, "Failed to delete invitation", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, m.UserID, audit.ActionTeamInviteRevoke, audit.TargetTeam, t.ID, map[string]any{
+		"invitation_id": invitationID,
+	}))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	u, err := h.userStore.ReadUser(r.Context(), httpx.UserIDFromRequest(r))
+	if err != nil {
+		httpx.JSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	inv, err := Accept(r.Context(), h.store, body.Token, u)
+	if err != nil {
+		if errors.Is(err, ErrInvitationInvalid) || errors.Is(err, ErrWrongRecipient) {
+			httpx.JSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, ErrEmailNotVerified) {
+			httpx.JSONError(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		log.Printf("Failed to accept invitation: %v", err)
+		httpx.JSONError(w, "Failed to accept invitation", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, u.ID, audit.ActionTeamJoin, audit.TargetTeam, inv.TeamID, map[string]any{
+		"role": inv.Role,
+	}))
+	httpx.CheckError(w, json.NewEncoder(w).Encode(&teamResponse{Team: inv.Team, Role: inv.Role}))
+}
+
+func (h *Handler) handleUpdateMember(w http.ResponseWriter, r *http.Request) {
+	t, m := h.teamForUser(w, r, RoleOwner)
+	if t == nil {
+		return
+	}
+	target := h.member(w, r, t.ID)
+	if target == nil {
+		return
+	}
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !ValidRole(body.Role) {
+		httpx.JSONError(w, "Role must be owner, editor or viewer", http.StatusBadRequest)
+		return
+	}
+
+	if err := SetRole(r.Context(), h.store, target, body.Role); err != nil {
+		h.memberError(w, "Failed to update member", err)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, m.UserID, audit.ActionTeamMemberUpdate, audit.TargetTeam, t.ID, map[string]any{
+		"user_id": target.UserID,
+		"role":    target.Role,
+	}))
+	httpx.CheckError(w, json.NewEncoder(w).Encode(target))
+}
+
+// handleRemoveMember lets owners remove anyone and everyone else leave
+func (h *Handler) handleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID := httpx.UserIDFromRequest(r)
+	min := RoleOwner
+	if chi.URLParam(r, "userID") == userID {
+		min = RoleViewer
+	}
+
+	t, _ := h.teamForUser(w, r, min)
+	if t == nil {
+		return
+	}
+	target := h.member(w, r, t.ID)
+	if target == nil {
+		return
+	}
+
+	if err := Remove(r.Context(), h.store, target); err != nil {
+		h.memberError(w, "Failed to remove member", err)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, userID, audit.ActionTeamMemberRemove, audit.TargetTeam, t.ID, map[string]any{
+		"user_id": target.UserID,
+	}))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// teamForUser reads the team in the URL and the caller's membership, writing a
+// 404 if they aren't a member or a 403 if their role is below min
+func (h *Handler) teamForUser(w http.ResponseWriter, r *http.Request, min string) (*Team, *Member) {
+	teamID := chi.URLParam(r, "id")
+
+	m, err := h.store.ReadMember(r.Context(), teamID, httpx.UserIDFromRequest(r))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			httpx.JSONError(w, "Team not found", http.StatusNotFound)
+			return nil, nil
+		}
+		log.Printf("Failed to read team member: %v", err)
+		httpx.JSONError(w, "Failed to read team", http.StatusInternalServerError)
+		return nil, nil
+	}
+	if !RoleAtLeast(m.Role, min) {
+		httpx.JSONError(w, "Forbidden", http.StatusForbidden)
+		return nil, nil
+	}
+
+	t, err := h.store.ReadTeam(r.Context(), teamID)
+	if err != nil {
+		log.Printf("Failed to read team: %v", err)
+		httpx.JSONError(w, "Failed to read team", http.StatusInternalServerError)
+		return nil, nil
+	}
+	return t, m
+}
+
+// member reads the member in the URL
+func (h *Handler) member(w http.ResponseWriter, r *http.Request, teamID string) *Member {
+	m, err := h.store.ReadMember(r.Context(), teamID, chi.URLParam(r, "userID"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			httpx.JSONError(w, "Member not found", http.StatusNotFound)
+			return nil
+		}
+		log.Printf("Failed to read team member: %v", err)
+		httpx.JSONError(w, "Failed to read team member", http.StatusInternalServerError)
+		return nil
+	}
+	return m
+}
+
+func (h *Handler) memberError(w http.ResponseWriter, msg string, err error) {
+	if errors.Is(err, ErrLastOwner) {
+		httpx.JSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.Printf("%s: %v", msg, err)
+	httpx.JSONError(w, msg, http.StatusInternalServerError)
+}
@@ -0,0 +1,265 @@
+package team
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/stretchr/testify/assert"
+	"github.com/zackb/updog/audit"
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/mail"
+	"github.com/zackb/updog/user"
+)
+
+// memoryStore keeps teams in memory, members are keyed by team then user
+type memoryStore struct {
+	teams       map[string]*Team
+	members     map[string]map[string]*Member
+	invitations map[string]*Invitation
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{teams: map[string]*Team{}, members: map[string]map[string]*Member{}, invitations: map[string]*Invitation{}}
+}
+
+func (s *memoryStore) CreateTeam(ctx context.Context, t *Team, ownerID string) error {
+	s.teams[t.ID] = t
+	s.members[t.ID] = map[string]*Member{ownerID: {TeamID: t.ID, UserID: ownerID, Role: RoleOwner, CreatedAt: time.Now()}}
+	return nil
+}
+
+func (s *memoryStore) ReadTeam(ctx context.Context, teamID string) (*Team, error) {
+	t, ok := s.teams[teamID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+func (s *memoryStore) UpdateTeam(ctx context.Context, t *Team) error {
+	s.teams[t.ID] = t
+	return nil
+}
+
+func (s *memoryStore) DeleteTeam(ctx context.Context, teamID string) error {
+	delete(s.teams, teamID)
+	delete(s.members, teamID)
+	return nil
+}
+
+func (s *memoryStore) ListTeamsByUser(ctx context.Context, userID string) ([]*Member, error) {
+	var members []*Member
+	for teamID, m := range s.members {
+		if member, ok := m[userID]; ok {
+			member.Team = s.teams[teamID]
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+func (s *memoryStore) ReadMember(ctx context.Context, teamID, userID string) (*Member, error) {
+	m, ok := s.members[teamID][userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	found := *m
+	return &found, nil
+}
+
+func (s *memoryStore) ListMembers(ctx context.Context, teamID string) ([]*Member, error) {
+	var members []*Member
+	for _, m := range s.members[teamID] {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].CreatedAt.Before(members[j].CreatedAt) })
+	return members, nil
+}
+
+func (s *memoryStore) UpdateMember(ctx context.Context, m *Member) error {
+	s.members[m.TeamID][m.UserID].Role = m.Role
+	return nil
+}
+
+func (s *memoryStore) RemoveMember(ctx context.Context, teamID, userID string) error {
+	delete(s.members[teamID], userID)
+	return nil
+}
+
+func (s *memoryStore) CreateInvitation(ctx context.Context, inv *Invitation) error {
+	s.invitations[inv.ID] = inv
+	return nil
+}
+
+func (s *memoryStore) ReadInvitationByToken(ctx context.Context, token string) (*Invitation, error) {
+	for _, inv := range s.invitations {
+		if inv.TokenHash == HashToken(token) {
+			inv.Team = s.teams[inv.TeamID]
+			return inv, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *memoryStore) ListInvitations(ctx context.Context, teamID string) ([]*Invitation, error) {
+	var invitations []*Invitation
+	for _, inv := range s.invitations {
+		if inv.TeamID == teamID && inv.AcceptedAt.IsZero() {
+			invitations = append(invitations, inv)
+		}
+	}
+	return invitations, nil
+}
+
+func (s *memoryStore) DeleteInvitation(ctx context.Context, teamID, invitationID string) error {
+	if inv, ok := s.invitations[invitationID]; ok && inv.TeamID == teamID {
+		delete(s.invitations, invitationID)
+	}
+	return nil
+}
+
+func (s *memoryStore) AcceptInvitation(ctx context.Context, inv *Invitation, userID string) error {
+	if !inv.AcceptedAt.IsZero() {
+		return ErrInvitationUsed
+	}
+	inv.AcceptedAt = time.Now()
+	s.members[inv.TeamID][userID] = &Member{TeamID: inv.TeamID, UserID: userID, Role: inv.Role, CreatedAt: time.Now()}
+	return nil
+}
+
+// memoryUsers only reads users, the handler doesn't change them
+type memoryUsers struct {
+	user.Storage
+	users map[string]*user.User
+}
+
+func (u memoryUsers) ReadUser(ctx context.Context, id string) (*user.User, error) {
+	if found, ok := u.users[id]; ok {
+		return found, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+type discardAudit struct{ audit.Storage }
+
+func (discardAudit) CreateAuditEntry(ctx context.Context, e *audit.Entry) error {
+	return nil
+}
+
+type nopSender struct{}
+
+func (nopSender) Send(ctx context.Context, msg *mail.Message) error {
+	return nil
+}
+
+func newTestAuth(t *testing.T) *auth.Service {
+	key, err := jwk.New([]byte("0123456789abcdef0123456789abcdef"))
+	assert.NoError(t, err)
+	assert.NoError(t, key.Set(jwk.KeyIDKey, "test"))
+	assert.NoError(t, key.Set(jwk.AlgorithmKey, jwa.HS256))
+	set := jwk.NewSet()
+	set.Add(key)
+	b, err := json.Marshal(set)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, b, 0600))
+
+	a, err := auth.NewAuthService(path, time.Minute)
+	assert.NoError(t, err)
+	return a
+}
+
+func TestTeamAPI(t *testing.T) {
+	t.Setenv("BASE_URL", "https://updog.example.com")
+	store := newMemoryStore()
+	a := newTestAuth(t)
+	alice := &user.User{ID: "alice", Email: "alice@example.com", EmailVerified: true}
+	bob := &user.User{ID: "bob", Email: "bob@example.com", EmailVerified: true}
+	carol := &user.User{ID: "carol", Email: "carol@example.com", EmailVerified: true}
+	users := memoryUsers{users: map[string]*user.User{alice.ID: alice, bob.ID: bob, carol.ID: carol}}
+	api := NewHandler(store, users, discardAudit{}, a, nopSender{}).Routes()
+
+	call := func(u *user.User, method, path string, body any) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		if body != nil {
+			assert.NoError(t, json.NewEncoder(&b).Encode(body))
+		}
+		access, _, err := a.CreateToken(u.ID, "", time.Time{})
+		assert.NoError(t, err)
+		r := httptest.NewRequest(method, path, &b)
+		r.Header.Set("Authorization", "Bearer "+access)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		return w
+	}
+
+	// create
+	assert.Equal(t, http.StatusBadRequest, call(alice, http.MethodPost, "/", map[string]any{"name": " "}).Code)
+	w := call(alice, http.MethodPost, "/", map[string]any{"name": "Marketing"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		ID   string `json:"id"`
+		Role string `json:"role"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, RoleOwner, created.Role)
+	path := "/" + created.ID
+
+	// outsiders don't know it exists
+	assert.Equal(t, http.StatusNotFound, call(bob, http.MethodGet, path, nil).Code)
+
+	// invite bob, who joins as an editor
+	assert.Equal(t, http.StatusBadRequest, call(alice, http.MethodPost, path+"/invitations", map[string]any{"email": "bob"}).Code)
+	assert.Equal(t, http.StatusBadRequest, call(alice, http.MethodPost, path+"/invitations", map[string]any{"email": "bob@example.com", "role": "admin"}).Code)
+	w = call(alice, http.MethodPost, path+"/invitations", map[string]any{"email": "bob@example.com", "role": RoleEditor})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var invited struct {
+		URL string `json:"url"`
+	}
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&invited))
+	token := invited.URL[len("https://updog.example.com/invitations/accept?token="):]
+
+	assert.Equal(t, http.StatusBadRequest, call(carol, http.MethodPost, "/invitations/accept", map[string]any{"token": token}).Code)
+	assert.Equal(t, http.StatusOK, call(bob, http.MethodPost, "/invitations/accept", map[string]any{"token": token}).Code)
+	assert.Equal(t, http.StatusBadRequest, call(bob, http.MethodPost, "/invitations/accept", map[string]any{"token": token}).Code)
+
+	w = call(bob, http.MethodGet, path, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var got teamResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, RoleEditor, got.Role)
+	assert.Len(t, got.Members, 2)
+
+	// only owners manage the team
+	assert.Equal(t, http.StatusForbidden, call(bob, http.MethodPatch, path, map[string]any{"name": "Sales"}).Code)
+	assert.Equal(t, http.StatusForbidden, call(bob, http.MethodPost, path+"/invitations", map[string]any{"email": "carol@example.com"}).Code)
+	assert.Equal(t, http.StatusForbidden, call(bob, http.MethodPatch, path+"/members/"+bob.ID, map[string]any{"role": RoleOwner}).Code)
+	assert.Equal(t, http.StatusForbidden, call(bob, http.MethodDelete, path, nil).Code)
+	assert.Equal(t, http.StatusOK, call(alice, http.MethodPatch, path, map[string]any{"name": "Sales"}).Code)
+	assert.Equal(t, "Sales", store.teams[created.ID].Name)
+
+	// the last owner can't step down or leave
+	assert.Equal(t, http.StatusConflict, call(alice, http.MethodPatch, path+"/members/"+alice.ID, map[string]any{"role": RoleViewer}).Code)
+	assert.Equal(t, http.StatusConflict, call(alice, http.MethodDelete, path+"/members/"+alice.ID, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, call(alice, http.MethodPatch, path+"/members/"+bob.ID, map[string]any{"role": "admin"}).Code)
+	assert.Equal(t, http.StatusNotFound, call(alice, http.MethodPatch, path+"/members/"+carol.ID, map[string]any{"role": RoleViewer}).Code)
+
+	// until there's another
+	assert.Equal(t, http.StatusOK, call(alice, http.MethodPatch, path+"/members/"+bob.ID, map[string]any{"role": RoleOwner}).Code)
+	assert.Equal(t, http.StatusNoContent, call(alice, http.MethodDelete, path+"/members/"+alice.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(alice, http.MethodGet, path, nil).Code)
+
+	assert.Equal(t, http.StatusNoContent, call(bob, http.MethodDelete, path, nil).Code)
+	assert.Equal(t, http.StatusNotFound, call(bob, http.MethodGet, path, nil).Code)
+}
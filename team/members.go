@@ -0,0 +1,95 @@
+package team
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/zackb/updog/mail"
+	"github.com/zackb/updog/user"
+)
+
+var (
+	ErrLastOwner         = errors.New("a team needs at least one owner")
+	ErrInvitationInvalid = errors.New("invitation is invalid or has expired")
+	ErrWrongRecipient    = errors.New("invitation was sent to a different email address")
+	ErrEmailNotVerified  = errors.New("confirm your email address before accepting invitations")
+)
+
+// InvitationURL is the page an invitee opens to join
+func InvitationURL(baseURL, token string) string {
+	return baseURL + "/invitations/accept?token=" + url.QueryEscape(token)
+}
+
+// SendInvitation emails the invitee the link accepting inv with token
+func SendInvitation(ctx context.Context, sender mail.Sender, t *Team, inv *Invitation, token string) error {
+	base, err := mail.BaseURL()
+	if err != nil {
+		return err
+	}
+	return sender.Send(ctx, mail.Invitation(inv.Email, t.Name, inv.Role, InvitationURL(base, token)))
+}
+
+// SetRole changes a member's role, the last owner can't be demoted
+func SetRole(ctx context.Context, store Storage, m *Member, role string) error {
+	if m.Role == RoleOwner && role != RoleOwner {
+		if err := ensureOtherOwner(ctx, store, m.TeamID, m.UserID); err != nil {
+			return err
+		}
+	}
+	m.Role = role
+	return store.UpdateMember(ctx, m)
+}
+
+// Remove takes userID out of the team, the last owner can't leave
+func Remove(ctx context.Context, store Storage, m *Member) error {
+	if m.Role == RoleOwner {
+		if err := ensureOtherOwner(ctx, store, m.TeamID, m.UserID); err != nil {
+			return err
+		}
+	}
+	return store.RemoveMember(ctx, m.TeamID, m.UserID)
+}
+
+// Accept joins u to the team of the invitation for token
+func Accept(ctx context.Context, store Storage, token string, u *user.User) (*Invitation, error) {
+	inv, err := store.ReadInvitationByToken(ctx, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !inv.Pending() {
+		return nil, ErrInvitationInvalid
+	}
+	if !strings.EqualFold(inv.Email, u.Email) {
+		return nil, ErrWrongRecipient
+	}
+	// otherwise anyone could take an invitation by changing their email to the invitee's
+	if !u.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+	if err := store.AcceptInvitation(ctx, inv, u.ID); err != nil {
+		if errors.Is(err, ErrInvitationUsed) {
+			return nil, ErrInvitationInvalid
+		}
+		return nil, err
+	}
+	return inv, nil
+}
+
+func ensureOtherOwner(ctx context.Context, store Storage, teamID, userID string) error {
+	members, err := store.ListMembers(ctx, teamID)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if m.Role == RoleOwner && m.UserID != userID {
+			return nil
+		}
+	}
+	return ErrLastOwner
+}
@@ -0,0 +1,27 @@
+package team
+
+import (
+	"context"
+)
+
+type Storage interface {
+	// CreateTeam creates the team with ownerID as its first owner
+	CreateTeam(ctx context.Context, t *Team, ownerID string) error
+	ReadTeam(ctx context.Context, teamID string) (*Team, error)
+	UpdateTeam(ctx context.Context, t *Team) error
+	// DeleteTeam removes the team and its memberships, its domains stay with their owners
+	DeleteTeam(ctx context.Context, teamID string) error
+	ListTeamsByUser(ctx context.Context, userID string) ([]*Member, error)
+
+	ReadMember(ctx context.Context, teamID, userID string) (*Member, error)
+	ListMembers(ctx context.Context, teamID string) ([]*Member, error)
+	UpdateMember(ctx context.Context, m *Member) error
+	RemoveMember(ctx context.Context, teamID, userID string) error
+
+	CreateInvitation(ctx context.Context, inv *Invitation) error
+	ReadInvitationByToken(ctx context.Context, token string) (*Invitation, error)
+	ListInvitations(ctx context.Context, teamID string) ([]*Invitation, error)
+	DeleteInvitation(ctx context.Context, teamID, invitationID string) error
+	// AcceptInvitation adds userID to the team and marks the invitation used
+	AcceptInvitation(ctx context.Context, inv *Invitation, userID string) error
+}
@@ -0,0 +1,130 @@
+package team
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/user"
+)
+
+// Member roles, each includes the permissions of the ones below it
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// InvitationTTL is how long an invitation can be accepted for
+const InvitationTTL = 7 * 24 * time.Hour
+
+var ErrInvitationUsed = errors.New("invitation has already been accepted")
+
+var roleRank = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// ValidRole is true for owner, editor and viewer
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleAtLeast is true if role grants everything min does, an empty role grants nothing
+func RoleAtLeast(role, min string) bool {
+	return roleRank[role] > 0 && roleRank[role] >= roleRank[min]
+}
+
+type Team struct {
+	bun.BaseModel `bun:"table:teams"`
+
+	ID   string `bun:",pk" json:"id"`
+	Name string `bun:",notnull" json:"name"`
+
+	UpdatedAt time.Time `bun:",default:CURRENT_TIMESTAMP" json:"updated_at"`
+	CreatedAt time.Time `bun:",default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// Member grants a user a role on every domain of a team
+type Member struct {
+	bun.BaseModel `bun:"table:team_members"`
+
+	TeamID    string    `bun:",pk" json:"team_id"`
+	UserID    string    `bun:",pk" json:"user_id"`
+	Role      string    `bun:",notnull" json:"role"`
+	CreatedAt time.Time `bun:",default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	User *user.User `bun:"rel:belongs-to,join:user_id=id" json:"user,omitempty"`
+	Team *Team      `bun:"rel:belongs-to,join:team_id=id" json:"team,omitempty"`
+}
+
+// Invitation lets whoever holds the token join a team as the invited email
+type Invitation struct {
+	bun.BaseModel `bun:"table:team_invitations"`
+
+	ID         string    `bun:",pk" json:"id"`
+	TeamID     string    `bun:",notnull" json:"team_id"`
+	Email      string    `bun:",notnull" json:"email"`
+	Role       string    `bun:",notnull" json:"role"`
+	TokenHash  string    `bun:",notnull,unique" json:"-"`
+	InvitedBy  string    `bun:",notnull" json:"invited_by"`
+	ExpiresAt  time.Time `bun:",notnull" json:"expires_at"`
+	AcceptedAt time.Time `bun:",nullzero" json:"accepted_at,omitzero"`
+	CreatedAt  time.Time `bun:",default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	Team *Team `bun:"rel:belongs-to,join:team_id=id" json:"team,omitempty"`
+}
+
+// NewInvitation creates an invitation and returns it with the plaintext token, only its hash is stored
+func NewInvitation(teamID, email, role, invitedBy string) (*Invitation, string) {
+	token := id.NewID() + id.NewID()
+	now := time.Now().UTC()
+	return &Invitation{
+		ID:        id.NewID(),
+		TeamID:    teamID,
+		Email:     strings.TrimSpace(email),
+		Role:      role,
+		TokenHash: HashToken(token),
+		InvitedBy: invitedBy,
+		ExpiresAt: now.Add(InvitationTTL),
+		CreatedAt: now,
+	}, token
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Pending is true if the invitation can still be accepted
+func (i *Invitation) Pending() bool {
+	return i.AcceptedAt.IsZero() && time.Now().Before(i.ExpiresAt)
+}
+
+// BeforeInsertHook for Team to set ID.
+var _ bun.BeforeInsertHook = (*Team)(nil)
+
+func (t *Team) BeforeInsert(ctx context.Context, query *bun.InsertQuery) error {
+	if t.ID == "" {
+		t.ID = id.NewID()
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// BeforeUpdateHook for Team to set UpdatedAt.
+var _ bun.BeforeUpdateHook = (*Team)(nil)
+
+func (t *Team) BeforeUpdate(ctx context.Context, query *bun.UpdateQuery) error {
+	t.UpdatedAt = time.Now()
+	return nil
+}
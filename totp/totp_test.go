@@ -0,0 +1,53 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the RFC 6238 test secret "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		code, err := Code(rfcSecret, Step(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, want, code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, Step(now))
+	assert.NoError(t, err)
+
+	step, ok := Validate(rfcSecret, code, now.Add(Period))
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	_, ok = Validate(rfcSecret, code, now.Add(3*Period))
+	assert.False(t, ok)
+	_, ok = Validate(rfcSecret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes := NewRecoveryCodes()
+	assert.Len(t, codes, RecoveryCodeCount)
+	assert.Equal(t, hashes[0], HashRecoveryCode(strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))))
+}
+
+func TestQRCodeSVG(t *testing.T) {
+	svg, err := QRCodeSVG(URL("Updog", "alice@example.com", NewSecret()))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(svg, "<svg"))
+}
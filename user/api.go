@@ -1,30 +1,370 @@
 package user
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/go-chi/chi/v5"
+	"github.com/zackb/updog/audit"
 	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/httpx"
 	"github.com/zackb/updog/httpx/middleware"
 )
 
+const contextKeyUser = "user"
+
+// SessionRevoker signs a user out everywhere
+type SessionRevoker interface {
+	RevokeAll(ctx context.Context, userID string) error
+}
+
 type Handler struct {
-	store Storage
-	auth  *auth.Service
+	store      Storage
+	auditStore audit.Storage
+	auth       *auth.Service
+	sessions   SessionRevoker
+	emails     *Emails
 }
 
-func NewHandler(store Storage, auth *auth.Service) *Handler {
+func NewHandler(store Storage, auditStore audit.Storage, auth *auth.Service, sessions SessionRevoker, emails *Emails) *Handler {
 	return &Handler{
-		store: store,
-		auth:  auth,
+		store:      store,
+		auditStore: auditStore,
+		auth:       auth,
+		sessions:   sessions,
+		emails:     emails,
 	}
 }
 
 func (h *Handler) Routes() chi.Router {
 	r := chi.NewRouter()
-	// r.Post("/", h.handleCreateUser)
 	r.Group(func(protected chi.Router) {
-		protected.Use(middleware.AuthMiddleware(h.auth))
-		// protected.Get("/users", ...)
+		protected.Use(middleware.AuthMiddleware(h.auth), middleware.RequireScope(auth.ScopeAccount), h.currentUser)
+		protected.Get("/me", h.handleGetMe)
+		protected.Patch("/me", h.handleUpdateMe)
+		protected.Delete("/me", h.handleDeleteMe)
+		protected.Post("/me/password", h.handleChangePassword)
+
+		protected.Group(func(admin chi.Router) {
+			admin.Use(adminOnly)
+			admin.Get("/", h.handleListUsers)
+			admin.Post("/{id}/disable", h.handleSetDisabled(true))
+			admin.Post("/{id}/enable", h.handleSetDisabled(false))
+			admin.Patch("/{id}", h.handleSetRole)
+			admin.Delete("/{id}", h.handleDeleteUser)
+		})
 	})
 
 	return r
 }
+
+// currentUser loads the authenticated user, rejecting disabled accounts
+func (h *Handler) currentUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, err := h.store.ReadUser(r.Context(), httpx.UserIDFromRequest(r))
+		if err != nil || u.Disabled {
+			httpx.JSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKeyUser, u)))
+	})
+}
+
+func adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !userFromRequest(r).IsAdmin() {
+			httpx.JSONError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func userFromRequest(r *http.Request) *User {
+	u, _ := r.Context().Value(contextKeyUser).(*User)
+	return u
+}
+
+func (h *Handler) handleGetMe(w http.ResponseWriter, r *http.Request) {
+	httpx.CheckError(w, json.NewEncoder(w).Encode(userFromRequest(r)))
+}
+
+func (h *Handler) handleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	u := userFromRequest(r)
+
+	var body struct {
+		Name  *string `json:"name"`
+		Email *string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	changed := map[string]any{}
+	if body.Name != nil {
+		name := strings.TrimSpace(*body.Name)
+		if name == "" {
+			httpx.JSONError(w, "Name can't be empty", http.StatusBadRequest)
+			return
+		}
+		u.Name = name
+		u.Initials = InitialsFromName(name)
+		changed["name"] = name
+	}
+	if body.Email != nil {
+		email := strings.TrimSpace(*body.Email)
+		if !strings.Contains(email, "@") {
+			httpx.JSONError(w, "A valid email is required", http.StatusBadRequest)
+			return
+		}
+		if email != u.Email {
+			existing, err := h.store.ReadUserByEmail(r.Context(), email)
+			if err == nil && existing.ID != u.ID {
+				httpx.JSONError(w, "Email is already in use", http.StatusConflict)
+				return
+			}
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Failed to read user: %v", err)
+				httpx.JSONError(w, "Failed to update user", http.StatusInternalServerError)
+				return
+			}
+			changed["email"] = map[string]string{"from": u.Email, "to": email}
+			u.Email = email
+			u.EmailVerified = false
+		}
+	}
+
+	if err := h.store.UpdateUser(r.Context(), u); err != nil {
+		log.Printf("Failed to update user: %v", err)
+		httpx.JSONError(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+	if len(changed) > 0 {
+		audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, u.ID, audit.ActionUserUpdate, audit.TargetUser, u.ID, changed))
+	}
+	if _, ok := changed["email"]; ok {
+		if err := h.emails.SendVerification(r.Context(), u); err != nil {
+			log.Printf("Failed to send verification email: %v", err)
+		}
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(u))
+}
+
+func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	u := userFromRequest(r)
+
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.NewPassword == "" {
+		httpx.JSONError(w, "New password is required", http.StatusBadRequest)
+		return
+	}
+	if u.EncryptedPassword == "" || !u.Validate(body.CurrentPassword) {
+		httpx.InvalidCredentials(w)
+		return
+	}
+
+	epass, err := HashPassword(body.NewPassword)
+	if err != nil {
+		log.Printf("Failed to hash password: %v", err)
+		httpx.JSONError(w, "Sorry! An internal error occurred", http.StatusInternalServerError)
+		return
+	}
+	u.EncryptedPassword = epass
+	if err := h.store.UpdateUser(r.Context(), u); err != nil {
+		log.Printf("Failed to update user: %v", err)
+		httpx.JSONError(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+	if err := h.sessions.RevokeAll(r.Context(), u.ID); err != nil {
+		log.Printf("Failed to revoke sessions: %v", err)
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, u.ID, audit.ActionUserPassword, audit.TargetUser, u.ID, nil))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDeleteMe deletes the caller's account and the domains no team shares. The password must be confirmed,
+// users without one confirm with a second factor code or by having just signed in.
+func (h *Handler) handleDeleteMe(w http.ResponseWriter, r *http.Request) {
+	u := userFromRequest(r)
+
+	var body struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var signedInAt time.Time
+	if t := middleware.TokenFromRequest(r); t != nil {
+		signedInAt = t.SignedInAt
+	}
+	if !u.Reauthenticated(body.Password, body.Code, signedInAt, time.Now()) {
+		if !u.HasPassword() {
+			httpx.JSONError(w, "Sign in again or send a two-factor code to confirm", http.StatusUnauthorized)
+			return
+		}
+		httpx.InvalidCredentials(w)
+		return
+	}
+
+	h.deleteUser(w, r, u)
+}
+
+func (h *Handler) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	users, err := h.store.ListUsers(r.Context(), limit, offset)
+	if err != nil {
+		log.Printf("Failed to list users: %v", err)
+		httpx.JSONError(w, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+	if users == nil {
+		users = []*User{}
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(users))
+}
+
+func (h *Handler) handleSetDisabled(disabled bool) http.HandlerFunc {
+	action := audit.ActionUserEnable
+	if disabled {
+		action = audit.ActionUserDisable
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := h.targetUser(w, r)
+		if target == nil {
+			return
+		}
+
+		target.Disabled = disabled
+		if err := h.store.UpdateUser(r.Context(), target); err != nil {
+			log.Printf("Failed to update user: %v", err)
+			httpx.JSONError(w, "Failed to update user", http.StatusInternalServerError)
+			return
+		}
+		if disabled {
+			if err := h.sessions.RevokeAll(r.Context(), target.ID); err != nil {
+				log.Printf("Failed to revoke sessions: %v", err)
+			}
+		}
+
+		audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, userFromRequest(r).ID, action, audit.TargetUser, target.ID, map[string]any{
+			"email": target.Email,
+		}))
+		httpx.CheckError(w, json.NewEncoder(w).Encode(target))
+	}
+}
+
+func (h *Handler) handleSetRole(w http.ResponseWriter, r *http.Request) {
+	target := h.targetUser(w, r)
+	if target == nil {
+		return
+	}
+
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		httpx.JSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !ValidRole(body.Role) {
+		httpx.JSONError(w, "Role must be admin or member", http.StatusBadRequest)
+		return
+	}
+
+	from := target.Role
+	if err := SetRole(r.Context(), h.store, target, body.Role); err != nil {
+		if errors.Is(err, ErrLastAdmin) {
+			httpx.JSONError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to update user: %v", err)
+		httpx.JSONError(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	if from != target.Role {
+		audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, userFromRequest(r).ID, audit.ActionUserRole, audit.TargetUser, target.ID, map[string]any{
+			"email": target.Email,
+			"from":  from,
+			"to":    target.Role,
+		}))
+	}
+	httpx.CheckError(w, json.NewEncoder(w).Encode(target))
+}
+
+func (h *Handler) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	target := h.targetUser(w, r)
+	if target == nil {
+		return
+	}
+	h.deleteUser(w, r, target)
+}
+
+func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request, u *User) {
+	err := ensureOtherAdmin(r.Context(), h.store, u)
+	if err == nil {
+		err = h.store.DeleteUser(r.Context(), u.ID)
+	}
+	if err != nil {
+		if errors.Is(err, ErrSoleTeamOwner) || errors.Is(err, ErrLastAdmin) {
+			httpx.JSONError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to delete user: %v", err)
+		httpx.JSONError(w, "Failed to delete user", http.StatusInternalServerError)
+		return
+	}
+
+	audit.Record(r.Context(), h.auditStore, audit.NewEntry(r, userFromRequest(r).ID, audit.ActionUserDelete, audit.TargetUser, u.ID, map[string]any{
+		"email": u.Email,
+	}))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// targetUser reads the user in the URL for an admin action, admins manage their own account through /me
+func (h *Handler) targetUser(w http.ResponseWriter, r *http.Request) *User {
+	id := chi.URLParam(r, "id")
+	if id == userFromRequest(r).ID {
+		httpx.JSONError(w, "Use /users/me to manage your own account", http.StatusBadRequest)
+		return nil
+	}
+
+	u, err := h.store.ReadUser(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			httpx.JSONError(w, "User not found", http.StatusNotFound)
+			return nil
+		}
+		log.Printf("Failed to read user: %v", err)
+		httpx.JSONError(w, "Failed to read user", http.StatusInternalServerError)
+		return nil
+	}
+	return u
+}
@@ -0,0 +1,183 @@
+package user
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zackb/updog/auth"
+	"github.com/zackb/updog/mail"
+)
+
+const (
+	// VerifyEmailTTL is how long an email confirmation link works
+	VerifyEmailTTL = auth.MaxChallengeTTL
+	// ResetPasswordTTL is how long a password reset link works
+	ResetPasswordTTL = time.Hour
+
+	// resetSendTimeout bounds sending a reset email, which outlives the request asking for it
+	resetSendTimeout = time.Minute
+)
+
+var ErrInvalidLink = errors.New("link is invalid or has expired")
+
+// Emails sends account emails and checks the signed links in them
+type Emails struct {
+	store  Storage
+	auth   *auth.Service
+	sender mail.Sender
+	// sending tracks the emails sent in the background
+	sending sync.WaitGroup
+}
+
+func NewEmails(store Storage, auth *auth.Service, sender mail.Sender) *Emails {
+	return &Emails{
+		store:  store,
+		auth:   auth,
+		sender: sender,
+	}
+}
+
+// Sender delivers the emails
+func (e *Emails) Sender() mail.Sender {
+	return e.sender
+}
+
+// SendVerification sends u a link confirming their current email address
+func (e *Emails) SendVerification(ctx context.Context, u *User) error {
+	baseURL, err := mail.BaseURL()
+	if err != nil {
+		return err
+	}
+	token, _, err := e.auth.CreateChallenge(u.ID, auth.PurposeVerifyEmail, strings.ToLower(u.Email), VerifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	return e.sender.Send(ctx, mail.VerifyEmail(u.Email, baseURL+"/verify-email?token="+url.QueryEscape(token)))
+}
+
+// SendPasswordReset sends a reset link if email belongs to an active user. Nothing tells
+// the caller whether it did, so the form can't be used to find out who has an account:
+// the lookup and sending happen in the background so the response takes as long either way.
+func (e *Emails) SendPasswordReset(ctx context.Context, email string) error {
+	baseURL, err := mail.BaseURL()
+	if err != nil {
+		return err
+	}
+	e.sending.Go(func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resetSendTimeout)
+		defer cancel()
+		if err := e.sendPasswordReset(ctx, baseURL, email); err != nil {
+			log.Printf("Failed to send password reset: %v", err)
+		}
+	})
+	return nil
+}
+
+// Wait blocks until the emails sent in the background are out
+func (e *Emails) Wait() {
+	e.sending.Wait()
+}
+
+func (e *Emails) sendPasswordReset(ctx context.Context, baseURL, email string) error {
+	u, err := e.store.ReadUserByEmail(ctx, strings.TrimSpace(email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if u.Disabled {
+		return nil
+	}
+
+	token, _, err := e.auth.CreateChallenge(u.ID, auth.PurposeResetPassword, passwordFingerprint(u), ResetPasswordTTL)
+	if err != nil {
+		return err
+	}
+	return e.sender.Send(ctx, mail.ResetPassword(u.Email, baseURL+"/reset-password?token="+url.QueryEscape(token)))
+}
+
+// VerifyEmail marks the user's email verified if token was sent to their current address
+func (e *Emails) VerifyEmail(ctx context.Context, token string) (*User, error) {
+	u, challenge, err := e.challengedUser(ctx, token, auth.PurposeVerifyEmail)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.Binding != strings.ToLower(u.Email) {
+		return nil, ErrInvalidLink
+	}
+	if u.EmailVerified {
+		return u, nil
+	}
+
+	u.EmailVerified = true
+	if err := e.store.UpdateUser(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// CheckPasswordReset reads the user a reset token is for, without using it up
+func (e *Emails) CheckPasswordReset(ctx context.Context, token string) (*User, error) {
+	u, challenge, err := e.challengedUser(ctx, token, auth.PurposeResetPassword)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.Binding != passwordFingerprint(u) {
+		return nil, ErrInvalidLink
+	}
+	return u, nil
+}
+
+// ResetPassword sets the password of the user token was sent to. The link stops working
+// once the password changes. Receiving it proves the email is theirs so it's verified too.
+// The caller ends the user's sessions.
+func (e *Emails) ResetPassword(ctx context.Context, token, password string) (*User, error) {
+	u, err := e.CheckPasswordReset(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	epass, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	u.EncryptedPassword = epass
+	u.EmailVerified = true
+	if err := e.store.UpdateUser(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (e *Emails) challengedUser(ctx context.Context, token, purpose string) (*User, *auth.Token, error) {
+	challenge, err := e.auth.ValidateChallenge(ctx, token, purpose)
+	if err != nil {
+		return nil, nil, ErrInvalidLink
+	}
+	u, err := e.store.ReadUser(ctx, challenge.ClientId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrInvalidLink
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Disabled {
+		return nil, nil, ErrInvalidLink
+	}
+	return u, challenge, nil
+}
+
+// passwordFingerprint changes whenever the password does, without revealing its hash
+func passwordFingerprint(u *User) string {
+	sum := sha256.Sum256([]byte(u.ID + ":" + u.EncryptedPassword))
+	return hex.EncodeToString(sum[:16])
+}
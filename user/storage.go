@@ -7,6 +7,16 @@ import (
 type Storage interface {
 	ReadUser(ctx context.Context, id string) (*User, error)
 	ReadUserByEmail(ctx context.Context, email string) (*User, error)
+	// ReadUserByOIDCSubject reads the user linked to subject at the single sign-on provider issuer
+	ReadUserByOIDCSubject(ctx context.Context, issuer, subject string) (*User, error)
 	CreateUser(ctx context.Context, u *User) error
 	UpdateUser(ctx context.Context, u *User) error
+	// DeleteUser removes the user along with their data and the domains no team shares. Their teams'
+	// domains pass to another owner, and ErrSoleTeamOwner is returned if a team would have no owner.
+	DeleteUser(ctx context.Context, id string) error
+	// IsUserDisabled is true if the user was disabled or doesn't exist
+	IsUserDisabled(ctx context.Context, id string) (bool, error)
+	ListUsers(ctx context.Context, limit, offset int) ([]*User, error)
+	// CountAdmins counts the admins who aren't disabled
+	CountAdmins(ctx context.Context) (int, error)
 }
@@ -2,13 +2,30 @@ package user
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/uptrace/bun"
 	"github.com/zackb/updog/id"
+	"github.com/zackb/updog/totp"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+var (
+	// ErrSoleTeamOwner is returned when deleting a user would leave a team with members but no owner
+	ErrSoleTeamOwner = errors.New("make another member an owner of your teams first")
+	// ErrLastAdmin is returned when deleting or demoting a user would leave nobody to manage the instance
+	ErrLastAdmin = errors.New("make another user an admin first")
+)
+
 type User struct {
 	bun.BaseModel     `bun:"table:users"`
 	ID                string `bun:",pk" json:"id"`
@@ -16,6 +33,22 @@ type User struct {
 	Name              string `bun:",notnull" json:"name"`
 	Initials          string `bun:",notnull" json:"initials"`
 	EncryptedPassword string `json:"-"`
+	Role              string `bun:",notnull,default:'member'" json:"role"`
+	Disabled          bool   `bun:",notnull,default:false" json:"disabled"`
+	// EmailVerified is set once the user opens the confirmation link sent to Email
+	EmailVerified bool `bun:",notnull,default:false" json:"email_verified"`
+
+	// TOTPSecret is set when enrolling in two-factor authentication, which is on once TOTPEnabled.
+	// TOTPLastStep is the time step of the last code used so it can't be replayed.
+	TOTPSecret   string `bun:"totp_secret,nullzero" json:"-"`
+	TOTPEnabled  bool   `bun:"totp_enabled,notnull,default:false" json:"two_factor_enabled"`
+	TOTPLastStep int64  `bun:"totp_last_step,notnull,default:0" json:"-"`
+	// RecoveryCodes are the hashes of the unused recovery codes, comma separated
+	RecoveryCodes string `bun:",nullzero" json:"-"`
+
+	// OIDCIssuer and OIDCSubject identify the account at the single sign-on provider it's linked to
+	OIDCIssuer  string `bun:"oidc_issuer,nullzero" json:"-"`
+	OIDCSubject string `bun:"oidc_subject,nullzero" json:"-"`
 
 	UpdatedAt time.Time `bun:",default:CURRENT_TIMESTAMP" json:"updated_at"`
 	CreatedAt time.Time `bun:",default:CURRENT_TIMESTAMP" json:"created_at"`
@@ -36,6 +69,142 @@ func (u *User) Validate(password string) bool {
 	return err == nil
 }
 
+// HasPassword is false for users who only sign in with single sign-on
+func (u *User) HasPassword() bool {
+	return u.EncryptedPassword != ""
+}
+
+// ReauthWindow is how long after signing in a user without a password can confirm
+// sensitive changes without signing in again
+const ReauthWindow = 10 * time.Minute
+
+// Reauthenticated is true if the user just proved it's them before a sensitive change, with their
+// password or, without one, a second factor code or having signed in within ReauthWindow.
+// A code is used up, the caller saves u.
+func (u *User) Reauthenticated(password, code string, signedInAt, now time.Time) bool {
+	if u.HasPassword() {
+		return u.Validate(password)
+	}
+	if code != "" && u.CheckSecondFactor(code, now) {
+		return true
+	}
+	return !signedInAt.IsZero() && now.Sub(signedInAt) < ReauthWindow
+}
+
+// dummyHash is compared against when there's no password to check, so it takes as long as when there is
+var dummyHash = sync.OnceValue(func() []byte {
+	h, _ := bcrypt.GenerateFromPassword([]byte("updog"), bcrypt.DefaultCost)
+	return h
+})
+
+// CheckLogin validates password for u, which is nil if no account has the email. It takes
+// as long either way, so response times don't tell which emails have accounts.
+func CheckLogin(u *User, password string) bool {
+	if u == nil || u.EncryptedPassword == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return false
+	}
+	return u.Validate(password)
+}
+
+// IsAdmin is true if the user can manage the instance and other users
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// ValidRole is true for admin and member
+func ValidRole(role string) bool {
+	return role == RoleAdmin || role == RoleMember
+}
+
+// SetRole changes a user's role, the last enabled admin can't be demoted
+func SetRole(ctx context.Context, store Storage, u *User, role string) error {
+	if u.IsAdmin() && role != RoleAdmin {
+		if err := ensureOtherAdmin(ctx, store, u); err != nil {
+			return err
+		}
+	}
+	u.Role = role
+	return store.UpdateUser(ctx, u)
+}
+
+// ensureOtherAdmin returns ErrLastAdmin if u is the only admin who can still sign in
+func ensureOtherAdmin(ctx context.Context, store Storage, u *User) error {
+	if !u.IsAdmin() || u.Disabled {
+		return nil
+	}
+	n, err := store.CountAdmins(ctx)
+	if err != nil {
+		return err
+	}
+	if n <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// CheckSecondFactor accepts a current authenticator code or an unused recovery code,
+// which is used up. The caller saves u so neither can be used again.
+func (u *User) CheckSecondFactor(code string, now time.Time) bool {
+	if !u.TOTPEnabled {
+		return false
+	}
+
+	if step, ok := totp.Validate(u.TOTPSecret, code, now); ok {
+		if step <= u.TOTPLastStep {
+			return false
+		}
+		u.TOTPLastStep = step
+		return true
+	}
+
+	hash := totp.HashRecoveryCode(code)
+	hashes := strings.Split(u.RecoveryCodes, ",")
+	if i := slices.Index(hashes, hash); i >= 0 && u.RecoveryCodes != "" {
+		u.RecoveryCodes = strings.Join(slices.Delete(hashes, i, i+1), ",")
+		return true
+	}
+	return false
+}
+
+// RecoveryCodesLeft is how many recovery codes haven't been used
+func (u *User) RecoveryCodesLeft() int {
+	if u.RecoveryCodes == "" {
+		return 0
+	}
+	return strings.Count(u.RecoveryCodes, ",") + 1
+}
+
+// EnableTwoFactor turns on two-factor authentication with the enrolled secret after
+// code proves the authenticator has it, returning new recovery codes
+func (u *User) EnableTwoFactor(code string, now time.Time) ([]string, bool) {
+	if u.TOTPSecret == "" {
+		return nil, false
+	}
+	step, ok := totp.Validate(u.TOTPSecret, code, now)
+	if !ok {
+		return nil, false
+	}
+	u.TOTPEnabled = true
+	u.TOTPLastStep = step
+	return u.ResetRecoveryCodes(), true
+}
+
+// ResetRecoveryCodes replaces the recovery codes and returns the new ones
+func (u *User) ResetRecoveryCodes() []string {
+	codes, hashes := totp.NewRecoveryCodes()
+	u.RecoveryCodes = strings.Join(hashes, ",")
+	return codes
+}
+
+// DisableTwoFactor turns off two-factor authentication and forgets the secret
+func (u *User) DisableTwoFactor() {
+	u.TOTPSecret = ""
+	u.TOTPEnabled = false
+	u.TOTPLastStep = 0
+	u.RecoveryCodes = ""
+}
+
 // BeforeInsertHook for User to set ID.
 var _ bun.BeforeInsertHook = (*User)(nil)
 
@@ -43,7 +212,12 @@ func (u *User) BeforeInsert(ctx context.Context, query *bun.InsertQuery) error {
 	if u.ID == "" {
 		u.ID = id.NewID()
 	}
-	u.CreatedAt = time.Now()
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	if u.Role == "" {
+		u.Role = RoleMember
+	}
 	return nil
 }
 
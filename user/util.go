@@ -40,6 +40,18 @@ func InitialsFromEmail(email string) string {
 	return strings.ToUpper(string(firstRune[0])) + strings.ToUpper(string(lastRune[0]))
 }
 
+// InitialsFromName uses the first letters of the first and last words of a name
+func InitialsFromName(name string) string {
+	parts := strings.Fields(name)
+	if len(parts) == 0 {
+		return ""
+	}
+
+	first := []rune(parts[0])
+	last := []rune(parts[len(parts)-1])
+	return strings.ToUpper(string(first[0])) + strings.ToUpper(string(last[0]))
+}
+
 // NameFromEmail tries to extract first and last name from the email address
 func NameFromEmail(email string) string {
 	at := strings.Index(email, "@")